@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -77,11 +78,14 @@ type BackupOptions struct {
 	ExcludeCaches    bool
 	Stdin            bool
 	StdinFilename    string
+	StdinTar         bool
+	TarFile          string
 	Tags             []string
 	Host             string
 	FilesFrom        []string
 	TimeStamp        string
 	WithAtime        bool
+	DryRun           bool
 }
 
 var backupOptions BackupOptions
@@ -99,6 +103,8 @@ func init() {
 	f.BoolVar(&backupOptions.ExcludeCaches, "exclude-caches", false, `excludes cache directories that are marked with a CACHEDIR.TAG file`)
 	f.BoolVar(&backupOptions.Stdin, "stdin", false, "read backup from stdin")
 	f.StringVar(&backupOptions.StdinFilename, "stdin-filename", "stdin", "file name to use when reading from stdin")
+	f.BoolVar(&backupOptions.StdinTar, "stdin-tar", false, "read a tar archive from stdin and backup the files it contains")
+	f.StringVar(&backupOptions.TarFile, "tar-file", "", "read a tar archive from `file` and backup the files it contains")
 	f.StringArrayVar(&backupOptions.Tags, "tag", nil, "add a `tag` for the new snapshot (can be specified multiple times)")
 
 	f.StringVarP(&backupOptions.Host, "host", "H", "", "set the `hostname` for the snapshot manually. To prevent an expensive rescan use the \"parent\" flag")
@@ -108,6 +114,7 @@ func init() {
 	f.StringArrayVar(&backupOptions.FilesFrom, "files-from", nil, "read the files to backup from file (can be combined with file args/can be specified multiple times)")
 	f.StringVar(&backupOptions.TimeStamp, "time", "", "time of the backup (ex. '2012-11-01 22:08:41') (default: now)")
 	f.BoolVar(&backupOptions.WithAtime, "with-atime", false, "store the atime for all files and directories")
+	f.BoolVarP(&backupOptions.DryRun, "dry-run", "n", false, "do not upload or write any data, just show what would be done")
 }
 
 // filterExisting returns a slice of all existing items, or an error if no
@@ -197,9 +204,36 @@ func (opts BackupOptions) Check(gopts GlobalOptions, args []string) error {
 		}
 	}
 
+	if opts.readTar() {
+		flag := "--tar-file"
+		if opts.StdinTar {
+			flag = "--stdin-tar"
+		}
+
+		switch {
+		case opts.StdinTar && opts.TarFile != "":
+			return errors.Fatal("--stdin-tar and --tar-file cannot be used together")
+		case opts.Stdin:
+			return errors.Fatalf("--stdin and %v cannot be used together", flag)
+		case len(opts.FilesFrom) > 0:
+			return errors.Fatalf("%v and --files-from cannot be used together", flag)
+		case len(args) > 0:
+			return errors.Fatalf("%v was specified and files/dirs were listed as arguments", flag)
+		case opts.ExcludeOtherFS, opts.ExcludeCaches, len(opts.ExcludeIfPresent) > 0:
+			return errors.Fatalf("%v cannot be used with --one-file-system, --exclude-caches or --exclude-if-present", flag)
+		case opts.StdinTar && gopts.password == "":
+			return errors.Fatal("unable to read password from stdin when data is to be read from stdin, use --password-file or $RESTIC_PASSWORD")
+		}
+	}
+
 	return nil
 }
 
+// readTar returns true if the files to backup are read from a tar archive.
+func (opts BackupOptions) readTar() bool {
+	return opts.StdinTar || opts.TarFile != ""
+}
+
 // collectRejectByNameFuncs returns a list of all functions which may reject data
 // from being saved in a snapshot based on path only
 func collectRejectByNameFuncs(opts BackupOptions, repo *repository.Repository, targets []string) (fs []RejectByNameFunc, err error) {
@@ -310,6 +344,11 @@ func collectTargets(opts BackupOptions, args []string) (targets []string, err er
 		return nil, nil
 	}
 
+	// the files in a tar archive are stored below the root directory
+	if opts.readTar() {
+		return []string{"/"}, nil
+	}
+
 	var lines []string
 	for _, file := range opts.FilesFrom {
 		fromfile, err := readLinesFromFile(file)
@@ -403,7 +442,12 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, term *termstatus.Termina
 		return err
 	}
 
+	if opts.DryRun {
+		repo.SetDryRun()
+	}
+
 	p := ui.NewBackup(term, gopts.verbosity)
+	p.DryRun = opts.DryRun
 
 	// use the terminal for stdout/stderr
 	prevStdout, prevStderr := gopts.stdout, gopts.stderr
@@ -424,11 +468,13 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, term *termstatus.Termina
 
 	t.Go(func() error { return p.Run(t.Context(gopts.ctx)) })
 
-	p.V("lock repository")
-	lock, err := lockRepo(repo)
-	defer unlockRepo(lock)
-	if err != nil {
-		return err
+	if !opts.DryRun {
+		p.V("lock repository")
+		lock, err := lockRepo(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
 	}
 
 	// rejectByNameFuncs collect functions that can reject items from the backup based on path only
@@ -488,6 +534,29 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, term *termstatus.Termina
 		targets = []string{opts.StdinFilename}
 	}
 
+	if opts.readTar() {
+		var rd io.Reader = os.Stdin
+		if opts.TarFile != "" {
+			f, err := os.Open(opts.TarFile)
+			if err != nil {
+				return errors.Fatalf("unable to open tar archive: %v", err)
+			}
+			defer f.Close()
+			rd = f
+			p.V("read tar archive from %v", opts.TarFile)
+		} else {
+			p.V("read tar archive from stdin")
+		}
+
+		tarFS, err := fs.NewTar(rd, "")
+		if err != nil {
+			return errors.Fatalf("unable to read tar archive: %v", err)
+		}
+		defer tarFS.Close()
+
+		targetFS = tarFS
+	}
+
 	sc := archiver.NewScanner(targetFS)
 	sc.SelectByName = selectByNameFilter
 	sc.Select = selectFilter
@@ -539,7 +608,9 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, term *termstatus.Termina
 	}
 
 	p.Finish()
-	p.P("snapshot %s saved\n", id.Str())
+	if !opts.DryRun {
+		p.P("snapshot %s saved\n", id.Str())
+	}
 
 	// cleanly shutdown all running goroutines
 	t.Kill(nil)
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -27,6 +29,7 @@ By default, the "check" command will always load all data directly from the
 repository and not use a local cache.
 `,
 	DisableAutoGenTag: true,
+	Annotations:       map[string]string{annotationJSONMessagesToStderr: ""},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return runCheck(checkOptions, globalOptions, args)
 	},
@@ -90,7 +93,7 @@ func stringToIntSlice(param string) (split []uint, err error) {
 }
 
 func newReadProgress(gopts GlobalOptions, todo restic.Stat) *restic.Progress {
-	if gopts.Quiet {
+	if gopts.Quiet || gopts.JSON {
 		return nil
 	}
 
@@ -161,6 +164,66 @@ func prepareCheckCache(opts CheckOptions, gopts *GlobalOptions) (cleanup func())
 	return cleanup
 }
 
+// checkErrorJSON is the JSON representation of an error or hint found by
+// check.
+type checkErrorJSON struct {
+	Message    string           `json:"message,omitempty"`
+	Pack       *restic.ID       `json:"pack,omitempty"`
+	Orphaned   bool             `json:"orphaned,omitempty"`
+	Tree       *restic.ID       `json:"tree,omitempty"`
+	Blob       *restic.ID       `json:"blob,omitempty"`
+	Errors     []checkErrorJSON `json:"errors,omitempty"`
+	StructType string           `json:"struct_type"` // "error", "pack_error", "tree_error", "hint" or "unused_blob"
+}
+
+// checkSummaryJSON is printed at the end of check when --json is set.
+type checkSummaryJSON struct {
+	Errors        int    `json:"errors"`
+	Hints         int    `json:"hints"`
+	OrphanedPacks int    `json:"orphaned_packs"`
+	UnusedBlobs   int    `json:"unused_blobs"`
+	ReadData      string `json:"read_data,omitempty"`
+	StructType    string `json:"struct_type"` // "summary"
+}
+
+func newCheckErrorJSON(err error) checkErrorJSON {
+	switch e := err.(type) {
+	case checker.PackError:
+		return checkErrorJSON{
+			Message:    e.Err.Error(),
+			Pack:       &e.ID,
+			Orphaned:   e.Orphaned,
+			StructType: "pack_error",
+		}
+	case checker.TreeError:
+		res := checkErrorJSON{
+			Tree:       &e.ID,
+			StructType: "tree_error",
+		}
+		for _, treeErr := range e.Errors {
+			res.Errors = append(res.Errors, newCheckErrorJSON(treeErr))
+		}
+		return res
+	case checker.Error:
+		res := checkErrorJSON{
+			Message:    e.Err.Error(),
+			StructType: "error",
+		}
+		if !e.TreeID.IsNull() {
+			res.Tree = &e.TreeID
+		}
+		if !e.BlobID.IsNull() {
+			res.Blob = &e.BlobID
+		}
+		return res
+	}
+
+	return checkErrorJSON{
+		Message:    err.Error(),
+		StructType: "error",
+	}
+}
+
 func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
 	if len(args) != 0 {
 		return errors.Fatal("check has no arguments")
@@ -188,24 +251,49 @@ func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
 
 	chkr := checker.New(repo)
 
+	summary := checkSummaryJSON{StructType: "summary"}
+	enc := json.NewEncoder(gopts.stdout)
+
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
 	Verbosef("load indexes\n")
-	hints, errs := chkr.LoadIndex(gopts.ctx)
+	hints, errs := chkr.LoadIndex(ctx)
 
 	dupFound := false
 	for _, hint := range hints {
-		Printf("%v\n", hint)
+		summary.Hints++
+		if gopts.JSON {
+			if err := enc.Encode(checkErrorJSON{Message: hint.Error(), StructType: "hint"}); err != nil {
+				return err
+			}
+		} else {
+			Printf("%v\n", hint)
+		}
 		if _, ok := hint.(checker.ErrDuplicatePacks); ok {
 			dupFound = true
 		}
 	}
 
-	if dupFound {
+	if dupFound && !gopts.JSON {
 		Printf("This is non-critical, you can run `restic rebuild-index' to correct this\n")
 	}
 
 	if len(errs) > 0 {
 		for _, err := range errs {
-			Warnf("error: %v\n", err)
+			if gopts.JSON {
+				if err := enc.Encode(newCheckErrorJSON(err)); err != nil {
+					return err
+				}
+			} else {
+				Warnf("error: %v\n", err)
+			}
+		}
+		if gopts.JSON {
+			summary.Errors = len(errs)
+			if err := enc.Encode(summary); err != nil {
+				return err
+			}
 		}
 		return errors.Fatal("LoadIndex returned errors")
 	}
@@ -215,17 +303,31 @@ func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
 	errChan := make(chan error)
 
 	Verbosef("check all packs\n")
-	go chkr.Packs(gopts.ctx, errChan)
+	go chkr.Packs(ctx, errChan)
 
 	for err := range errChan {
 		if checker.IsOrphanedPack(err) {
 			orphanedPacks++
-			Verbosef("%v\n", err)
+			if gopts.JSON {
+				if err := enc.Encode(newCheckErrorJSON(err)); err != nil {
+					return err
+				}
+			} else {
+				Verbosef("%v\n", err)
+			}
 			continue
 		}
 		errorsFound = true
-		fmt.Fprintf(os.Stderr, "%v\n", err)
+		summary.Errors++
+		if gopts.JSON {
+			if err := enc.Encode(newCheckErrorJSON(err)); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
 	}
+	summary.OrphanedPacks = orphanedPacks
 
 	if orphanedPacks > 0 {
 		Verbosef("%d additional files were found in the repo, which likely contain duplicate data.\nYou can run `restic prune` to correct this.\n", orphanedPacks)
@@ -233,10 +335,18 @@ func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
 
 	Verbosef("check snapshots, trees and blobs\n")
 	errChan = make(chan error)
-	go chkr.Structure(gopts.ctx, errChan)
+	go chkr.Structure(ctx, errChan)
 
 	for err := range errChan {
 		errorsFound = true
+		summary.Errors++
+		if gopts.JSON {
+			if err := enc.Encode(newCheckErrorJSON(err)); err != nil {
+				return err
+			}
+			continue
+		}
+
 		if e, ok := err.(checker.TreeError); ok {
 			fmt.Fprintf(os.Stderr, "error for tree %v:\n", e.ID.Str())
 			for _, treeErr := range e.Errors {
@@ -249,12 +359,20 @@ func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
 
 	if opts.CheckUnused {
 		for _, id := range chkr.UnusedBlobs() {
-			Verbosef("unused blob %v\n", id.Str())
+			if gopts.JSON {
+				id := id
+				if err := enc.Encode(checkErrorJSON{Blob: &id, StructType: "unused_blob"}); err != nil {
+					return err
+				}
+			} else {
+				Verbosef("unused blob %v\n", id.Str())
+			}
+			summary.UnusedBlobs++
 			errorsFound = true
 		}
 	}
 
-	doReadData := func(bucket, totalBuckets uint) {
+	doReadData := func(bucket, totalBuckets uint) error {
 		packs := restic.IDSet{}
 		for pack := range chkr.GetPacks() {
 			if (uint(pack[0]) % totalBuckets) == (bucket - 1) {
@@ -272,20 +390,40 @@ func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
 		p := newReadProgress(gopts, restic.Stat{Blobs: packCount})
 		errChan := make(chan error)
 
-		go chkr.ReadPacks(gopts.ctx, packs, p, errChan)
+		go chkr.ReadPacks(ctx, packs, p, errChan)
 
 		for err := range errChan {
 			errorsFound = true
-			fmt.Fprintf(os.Stderr, "%v\n", err)
+			summary.Errors++
+			if gopts.JSON {
+				if err := enc.Encode(newCheckErrorJSON(err)); err != nil {
+					return err
+				}
+			} else {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+			}
 		}
+		return nil
 	}
 
 	switch {
 	case opts.ReadData:
-		doReadData(1, 1)
+		summary.ReadData = "all"
+		if err := doReadData(1, 1); err != nil {
+			return err
+		}
 	case opts.ReadDataSubset != "":
+		summary.ReadData = opts.ReadDataSubset
 		dataSubset, _ := stringToIntSlice(opts.ReadDataSubset)
-		doReadData(dataSubset[0], dataSubset[1])
+		if err := doReadData(dataSubset[0], dataSubset[1]); err != nil {
+			return err
+		}
+	}
+
+	if gopts.JSON {
+		if err := enc.Encode(summary); err != nil {
+			return err
+		}
 	}
 
 	if errorsFound {
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdCopy = &cobra.Command{
+	Use:   "copy [flags] [snapshotID ...]",
+	Short: "Copy snapshots from one repository to another",
+	Long: `
+The "copy" command copies one or more snapshots from one repository to another
+repository. Note that this will have to read (download) and write (upload) the
+entire snapshot(s) due to the different encryption keys on the source and
+destination, and that transferred files are not re-chunked, which may break
+their deduplication.
+
+When no snapshot ID is given, all snapshots matching the host, tag and path
+filter criteria are copied. Snapshots which have already been copied to the
+destination repository are skipped.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runCopy(copyOptions, globalOptions, args)
+	},
+}
+
+// CopyOptions bundles all options for the copy command.
+type CopyOptions struct {
+	Repo            string
+	PasswordFile    string
+	PasswordCommand string
+	KeyHint         string
+
+	Host  string
+	Tags  restic.TagLists
+	Paths []string
+}
+
+var copyOptions CopyOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdCopy)
+
+	f := cmdCopy.Flags()
+	f.StringVarP(&copyOptions.Repo, "repo2", "", os.Getenv("RESTIC_REPOSITORY2"), "destination repository to copy snapshots to (default: $RESTIC_REPOSITORY2)")
+	f.StringVarP(&copyOptions.PasswordFile, "password-file2", "", os.Getenv("RESTIC_PASSWORD_FILE2"), "read the destination repository password from a file (default: $RESTIC_PASSWORD_FILE2)")
+	f.StringVarP(&copyOptions.KeyHint, "key-hint2", "", os.Getenv("RESTIC_KEY_HINT2"), "key ID of key to try decrypting the destination repository first (default: $RESTIC_KEY_HINT2)")
+	f.StringVarP(&copyOptions.PasswordCommand, "password-command2", "", os.Getenv("RESTIC_PASSWORD_COMMAND2"), "specify a shell command to obtain a password for the destination repository (default: $RESTIC_PASSWORD_COMMAND2)")
+
+	f.StringVarP(&copyOptions.Host, "host", "H", "", "only consider snapshots for this `host`, when no snapshot ID is given")
+	f.Var(&copyOptions.Tags, "tag", "only consider snapshots which include this `taglist`, when no snapshot ID is given")
+	f.StringArrayVar(&copyOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`, when no snapshot ID is given")
+}
+
+func runCopy(opts CopyOptions, gopts GlobalOptions, args []string) error {
+	if opts.Repo == "" {
+		return errors.Fatal("Please specify a destination repository location (--repo2)")
+	}
+
+	dstGopts := gopts
+	dstGopts.Repo = opts.Repo
+	dstGopts.PasswordFile = opts.PasswordFile
+	dstGopts.PasswordCommand = opts.PasswordCommand
+	dstGopts.KeyHint = opts.KeyHint
+
+	var err error
+	dstGopts.password, err = resolvePassword(dstGopts, "RESTIC_PASSWORD2")
+	if err != nil {
+		return err
+	}
+	dstGopts.password, err = ReadPassword(dstGopts, "enter password for destination repository: ")
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	srcRepo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	dstRepo, err := OpenRepository(dstGopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		srcLock, err := lockRepo(srcRepo)
+		defer unlockRepo(srcLock)
+		if err != nil {
+			return err
+		}
+	}
+
+	dstLock, err := lockRepo(dstRepo)
+	defer unlockRepo(dstLock)
+	if err != nil {
+		return err
+	}
+
+	debug.Log("loading source index")
+	if err := srcRepo.LoadIndex(ctx); err != nil {
+		return err
+	}
+
+	debug.Log("loading destination index")
+	if err := dstRepo.LoadIndex(ctx); err != nil {
+		return err
+	}
+
+	// collect all snapshots in the destination, indexed by the ID of the
+	// snapshot they were originally created as
+	dstSnapshotByOriginal := make(map[restic.ID][]*restic.Snapshot)
+	dstSnapshots, err := restic.LoadAllSnapshots(ctx, dstRepo)
+	if err != nil {
+		return err
+	}
+
+	for _, sn := range dstSnapshots {
+		if sn.Original != nil && !sn.Original.IsNull() {
+			dstSnapshotByOriginal[*sn.Original] = append(dstSnapshotByOriginal[*sn.Original], sn)
+		}
+		// also consider identical snapshot copies
+		dstSnapshotByOriginal[*sn.ID()] = append(dstSnapshotByOriginal[*sn.ID()], sn)
+	}
+
+	cloner := &treeCloner{
+		srcRepo:      srcRepo,
+		dstRepo:      dstRepo,
+		visitedTrees: restic.NewIDSet(),
+		copiedBlobs:  restic.NewBlobSet(),
+	}
+
+	for sn := range FindFilteredSnapshots(ctx, srcRepo, opts.Host, opts.Tags, opts.Paths, args) {
+		Verbosef("\nsnapshot %s of %v at %s\n", sn.ID().Str(), sn.Paths, sn.Time)
+
+		// check whether the destination has a snapshot with the same
+		// original ID and the same contents
+		srcOriginal := *sn.ID()
+		if sn.Original != nil {
+			srcOriginal = *sn.Original
+		}
+
+		if copied := findCopiedSnapshot(dstSnapshotByOriginal[srcOriginal], sn); copied != nil {
+			Verbosef("skipping source snapshot %s, was already copied to snapshot %s\n", sn.ID().Str(), copied.ID().Str())
+			continue
+		}
+
+		Verbosef("  copy started, this may take a while...\n")
+
+		if err := cloner.copyTree(ctx, *sn.Tree); err != nil {
+			return err
+		}
+		debug.Log("tree copied")
+
+		if err = dstRepo.Flush(ctx); err != nil {
+			return err
+		}
+
+		if err = dstRepo.SaveIndex(ctx); err != nil {
+			return err
+		}
+		debug.Log("flushed packs and saved index")
+
+		// the parent snapshot does not exist in the destination repository
+		sn.Parent = nil
+
+		// use the original ID as a persistent identifier of the snapshot
+		if sn.Original == nil {
+			sn.Original = sn.ID()
+		}
+
+		newID, err := dstRepo.SaveJSONUnpacked(ctx, restic.SnapshotFile, sn)
+		if err != nil {
+			return err
+		}
+		Verbosef("snapshot %s saved\n", newID.Str())
+	}
+
+	return nil
+}
+
+// findCopiedSnapshot returns the first snapshot in candidates which is a copy
+// of sn, or nil if there is none.
+func findCopiedSnapshot(candidates []*restic.Snapshot, sn *restic.Snapshot) *restic.Snapshot {
+	for _, candidate := range candidates {
+		if similarSnapshots(candidate, sn) {
+			return candidate
+		}
+	}
+
+	return nil
+}
+
+// similarSnapshots returns true when both snapshots are equal in all fields
+// except Parent and Original.
+func similarSnapshots(sna *restic.Snapshot, snb *restic.Snapshot) bool {
+	if !sna.Time.Equal(snb.Time) || !sna.Tree.Equal(*snb.Tree) || sna.Hostname != snb.Hostname ||
+		sna.Username != snb.Username || sna.UID != snb.UID || sna.GID != snb.GID ||
+		len(sna.Paths) != len(snb.Paths) || len(sna.Excludes) != len(snb.Excludes) ||
+		len(sna.Tags) != len(snb.Tags) {
+		return false
+	}
+
+	if !sna.HasPaths(snb.Paths) || !sna.HasTags(snb.Tags) {
+		return false
+	}
+
+	for i, a := range sna.Excludes {
+		if a != snb.Excludes[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// treeCloner copies trees and the blobs referenced by them from one
+// repository to another.
+type treeCloner struct {
+	srcRepo restic.Repository
+	dstRepo restic.Repository
+
+	// visitedTrees contains all trees which have been processed already
+	visitedTrees restic.IDSet
+
+	// copiedBlobs contains all blobs saved to the destination repository
+	// during this run, they may not have been added to the index yet
+	copiedBlobs restic.BlobSet
+}
+
+// hasBlob returns true when the destination repository already contains the
+// blob.
+func (t *treeCloner) hasBlob(id restic.ID, tpe restic.BlobType) bool {
+	return t.copiedBlobs.Has(restic.BlobHandle{ID: id, Type: tpe}) || t.dstRepo.Index().Has(id, tpe)
+}
+
+// copyTree copies the tree treeID and all blobs and subtrees referenced by it
+// to the destination repository.
+func (t *treeCloner) copyTree(ctx context.Context, treeID restic.ID) error {
+	if t.visitedTrees.Has(treeID) {
+		return nil
+	}
+
+	tree, err := t.srcRepo.LoadTree(ctx, treeID)
+	if err != nil {
+		return errors.Wrapf(err, "LoadTree(%v)", treeID.Str())
+	}
+	t.visitedTrees.Insert(treeID)
+
+	if !t.hasBlob(treeID, restic.TreeBlob) {
+		newTreeID, err := t.dstRepo.SaveTree(ctx, tree)
+		if err != nil {
+			return errors.Wrapf(err, "SaveTree(%v)", treeID.Str())
+		}
+
+		if !newTreeID.Equal(treeID) {
+			return errors.Errorf("SaveTree(%v) returned unexpected id %v", treeID.Str(), newTreeID.Str())
+		}
+
+		t.copiedBlobs.Insert(restic.BlobHandle{ID: treeID, Type: restic.TreeBlob})
+	}
+
+	for _, node := range tree.Nodes {
+		if node.Type == "dir" && node.Subtree != nil {
+			if err := t.copyTree(ctx, *node.Subtree); err != nil {
+				return err
+			}
+		}
+
+		for _, blobID := range node.Content {
+			if err := t.copyBlob(ctx, blobID, restic.DataBlob); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// copyBlob copies a single blob to the destination repository, unless it
+// already exists there.
+func (t *treeCloner) copyBlob(ctx context.Context, id restic.ID, tpe restic.BlobType) error {
+	if t.hasBlob(id, tpe) {
+		return nil
+	}
+
+	debug.Log("copying blob %v", id.Str())
+
+	size, found := t.srcRepo.LookupBlobSize(id, tpe)
+	if !found {
+		return errors.Errorf("LookupBlobSize(%v) failed", id.Str())
+	}
+
+	buf := restic.NewBlobBuffer(int(size))
+	n, err := t.srcRepo.LoadBlob(ctx, tpe, id, buf)
+	if err != nil {
+		return errors.Wrapf(err, "LoadBlob(%v)", id.Str())
+	}
+
+	_, err = t.dstRepo.SaveBlob(ctx, tpe, buf[:n], id)
+	if err != nil {
+		return errors.Wrapf(err, "SaveBlob(%v)", id.Str())
+	}
+
+	t.copiedBlobs.Insert(restic.BlobHandle{ID: id, Type: tpe})
+	return nil
+}
@@ -2,20 +2,29 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"io"
+	"os"
 	"path"
+	"path/filepath"
 	"reflect"
 	"sort"
+	"strings"
+	"time"
 
+	"github.com/restic/chunker"
+	"github.com/restic/restic/internal/archiver"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/spf13/cobra"
 )
 
 var cmdDiff = &cobra.Command{
-	Use:   "diff snapshot-ID snapshot-ID",
-	Short: "Show differences between two snapshots",
+	Use:   "diff snapshot-ID [snapshot-ID]",
+	Short: "Show differences between two snapshots or a snapshot and a directory",
 	Long: `
 The "diff" command shows differences from the first to the second snapshot. The
 first characters in each line display what has happened to a particular file or
@@ -26,8 +35,16 @@ directory:
 * U  The metadata (access mode, timestamps, ...) for the item was updated
 * M  The file's content was modified
 * T  The type was changed, e.g. a file was made a symlink
+
+With --live, the snapshot is compared to the files in a local directory instead
+of a second snapshot. The directory must be contained in the snapshot under its
+absolute path. Files are reported as modified when their size, modification
+time or inode differ from the snapshot, like the backup command does. With
+--check-content, these files are read and only reported as modified if their
+content differs.
 `,
 	DisableAutoGenTag: true,
+	Annotations:       map[string]string{annotationJSONMessagesToStderr: ""},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return runDiff(diffOptions, globalOptions, args)
 	},
@@ -36,6 +53,8 @@ directory:
 // DiffOptions collects all options for the diff command.
 type DiffOptions struct {
 	ShowMetadata bool
+	Live         string
+	CheckContent bool
 }
 
 var diffOptions DiffOptions
@@ -45,6 +64,8 @@ func init() {
 
 	f := cmdDiff.Flags()
 	f.BoolVar(&diffOptions.ShowMetadata, "metadata", false, "print changes in metadata")
+	f.StringVar(&diffOptions.Live, "live", "", "compare the snapshot to the files in `dir` instead of a second snapshot")
+	f.BoolVar(&diffOptions.CheckContent, "check-content", false, "with --live, read files which may have been modified and compare their content")
 }
 
 func loadSnapshot(ctx context.Context, repo *repository.Repository, desc string) (*restic.Snapshot, error) {
@@ -58,15 +79,81 @@ func loadSnapshot(ctx context.Context, repo *repository.Repository, desc string)
 
 // Comparer collects all things needed to compare two snapshots.
 type Comparer struct {
-	repo restic.Repository
-	opts DiffOptions
+	repo        restic.Repository
+	fs          fs.FS
+	opts        DiffOptions
+	printChange func(change *Change)
+
+	// printErr is the first error which occurred while printing a change
+	printErr error
+}
+
+// Change describes a changed item, it is printed as JSON when --json is set.
+type Change struct {
+	Path     string      `json:"path"`
+	Modifier string      `json:"modifier"`
+	Before   *ChangeItem `json:"before,omitempty"`
+	After    *ChangeItem `json:"after,omitempty"`
+
+	// Content is set for modified files when the blobs of both versions
+	// are known.
+	Content *ContentChange `json:"content,omitempty"`
+
+	StructType string `json:"struct_type"` // "change"
+}
+
+// ChangeItem contains the metadata of an item before or after a change.
+type ChangeItem struct {
+	Type    string      `json:"type"`
+	Size    uint64      `json:"size"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"mtime"`
+}
+
+// newChangeItem returns the metadata of node.
+func newChangeItem(node *restic.Node) *ChangeItem {
+	return &ChangeItem{
+		Type:    node.Type,
+		Size:    node.Size,
+		Mode:    node.Mode,
+		ModTime: node.ModTime,
+	}
+}
+
+// ContentChange counts the blobs which were added to and removed from the
+// content of files.
+type ContentChange struct {
+	AddedBlobs   int `json:"added_blobs"`
+	AddedBytes   int `json:"added_bytes"`
+	RemovedBlobs int `json:"removed_blobs"`
+	RemovedBytes int `json:"removed_bytes"`
+}
+
+// Add adds the counts of other to cc.
+func (cc *ContentChange) Add(other *ContentChange) {
+	if other == nil {
+		return
+	}
+
+	cc.AddedBlobs += other.AddedBlobs
+	cc.AddedBytes += other.AddedBytes
+	cc.RemovedBlobs += other.RemovedBlobs
+	cc.RemovedBytes += other.RemovedBytes
+}
+
+// NewChange returns a new change for the item at path.
+func NewChange(path string, mode string) *Change {
+	return &Change{Path: path, Modifier: mode, StructType: "change"}
 }
 
 // DiffStat collects stats for all types of items.
 type DiffStat struct {
-	Files, Dirs, Others  int
-	DataBlobs, TreeBlobs int
-	Bytes                int
+	Files     int `json:"files"`
+	Dirs      int `json:"dirs"`
+	Others    int `json:"others"`
+	DataBlobs int `json:"data_blobs"`
+	TreeBlobs int `json:"tree_blobs"`
+	Bytes     int `json:"bytes"`
 }
 
 // Add adds stats information for node to s.
@@ -111,10 +198,12 @@ func addBlobs(bs restic.BlobSet, node *restic.Node) {
 
 // DiffStats collects the differences between two snapshots.
 type DiffStats struct {
-	ChangedFiles            int
-	Added                   DiffStat
-	Removed                 DiffStat
-	BlobsBefore, BlobsAfter restic.BlobSet
+	ChangedFiles            int            `json:"changed_files"`
+	Added                   DiffStat       `json:"added"`
+	Removed                 DiffStat       `json:"removed"`
+	Modified                ContentChange  `json:"modified"`
+	BlobsBefore, BlobsAfter restic.BlobSet `json:"-"`
+	StructType              string         `json:"struct_type"` // "statistics"
 }
 
 // NewDiffStats creates new stats for a diff run.
@@ -122,6 +211,7 @@ func NewDiffStats() *DiffStats {
 	return &DiffStats{
 		BlobsBefore: restic.NewBlobSet(),
 		BlobsAfter:  restic.NewBlobSet(),
+		StructType:  "statistics",
 	}
 }
 
@@ -145,6 +235,48 @@ func updateBlobs(repo restic.Repository, blobs restic.BlobSet, stats *DiffStat)
 	}
 }
 
+// blobSize returns the size of the data blob with id in the repository.
+func (c *Comparer) blobSize(id restic.ID) (uint, bool) {
+	return c.repo.LookupBlobSize(id, restic.DataBlob)
+}
+
+// contentChange returns the blobs which were added to and removed from a file
+// whose content changed from before to after. size returns the size of the
+// new blobs.
+func (c *Comparer) contentChange(before, after restic.IDs, size func(restic.ID) (uint, bool)) *ContentChange {
+	oldBlobs := restic.NewIDSet(before...)
+	newBlobs := restic.NewIDSet(after...)
+
+	cc := &ContentChange{}
+	for id := range newBlobs.Sub(oldBlobs) {
+		cc.AddedBlobs++
+		if n, ok := size(id); ok {
+			cc.AddedBytes += int(n)
+		}
+	}
+
+	for id := range oldBlobs.Sub(newBlobs) {
+		cc.RemovedBlobs++
+		if n, ok := c.blobSize(id); ok {
+			cc.RemovedBytes += int(n)
+		}
+	}
+
+	return cc
+}
+
+// newAddRemoveChange returns the change for an item which was added ("+") or
+// removed ("-").
+func newAddRemoveChange(path, mode string, node *restic.Node) *Change {
+	change := NewChange(path, mode)
+	if mode == "-" {
+		change.Before = newChangeItem(node)
+	} else {
+		change.After = newChangeItem(node)
+	}
+	return change
+}
+
 func (c *Comparer) printDir(ctx context.Context, mode string, stats *DiffStat, blobs restic.BlobSet, prefix string, id restic.ID) error {
 	debug.Log("print %v tree %v", mode, id)
 	tree, err := c.repo.LoadTree(ctx, id)
@@ -157,7 +289,7 @@ func (c *Comparer) printDir(ctx context.Context, mode string, stats *DiffStat, b
 		if node.Type == "dir" {
 			name += "/"
 		}
-		Printf("%-5s%v\n", mode, name)
+		c.printChange(newAddRemoveChange(name, mode, node))
 		stats.Add(node)
 		addBlobs(blobs, node)
 
@@ -229,17 +361,23 @@ func (c *Comparer) diffTree(ctx context.Context, stats *DiffStats, prefix string
 				name += "/"
 			}
 
+			change := NewChange(name, "")
 			if node1.Type == "file" &&
 				node2.Type == "file" &&
 				!reflect.DeepEqual(node1.Content, node2.Content) {
 				mod += "M"
 				stats.ChangedFiles++
+				change.Content = c.contentChange(node1.Content, node2.Content, c.blobSize)
+				stats.Modified.Add(change.Content)
 			} else if c.opts.ShowMetadata && !node1.Equals(*node2) {
 				mod += "U"
 			}
 
 			if mod != "" {
-				Printf("%-5s%v\n", mod, name)
+				change.Modifier = mod
+				change.Before = newChangeItem(node1)
+				change.After = newChangeItem(node2)
+				c.printChange(change)
 			}
 
 			if node1.Type == "dir" && node2.Type == "dir" {
@@ -253,7 +391,7 @@ func (c *Comparer) diffTree(ctx context.Context, stats *DiffStats, prefix string
 			if node1.Type == "dir" {
 				prefix += "/"
 			}
-			Printf("%-5s%v\n", "-", prefix)
+			c.printChange(newAddRemoveChange(prefix, "-", node1))
 			stats.Removed.Add(node1)
 
 			if node1.Type == "dir" {
@@ -267,7 +405,7 @@ func (c *Comparer) diffTree(ctx context.Context, stats *DiffStats, prefix string
 			if node2.Type == "dir" {
 				prefix += "/"
 			}
-			Printf("%-5s%v\n", "+", prefix)
+			c.printChange(newAddRemoveChange(prefix, "+", node2))
 			stats.Added.Add(node2)
 
 			if node2.Type == "dir" {
@@ -282,11 +420,338 @@ func (c *Comparer) diffTree(ctx context.Context, stats *DiffStats, prefix string
 	return nil
 }
 
+// snapshotPath returns the path of the local directory dir within a snapshot,
+// the archiver stores absolute paths below the volume name on Windows.
+func snapshotPath(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", errors.Wrap(err, "Abs")
+	}
+
+	volume := filepath.VolumeName(abs)
+	p := path.Join("/", filepath.ToSlash(abs[len(volume):]))
+
+	if volume != "" {
+		// strip colon
+		if len(volume) == 2 && volume[1] == ':' {
+			volume = volume[:1]
+		}
+		p = path.Join("/", volume, p)
+	}
+
+	return p, nil
+}
+
+// findSubtree returns the ID of the tree for the directory at p within the
+// tree with the given id.
+func findSubtree(ctx context.Context, repo restic.Repository, id restic.ID, p string) (restic.ID, error) {
+	for _, name := range strings.Split(strings.Trim(p, "/"), "/") {
+		if name == "" {
+			continue
+		}
+
+		tree, err := repo.LoadTree(ctx, id)
+		if err != nil {
+			return restic.ID{}, err
+		}
+
+		node := tree.Find(name)
+		if node == nil || node.Type != "dir" || node.Subtree == nil {
+			return restic.ID{}, errors.Fatalf("directory %v not found in snapshot", p)
+		}
+		id = *node.Subtree
+	}
+
+	return id, nil
+}
+
+// liveMetadataChanged returns true if the metadata of the local item differs
+// from the node in the snapshot.
+func liveMetadataChanged(node, live *restic.Node) bool {
+	return node.Mode != live.Mode ||
+		!node.ModTime.Equal(live.ModTime) ||
+		node.UID != live.UID ||
+		node.GID != live.GID ||
+		node.Size != live.Size ||
+		node.LinkTarget != live.LinkTarget ||
+		node.Device != live.Device
+}
+
+// splitContent splits the data from rd into chunks like the archiver does and
+// returns the IDs of the resulting blobs and their sizes.
+func splitContent(ctx context.Context, rd io.Reader, pol chunker.Pol) (restic.IDs, map[restic.ID]uint, error) {
+	chnker := chunker.New(rd, pol)
+	buf := make([]byte, chunker.MaxSize)
+
+	var content restic.IDs
+	sizes := make(map[restic.ID]uint)
+	for {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+
+		chunk, err := chnker.Next(buf)
+		if errors.Cause(err) == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "Next")
+		}
+
+		id := restic.Hash(chunk.Data)
+		content = append(content, id)
+		sizes[id] = chunk.Length
+	}
+
+	return content, sizes, nil
+}
+
+// liveFileChanged returns true if the local file differs from node. Files
+// which may have changed are split into chunks and compared to the content of
+// node when CheckContent is set, the blobs which were added and removed are
+// returned for them.
+func (c *Comparer) liveFileChanged(ctx context.Context, filename string, fi os.FileInfo, node *restic.Node) (bool, *ContentChange, error) {
+	if !archiver.FileChanged(fi, node) {
+		return false, nil, nil
+	}
+
+	if !c.opts.CheckContent {
+		return true, nil, nil
+	}
+
+	f, err := c.fs.OpenFile(filename, fs.O_RDONLY|fs.O_NOFOLLOW, 0)
+	if err != nil {
+		return false, nil, errors.Wrap(err, "Open")
+	}
+	defer f.Close()
+
+	content, sizes, err := splitContent(ctx, f, c.repo.Config().ChunkerPolynomial)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if reflect.DeepEqual(content, node.Content) {
+		return false, nil, nil
+	}
+
+	size := func(id restic.ID) (uint, bool) {
+		n, ok := sizes[id]
+		return n, ok
+	}
+	return true, c.contentChange(node.Content, content, size), nil
+}
+
+// liveNode returns the node for the local item at filename.
+func (c *Comparer) liveNode(filename string) (*restic.Node, os.FileInfo, error) {
+	fi, err := c.fs.Lstat(filename)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Lstat")
+	}
+
+	node, err := restic.NodeFromFileInfo(filename, fi)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "NodeFromFileInfo")
+	}
+
+	return node, fi, nil
+}
+
+// printLiveDir prints all items in the local directory dir with mode.
+func (c *Comparer) printLiveDir(mode string, stats *DiffStat, prefix, dir string) error {
+	names, err := fs.ReadDirNames(c.fs, dir)
+	if err != nil {
+		return errors.Wrap(err, "ReadDirNames")
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		filename := c.fs.Join(dir, name)
+		node, _, err := c.liveNode(filename)
+		if err != nil {
+			Warnf("error: %v\n", err)
+			continue
+		}
+
+		p := path.Join(prefix, name)
+		if node.Type == "dir" {
+			p += "/"
+		}
+		c.printChange(newAddRemoveChange(p, mode, node))
+		stats.Add(node)
+		if node.Type == "file" {
+			stats.Bytes += int(node.Size)
+		}
+
+		if node.Type == "dir" {
+			err := c.printLiveDir(mode, stats, p, filename)
+			if err != nil {
+				Warnf("error: %v\n", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// addRemovedBytes adds the size of the files in the tree with id to stats.
+func (c *Comparer) addRemovedBytes(ctx context.Context, stats *DiffStat, id restic.ID) error {
+	tree, err := c.repo.LoadTree(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range tree.Nodes {
+		switch node.Type {
+		case "file":
+			stats.Bytes += int(node.Size)
+		case "dir":
+			err := c.addRemovedBytes(ctx, stats, *node.Subtree)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// diffLive compares the tree with id to the local directory dir.
+func (c *Comparer) diffLive(ctx context.Context, stats *DiffStats, prefix string, id restic.ID, dir string) error {
+	debug.Log("diffing %v to local directory %v", id, dir)
+	tree, err := c.repo.LoadTree(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	names, err := fs.ReadDirNames(c.fs, dir)
+	if err != nil {
+		return errors.Wrap(err, "ReadDirNames")
+	}
+
+	local := &restic.Tree{}
+	for _, name := range names {
+		local.Nodes = append(local.Nodes, &restic.Node{Name: name})
+	}
+
+	treeNodes, localNodes, names := uniqueNodeNames(tree, local)
+
+	for _, name := range names {
+		node1, t1 := treeNodes[name]
+		_, t2 := localNodes[name]
+		filename := c.fs.Join(dir, name)
+
+		switch {
+		case t1 && t2:
+			node2, fi, err := c.liveNode(filename)
+			if err != nil {
+				Warnf("error: %v\n", err)
+				continue
+			}
+
+			name := path.Join(prefix, name)
+			mod := ""
+
+			if node1.Type != node2.Type {
+				mod += "T"
+			}
+
+			if node2.Type == "dir" {
+				name += "/"
+			}
+
+			change := NewChange(name, "")
+			changed := false
+			if node1.Type == "file" && node2.Type == "file" {
+				changed, change.Content, err = c.liveFileChanged(ctx, filename, fi, node1)
+				if err != nil {
+					Warnf("error: %v\n", err)
+				}
+			}
+
+			if changed {
+				mod += "M"
+				stats.ChangedFiles++
+				stats.Modified.Add(change.Content)
+			} else if c.opts.ShowMetadata && (node1.Type != node2.Type || liveMetadataChanged(node1, node2)) {
+				mod += "U"
+			}
+
+			if mod != "" {
+				change.Modifier = mod
+				change.Before = newChangeItem(node1)
+				change.After = newChangeItem(node2)
+				c.printChange(change)
+			}
+
+			if node1.Type == "dir" && node2.Type == "dir" {
+				err := c.diffLive(ctx, stats, name, *node1.Subtree, filename)
+				if err != nil {
+					Warnf("error: %v\n", err)
+				}
+			}
+		case t1 && !t2:
+			prefix := path.Join(prefix, name)
+			if node1.Type == "dir" {
+				prefix += "/"
+			}
+			c.printChange(newAddRemoveChange(prefix, "-", node1))
+			stats.Removed.Add(node1)
+
+			switch node1.Type {
+			case "file":
+				stats.Removed.Bytes += int(node1.Size)
+			case "dir":
+				blobs := restic.NewBlobSet()
+				err := c.printDir(ctx, "-", &stats.Removed, blobs, prefix, *node1.Subtree)
+				if err == nil {
+					err = c.addRemovedBytes(ctx, &stats.Removed, *node1.Subtree)
+				}
+				if err != nil {
+					Warnf("error: %v\n", err)
+				}
+			}
+		case !t1 && t2:
+			node2, _, err := c.liveNode(filename)
+			if err != nil {
+				Warnf("error: %v\n", err)
+				continue
+			}
+
+			prefix := path.Join(prefix, name)
+			if node2.Type == "dir" {
+				prefix += "/"
+			}
+			c.printChange(newAddRemoveChange(prefix, "+", node2))
+			stats.Added.Add(node2)
+
+			switch node2.Type {
+			case "file":
+				stats.Added.Bytes += int(node2.Size)
+			case "dir":
+				err := c.printLiveDir("+", &stats.Added, prefix, filename)
+				if err != nil {
+					Warnf("error: %v\n", err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
 func runDiff(opts DiffOptions, gopts GlobalOptions, args []string) error {
-	if len(args) != 2 {
+	if opts.Live != "" {
+		if len(args) != 1 {
+			return errors.Fatalf("specify one snapshot ID to compare to the live directory")
+		}
+	} else if len(args) != 2 {
 		return errors.Fatalf("specify two snapshot IDs")
 	}
 
+	if opts.CheckContent && opts.Live == "" {
+		return errors.Fatal("--check-content can only be used together with --live")
+	}
+
 	ctx, cancel := context.WithCancel(gopts.ctx)
 	defer cancel()
 
@@ -312,6 +777,32 @@ func runDiff(opts DiffOptions, gopts GlobalOptions, args []string) error {
 		return err
 	}
 
+	if sn1.Tree == nil {
+		return errors.Errorf("snapshot %v has nil tree", sn1.ID().Str())
+	}
+
+	c := &Comparer{
+		repo: repo,
+		fs:   fs.Local{},
+		opts: opts,
+		printChange: func(change *Change) {
+			Printf("%-5s%v\n", change.Modifier, change.Path)
+		},
+	}
+
+	if gopts.JSON {
+		enc := json.NewEncoder(gopts.stdout)
+		c.printChange = func(change *Change) {
+			if c.printErr == nil {
+				c.printErr = enc.Encode(change)
+			}
+		}
+	}
+
+	if opts.Live != "" {
+		return runDiffLive(ctx, c, gopts, sn1)
+	}
+
 	sn2, err := loadSnapshot(ctx, repo, args[1])
 	if err != nil {
 		return err
@@ -319,30 +810,28 @@ func runDiff(opts DiffOptions, gopts GlobalOptions, args []string) error {
 
 	Verbosef("comparing snapshot %v to %v:\n\n", sn1.ID().Str(), sn2.ID().Str())
 
-	if sn1.Tree == nil {
-		return errors.Errorf("snapshot %v has nil tree", sn1.ID().Str())
-	}
-
 	if sn2.Tree == nil {
 		return errors.Errorf("snapshot %v has nil tree", sn2.ID().Str())
 	}
 
-	c := &Comparer{
-		repo: repo,
-		opts: diffOptions,
-	}
-
 	stats := NewDiffStats()
 
 	err = c.diffTree(ctx, stats, "/", *sn1.Tree, *sn2.Tree)
 	if err != nil {
 		return err
 	}
+	if c.printErr != nil {
+		return c.printErr
+	}
 
 	both := stats.BlobsBefore.Intersect(stats.BlobsAfter)
 	updateBlobs(repo, stats.BlobsBefore.Sub(both), &stats.Removed)
 	updateBlobs(repo, stats.BlobsAfter.Sub(both), &stats.Added)
 
+	if gopts.JSON {
+		return json.NewEncoder(gopts.stdout).Encode(stats)
+	}
+
 	Printf("\n")
 	Printf("Files:       %5d new, %5d removed, %5d changed\n", stats.Added.Files, stats.Removed.Files, stats.ChangedFiles)
 	Printf("Dirs:        %5d new, %5d removed\n", stats.Added.Dirs, stats.Removed.Dirs)
@@ -354,3 +843,49 @@ func runDiff(opts DiffOptions, gopts GlobalOptions, args []string) error {
 
 	return nil
 }
+
+// runDiffLive compares the snapshot sn to the local directory in the options.
+func runDiffLive(ctx context.Context, c *Comparer, gopts GlobalOptions, sn *restic.Snapshot) error {
+	fi, err := c.fs.Stat(c.opts.Live)
+	if err != nil {
+		return errors.Fatalf("unable to access %v: %v", c.opts.Live, err)
+	}
+	if !fi.IsDir() {
+		return errors.Fatalf("%v is not a directory", c.opts.Live)
+	}
+
+	prefix, err := snapshotPath(c.opts.Live)
+	if err != nil {
+		return err
+	}
+
+	id, err := findSubtree(ctx, c.repo, *sn.Tree, prefix)
+	if err != nil {
+		return err
+	}
+
+	Verbosef("comparing snapshot %v to %v:\n\n", sn.ID().Str(), c.opts.Live)
+
+	stats := NewDiffStats()
+
+	err = c.diffLive(ctx, stats, prefix, id, c.opts.Live)
+	if err != nil {
+		return err
+	}
+	if c.printErr != nil {
+		return c.printErr
+	}
+
+	if gopts.JSON {
+		return json.NewEncoder(gopts.stdout).Encode(stats)
+	}
+
+	Printf("\n")
+	Printf("Files:       %5d new, %5d removed, %5d changed\n", stats.Added.Files, stats.Removed.Files, stats.ChangedFiles)
+	Printf("Dirs:        %5d new, %5d removed\n", stats.Added.Dirs, stats.Removed.Dirs)
+	Printf("Others:      %5d new, %5d removed\n", stats.Added.Others, stats.Removed.Others)
+	Printf("  Added:   %-5s\n", formatBytes(uint64(stats.Added.Bytes)))
+	Printf("  Removed: %-5s\n", formatBytes(uint64(stats.Removed.Bytes)))
+
+	return nil
+}
@@ -3,11 +3,12 @@ package main
 import (
 	"context"
 	"fmt"
-	"os"
+	"io"
 	"path"
 	"path/filepath"
 
 	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/dump"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 
@@ -16,10 +17,17 @@ import (
 
 var cmdDump = &cobra.Command{
 	Use:   "dump [flags] snapshotID file",
-	Short: "Print a backed-up file to stdout",
+	Short: "Print a backed-up file or directory to stdout",
 	Long: `
-The "dump" command extracts a single file from a snapshot from the repository and
-prints its contents to stdout.
+The "dump" command extracts files from a snapshot from the repository. If a
+single file is selected, it prints its contents to stdout. Directories are
+written to stdout as an archive, which contains the directory and all files
+below it. The format of the archive is selected with --archive, which can be
+"tar" (the default) or "zip". Use "/" as the path to dump the whole snapshot.
+
+The paths in the archive can be changed with --strip-components and --map in
+the same way as for the "restore" command. In that case, the paths are derived
+from the full paths of the items in the snapshot.
 
 The special snapshot "latest" can be used to use the latest snapshot in the
 repository.
@@ -32,9 +40,13 @@ repository.
 
 // DumpOptions collects all options for the dump command.
 type DumpOptions struct {
-	Host  string
-	Paths []string
-	Tags  restic.TagLists
+	Host    string
+	Paths   []string
+	Tags    restic.TagLists
+	Archive string
+
+	StripComponents int
+	Map             []string
 }
 
 var dumpOptions DumpOptions
@@ -46,6 +58,9 @@ func init() {
 	flags.StringVarP(&dumpOptions.Host, "host", "H", "", `only consider snapshots for this host when the snapshot ID is "latest"`)
 	flags.Var(&dumpOptions.Tags, "tag", "only consider snapshots which include this `taglist` for snapshot ID \"latest\"")
 	flags.StringArrayVar(&dumpOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path` for snapshot ID \"latest\"")
+	flags.StringVarP(&dumpOptions.Archive, "archive", "a", "tar", "set archive `format` for directories as \"tar\" or \"zip\"")
+	flags.IntVar(&dumpOptions.StripComponents, "strip-components", 0, "remove `n` leading components from the paths in the archive")
+	flags.StringArrayVar(&dumpOptions.Map, "map", nil, "store items below `/old/prefix=/new/prefix` with the new prefix in the archive (can be specified multiple times)")
 }
 
 func splitPath(p string) []string {
@@ -57,34 +72,26 @@ func splitPath(p string) []string {
 	return append(s, f)
 }
 
-func dumpNode(ctx context.Context, repo restic.Repository, node *restic.Node) error {
-	var buf []byte
-	for _, id := range node.Content {
-		size, found := repo.LookupBlobSize(id, restic.DataBlob)
-		if !found {
-			return errors.Errorf("id %v not found in repository", id)
-		}
-
-		buf = buf[:cap(buf)]
-		if len(buf) < restic.CiphertextLength(int(size)) {
-			buf = restic.NewBlobBuffer(int(size))
-		}
-
-		n, err := repo.LoadBlob(ctx, restic.DataBlob, id, buf)
-		if err != nil {
-			return err
-		}
-		buf = buf[:n]
+// dumpDirectory writes the tree to dst as an archive in the given format. dir
+// is the path of the tree in the snapshot, it is used when the paths are
+// rewritten.
+func dumpDirectory(ctx context.Context, repo restic.Repository, tree *restic.Tree, dir string, rewrite restic.PathRewriter, archive string, dst io.Writer) error {
+	prefix := ""
+	if !rewrite.Identity() {
+		prefix = dir
+	}
 
-		_, err = os.Stdout.Write(buf)
-		if err != nil {
-			return errors.Wrap(err, "Write")
-		}
+	switch archive {
+	case "tar":
+		return dump.WriteTar(ctx, repo, tree, prefix, rewrite, dst)
+	case "zip":
+		return dump.WriteZip(ctx, repo, tree, prefix, rewrite, dst)
 	}
-	return nil
+
+	return errors.Fatalf("unknown archive format %q", archive)
 }
 
-func printFromTree(ctx context.Context, tree *restic.Tree, repo restic.Repository, prefix string, pathComponents []string) error {
+func printFromTree(ctx context.Context, tree *restic.Tree, repo restic.Repository, prefix string, pathComponents []string, rewrite restic.PathRewriter, archive string, dst io.Writer) error {
 	if tree == nil {
 		return fmt.Errorf("called with a nil tree")
 	}
@@ -100,17 +107,19 @@ func printFromTree(ctx context.Context, tree *restic.Tree, repo restic.Repositor
 		if node.Name == pathComponents[0] {
 			switch {
 			case l == 1 && node.Type == "file":
-				return dumpNode(ctx, repo, node)
+				return dump.WriteNodeData(ctx, dst, repo, node)
+			case l == 1 && node.Type == "dir":
+				return dumpDirectory(ctx, repo, &restic.Tree{Nodes: []*restic.Node{node}}, path.Join("/", filepath.ToSlash(prefix)), rewrite, archive, dst)
 			case l > 1 && node.Type == "dir":
 				subtree, err := repo.LoadTree(ctx, *node.Subtree)
 				if err != nil {
 					return errors.Wrapf(err, "cannot load subtree for %q", item)
 				}
-				return printFromTree(ctx, subtree, repo, item, pathComponents[1:])
+				return printFromTree(ctx, subtree, repo, item, pathComponents[1:], rewrite, archive, dst)
 			case l > 1:
 				return fmt.Errorf("%q should be a dir, but s a %q", item, node.Type)
 			case node.Type != "file":
-				return fmt.Errorf("%q should be a file, but is a %q", item, node.Type)
+				return fmt.Errorf("%q should be a file or dir, but is a %q", item, node.Type)
 			}
 		}
 	}
@@ -129,7 +138,16 @@ func runDump(opts DumpOptions, gopts GlobalOptions, args []string) error {
 
 	debug.Log("dump file %q from %q", pathToPrint, snapshotIDString)
 
-	splittedPath := splitPath(pathToPrint)
+	if opts.Archive != "tar" && opts.Archive != "zip" {
+		return errors.Fatalf("unknown archive format %q", opts.Archive)
+	}
+
+	rewrite, err := parsePathRewriter(opts.StripComponents, opts.Map)
+	if err != nil {
+		return err
+	}
+
+	splittedPath := splitPath(path.Clean(pathToPrint))
 
 	repo, err := OpenRepository(gopts)
 	if err != nil {
@@ -173,7 +191,11 @@ func runDump(opts DumpOptions, gopts GlobalOptions, args []string) error {
 		Exitf(2, "loading tree for snapshot %q failed: %v", snapshotIDString, err)
 	}
 
-	err = printFromTree(ctx, tree, repo, "", splittedPath)
+	if path.Clean(pathToPrint) == "/" {
+		err = dumpDirectory(ctx, repo, tree, "/", rewrite, opts.Archive, gopts.stdout)
+	} else {
+		err = printFromTree(ctx, tree, repo, "", splittedPath, rewrite, opts.Archive, gopts.stdout)
+	}
 	if err != nil {
 		Exitf(2, "cannot dump file: %v", err)
 	}
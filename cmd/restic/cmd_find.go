@@ -1,16 +1,22 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"io"
+	"reflect"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/dump"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/filter"
+	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/walker"
 )
@@ -21,9 +27,21 @@ var cmdFind = &cobra.Command{
 	Long: `
 The "find" command searches for files or directories in snapshots stored in the
 repo.
-It can also be used to search for restic blobs or trees for troubleshooting.`,
+It can also be used to search for restic blobs or trees for troubleshooting.
+
+With --content, the content of the files whose names match the patterns is
+searched for lines which match a regular expression. If no pattern is given,
+all files are searched. Files with the same content are only searched once,
+even if they are contained in several snapshots.
+
+With --local-file, the files in the snapshots which have the same content as a
+local file are listed, regardless of their names. The local file is split into
+blobs like during a backup. With --partial, files which share at least one blob
+with the local file are listed as well.`,
 	Example: `restic find config.json
 restic find --json "*.yml" "*.json"
+restic find --content "token=[0-9a-f]+" "*.conf"
+restic find --local-file /tmp/suspicious.bin --partial
 restic find --json --blob 420f620f b46ebe8a ddd38656
 restic find --show-pack-id --blob 420f620f
 restic find --tree 577c2bc9 f81f2e22 a62827a9
@@ -48,6 +66,10 @@ type FindOptions struct {
 	Host               string
 	Paths              []string
 	Tags               restic.TagLists
+	Content            string
+	MaxSize            string
+	LocalFile          string
+	Partial            bool
 }
 
 var findOptions FindOptions
@@ -65,6 +87,10 @@ func init() {
 	f.BoolVar(&findOptions.ShowPackID, "show-pack-id", false, "display the pack-ID the blobs belong to (with --blob)")
 	f.BoolVarP(&findOptions.CaseInsensitive, "ignore-case", "i", false, "ignore case for pattern")
 	f.BoolVarP(&findOptions.ListLong, "long", "l", false, "use a long listing format showing size and mode")
+	f.StringVar(&findOptions.Content, "content", "", "search the content of files for lines matching the regular expression `regex`")
+	f.StringVar(&findOptions.LocalFile, "local-file", "", "find files with the same content as the local `file`")
+	f.BoolVar(&findOptions.Partial, "partial", false, "with --local-file, also find files which share some of the content")
+	f.StringVar(&findOptions.MaxSize, "max-size", "", "with --content, only search files up to `size` (allowed suffixes: k/K, m/M, g/G, t/T)")
 
 	f.StringVarP(&findOptions.Host, "host", "H", "", "only consider snapshots for this `host`, when no snapshot ID is given")
 	f.Var(&findOptions.Tags, "tag", "only consider snapshots which include this `taglist`, when no snapshot-ID is given")
@@ -110,12 +136,13 @@ type statefulOutput struct {
 	hits     int
 }
 
-func (s *statefulOutput) PrintPatternJSON(path string, node *restic.Node) {
+func (s *statefulOutput) PrintPatternJSON(path string, node *restic.Node, match *findMatch) {
 	type findNode restic.Node
 	b, err := json.Marshal(struct {
 		// Add these attributes
 		Path        string `json:"path,omitempty"`
 		Permissions string `json:"permissions,omitempty"`
+		*findMatch
 
 		*findNode
 
@@ -129,6 +156,7 @@ func (s *statefulOutput) PrintPatternJSON(path string, node *restic.Node) {
 	}{
 		Path:        path,
 		Permissions: node.Mode.String(),
+		findMatch:   match,
 		findNode:    (*findNode)(node),
 	})
 	if err != nil {
@@ -154,7 +182,7 @@ func (s *statefulOutput) PrintPatternJSON(path string, node *restic.Node) {
 	s.hits++
 }
 
-func (s *statefulOutput) PrintPatternNormal(path string, node *restic.Node) {
+func (s *statefulOutput) PrintPatternNormal(path string, node *restic.Node, match *findMatch) {
 	if s.newsn != s.oldsn {
 		if s.oldsn != nil {
 			Verbosef("\n")
@@ -163,13 +191,23 @@ func (s *statefulOutput) PrintPatternNormal(path string, node *restic.Node) {
 		Verbosef("Found matching entries in snapshot %s\n", s.oldsn.ID().Str())
 	}
 	Printf(formatNode(path, node, s.ListLong) + "\n")
+	if match == nil {
+		return
+	}
+
+	for _, l := range match.Lines {
+		Printf("    %d: %s\n", l.Line, l.Text)
+	}
+	if match.SharedBlobs > 0 {
+		Printf("    shares %d of %d blobs (%s)\n", match.SharedBlobs, match.LocalBlobs, formatBytes(match.SharedBytes))
+	}
 }
 
-func (s *statefulOutput) PrintPattern(path string, node *restic.Node) {
+func (s *statefulOutput) PrintPattern(path string, node *restic.Node, match *findMatch) {
 	if s.JSON {
-		s.PrintPatternJSON(path, node)
+		s.PrintPatternJSON(path, node, match)
 	} else {
-		s.PrintPatternNormal(path, node)
+		s.PrintPatternNormal(path, node, match)
 	}
 }
 
@@ -248,6 +286,141 @@ type Finder struct {
 	blobIDs     map[string]struct{}
 	treeIDs     map[string]struct{}
 	itemsFound  int
+
+	// content and maxSize are set for --content, the matching lines are
+	// cached by the ID of the file content.
+	content      *regexp.Regexp
+	maxSize      uint64
+	contentCache map[restic.ID][]contentLine
+
+	// local contains the blobs of the file given with --local-file.
+	local *localContent
+}
+
+// findMatch contains details about a match for --content or --local-file.
+type findMatch struct {
+	// Lines are the lines which match --content.
+	Lines []contentLine `json:"lines,omitempty"`
+
+	// SharedBlobs and SharedBytes are set for --local-file with --partial
+	// and describe the blobs which the file has in common with the local
+	// file, which consists of LocalBlobs blobs.
+	SharedBlobs int    `json:"shared_blobs,omitempty"`
+	SharedBytes uint64 `json:"shared_bytes,omitempty"`
+	LocalBlobs  int    `json:"local_blobs,omitempty"`
+}
+
+// localContent is the content of the file given with --local-file.
+type localContent struct {
+	content restic.IDs
+	sizes   map[restic.ID]uint
+	partial bool
+}
+
+// loadLocalContent splits the local file filename into blobs.
+func loadLocalContent(ctx context.Context, repo restic.Repository, filename string, partial bool) (*localContent, error) {
+	f, err := fs.Open(filename)
+	if err != nil {
+		return nil, errors.Fatalf("unable to open %v: %v", filename, err)
+	}
+	defer f.Close()
+
+	content, sizes, err := splitContent(ctx, f, repo.Config().ChunkerPolynomial)
+	if err != nil {
+		return nil, errors.Fatalf("unable to read %v: %v", filename, err)
+	}
+
+	if len(content) == 0 {
+		return nil, errors.Fatalf("%v is empty", filename)
+	}
+
+	return &localContent{content: content, sizes: sizes, partial: partial}, nil
+}
+
+// match returns the details for node if it has the same content as the local
+// file or, with partial, shares blobs with it. It returns nil otherwise.
+func (l *localContent) match(node *restic.Node) *findMatch {
+	if node.Type != "file" {
+		return nil
+	}
+
+	if reflect.DeepEqual(node.Content, l.content) {
+		if !l.partial {
+			return &findMatch{}
+		}
+	} else if !l.partial {
+		return nil
+	}
+
+	m := &findMatch{LocalBlobs: len(l.sizes)}
+	for _, id := range restic.NewIDSet(node.Content...).List() {
+		if size, ok := l.sizes[id]; ok {
+			m.SharedBlobs++
+			m.SharedBytes += uint64(size)
+		}
+	}
+
+	if m.SharedBlobs == 0 {
+		return nil
+	}
+	return m
+}
+
+// contentLine is a line in a file which matches --content.
+type contentLine struct {
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// maxContentLine is the maximum length of a line which is matched against
+// --content, the remainder of longer lines is ignored.
+const maxContentLine = 64 * 1024
+
+// searchContent returns the lines in the file node which match f.content.
+func (f *Finder) searchContent(ctx context.Context, node *restic.Node) ([]contentLine, error) {
+	id := nodeContentID(node)
+	if lines, ok := f.contentCache[id]; ok {
+		return lines, nil
+	}
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+
+	go func() {
+		pw.CloseWithError(dump.WriteNodeData(ctx, pw, f.repo, node))
+	}()
+
+	var lines []contentLine
+	rd := bufio.NewReader(pr)
+	var line []byte
+	for nr := 1; ; {
+		part, isPrefix, err := rd.ReadLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if n := maxContentLine - len(line); n > 0 {
+			if len(part) > n {
+				part = part[:n]
+			}
+			line = append(line, part...)
+		}
+		if isPrefix {
+			continue
+		}
+
+		if f.content.Match(line) {
+			lines = append(lines, contentLine{Line: nr, Text: string(line)})
+		}
+		line = line[:0]
+		nr++
+	}
+
+	f.contentCache[id] = lines
+	return lines, nil
 }
 
 func (f *Finder) findInSnapshot(ctx context.Context, sn *restic.Snapshot) error {
@@ -324,8 +497,35 @@ func (f *Finder) findInSnapshot(ctx context.Context, sn *restic.Snapshot) error
 			return ignoreIfNoMatch, errIfNoMatch
 		}
 
+		var match *findMatch
+		if f.local != nil {
+			match = f.local.match(node)
+			if match == nil {
+				return ignoreIfNoMatch, errIfNoMatch
+			}
+		}
+
+		if f.content != nil {
+			if node.Type != "file" || (f.maxSize > 0 && node.Size > f.maxSize) {
+				return ignoreIfNoMatch, errIfNoMatch
+			}
+
+			lines, err := f.searchContent(ctx, node)
+			if err != nil {
+				Warnf("unable to search %v: %v\n", nodepath, err)
+			}
+			if len(lines) == 0 {
+				return ignoreIfNoMatch, errIfNoMatch
+			}
+
+			if match == nil {
+				match = &findMatch{}
+			}
+			match.Lines = lines
+		}
+
 		debug.Log("    found match\n")
-		f.out.PrintPattern(nodepath, node)
+		f.out.PrintPattern(nodepath, node, match)
 		return false, nil
 	})
 }
@@ -468,7 +668,11 @@ func (f *Finder) findBlobsPacks(ctx context.Context) {
 
 func runFind(opts FindOptions, gopts GlobalOptions, args []string) error {
 	if len(args) == 0 {
-		return errors.Fatal("wrong number of arguments")
+		if opts.Content == "" && opts.LocalFile == "" {
+			return errors.Fatal("wrong number of arguments")
+		}
+		// search the content of all files
+		args = []string{"*"}
 	}
 
 	var err error
@@ -500,6 +704,42 @@ func runFind(opts FindOptions, gopts GlobalOptions, args []string) error {
 		return errors.Fatal("cannot have several ID types")
 	}
 
+	var content *regexp.Regexp
+	if opts.Content != "" {
+		if opts.BlobID || opts.TreeID || opts.PackID {
+			return errors.Fatal("--content cannot be used together with --blob, --tree or --pack")
+		}
+
+		expr := opts.Content
+		if opts.CaseInsensitive {
+			expr = "(?i)" + expr
+		}
+		if content, err = regexp.Compile(expr); err != nil {
+			return errors.Fatalf("invalid regular expression for --content: %v", err)
+		}
+	}
+
+	if opts.LocalFile != "" && (opts.BlobID || opts.TreeID || opts.PackID) {
+		return errors.Fatal("--local-file cannot be used together with --blob, --tree or --pack")
+	}
+
+	if opts.Partial && opts.LocalFile == "" {
+		return errors.Fatal("--partial can only be used together with --local-file")
+	}
+
+	var maxSize uint64
+	if opts.MaxSize != "" {
+		if opts.Content == "" {
+			return errors.Fatal("--max-size can only be used together with --content")
+		}
+
+		size, err := parseSizeStr(opts.MaxSize)
+		if err != nil {
+			return errors.Fatal(err.Error())
+		}
+		maxSize = uint64(size)
+	}
+
 	repo, err := OpenRepository(gopts)
 	if err != nil {
 		return err
@@ -525,6 +765,17 @@ func runFind(opts FindOptions, gopts GlobalOptions, args []string) error {
 		pat:         pat,
 		out:         statefulOutput{ListLong: opts.ListLong, JSON: globalOptions.JSON},
 		ignoreTrees: restic.NewIDSet(),
+
+		content:      content,
+		maxSize:      maxSize,
+		contentCache: make(map[restic.ID][]contentLine),
+	}
+
+	if opts.LocalFile != "" {
+		f.local, err = loadLocalContent(ctx, repo, opts.LocalFile, opts.Partial)
+		if err != nil {
+			return err
+		}
 	}
 
 	if opts.BlobID {
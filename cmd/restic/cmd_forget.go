@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"sort"
 	"strings"
 
@@ -20,6 +21,7 @@ this command really only deletes the snapshot object in the repository, which
 is a reference to data stored there. In order to remove this (now unreferenced)
 data after 'forget' was run successfully, see the 'prune' command. `,
 	DisableAutoGenTag: true,
+	Annotations:       map[string]string{annotationJSONMessagesToStderr: ""},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return runForget(forgetOptions, globalOptions, args)
 	},
@@ -27,14 +29,19 @@ data after 'forget' was run successfully, see the 'prune' command. `,
 
 // ForgetOptions collects all options for the forget command.
 type ForgetOptions struct {
-	Last     int
-	Hourly   int
-	Daily    int
-	Weekly   int
-	Monthly  int
-	Yearly   int
-	Within   restic.Duration
-	KeepTags restic.TagLists
+	Last          int
+	Hourly        int
+	Daily         int
+	Weekly        int
+	Monthly       int
+	Yearly        int
+	Within        restic.Duration
+	WithinHourly  restic.Duration
+	WithinDaily   restic.Duration
+	WithinWeekly  restic.Duration
+	WithinMonthly restic.Duration
+	WithinYearly  restic.Duration
+	KeepTags      restic.TagLists
 
 	Host    string
 	Tags    restic.TagLists
@@ -60,6 +67,11 @@ func init() {
 	f.IntVarP(&forgetOptions.Monthly, "keep-monthly", "m", 0, "keep the last `n` monthly snapshots")
 	f.IntVarP(&forgetOptions.Yearly, "keep-yearly", "y", 0, "keep the last `n` yearly snapshots")
 	f.VarP(&forgetOptions.Within, "keep-within", "", "keep snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.VarP(&forgetOptions.WithinHourly, "keep-within-hourly", "", "keep hourly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.VarP(&forgetOptions.WithinDaily, "keep-within-daily", "", "keep daily snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.VarP(&forgetOptions.WithinWeekly, "keep-within-weekly", "", "keep weekly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.VarP(&forgetOptions.WithinMonthly, "keep-within-monthly", "", "keep monthly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.VarP(&forgetOptions.WithinYearly, "keep-within-yearly", "", "keep yearly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
 
 	f.Var(&forgetOptions.KeepTags, "keep-tag", "keep snapshots with this `taglist` (can be specified multiple times)")
 	f.StringVar(&forgetOptions.Host, "host", "", "only consider snapshots with the given `host`")
@@ -74,11 +86,18 @@ func init() {
 	f.StringVarP(&forgetOptions.GroupBy, "group-by", "g", "host,paths", "string for grouping snapshots by host,paths,tags")
 	f.BoolVarP(&forgetOptions.DryRun, "dry-run", "n", false, "do not delete anything, just print what would be done")
 	f.BoolVar(&forgetOptions.Prune, "prune", false, "automatically run the 'prune' command if snapshots have been removed")
+	addPruneOptions(cmdForget)
 
 	f.SortFlags = false
 }
 
 func runForget(opts ForgetOptions, gopts GlobalOptions, args []string) error {
+	if opts.Prune {
+		if err := verifyPruneOptions(&pruneOptions); err != nil {
+			return err
+		}
+	}
+
 	repo, err := OpenRepository(gopts)
 	if err != nil {
 		return err
@@ -120,6 +139,8 @@ func runForget(opts ForgetOptions, gopts GlobalOptions, args []string) error {
 	}
 
 	removeSnapshots := 0
+	var jsonGroups []ForgetGroup
+	var removeByID restic.Snapshots
 
 	ctx, cancel := context.WithCancel(gopts.ctx)
 	defer cancel()
@@ -136,6 +157,7 @@ func runForget(opts ForgetOptions, gopts GlobalOptions, args []string) error {
 			} else {
 				Verbosef("would have removed snapshot %v\n", sn.ID().Str())
 			}
+			removeByID = append(removeByID, sn)
 		} else {
 			// Determining grouping-keys
 			var tags []string
@@ -167,14 +189,19 @@ func runForget(opts ForgetOptions, gopts GlobalOptions, args []string) error {
 	}
 
 	policy := restic.ExpirePolicy{
-		Last:    opts.Last,
-		Hourly:  opts.Hourly,
-		Daily:   opts.Daily,
-		Weekly:  opts.Weekly,
-		Monthly: opts.Monthly,
-		Yearly:  opts.Yearly,
-		Within:  opts.Within,
-		Tags:    opts.KeepTags,
+		Last:          opts.Last,
+		Hourly:        opts.Hourly,
+		Daily:         opts.Daily,
+		Weekly:        opts.Weekly,
+		Monthly:       opts.Monthly,
+		Yearly:        opts.Yearly,
+		Within:        opts.Within,
+		WithinHourly:  opts.WithinHourly,
+		WithinDaily:   opts.WithinDaily,
+		WithinWeekly:  opts.WithinWeekly,
+		WithinMonthly: opts.WithinMonthly,
+		WithinYearly:  opts.WithinYearly,
+		Tags:          opts.KeepTags,
 	}
 
 	if policy.Empty() && len(args) == 0 {
@@ -209,13 +236,17 @@ func runForget(opts ForgetOptions, gopts GlobalOptions, args []string) error {
 
 			keep, remove, reasons := restic.ApplyPolicy(snapshotGroup, policy)
 
-			if len(keep) != 0 && !gopts.Quiet {
+			if gopts.JSON {
+				jsonGroups = append(jsonGroups, newForgetGroup(key.Hostname, key.Paths, key.Tags, keep, remove, reasons))
+			}
+
+			if len(keep) != 0 && !gopts.Quiet && !gopts.JSON {
 				Printf("keep %d snapshots:\n", len(keep))
 				PrintSnapshots(globalOptions.stdout, keep, reasons, opts.Compact)
 				Printf("\n")
 			}
 
-			if len(remove) != 0 && !gopts.Quiet {
+			if len(remove) != 0 && !gopts.Quiet && !gopts.JSON {
 				Printf("remove %d snapshots:\n", len(remove))
 				PrintSnapshots(globalOptions.stdout, remove, nil, opts.Compact)
 				Printf("\n")
@@ -235,12 +266,91 @@ func runForget(opts ForgetOptions, gopts GlobalOptions, args []string) error {
 		}
 	}
 
+	var pruneSummary *pruneJSON
 	if removeSnapshots > 0 && opts.Prune {
 		Verbosef("%d snapshots have been removed, running prune\n", removeSnapshots)
 		if !opts.DryRun {
-			return pruneRepository(gopts, repo)
+			pruneSummary, err = pruneRepositorySummary(pruneOptions, gopts, repo)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
+	if gopts.JSON {
+		return printForgetJSON(gopts.stdout, jsonGroups, removeByID, pruneSummary)
+	}
 	return nil
 }
+
+// ForgetGroup is the JSON representation of a group of snapshots and the
+// result of applying the policy to it.
+type ForgetGroup struct {
+	Tags    []string     `json:"tags"`
+	Host    string       `json:"host"`
+	Paths   []string     `json:"paths"`
+	Keep    []Snapshot   `json:"keep"`
+	Remove  []Snapshot   `json:"remove"`
+	Reasons []KeepReason `json:"reasons"`
+}
+
+// KeepReason is the JSON representation of the reason a snapshot was kept.
+type KeepReason struct {
+	Snapshot Snapshot `json:"snapshot"`
+	Matches  []string `json:"matches"`
+}
+
+func asJSONSnapshots(list restic.Snapshots) []Snapshot {
+	snapshots := []Snapshot{}
+	for _, sn := range list {
+		snapshots = append(snapshots, Snapshot{
+			Snapshot: sn,
+			ID:       sn.ID(),
+			ShortID:  sn.ID().Str(),
+		})
+	}
+	return snapshots
+}
+
+func newForgetGroup(host string, paths, tags []string, keep, remove restic.Snapshots, reasons []restic.KeepReason) ForgetGroup {
+	group := ForgetGroup{
+		Tags:    tags,
+		Host:    host,
+		Paths:   paths,
+		Keep:    asJSONSnapshots(keep),
+		Remove:  asJSONSnapshots(remove),
+		Reasons: []KeepReason{},
+	}
+
+	for _, r := range reasons {
+		group.Reasons = append(group.Reasons, KeepReason{
+			Snapshot: Snapshot{Snapshot: r.Snapshot, ID: r.Snapshot.ID(), ShortID: r.Snapshot.ID().Str()},
+			Matches:  r.Matches,
+		})
+	}
+
+	return group
+}
+
+// forgetJSON is printed by forget when --json is set.
+type forgetJSON struct {
+	Groups     []ForgetGroup `json:"groups"`
+	Remove     []Snapshot    `json:"remove"`
+	Prune      *pruneJSON    `json:"prune,omitempty"`
+	StructType string        `json:"struct_type"` // "forget"
+}
+
+// printForgetJSON writes the groups, the snapshots removed by ID and the
+// summary of prune to stdout as a single object. The summary is nil when
+// prune did not run.
+func printForgetJSON(stdout io.Writer, groups []ForgetGroup, removeByID restic.Snapshots, summary *pruneJSON) error {
+	if groups == nil {
+		groups = []ForgetGroup{}
+	}
+	return json.NewEncoder(stdout).Encode(forgetJSON{
+		Groups:     groups,
+		Remove:     asJSONSnapshots(removeByID),
+		Prune:      summary,
+		StructType: "forget",
+	})
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	tomb "gopkg.in/tomb.v2"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/table"
+	"github.com/restic/restic/internal/ui/termstatus"
+	"github.com/restic/restic/internal/walker"
+)
+
+var cmdHistory = &cobra.Command{
+	Use:   "history [flags] path",
+	Short: "List all versions of a file or directory",
+	Long: `
+The "history" command lists the distinct versions of a file or directory in
+all snapshots, together with the first and the last snapshot in which each
+version was seen. The path must be absolute and use the forward slash '/' as
+separator, like for the "ls" command. The path "/" stands for the root
+directory of the snapshots.
+
+Two versions are identical when they have the same content, the content ID is
+computed from the list of blobs for files, the tree for directories and the
+target of symlinks.
+
+With --restore-version N, version N is restored to the directory given with
+--target from the latest snapshot which contains it, instead of listing the
+versions.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var t tomb.Tomb
+		term := termstatus.New(globalOptions.stdout, globalOptions.stderr, globalOptions.Quiet)
+		t.Go(func() error { term.Run(t.Context(globalOptions.ctx)); return nil })
+
+		err := runHistory(historyOptions, globalOptions, term, args)
+		if err != nil {
+			return err
+		}
+		t.Kill(nil)
+		return t.Wait()
+	},
+}
+
+// HistoryOptions collects all options for the history command.
+type HistoryOptions struct {
+	Host           string
+	Tags           restic.TagLists
+	Paths          []string
+	RestoreVersion int
+	Target         string
+}
+
+var historyOptions HistoryOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdHistory)
+
+	flags := cmdHistory.Flags()
+	flags.StringVarP(&historyOptions.Host, "host", "H", "", "only consider snapshots for this `host`")
+	flags.Var(&historyOptions.Tags, "tag", "only consider snapshots which include this `taglist`")
+	flags.StringArrayVar(&historyOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`")
+	flags.IntVar(&historyOptions.RestoreVersion, "restore-version", 0, "restore version `n` instead of listing the versions")
+	flags.StringVarP(&historyOptions.Target, "target", "t", "", "directory to restore the version to")
+}
+
+// historyVersion is one version of the item, it is printed as JSON when
+// --json is set.
+type historyVersion struct {
+	Version       int        `json:"version"`
+	Type          string     `json:"type"`
+	Size          uint64     `json:"size"`
+	ModTime       time.Time  `json:"mtime"`
+	ContentID     restic.ID  `json:"content_id"`
+	FirstSnapshot *restic.ID `json:"first_snapshot"`
+	FirstTime     time.Time  `json:"first_time"`
+	LastSnapshot  *restic.ID `json:"last_snapshot"`
+	LastTime      time.Time  `json:"last_time"`
+	Snapshots     int        `json:"snapshots"`
+	StructType    string     `json:"struct_type"` // "version"
+}
+
+// historyKey identifies a version of the item.
+type historyKey struct {
+	Type      string
+	ContentID restic.ID
+}
+
+// nodeContentID returns an ID for the content of node: the hash of the
+// blob IDs for files, the tree for directories and the hash of the link
+// target for symlinks.
+func nodeContentID(node *restic.Node) restic.ID {
+	switch node.Type {
+	case "file":
+		buf := make([]byte, 0, len(node.Content)*len(restic.ID{}))
+		for _, id := range node.Content {
+			buf = append(buf, id[:]...)
+		}
+		return restic.Hash(buf)
+	case "dir":
+		if node.Subtree != nil {
+			return *node.Subtree
+		}
+	case "symlink":
+		return restic.Hash([]byte(node.LinkTarget))
+	}
+
+	return restic.Hash(nil)
+}
+
+// findNode returns the node at p in the snapshot sn, or nil if there is no
+// such item.
+func findNode(ctx context.Context, repo restic.Repository, sn *restic.Snapshot, p string) (*restic.Node, error) {
+	if p == "/" {
+		// the root directory has no node of its own
+		return &restic.Node{Name: "/", Type: "dir", ModTime: sn.Time, Subtree: sn.Tree}, nil
+	}
+
+	var found *restic.Node
+
+	err := walker.Walk(ctx, repo, *sn.Tree, nil, func(_ restic.ID, nodepath string, node *restic.Node, err error) (bool, error) {
+		if err != nil {
+			return false, err
+		}
+		if node == nil {
+			return false, nil
+		}
+
+		if nodepath == p {
+			found = node
+			return false, walker.SkipNode
+		}
+
+		// descend into the directories which contain the item
+		if node.Type == "dir" && !fs.HasPathPrefix(nodepath, p) {
+			return false, walker.SkipNode
+		}
+		return false, nil
+	})
+
+	return found, err
+}
+
+// escapePattern returns a pattern for the filter package which only matches
+// the path p, the special characters '*', '?', '[' and '\\' in p are matched
+// literally.
+func escapePattern(p string) string {
+	var buf strings.Builder
+	for _, c := range p {
+		switch c {
+		case '*', '?', '[':
+			buf.WriteString("[" + string(c) + "]")
+		case '\\':
+			if filepath.Separator == '/' {
+				buf.WriteString(`\\`)
+			} else {
+				buf.WriteRune(c)
+			}
+		default:
+			buf.WriteRune(c)
+		}
+	}
+	return buf.String()
+}
+
+func runHistory(opts HistoryOptions, gopts GlobalOptions, term *termstatus.Terminal, args []string) error {
+	if len(args) != 1 {
+		return errors.Fatal("specify the path of one file or directory")
+	}
+
+	p := args[0]
+	if !strings.HasPrefix(p, "/") {
+		return errors.Fatal("the path must be absolute, starting with a forward slash '/'")
+	}
+	if p != "/" {
+		p = strings.TrimSuffix(p, "/")
+	}
+
+	if opts.RestoreVersion < 0 {
+		return errors.Fatal("--restore-version must not be negative")
+	}
+	if opts.RestoreVersion > 0 && opts.Target == "" {
+		return errors.Fatal("please specify a directory to restore to (--target)")
+	}
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		lock, err := lockRepo(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = repo.LoadIndex(gopts.ctx); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	var snapshots restic.Snapshots
+	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, nil) {
+		snapshots = append(snapshots, sn)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+
+	var versions []*historyVersion
+	index := make(map[historyKey]*historyVersion)
+	for _, sn := range snapshots {
+		if sn.Tree == nil {
+			Warnf("snapshot %v has nil tree\n", sn.ID().Str())
+			continue
+		}
+
+		node, err := findNode(ctx, repo, sn, p)
+		if err != nil {
+			return err
+		}
+		if node == nil {
+			continue
+		}
+
+		key := historyKey{Type: node.Type, ContentID: nodeContentID(node)}
+		v, ok := index[key]
+		if !ok {
+			v = &historyVersion{
+				Version:       len(versions) + 1,
+				Type:          node.Type,
+				Size:          node.Size,
+				ModTime:       node.ModTime,
+				ContentID:     key.ContentID,
+				FirstSnapshot: sn.ID(),
+				FirstTime:     sn.Time,
+				StructType:    "version",
+			}
+			index[key] = v
+			versions = append(versions, v)
+		}
+
+		v.LastSnapshot = sn.ID()
+		v.LastTime = sn.Time
+		v.Snapshots++
+	}
+
+	if opts.RestoreVersion > 0 {
+		if opts.RestoreVersion > len(versions) {
+			return errors.Fatalf("version %d of %v not found, there are %d versions", opts.RestoreVersion, p, len(versions))
+		}
+
+		v := versions[opts.RestoreVersion-1]
+		restoreOpts := RestoreOptions{
+			Target: opts.Target,
+		}
+		if p != "/" {
+			restoreOpts.Include = []string{escapePattern(p)}
+		}
+		return runRestore(restoreOpts, gopts, term, []string{v.LastSnapshot.String()})
+	}
+
+	if gopts.JSON {
+		enc := json.NewEncoder(gopts.stdout)
+		for _, v := range versions {
+			err := enc.Encode(v)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tab := table.New()
+	tab.AddColumn("Version", "{{ .Version }}")
+	tab.AddColumn("First seen", "{{ .First }}")
+	tab.AddColumn("Last seen", "{{ .Last }}")
+	tab.AddColumn("Snapshots", "{{ .Snapshots }}")
+	tab.AddColumn("Type", "{{ .Type }}")
+	tab.AddColumn("Size", "{{ .Size }}")
+	tab.AddColumn("Modified", "{{ .ModTime }}")
+	tab.AddColumn("Content", "{{ .ContentID }}")
+
+	type version struct {
+		Version   int
+		First     string
+		Last      string
+		Snapshots int
+		Type      string
+		Size      string
+		ModTime   string
+		ContentID string
+	}
+
+	for _, v := range versions {
+		tab.AddRow(version{
+			Version:   v.Version,
+			First:     fmt.Sprintf("%s %s", v.FirstSnapshot.Str(), v.FirstTime.Local().Format(TimeFormat)),
+			Last:      fmt.Sprintf("%s %s", v.LastSnapshot.Str(), v.LastTime.Local().Format(TimeFormat)),
+			Snapshots: v.Snapshots,
+			Type:      v.Type,
+			Size:      formatBytes(v.Size),
+			ModTime:   v.ModTime.Local().Format(TimeFormat),
+			ContentID: v.ContentID.Str(),
+		})
+	}
+
+	tab.AddFooter(fmt.Sprintf("%d versions of %s in %d snapshots", len(versions), p, len(snapshots)))
+
+	return tab.Write(gopts.stdout)
+}
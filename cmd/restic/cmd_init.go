@@ -1,8 +1,12 @@
 package main
 
 import (
+	"encoding/json"
+	"strconv"
+
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
 
 	"github.com/spf13/cobra"
 )
@@ -14,20 +18,62 @@ var cmdInit = &cobra.Command{
 The "init" command initializes a new repository.
 `,
 	DisableAutoGenTag: true,
+	Annotations:       map[string]string{annotationJSONMessagesToStderr: ""},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runInit(globalOptions, args)
+		return runInit(initOptions, globalOptions, args)
 	},
 }
 
+// InitOptions bundles all options for the init command.
+type InitOptions struct {
+	RepositoryVersion string
+}
+
+var initOptions InitOptions
+
+// initJSON is printed when a repository was created and --json is set.
+type initJSON struct {
+	ID         string `json:"id"`
+	Repository string `json:"repository"`
+	Version    uint   `json:"version"`
+	StructType string `json:"struct_type"` // "initialized"
+}
+
 func init() {
 	cmdRoot.AddCommand(cmdInit)
+
+	f := cmdInit.Flags()
+	f.StringVar(&initOptions.RepositoryVersion, "repository-version", "stable", "repository format version to use, allowed values are a format version, 'stable' and 'latest'")
 }
 
-func runInit(gopts GlobalOptions, args []string) error {
+// parseRepositoryVersion returns the repository version selected by s.
+func parseRepositoryVersion(s string) (uint, error) {
+	switch s {
+	case "", "stable":
+		return restic.RepoVersion, nil
+	case "latest":
+		return restic.MaxRepoVersion, nil
+	}
+
+	v, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || v < restic.MinRepoVersion || v > restic.MaxRepoVersion {
+		return 0, errors.Fatalf("unsupported repository version %q, must be between %d and %d, 'stable' or 'latest'",
+			s, restic.MinRepoVersion, restic.MaxRepoVersion)
+	}
+
+	return uint(v), nil
+}
+
+func runInit(opts InitOptions, gopts GlobalOptions, args []string) error {
 	if gopts.Repo == "" {
 		return errors.Fatal("Please specify repository location (-r)")
 	}
 
+	version, err := parseRepositoryVersion(opts.RepositoryVersion)
+	if err != nil {
+		return err
+	}
+
 	be, err := create(gopts.Repo, gopts.extended)
 	if err != nil {
 		return errors.Fatalf("create repository at %s failed: %v\n", gopts.Repo, err)
@@ -42,11 +88,20 @@ func runInit(gopts GlobalOptions, args []string) error {
 
 	s := repository.New(be)
 
-	err = s.Init(gopts.ctx, gopts.password)
+	err = s.Init(gopts.ctx, version, gopts.password)
 	if err != nil {
 		return errors.Fatalf("create key in repository at %s failed: %v\n", gopts.Repo, err)
 	}
 
+	if gopts.JSON {
+		return json.NewEncoder(gopts.stdout).Encode(initJSON{
+			ID:         s.Config().ID,
+			Repository: gopts.Repo,
+			Version:    s.Config().Version,
+			StructType: "initialized",
+		})
+	}
+
 	Verbosef("created restic repository %v at %s\n", s.Config().ID[:10], gopts.Repo)
 	Verbosef("\n")
 	Verbosef("Please note that knowledge of your password is required to access\n")
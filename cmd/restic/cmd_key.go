@@ -20,6 +20,12 @@ var cmdKey = &cobra.Command{
 	Short: "Manage keys (passwords)",
 	Long: `
 The "key" command manages keys (passwords) for accessing the repository.
+
+Each key has a role which restricts the modifications it permits: "full" keys
+permit everything, "append-only" keys permit adding data but not removing it,
+and "read-only" keys only permit reading data. A key can only add keys which
+are at least as restrictive as itself. Changing passwords and removing keys
+requires a key with full access.
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -28,12 +34,14 @@ The "key" command manages keys (passwords) for accessing the repository.
 }
 
 var newPasswordFile string
+var newKeyRole string
 
 func init() {
 	cmdRoot.AddCommand(cmdKey)
 
 	flags := cmdKey.Flags()
 	flags.StringVarP(&newPasswordFile, "new-password-file", "", "", "the file from which to load a new password")
+	flags.StringVarP(&newKeyRole, "role", "", "", "the `role` of the new key: full, append-only or read-only (default: role of the current key)")
 }
 
 func listKeys(ctx context.Context, s *repository.Repository, gopts GlobalOptions) error {
@@ -43,6 +51,7 @@ func listKeys(ctx context.Context, s *repository.Repository, gopts GlobalOptions
 		UserName string `json:"userName"`
 		HostName string `json:"hostName"`
 		Created  string `json:"created"`
+		Role     string `json:"role"`
 	}
 
 	var keys []keyInfo
@@ -60,6 +69,7 @@ func listKeys(ctx context.Context, s *repository.Repository, gopts GlobalOptions
 			UserName: k.Username,
 			HostName: k.Hostname,
 			Created:  k.Created.Local().Format(TimeFormat),
+			Role:     string(k.KeyRole()),
 		}
 
 		keys = append(keys, key)
@@ -79,6 +89,7 @@ func listKeys(ctx context.Context, s *repository.Repository, gopts GlobalOptions
 	tab.AddColumn("User", "{{ .UserName }}")
 	tab.AddColumn("Host", "{{ .HostName }}")
 	tab.AddColumn("Created", "{{ .Created }}")
+	tab.AddColumn("Role", "{{ .Role }}")
 
 	for _, key := range keys {
 		tab.AddRow(key)
@@ -109,13 +120,37 @@ func getNewPassword(gopts GlobalOptions) (string, error) {
 		"enter password again: ")
 }
 
+// getNewKeyRole returns the role for a new key, which must not permit more
+// than the role of the current key. If no role was specified, def is used.
+func getNewKeyRole(repo *repository.Repository, def repository.KeyRole) (repository.KeyRole, error) {
+	if newKeyRole == "" {
+		return def, nil
+	}
+
+	role, err := repository.ParseKeyRole(newKeyRole)
+	if err != nil {
+		return "", err
+	}
+
+	if !repo.KeyRole().Permits(role) {
+		return "", errors.Fatalf("a %v key cannot create a %v key", repo.KeyRole(), role)
+	}
+
+	return role, nil
+}
+
 func addKey(gopts GlobalOptions, repo *repository.Repository) error {
+	role, err := getNewKeyRole(repo, repo.KeyRole())
+	if err != nil {
+		return err
+	}
+
 	pw, err := getNewPassword(gopts)
 	if err != nil {
 		return err
 	}
 
-	id, err := repository.AddKey(gopts.ctx, repo, pw, repo.Key())
+	id, err := repository.AddKey(gopts.ctx, repo, pw, role, repo.Key())
 	if err != nil {
 		return errors.Fatalf("creating new key failed: %v\n", err)
 	}
@@ -141,12 +176,17 @@ func deleteKey(ctx context.Context, repo *repository.Repository, name string) er
 }
 
 func changePassword(gopts GlobalOptions, repo *repository.Repository) error {
+	role, err := getNewKeyRole(repo, repo.KeyRole())
+	if err != nil {
+		return err
+	}
+
 	pw, err := getNewPassword(gopts)
 	if err != nil {
 		return err
 	}
 
-	id, err := repository.AddKey(gopts.ctx, repo, pw, repo.Key())
+	id, err := repository.AddKey(gopts.ctx, repo, pw, role, repo.Key())
 	if err != nil {
 		return errors.Fatalf("creating new key failed: %v\n", err)
 	}
@@ -193,6 +233,10 @@ func runKey(gopts GlobalOptions, args []string) error {
 
 		return addKey(gopts, repo)
 	case "remove":
+		if repo.KeyRole() != repository.KeyRoleFull {
+			return errors.Fatalf("removing keys is not permitted with a %v key", repo.KeyRole())
+		}
+
 		lock, err := lockRepoExclusive(repo)
 		defer unlockRepo(lock)
 		if err != nil {
@@ -206,6 +250,10 @@ func runKey(gopts GlobalOptions, args []string) error {
 
 		return deleteKey(gopts.ctx, repo, id)
 	case "passwd":
+		if repo.KeyRole() != repository.KeyRoleFull {
+			return errors.Fatalf("changing the password is not permitted with a %v key", repo.KeyRole())
+		}
+
 		lock, err := lockRepoExclusive(repo)
 		defer unlockRepo(lock)
 		if err != nil {
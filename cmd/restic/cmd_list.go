@@ -11,7 +11,7 @@ import (
 )
 
 var cmdList = &cobra.Command{
-	Use:   "list [blobs|packs|index|snapshots|keys|locks]",
+	Use:   "list [blobs|packs|index|snapshots|keys|locks|pending-delete]",
 	Short: "List objects in the repository",
 	Long: `
 The "list" command allows listing objects in the repository based on type.
@@ -56,6 +56,8 @@ func runList(cmd *cobra.Command, opts GlobalOptions, args []string) error {
 		t = restic.KeyFile
 	case "locks":
 		t = restic.LockFile
+	case "pending-delete":
+		t = restic.PendingDeleteFile
 	case "blobs":
 		idx, err := index.Load(opts.ctx, repo, nil)
 		if err != nil {
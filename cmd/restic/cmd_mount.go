@@ -61,6 +61,9 @@ type MountOptions struct {
 	Tags                 restic.TagLists
 	Paths                []string
 	SnapshotTemplate     string
+	OwnerMode            string
+	UIDMap               string
+	GIDMap               string
 }
 
 var mountOptions MountOptions
@@ -73,6 +76,7 @@ func init() {
 	mountFlags.BoolVar(&mountOptions.AllowRoot, "allow-root", false, "allow root user to access the data in the mounted directory")
 	mountFlags.BoolVar(&mountOptions.AllowOther, "allow-other", false, "allow other users to access the data in the mounted directory")
 	mountFlags.BoolVar(&mountOptions.NoDefaultPermissions, "no-default-permissions", false, "for 'allow-other', ignore Unix permissions and allow users to read all snapshot files")
+	addOwnerFlags(mountFlags, &mountOptions.OwnerMode, &mountOptions.UIDMap, &mountOptions.GIDMap)
 
 	mountFlags.StringVarP(&mountOptions.Host, "host", "H", "", `only consider snapshots for this host`)
 	mountFlags.Var(&mountOptions.Tags, "tag", "only consider snapshots which include this `taglist`")
@@ -85,6 +89,15 @@ func mount(opts MountOptions, gopts GlobalOptions, mountpoint string) error {
 	debug.Log("start mount")
 	defer debug.Log("finish mount")
 
+	if opts.OwnerRoot && opts.OwnerMode != "" && opts.OwnerMode != string(restic.OwnerNumeric) {
+		return errors.Fatal("--owner-root and --owner-mode are mutually exclusive")
+	}
+
+	owners, err := parseOwnerMapper(opts.OwnerMode, opts.UIDMap, opts.GIDMap)
+	if err != nil {
+		return err
+	}
+
 	repo, err := OpenRepository(gopts)
 	if err != nil {
 		return err
@@ -138,6 +151,7 @@ func mount(opts MountOptions, gopts GlobalOptions, mountpoint string) error {
 
 	cfg := fuse.Config{
 		OwnerIsRoot:      opts.OwnerRoot,
+		Owners:           owners,
 		Host:             opts.Host,
 		Tags:             opts.Tags,
 		Paths:            opts.Paths,
@@ -1,7 +1,13 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/restic/restic/internal/debug"
@@ -19,15 +25,125 @@ var cmdPrune = &cobra.Command{
 	Long: `
 The "prune" command checks the repository and removes data that is not
 referenced and therefore not needed any more.
+
+The decision which pack files are removed or repacked is made using the index
+alone. Pack files which only contain unused data are deleted. Pack files which
+contain both used and unused data are repacked, starting with the ones
+containing the most unused data, until the amount of unused data left in the
+repository is below the limit set with --max-unused. The amount of data
+repacked in a single run can be limited with --max-repack-size.
+
+Use --dry-run to only print the plan, including the expected amount of data
+downloaded, uploaded and freed.
+
+With --concurrent, prune does not lock the repository exclusively, so that
+backups can run at the same time. Instead of deleting pack files, it marks them
+for deletion. The marked pack files are only deleted by a later run of prune,
+once the --delete-grace-period has passed and all processes which accessed the
+repository before the pack files were marked have finished. Blobs in marked
+pack files are not used by new backups, and pack files which still contain
+data referenced by a snapshot are not deleted.
+
+Older versions of restic do not record when they refresh their locks, so
+their locks cannot be told apart from stale locks after 30 minutes. Prune
+refuses to run with --concurrent while such a lock exists. Remove it with
+"restic unlock" once the process which created it has finished.
 `,
 	DisableAutoGenTag: true,
+	Annotations:       map[string]string{annotationJSONMessagesToStderr: ""},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runPrune(globalOptions)
+		return runPrune(pruneOptions, globalOptions)
 	},
 }
 
+// PruneOptions collects all options for the prune command.
+type PruneOptions struct {
+	DryRun bool
+
+	MaxUnused      string
+	maxUnusedBytes func(used uint64) (unused uint64) // calculates the number of tolerated unused bytes, according to MaxUnused
+
+	MaxRepackSize  string
+	MaxRepackBytes uint64
+
+	Concurrent        bool
+	DeleteGracePeriod time.Duration
+}
+
+var pruneOptions PruneOptions
+
 func init() {
 	cmdRoot.AddCommand(cmdPrune)
+
+	f := cmdPrune.Flags()
+	f.BoolVarP(&pruneOptions.DryRun, "dry-run", "n", false, "do not modify the repository, just print what would be done")
+	f.BoolVar(&pruneOptions.Concurrent, "concurrent", false, "do not lock the repository exclusively and only mark pack files for deletion, so that backups can run at the same time")
+	f.DurationVar(&pruneOptions.DeleteGracePeriod, "delete-grace-period", 24*time.Hour, "with --concurrent, only delete pack files which were marked for deletion at least this `duration` ago")
+	addPruneOptions(cmdPrune)
+}
+
+// addPruneOptions adds the flags which control how pack files are repacked to c.
+func addPruneOptions(c *cobra.Command) {
+	f := c.Flags()
+	f.StringVar(&pruneOptions.MaxUnused, "max-unused", "5%", "tolerate given `limit` of unused data (absolute value in bytes with suffixes k/K, m/M, g/G, t/T, a value in % or the word 'unlimited')")
+	f.StringVar(&pruneOptions.MaxRepackSize, "max-repack-size", "", "maximum `size` to repack (allowed suffixes: k/K, m/M, g/G, t/T)")
+}
+
+// verifyPruneOptions parses the limits in opts.
+func verifyPruneOptions(opts *PruneOptions) error {
+	if len(opts.MaxRepackSize) > 0 {
+		size, err := parseSizeStr(opts.MaxRepackSize)
+		if err != nil {
+			return errors.Fatalf("invalid value for --max-repack-size: %v", err)
+		}
+		opts.MaxRepackBytes = uint64(size)
+	}
+
+	maxUnused := strings.TrimSpace(opts.MaxUnused)
+	if maxUnused == "" {
+		return errors.Fatalf("invalid value for --max-unused: %q", opts.MaxUnused)
+	}
+
+	// parse MaxUnused either as unlimited, a percentage, or an absolute number of bytes
+	switch {
+	case maxUnused == "unlimited":
+		opts.maxUnusedBytes = func(used uint64) uint64 {
+			return math.MaxUint64
+		}
+
+	case strings.HasSuffix(maxUnused, "%"):
+		maxUnused = strings.TrimSuffix(maxUnused, "%")
+		p, err := strconv.ParseFloat(maxUnused, 64)
+		if err != nil {
+			return errors.Fatalf("invalid percentage %q passed for --max-unused: %v", opts.MaxUnused, err)
+		}
+
+		if p < 0 {
+			return errors.Fatal("percentage for --max-unused must be positive")
+		}
+
+		if p >= 100 {
+			return errors.Fatal("percentage for --max-unused must be below 100%")
+		}
+
+		// the unused data must not exceed p percent of the total size
+		// after pruning, which is used + unused
+		opts.maxUnusedBytes = func(used uint64) uint64 {
+			return uint64(p / (100 - p) * float64(used))
+		}
+
+	default:
+		size, err := parseSizeStr(maxUnused)
+		if err != nil {
+			return errors.Fatalf("invalid number of bytes %q for --max-unused: %v", opts.MaxUnused, err)
+		}
+
+		opts.maxUnusedBytes = func(used uint64) uint64 {
+			return uint64(size)
+		}
+	}
+
+	return nil
 }
 
 func shortenStatus(maxLength int, s string) string {
@@ -44,7 +160,7 @@ func shortenStatus(maxLength int, s string) string {
 
 // newProgressMax returns a progress that counts blobs.
 func newProgressMax(show bool, max uint64, description string) *restic.Progress {
-	if !show {
+	if !show || globalOptions.JSON {
 		return nil
 	}
 
@@ -70,238 +186,770 @@ func newProgressMax(show bool, max uint64, description string) *restic.Progress
 	return p
 }
 
-func runPrune(gopts GlobalOptions) error {
+func runPrune(opts PruneOptions, gopts GlobalOptions) error {
+	err := verifyPruneOptions(&opts)
+	if err != nil {
+		return err
+	}
+
 	repo, err := OpenRepository(gopts)
 	if err != nil {
 		return err
 	}
 
-	lock, err := lockRepoExclusive(repo)
+	var lock *restic.Lock
+	if opts.Concurrent {
+		lock, err = lockRepo(repo)
+	} else {
+		lock, err = lockRepoExclusive(repo)
+	}
 	defer unlockRepo(lock)
 	if err != nil {
 		return err
 	}
 
-	return pruneRepository(gopts, repo)
+	if opts.Concurrent {
+		locks, err := restic.FindUnrefreshedLocks(gopts.ctx, repo)
+		if err != nil {
+			return err
+		}
+		if len(locks) > 0 {
+			return errors.Fatalf("found %d locks created by an older version of restic more than 30 minutes ago, "+
+				"which may still be in use; --concurrent cannot be used until they are removed with \"restic unlock\"", len(locks))
+		}
+	}
+
+	return pruneRepository(opts, gopts, repo)
 }
 
-func mixedBlobs(list []restic.Blob) bool {
-	var tree, data bool
+// packInfo contains the statistics of a pack file, computed from the index.
+type packInfo struct {
+	usedBlobs   uint
+	unusedBlobs uint
+	usedSize    uint64
+	unusedSize  uint64
+	tpe         restic.BlobType
+	mixed       bool
+}
 
-	for _, pb := range list {
-		switch pb.Type {
-		case restic.TreeBlob:
-			tree = true
-		case restic.DataBlob:
-			data = true
-		}
+// packInfoWithID is a packInfo together with the ID and size of the pack.
+type packInfoWithID struct {
+	ID   restic.ID
+	size uint64
+	packInfo
+}
 
-		if tree && data {
-			return true
-		}
+// prunePlan contains the decisions which pack files are deleted or repacked.
+type prunePlan struct {
+	removePacksFirst restic.IDSet   // unreferenced packs, removed before repacking
+	repackPacks      restic.IDSet   // packs to repack
+	removePacks      restic.IDSet   // packs to remove, contain only unused data
+	keepBlobs        restic.BlobSet // blobs to keep while repacking
+}
+
+// pruneStats collects the numbers printed for the plan.
+type pruneStats struct {
+	blobs struct {
+		used      uint
+		duplicate uint
+		unused    uint
+		remove    uint
+		repack    uint
+		repackrm  uint
 	}
+	size struct {
+		used      uint64
+		duplicate uint64
+		unused    uint64
+		remove    uint64
+		repack    uint64
+		repackrm  uint64
+		unref     uint64
+		overhead  uint64
+	}
+	packs struct {
+		used       uint
+		unused     uint
+		partlyUsed uint
+		unref      uint
+		keep       uint
+		repack     uint
+		remove     uint
+	}
+}
 
-	return false
+// pruneJSON is printed at the end of prune when --json is set. All sizes are
+// in bytes.
+type pruneJSON struct {
+	DryRun     bool `json:"dry_run"`
+	Concurrent bool `json:"concurrent"`
+
+	UsedBlobs           uint   `json:"used_blobs"`
+	UsedSize            uint64 `json:"used_size"`
+	DuplicateBlobs      uint   `json:"duplicate_blobs"`
+	DuplicateSize       uint64 `json:"duplicate_size"`
+	UnusedBlobs         uint   `json:"unused_blobs"`
+	UnusedSize          uint64 `json:"unused_size"`
+	UnreferencedSize    uint64 `json:"unreferenced_size"`
+	TotalBlobs          uint   `json:"total_blobs"`
+	TotalSize           uint64 `json:"total_size"`
+	RepackBlobs         uint   `json:"repack_blobs"`
+	RepackSize          uint64 `json:"repack_size"`
+	RemoveBlobs         uint   `json:"remove_blobs"`
+	RemoveSize          uint64 `json:"remove_size"`
+	RemainingBlobs      uint   `json:"remaining_blobs"`
+	RemainingSize       uint64 `json:"remaining_size"`
+	RemainingUnusedSize uint64 `json:"remaining_unused_size"`
+
+	PacksUsed         uint `json:"packs_used"`
+	PacksPartlyUsed   uint `json:"packs_partly_used"`
+	PacksUnused       uint `json:"packs_unused"`
+	PacksUnreferenced uint `json:"packs_unreferenced"`
+	PacksKeep         uint `json:"packs_keep"`
+	PacksRepack       uint `json:"packs_repack"`
+	PacksRemove       uint `json:"packs_remove"`
+
+	PendingDeletesFinished int    `json:"pending_deletes_finished"`
+	PendingDeletesWaiting  int    `json:"pending_deletes_waiting"`
+	PacksMarked            int    `json:"packs_marked"`
+	PacksDeleted           int    `json:"packs_deleted"`
+	FreedSize              uint64 `json:"freed_size"`
+
+	StructType string `json:"struct_type"` // "prune"
 }
 
-func pruneRepository(gopts GlobalOptions, repo restic.Repository) error {
-	ctx := gopts.ctx
+// summarize fills in the numbers of the plan.
+func (s *pruneJSON) summarize(stats pruneStats) {
+	s.UsedBlobs = stats.blobs.used
+	s.UsedSize = stats.size.used
+	s.DuplicateBlobs = stats.blobs.duplicate
+	s.DuplicateSize = stats.size.duplicate
+	s.UnusedBlobs = stats.blobs.unused
+	s.UnusedSize = stats.size.unused
+	s.UnreferencedSize = stats.size.unref
+	s.TotalBlobs = stats.blobs.used + stats.blobs.duplicate + stats.blobs.unused
+	s.TotalSize = stats.size.used + stats.size.duplicate + stats.size.unused + stats.size.overhead + stats.size.unref
+	s.RepackBlobs = stats.blobs.repack
+	s.RepackSize = stats.size.repack
+	s.RemoveBlobs = stats.blobs.remove + stats.blobs.repackrm
+	s.RemoveSize = stats.size.remove + stats.size.repackrm + stats.size.unref
+	s.RemainingBlobs = s.TotalBlobs - s.RemoveBlobs
+	s.RemainingSize = s.TotalSize - s.RemoveSize
+	s.RemainingUnusedSize = stats.size.unused + stats.size.duplicate - stats.size.remove - stats.size.repackrm
+
+	s.PacksUsed = stats.packs.used
+	s.PacksPartlyUsed = stats.packs.partlyUsed
+	s.PacksUnused = stats.packs.unused
+	s.PacksUnreferenced = stats.packs.unref
+	s.PacksKeep = stats.packs.keep
+	s.PacksRepack = stats.packs.repack
+	s.PacksRemove = stats.packs.remove
+}
 
-	err := repo.LoadIndex(ctx)
+func pruneRepository(opts PruneOptions, gopts GlobalOptions, repo restic.Repository) error {
+	summary, err := pruneRepositorySummary(opts, gopts, repo)
 	if err != nil {
 		return err
 	}
 
-	var stats struct {
-		blobs     int
-		packs     int
-		snapshots int
-		bytes     int64
+	if gopts.JSON {
+		return json.NewEncoder(gopts.stdout).Encode(summary)
 	}
+	return nil
+}
 
-	Verbosef("counting files in repo\n")
-	err = repo.List(ctx, restic.DataFile, func(restic.ID, int64) error {
-		stats.packs++
-		return nil
-	})
+// pruneRepositorySummary removes unused data from the repository and returns
+// the numbers which are printed with --json.
+func pruneRepositorySummary(opts PruneOptions, gopts GlobalOptions, repo restic.Repository) (*pruneJSON, error) {
+	ctx := gopts.ctx
+
+	summary := &pruneJSON{
+		DryRun:     opts.DryRun,
+		Concurrent: opts.Concurrent,
+		StructType: "prune",
+	}
+
+	marks, err := restic.LoadAllPendingDeletes(ctx, repo)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	Verbosef("building new index for repo\n")
+	// this must happen before the snapshots are loaded, so that all snapshots
+	// which may reference blobs in the marked packs are taken into account
+	ready, waiting, err := checkPendingDeletes(ctx, opts, repo, marks)
+	if err != nil {
+		return nil, err
+	}
 
-	bar := newProgressMax(!gopts.Quiet, uint64(stats.packs), "packs")
-	idx, invalidFiles, err := index.New(ctx, repo, restic.NewIDSet(), bar)
+	// load the snapshots before the index, so that the index contains all
+	// blobs referenced by the snapshots even when a backup runs concurrently
+	Verbosef("loading all snapshots...\n")
+	snapshots, err := restic.LoadAllSnapshots(ctx, repo)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, id := range invalidFiles {
-		Warnf("incomplete pack file (will be removed): %v\n", id)
+	if err = repo.LoadIndex(ctx); err != nil {
+		return nil, err
 	}
 
-	blobs := 0
-	for _, pack := range idx.Packs {
-		stats.bytes += pack.Size
-		blobs += len(pack.Entries)
+	usedBlobs, err := getUsedBlobs(gopts, repo, snapshots)
+	if err != nil {
+		return nil, err
 	}
-	Verbosef("repository contains %v packs (%v blobs) with %v\n",
-		len(idx.Packs), blobs, formatBytes(uint64(stats.bytes)))
 
-	blobCount := make(map[restic.BlobHandle]int)
-	var duplicateBlobs uint64
-	var duplicateBytes uint64
+	removedPacks := restic.NewIDSet()
+	if len(ready) > 0 && !opts.DryRun {
+		var sizes map[restic.ID]int64
+		if gopts.JSON {
+			// the sizes are only available before the packs are deleted
+			sizes, err = packSizes(ctx, repo)
+			if err != nil {
+				return nil, err
+			}
+		}
 
-	// find duplicate blobs
-	for _, p := range idx.Packs {
-		for _, entry := range p.Entries {
-			stats.blobs++
-			h := restic.BlobHandle{ID: entry.ID, Type: entry.Type}
-			blobCount[h]++
+		removedPacks, err = finishPendingDeletes(gopts, repo, ready, waiting, usedBlobs)
+		if err != nil {
+			return nil, err
+		}
 
-			if blobCount[h] > 1 {
-				duplicateBlobs++
-				duplicateBytes += uint64(entry.Length)
-			}
+		summary.PendingDeletesFinished = len(ready)
+		summary.PacksDeleted += len(removedPacks)
+		for id := range removedPacks {
+			summary.FreedSize += uint64(sizes[id])
 		}
 	}
 
-	Verbosef("processed %d blobs: %d duplicate blobs, %v duplicate\n",
-		stats.blobs, duplicateBlobs, formatBytes(uint64(duplicateBytes)))
-	Verbosef("load all snapshots\n")
+	summary.PendingDeletesWaiting = len(waiting)
+	if len(waiting) > 0 {
+		Verbosef("%d marks for deletion are still pending, not looking for more unused data\n", len(waiting))
+		return summary, nil
+	}
 
-	// find referenced blobs
-	snapshots, err := restic.LoadAllSnapshots(ctx, repo)
+	plan, stats, err := planPrune(ctx, opts, repo, usedBlobs, removedPacks)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	stats.snapshots = len(snapshots)
+	summary.summarize(stats)
+	if !gopts.JSON {
+		printPruneStats(opts, stats)
+	}
 
-	Verbosef("find data that is still in use for %d snapshots\n", stats.snapshots)
+	if opts.DryRun {
+		Verbosef("\ndry run, the repository was not modified\n")
+		return summary, nil
+	}
+
+	obsoletePacks := len(plan.removePacksFirst) + len(plan.repackPacks) + len(plan.removePacks)
+
+	if opts.Concurrent {
+		if err = markForDeletion(gopts, repo, plan); err != nil {
+			return nil, err
+		}
+		summary.PacksMarked = obsoletePacks
+		return summary, nil
+	}
+
+	if err = doPrune(gopts, repo, plan); err != nil {
+		return nil, err
+	}
+	summary.PacksDeleted += obsoletePacks
+	summary.FreedSize += summary.RemoveSize
+	return summary, nil
+}
+
+// packSizes returns the sizes of all pack files in the repository.
+func packSizes(ctx context.Context, repo restic.Repository) (map[restic.ID]int64, error) {
+	sizes := make(map[restic.ID]int64)
+	err := repo.List(ctx, restic.DataFile, func(id restic.ID, size int64) error {
+		sizes[id] = size
+		return nil
+	})
+	return sizes, err
+}
+
+// getUsedBlobs returns all blobs referenced by snapshots.
+func getUsedBlobs(gopts GlobalOptions, repo restic.Repository, snapshots []*restic.Snapshot) (restic.BlobSet, error) {
+	ctx := gopts.ctx
+
+	Verbosef("finding data that is still in use for %d snapshots\n", len(snapshots))
 
 	usedBlobs := restic.NewBlobSet()
 	seenBlobs := restic.NewBlobSet()
 
-	bar = newProgressMax(!gopts.Quiet, uint64(len(snapshots)), "snapshots")
+	bar := newProgressMax(!gopts.Quiet, uint64(len(snapshots)), "snapshots")
 	bar.Start()
+	defer bar.Done()
+
 	for _, sn := range snapshots {
 		debug.Log("process snapshot %v", sn.ID())
 
-		err = restic.FindUsedBlobs(ctx, repo, *sn.Tree, usedBlobs, seenBlobs)
+		err := restic.FindUsedBlobs(ctx, repo, *sn.Tree, usedBlobs, seenBlobs)
 		if err != nil {
 			if repo.Backend().IsNotExist(err) {
-				return errors.Fatal("unable to load a tree from the repo: " + err.Error())
+				return nil, errors.Fatal("unable to load a tree from the repo: " + err.Error())
 			}
 
-			return err
+			return nil, err
 		}
 
 		debug.Log("processed snapshot %v", sn.ID())
 		bar.Report(restic.Stat{Blobs: 1})
 	}
-	bar.Done()
 
-	if len(usedBlobs) > stats.blobs {
-		return errors.Fatalf("number of used blobs is larger than number of available blobs!\n" +
-			"Please report this error (along with the output of the 'prune' run) at\n" +
-			"https://github.com/restic/restic/issues/new")
-	}
+	return usedBlobs, nil
+}
+
+// planPrune decides for each pack file whether it is kept, repacked or
+// removed. Only the index and the list of pack files are used. Blobs in the
+// packs ignorePacks, which have already been removed, are not considered.
+func planPrune(ctx context.Context, opts PruneOptions, repo restic.Repository, usedBlobs restic.BlobSet, ignorePacks restic.IDSet) (prunePlan, pruneStats, error) {
+	var stats pruneStats
 
-	Verbosef("found %d of %d data blobs still in use, removing %d blobs\n",
-		len(usedBlobs), stats.blobs, stats.blobs-len(usedBlobs))
+	Verbosef("searching used packs...\n")
 
-	// find packs that need a rewrite
-	rewritePacks := restic.NewIDSet()
-	for _, pack := range idx.Packs {
-		if mixedBlobs(pack.Entries) {
-			rewritePacks.Insert(pack.ID)
+	indexPack := make(map[restic.ID]packInfo)
+	foundBlobs := restic.NewBlobSet()
+
+	for blob := range repo.Index().Each(ctx) {
+		if ignorePacks.Has(blob.PackID) {
 			continue
 		}
 
-		for _, blob := range pack.Entries {
-			h := restic.BlobHandle{ID: blob.ID, Type: blob.Type}
-			if !usedBlobs.Has(h) {
-				rewritePacks.Insert(pack.ID)
-				continue
-			}
+		ip, ok := indexPack[blob.PackID]
+		if !ok {
+			ip.tpe = blob.Type
+		} else if ip.tpe != blob.Type {
+			ip.mixed = true
+		}
 
-			if blobCount[h] > 1 {
-				rewritePacks.Insert(pack.ID)
-			}
+		size := uint64(blob.Length)
+		h := restic.BlobHandle{ID: blob.ID, Type: blob.Type}
+		switch {
+		case usedBlobs.Has(h) && !foundBlobs.Has(h):
+			foundBlobs.Insert(h)
+			ip.usedBlobs++
+			ip.usedSize += size
+			stats.blobs.used++
+			stats.size.used += size
+		case usedBlobs.Has(h):
+			// the blob is already counted as used in another pack
+			ip.unusedBlobs++
+			ip.unusedSize += size
+			stats.blobs.duplicate++
+			stats.size.duplicate += size
+		default:
+			ip.unusedBlobs++
+			ip.unusedSize += size
+			stats.blobs.unused++
+			stats.size.unused += size
 		}
+
+		indexPack[blob.PackID] = ip
 	}
 
-	removeBytes := duplicateBytes
+	if len(foundBlobs) != len(usedBlobs) {
+		Warnf("%d used blobs are missing from the index\n", len(usedBlobs)-len(foundBlobs))
+		return prunePlan{}, stats, errors.Fatal("index is not complete, run 'restic rebuild-index' and 'restic check'")
+	}
 
-	// find packs that are unneeded
-	removePacks := restic.NewIDSet()
+	Verbosef("collecting packs for deletion and repacking\n")
+
+	plan := prunePlan{
+		removePacksFirst: restic.NewIDSet(),
+		repackPacks:      restic.NewIDSet(),
+		removePacks:      restic.NewIDSet(),
+		keepBlobs:        restic.NewBlobSet(),
+	}
+
+	var candidates []packInfoWithID
+	err := repo.List(ctx, restic.DataFile, func(id restic.ID, packSize int64) error {
+		ip, ok := indexPack[id]
+		if !ok {
+			// the pack is not referenced in the index
+			plan.removePacksFirst.Insert(id)
+			stats.packs.unref++
+			stats.size.unref += uint64(packSize)
+			return nil
+		}
+		delete(indexPack, id)
+
+		size := uint64(packSize)
+		stats.size.overhead += size - ip.usedSize - ip.unusedSize
+
+		switch {
+		case ip.usedBlobs == 0:
+			// the pack does not contain any used data, remove it
+			plan.removePacks.Insert(id)
+			stats.packs.unused++
+			stats.packs.remove++
+			stats.blobs.remove += ip.unusedBlobs
+			stats.size.remove += ip.unusedSize
+		case ip.unusedBlobs == 0 && !ip.mixed:
+			stats.packs.used++
+			stats.packs.keep++
+		default:
+			stats.packs.partlyUsed++
+			candidates = append(candidates, packInfoWithID{ID: id, size: size, packInfo: ip})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return prunePlan{}, stats, err
+	}
 
-	Verbosef("will remove %d invalid files\n", len(invalidFiles))
-	for _, id := range invalidFiles {
-		removePacks.Insert(id)
+	if len(indexPack) != 0 {
+		Warnf("the index references %d packs which are missing from the repository\n", len(indexPack))
+		return prunePlan{}, stats, errors.Fatal("index is not complete, run 'restic rebuild-index'")
 	}
 
-	for packID, p := range idx.Packs {
+	// repack packs with mixed blob types first, then the packs containing the
+	// most unused data relative to their size
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].mixed != candidates[j].mixed {
+			return candidates[i].mixed
+		}
+		return candidates[i].unusedSize*candidates[j].size > candidates[j].unusedSize*candidates[i].size
+	})
+
+	maxUnused := opts.maxUnusedBytes(stats.size.used)
+	unusedAfterPrune := stats.size.unused + stats.size.duplicate - stats.size.remove
+	var repackBytes uint64
 
-		hasActiveBlob := false
-		for _, blob := range p.Entries {
-			h := restic.BlobHandle{ID: blob.ID, Type: blob.Type}
+	for _, p := range candidates {
+		if !p.mixed && unusedAfterPrune <= maxUnused {
+			stats.packs.keep++
+			continue
+		}
+
+		if opts.MaxRepackBytes > 0 && repackBytes+p.size > opts.MaxRepackBytes {
+			stats.packs.keep++
+			continue
+		}
+
+		plan.repackPacks.Insert(p.ID)
+		repackBytes += p.size
+		unusedAfterPrune -= p.unusedSize
+
+		stats.packs.repack++
+		stats.blobs.repack += p.usedBlobs
+		stats.size.repack += p.usedSize
+		stats.blobs.repackrm += p.unusedBlobs
+		stats.size.repackrm += p.unusedSize
+	}
+
+	// keep the used blobs from the repacked packs, unless a copy of the blob
+	// is contained in a pack which is kept
+	keptBlobs := restic.NewBlobSet()
+	for blob := range repo.Index().Each(ctx) {
+		h := restic.BlobHandle{ID: blob.ID, Type: blob.Type}
+		switch {
+		case ignorePacks.Has(blob.PackID):
+			continue
+		case plan.repackPacks.Has(blob.PackID):
 			if usedBlobs.Has(h) {
-				hasActiveBlob = true
-				continue
+				plan.keepBlobs.Insert(h)
 			}
+		case !plan.removePacks.Has(blob.PackID):
+			keptBlobs.Insert(h)
+		}
+	}
+
+	for h := range keptBlobs {
+		plan.keepBlobs.Delete(h)
+	}
+
+	return plan, stats, nil
+}
+
+// printPruneStats prints the plan computed by planPrune.
+func printPruneStats(opts PruneOptions, stats pruneStats) {
+	var s pruneJSON
+	s.summarize(stats)
+	totalBlobs, totalSize := s.TotalBlobs, s.TotalSize
+	removeBlobs, removeSize := s.RemoveBlobs, s.RemoveSize
+	remainingBlobs, remainingSize := s.RemainingBlobs, s.RemainingSize
+	remainingUnused := s.RemainingUnusedSize
+
+	Verbosef("\n")
+	Verbosef("used:         %10d blobs / %s\n", stats.blobs.used, formatBytes(stats.size.used))
+	if stats.blobs.duplicate > 0 {
+		Verbosef("duplicates:   %10d blobs / %s\n", stats.blobs.duplicate, formatBytes(stats.size.duplicate))
+	}
+	Verbosef("unused:       %10d blobs / %s\n", stats.blobs.unused, formatBytes(stats.size.unused))
+	if stats.size.unref > 0 {
+		Verbosef("unreferenced:                    %s\n", formatBytes(stats.size.unref))
+	}
+	Verbosef("total:        %10d blobs / %s\n", totalBlobs, formatBytes(totalSize))
+	Verbosef("unused size:  %s of total size\n", formatPercent(stats.size.unused+stats.size.duplicate, totalSize))
+
+	Verbosef("\n")
+	Verbosef("to repack:    %10d blobs / %s\n", stats.blobs.repack, formatBytes(stats.size.repack))
+	Verbosef("this removes: %10d blobs / %s\n", stats.blobs.repackrm, formatBytes(stats.size.repackrm))
+	Verbosef("to delete:    %10d blobs / %s\n", stats.blobs.remove, formatBytes(stats.size.remove+stats.size.unref))
+	Verbosef("total prune:  %10d blobs / %s\n", removeBlobs, formatBytes(removeSize))
+	Verbosef("remaining:    %10d blobs / %s\n", remainingBlobs, formatBytes(remainingSize))
+	Verbosef("unused size after prune: %s (%s of remaining size)\n",
+		formatBytes(remainingUnused), formatPercent(remainingUnused, remainingSize))
+
+	Verbosef("\n")
+	Verbosef("totally used packs: %10d\n", stats.packs.used)
+	Verbosef("partly used packs:  %10d\n", stats.packs.partlyUsed)
+	Verbosef("unused packs:       %10d\n", stats.packs.unused)
+
+	Verbosef("\n")
+	Verbosef("to keep:      %10d packs\n", stats.packs.keep)
+	Verbosef("to repack:    %10d packs\n", stats.packs.repack)
+	Verbosef("to delete:    %10d packs\n", stats.packs.remove)
+	if stats.packs.unref > 0 {
+		Verbosef("to delete:    %10d unreferenced packs\n", stats.packs.unref)
+	}
+
+	if opts.DryRun {
+		downloadSize := stats.size.repack + stats.size.repackrm
+		Verbosef("\n")
+		Verbosef("would download: %s\n", formatBytes(downloadSize))
+		Verbosef("would upload:   %s\n", formatBytes(stats.size.repack))
+		Verbosef("would free:     %s\n", formatBytes(removeSize))
+	}
+}
+
+// doPrune executes the plan computed by planPrune.
+func doPrune(gopts GlobalOptions, repo restic.Repository, plan prunePlan) error {
+	ctx := gopts.ctx
 
-			removeBytes += uint64(blob.Length)
+	if len(plan.removePacksFirst) != 0 {
+		Verbosef("deleting unreferenced packs\n")
+		deleteFiles(gopts, repo, plan.removePacksFirst, restic.DataFile)
+	}
+
+	if len(plan.repackPacks) != 0 {
+		Verbosef("repacking packs\n")
+		bar := newProgressMax(!gopts.Quiet, uint64(len(plan.repackPacks)), "packs repacked")
+		bar.Start()
+		_, err := repository.Repack(ctx, repo, plan.repackPacks, plan.keepBlobs, bar)
+		bar.Done()
+		if err != nil {
+			return err
 		}
 
-		if hasActiveBlob {
+		// save the index for the new packs
+		if err = repo.SaveIndex(ctx); err != nil {
+			return err
+		}
+
+		// the packs are obsolete now
+		plan.removePacks.Merge(plan.repackPacks)
+	}
+
+	if len(plan.removePacks) != 0 {
+		if err := rewriteIndexWithoutPacks(ctx, repo, plan.removePacks); err != nil {
+			return err
+		}
+
+		Verbosef("removing %d old packs\n", len(plan.removePacks))
+		deleteFiles(gopts, repo, plan.removePacks, restic.DataFile)
+	}
+
+	Verbosef("done\n")
+	return nil
+}
+
+// checkPendingDeletes sorts the marks for deletion into the ones which are
+// ready to be finished and the ones which have to wait. A mark is ready when
+// the grace period has passed and no lock created before the mark is left.
+// When the repository is locked exclusively, all marks are ready.
+func checkPendingDeletes(ctx context.Context, opts PruneOptions, repo restic.Repository, marks []*restic.PendingDelete) (ready, waiting []*restic.PendingDelete, err error) {
+	if !opts.Concurrent {
+		return marks, nil, nil
+	}
+
+	for _, pd := range marks {
+		if time.Since(pd.Time) < opts.DeleteGracePeriod {
+			debug.Log("%v: grace period has not passed yet", pd)
+			waiting = append(waiting, pd)
 			continue
 		}
 
-		removePacks.Insert(packID)
+		locks, err := restic.FindLocksCreatedBefore(ctx, repo, pd.Time)
+		if err != nil {
+			return nil, nil, err
+		}
 
-		if !rewritePacks.Has(packID) {
-			return errors.Fatalf("pack %v is unneeded, but not contained in rewritePacks", packID.Str())
+		if len(locks) > 0 {
+			Verbosef("packs marked for deletion at %s are still in use by %d processes\n",
+				pd.Time.Format(TimeFormat), len(locks))
+			waiting = append(waiting, pd)
+			continue
 		}
 
-		rewritePacks.Delete(packID)
+		ready = append(ready, pd)
 	}
 
-	Verbosef("will delete %d packs and rewrite %d packs, this frees %s\n",
-		len(removePacks), len(rewritePacks), formatBytes(uint64(removeBytes)))
+	return ready, waiting, nil
+}
 
-	var obsoletePacks restic.IDSet
-	if len(rewritePacks) != 0 {
-		bar = newProgressMax(!gopts.Quiet, uint64(len(rewritePacks)), "packs rewritten")
+// finishPendingDeletes deletes the packs of the ready marks, unless they
+// contain used blobs which are not available in any other pack. The waiting
+// marks are needed to find out which other packs will be deleted later. It
+// returns the packs which were deleted.
+func finishPendingDeletes(gopts GlobalOptions, repo restic.Repository, ready, waiting []*restic.PendingDelete, usedBlobs restic.BlobSet) (restic.IDSet, error) {
+	ctx := gopts.ctx
+
+	marked := restic.NewIDSet()
+	for _, pd := range append(ready, waiting...) {
+		for _, id := range pd.Packs {
+			marked.Insert(id)
+		}
+	}
+
+	// find the used blobs which are only contained in marked packs
+	availableBlobs := restic.NewBlobSet()
+	packBlobs := make(map[restic.ID][]restic.BlobHandle)
+	for blob := range repo.Index().Each(ctx) {
+		h := restic.BlobHandle{ID: blob.ID, Type: blob.Type}
+		if marked.Has(blob.PackID) {
+			packBlobs[blob.PackID] = append(packBlobs[blob.PackID], h)
+		} else {
+			availableBlobs.Insert(h)
+		}
+	}
+
+	removePacks := restic.NewIDSet()
+	keptPacks := 0
+	for _, pd := range ready {
+		for _, id := range pd.Packs {
+			keep := false
+			for _, h := range packBlobs[id] {
+				if usedBlobs.Has(h) && !availableBlobs.Has(h) {
+					keep = true
+					break
+				}
+			}
+
+			if keep {
+				debug.Log("pack %v marked for deletion is still used", id)
+				keptPacks++
+				continue
+			}
+
+			removePacks.Insert(id)
+		}
+	}
+
+	Verbosef("finishing %d marks for deletion, deleting %d packs, %d packs are still used\n",
+		len(ready), len(removePacks), keptPacks)
+
+	if len(removePacks) > 0 {
+		if err := rewriteIndexWithoutPacks(ctx, repo, removePacks); err != nil {
+			return nil, err
+		}
+
+		Verbosef("removing %d old packs\n", len(removePacks))
+		deleteFiles(gopts, repo, removePacks, restic.DataFile)
+	}
+
+	for _, pd := range ready {
+		if err := pd.Remove(ctx, repo); err != nil {
+			Warnf("unable to remove mark for deletion %v: %v\n", pd.ID().Str(), err)
+		}
+	}
+
+	return removePacks, nil
+}
+
+// markForDeletion executes the plan computed by planPrune without deleting
+// anything: the used blobs are repacked, afterwards all obsolete packs are
+// marked for deletion.
+func markForDeletion(gopts GlobalOptions, repo restic.Repository, plan prunePlan) error {
+	ctx := gopts.ctx
+
+	if len(plan.repackPacks) != 0 {
+		Verbosef("repacking packs\n")
+		bar := newProgressMax(!gopts.Quiet, uint64(len(plan.repackPacks)), "packs repacked")
 		bar.Start()
-		obsoletePacks, err = repository.Repack(ctx, repo, rewritePacks, usedBlobs, bar)
+		_, err := repository.Repack(ctx, repo, plan.repackPacks, plan.keepBlobs, bar)
+		bar.Done()
 		if err != nil {
 			return err
 		}
-		bar.Done()
+
+		// save the index for the new packs
+		if err = repo.SaveIndex(ctx); err != nil {
+			return err
+		}
 	}
 
-	removePacks.Merge(obsoletePacks)
+	packs := restic.NewIDSet()
+	packs.Merge(plan.removePacksFirst)
+	packs.Merge(plan.repackPacks)
+	packs.Merge(plan.removePacks)
 
-	if err = rebuildIndex(ctx, repo, removePacks); err != nil {
+	if len(packs) == 0 {
+		Verbosef("done\n")
+		return nil
+	}
+
+	pd := restic.NewPendingDelete(packs)
+	if err := pd.Save(ctx, repo); err != nil {
 		return err
 	}
 
-	if len(removePacks) != 0 {
-		bar = newProgressMax(!gopts.Quiet, uint64(len(removePacks)), "packs deleted")
-		bar.Start()
-		for packID := range removePacks {
-			h := restic.Handle{Type: restic.DataFile, Name: packID.String()}
-			err = repo.Backend().Remove(ctx, h)
-			if err != nil {
-				Warnf("unable to remove file %v from the repository\n", packID.Str())
+	Verbosef("marked %d packs for deletion, they are deleted by a later run of prune\n", len(packs))
+	return nil
+}
+
+// rewriteIndexWithoutPacks loads all index files, removes the packs and
+// replaces the index files with new ones.
+func rewriteIndexWithoutPacks(ctx context.Context, repo restic.Repository, packs restic.IDSet) error {
+	Verbosef("rebuilding index\n")
+
+	idx, err := index.Load(ctx, repo, nil)
+	if err != nil {
+		return err
+	}
+
+	for id := range packs {
+		if _, ok := idx.Packs[id]; ok {
+			if err = idx.RemovePack(id); err != nil {
+				return err
 			}
-			bar.Report(restic.Stat{Blobs: 1})
 		}
-		bar.Done()
 	}
 
-	Verbosef("done\n")
+	supersedes := idx.IndexIDs.List()
+	ids, err := idx.Save(ctx, repo, supersedes)
+	if err != nil {
+		return errors.Fatalf("unable to save index, last error was: %v", err)
+	}
+	debug.Log("saved new indexes as %v", ids)
+
+	Verbosef("removing %d old index files\n", len(supersedes))
+	for _, id := range supersedes {
+		h := restic.Handle{Type: restic.IndexFile, Name: id.String()}
+		if err := repo.Backend().Remove(ctx, h); err != nil {
+			Warnf("error removing old index %v: %v\n", id.Str(), err)
+		}
+	}
+
 	return nil
 }
+
+// deleteFiles removes the files ids of type t from the repository.
+func deleteFiles(gopts GlobalOptions, repo restic.Repository, ids restic.IDSet, t restic.FileType) {
+	bar := newProgressMax(!gopts.Quiet, uint64(len(ids)), "files deleted")
+	bar.Start()
+	defer bar.Done()
+
+	for id := range ids {
+		h := restic.Handle{Type: t, Name: id.String()}
+		err := repo.Backend().Remove(gopts.ctx, h)
+		if err != nil {
+			Warnf("unable to remove %v from the repository\n", h)
+		}
+		bar.Report(restic.Stat{Blobs: 1})
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/restic/restic/internal/checker"
+	"github.com/restic/restic/internal/compression"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/pack"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdRepairPacks = &cobra.Command{
+	Use:   "packs [packIDs...]",
+	Short: "Salvage damaged pack files",
+	Long: `
+The "repair packs" command checks the given pack files, or all pack files in
+the repository when no pack ID is given, and salvages the damaged ones: all
+blobs which can still be read and decrypted are saved to new pack files,
+afterwards the damaged pack files are removed and the index is rebuilt.
+
+Blobs which cannot be salvaged are lost. Run "check" afterwards to find out
+which snapshots are affected, and "repair snapshots" to repair them.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRepairPacks(globalOptions, args)
+	},
+}
+
+func init() {
+	cmdRepair.AddCommand(cmdRepairPacks)
+}
+
+// findDamagedPacks checks the packs ids and returns all which fail the check.
+func findDamagedPacks(ctx context.Context, gopts GlobalOptions, repo restic.Repository, ids restic.IDs) (restic.IDSet, error) {
+	damaged := restic.NewIDSet()
+
+	bar := newProgressMax(!gopts.Quiet, uint64(len(ids)), "packs checked")
+	bar.Start()
+	defer bar.Done()
+
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		err := checker.CheckPack(ctx, repo, id)
+		if err != nil {
+			debug.Log("pack %v is damaged: %v", id, err)
+			Warnf("pack %v is damaged: %v\n", id.Str(), err)
+			damaged.Insert(id)
+		}
+		bar.Report(restic.Stat{Blobs: 1})
+	}
+
+	return damaged, nil
+}
+
+// packBlobs returns the list of blobs in the pack id, as listed in the pack
+// header. If the header cannot be read, the blobs listed in the index are
+// returned instead.
+func packBlobs(ctx context.Context, repo restic.Repository, id restic.ID, rd io.ReaderAt, size int64) []restic.Blob {
+	blobs, err := pack.List(repo.Key(), rd, size)
+	if err == nil {
+		return blobs
+	}
+
+	Warnf("unable to read header of pack %v, using the index instead: %v\n", id.Str(), err)
+
+	blobs = nil
+	for pb := range repo.Index().Each(ctx) {
+		if pb.PackID.Equal(id) {
+			blobs = append(blobs, pb.Blob)
+		}
+	}
+	return blobs
+}
+
+// loadPackBlob reads, decrypts and verifies the blob from rd.
+func loadPackBlob(repo restic.Repository, rd io.ReaderAt, blob restic.Blob) ([]byte, error) {
+	buf := make([]byte, blob.Length)
+	n, err := rd.ReadAt(buf, int64(blob.Offset))
+	if err != nil {
+		return nil, err
+	}
+
+	if n != int(blob.Length) {
+		return nil, errors.Errorf("wrong length returned, want %d, got %d", blob.Length, n)
+	}
+
+	key := repo.Key()
+	if len(buf) < key.NonceSize() {
+		return nil, errors.New("blob is too short")
+	}
+
+	nonce, ciphertext := buf[:key.NonceSize()], buf[key.NonceSize():]
+	plaintext, err := key.Open(ciphertext[:0], nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if blob.IsCompressed() {
+		plaintext, err = compression.Decompress(nil, plaintext)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !restic.Hash(plaintext).Equal(blob.ID) {
+		return nil, errors.New("invalid hash")
+	}
+
+	return plaintext, nil
+}
+
+// salvagePack saves all blobs from the pack id which can still be read to new
+// packs. It returns the number of salvaged and lost blobs.
+func salvagePack(ctx context.Context, repo restic.Repository, id restic.ID) (salvaged, lost int, err error) {
+	h := restic.Handle{Type: restic.DataFile, Name: id.String()}
+
+	packfile, _, size, err := repository.DownloadAndHash(ctx, repo.Backend(), h)
+	if err != nil {
+		Warnf("unable to download pack %v: %v\n", id.Str(), err)
+		return 0, 0, nil
+	}
+
+	defer func() {
+		_ = packfile.Close()
+		_ = os.Remove(packfile.Name())
+	}()
+
+	for _, blob := range packBlobs(ctx, repo, id, packfile, size) {
+		plaintext, err := loadPackBlob(repo, packfile, blob)
+		if err != nil {
+			debug.Log("unable to salvage blob %v from pack %v: %v", blob.ID, id, err)
+			Warnf("unable to salvage %v blob %v: %v\n", blob.Type, blob.ID.Str(), err)
+			lost++
+			continue
+		}
+
+		_, err = repo.SaveBlob(ctx, blob.Type, plaintext, blob.ID)
+		if err != nil {
+			return salvaged, lost, err
+		}
+		salvaged++
+	}
+
+	return salvaged, lost, nil
+}
+
+func runRepairPacks(gopts GlobalOptions, args []string) error {
+	var ids restic.IDs
+	for _, arg := range args {
+		id, err := restic.ParseID(arg)
+		if err != nil {
+			return errors.Fatalf("invalid pack ID %q: %v", arg, err)
+		}
+		ids = append(ids, id)
+	}
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockRepoExclusive(repo)
+	defer unlockRepo(lock)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	if err = repo.LoadIndex(ctx); err != nil {
+		return err
+	}
+
+	if len(ids) == 0 {
+		err = repo.List(ctx, restic.DataFile, func(id restic.ID, size int64) error {
+			ids = append(ids, id)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	Verbosef("checking %d packs\n", len(ids))
+	damaged, err := findDamagedPacks(ctx, gopts, repo, ids)
+	if err != nil {
+		return err
+	}
+
+	if len(damaged) == 0 {
+		Verbosef("no damaged packs found\n")
+		return nil
+	}
+
+	Verbosef("salvaging %d damaged packs\n", len(damaged))
+	for id := range damaged {
+		salvaged, lost, err := salvagePack(ctx, repo, id)
+		if err != nil {
+			return err
+		}
+		Verbosef("pack %v: salvaged %d blobs, %d blobs lost\n", id.Str(), salvaged, lost)
+	}
+
+	if err = repo.Flush(ctx); err != nil {
+		return err
+	}
+
+	Verbosef("rebuilding index\n")
+	if err = rebuildIndex(ctx, repo, damaged); err != nil {
+		return err
+	}
+
+	Verbosef("removing %d damaged packs\n", len(damaged))
+	for id := range damaged {
+		h := restic.Handle{Type: restic.DataFile, Name: id.String()}
+		if err = repo.Backend().Remove(ctx, h); err != nil {
+			Warnf("unable to remove pack %v: %v\n", id.Str(), err)
+		}
+	}
+
+	Verbosef("done, run \"check\" to find snapshots which reference lost blobs\n")
+	return nil
+}
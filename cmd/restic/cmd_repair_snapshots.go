@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/walker"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdRepairSnapshots = &cobra.Command{
+	Use:   "snapshots [flags] [snapshotID ...]",
+	Short: "Repair snapshots",
+	Long: `
+The "repair snapshots" command repairs snapshots which reference trees or data
+blobs that are missing from the repository. Run "rebuild-index" first, so that
+the index reflects the data which is actually available.
+
+Damaged snapshots are repaired as follows:
+
+* Directories which cannot be loaded are replaced with empty directories.
+* Files which reference missing data are truncated before the first missing
+  part of their content.
+
+The repaired snapshots are saved as new snapshots tagged with "repaired". By
+default, the original snapshots are kept; use --forget to remove them.
+
+When no snapshot ID is given, all snapshots matching the host, tag and path
+filter criteria are repaired. Use --dry-run to only report the damage without
+modifying the repository.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRepairSnapshots(repairSnapshotsOptions, globalOptions, args)
+	},
+}
+
+// RepairSnapshotsOptions bundles all options for the 'repair snapshots' command.
+type RepairSnapshotsOptions struct {
+	Forget bool
+	DryRun bool
+
+	Host  string
+	Tags  restic.TagLists
+	Paths []string
+}
+
+var repairSnapshotsOptions RepairSnapshotsOptions
+
+func init() {
+	cmdRepair.AddCommand(cmdRepairSnapshots)
+
+	f := cmdRepairSnapshots.Flags()
+	f.BoolVarP(&repairSnapshotsOptions.Forget, "forget", "", false, "remove original snapshots after creating new ones")
+	f.BoolVarP(&repairSnapshotsOptions.DryRun, "dry-run", "n", false, "do not do anything, just print what would be done")
+
+	f.StringVarP(&repairSnapshotsOptions.Host, "host", "H", "", "only consider snapshots for this `host`, when no snapshot ID is given")
+	f.Var(&repairSnapshotsOptions.Tags, "tag", "only consider snapshots which include this `taglist`, when no snapshot ID is given")
+	f.StringArrayVar(&repairSnapshotsOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`, when no snapshot ID is given")
+}
+
+// repairedTag is added to repaired snapshots when the original ones are kept.
+const repairedTag = "repaired"
+
+// newSnapshotRepairer returns a TreeRewriter which removes references to
+// missing blobs. Unreadable trees are replaced by the tree emptyTree.
+func newSnapshotRepairer(repo restic.Repository, emptyTree restic.ID) *walker.TreeRewriter {
+	rewriteNode := func(node *restic.Node, path string) *restic.Node {
+		switch node.Type {
+		case "file":
+			var size uint64
+			for i, id := range node.Content {
+				blobSize, found := repo.LookupBlobSize(id, restic.DataBlob)
+				if !found {
+					Printf("  file %q: content missing, truncated from %d to %d bytes\n", path, node.Size, size)
+					n := *node
+					n.Content = append(restic.IDs{}, node.Content[:i]...)
+					n.Size = size
+					return &n
+				}
+				size += uint64(blobSize)
+			}
+
+		case "dir":
+			if node.Subtree == nil {
+				Printf("  dir %q: subtree is missing, replaced with an empty directory\n", path)
+				n := *node
+				n.Subtree = &emptyTree
+				return &n
+			}
+		}
+
+		return node
+	}
+
+	failedTree := func(id restic.ID, path string, err error) (restic.ID, error) {
+		Printf("  dir %q: unable to load tree %v, replaced with an empty directory: %v\n", path, id.Str(), err)
+		return emptyTree, nil
+	}
+
+	return walker.NewTreeRewriter(rewriteNode, failedTree)
+}
+
+// emptyTreeLoader returns the empty tree without loading it from the
+// repository, which does not contain it yet in dry-run mode or before the
+// repository is flushed.
+type emptyTreeLoader struct {
+	walker.TreeLoadSaver
+	emptyTree restic.ID
+}
+
+func (l emptyTreeLoader) LoadTree(ctx context.Context, id restic.ID) (*restic.Tree, error) {
+	if id.Equal(l.emptyTree) {
+		return restic.NewTree(), nil
+	}
+	return l.TreeLoadSaver.LoadTree(ctx, id)
+}
+
+func repairSnapshot(ctx context.Context, repo *repository.Repository, sn *restic.Snapshot, opts RepairSnapshotsOptions) (bool, error) {
+	filter := func(ctx context.Context, saver walker.TreeLoadSaver, sn *restic.Snapshot) (restic.ID, error) {
+		emptyTree, err := saver.SaveTree(ctx, restic.NewTree())
+		if err != nil {
+			return restic.ID{}, err
+		}
+
+		saver = emptyTreeLoader{TreeLoadSaver: saver, emptyTree: emptyTree}
+		return newSnapshotRepairer(repo, emptyTree).RewriteTree(ctx, saver, "/", *sn.Tree)
+	}
+
+	return filterAndReplaceSnapshot(ctx, repo, sn, filter, opts.DryRun, opts.Forget, repairedTag)
+}
+
+func runRepairSnapshots(opts RepairSnapshotsOptions, gopts GlobalOptions, args []string) error {
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		var lock *restic.Lock
+		if opts.Forget && !opts.DryRun {
+			Verbosef("create exclusive lock for repository\n")
+			lock, err = lockRepoExclusive(repo)
+		} else {
+			lock, err = lockRepo(repo)
+		}
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	if err = repo.LoadIndex(ctx); err != nil {
+		return err
+	}
+
+	changedCount := 0
+	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, args) {
+		Verbosef("\nsnapshot %s of %v at %s\n", sn.ID().Str(), sn.Paths, sn.Time)
+		changed, err := repairSnapshot(ctx, repo, sn, opts)
+		if err != nil {
+			return errors.Fatalf("unable to repair snapshot ID %q: %v", sn.ID().Str(), err)
+		}
+		if changed {
+			changedCount++
+		}
+	}
+
+	Verbosef("\n")
+	if changedCount == 0 {
+		Verbosef("no snapshots were modified\n")
+	} else if opts.DryRun {
+		Verbosef("would repair %v snapshots\n", changedCount)
+	} else {
+		Verbosef("repaired %v snapshots\n", changedCount)
+	}
+
+	return nil
+}
@@ -1,13 +1,21 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/filter"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/restorer"
+	"github.com/restic/restic/internal/ui"
+	"github.com/restic/restic/internal/ui/termstatus"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	tomb "gopkg.in/tomb.v2"
 )
 
 var cmdRestore = &cobra.Command{
@@ -19,22 +27,68 @@ a directory.
 
 The special snapshot "latest" can be used to restore the latest snapshot in the
 repository.
+
+Files which already exist in the target directory are replaced according to
+--overwrite: "always" writes all files, "if-changed" only writes files whose
+size, modification time or content differ from the snapshot, "if-newer" only
+writes files which are older than the version in the snapshot and "never"
+keeps all existing files. With --delete, files in the restored directories
+which are not contained in the snapshot are removed, other files in the target
+directory are kept. Use --dry-run to print what would be written and deleted.
+
+Data which is already present in the existing files in the target directory is
+copied from there instead of being downloaded. With --seed-dir, the files at
+the same paths in another directory, for example an older restore, are used in
+the same way.
+
+With --strip-components N, the first N components of the paths in the
+snapshot are removed, items which have no components left are not restored.
+--map /old/prefix=/new/prefix replaces the prefix of all matching paths, it can
+be given multiple times. Mappings are applied before components are stripped.
+The patterns of --include and --exclude always match the paths in the
+snapshot. Path rewriting cannot be combined with --delete.
+
+While the files are restored, the progress is shown in the terminal. With
+--json, a status message is printed every second instead, followed by a summary
+at the end.
 `,
 	DisableAutoGenTag: true,
+	Annotations:       map[string]string{annotationJSONMessagesToStderr: ""},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runRestore(restoreOptions, globalOptions, args)
+		var t tomb.Tomb
+		term := termstatus.New(globalOptions.stdout, globalOptions.stderr, globalOptions.Quiet)
+		t.Go(func() error { term.Run(t.Context(globalOptions.ctx)); return nil })
+
+		err := runRestore(restoreOptions, globalOptions, term, args)
+		if err != nil {
+			return err
+		}
+		t.Kill(nil)
+		return t.Wait()
 	},
 }
 
 // RestoreOptions collects all options for the restore command.
 type RestoreOptions struct {
-	Exclude []string
-	Include []string
-	Target  string
-	Host    string
-	Paths   []string
-	Tags    restic.TagLists
-	Verify  bool
+	Exclude   []string
+	Include   []string
+	Target    string
+	Host      string
+	Paths     []string
+	Tags      restic.TagLists
+	Verify    bool
+	Overwrite string
+	Delete    bool
+	DryRun    bool
+	SeedDir   string
+	Sparse    bool
+
+	StripComponents int
+	Map             []string
+
+	OwnerMode string
+	UIDMap    string
+	GIDMap    string
 }
 
 var restoreOptions RestoreOptions
@@ -51,9 +105,121 @@ func init() {
 	flags.Var(&restoreOptions.Tags, "tag", "only consider snapshots which include this `taglist` for snapshot ID \"latest\"")
 	flags.StringArrayVar(&restoreOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path` for snapshot ID \"latest\"")
 	flags.BoolVar(&restoreOptions.Verify, "verify", false, "verify restored files content")
+	flags.StringVar(&restoreOptions.Overwrite, "overwrite", string(restorer.OverwriteAlways), "overwrite existing files: always, if-changed, if-newer or never")
+	flags.BoolVar(&restoreOptions.Delete, "delete", false, "delete files from the restored directories which are not contained in the snapshot")
+	flags.BoolVarP(&restoreOptions.DryRun, "dry-run", "n", false, "do not write or delete any files, just print what would be done")
+	flags.StringVar(&restoreOptions.SeedDir, "seed-dir", "", "copy matching data from the files in `dir` instead of downloading it")
+	flags.BoolVar(&restoreOptions.Sparse, "sparse", false, "restore files as sparse files, regions which only contain zeros are not written")
+	flags.IntVar(&restoreOptions.StripComponents, "strip-components", 0, "remove `n` leading components from the paths of the restored items")
+	flags.StringArrayVar(&restoreOptions.Map, "map", nil, "restore items below `/old/prefix=/new/prefix` to the new prefix (can be specified multiple times)")
+	addOwnerFlags(flags, &restoreOptions.OwnerMode, &restoreOptions.UIDMap, &restoreOptions.GIDMap)
+}
+
+// addOwnerFlags adds the options --owner-mode, --uid-map and --gid-map, which
+// are shared by the commands restore and mount.
+func addOwnerFlags(flags *pflag.FlagSet, mode, uidMap, gidMap *string) {
+	flags.StringVar(mode, "owner-mode", string(restic.OwnerNumeric), "set the owner of the items using the numeric IDs in the snapshot (numeric), the user and group names (names) or not at all (none)")
+	flags.StringVar(uidMap, "uid-map", "", "read a mapping of users in the snapshot to local users from `file`")
+	flags.StringVar(gidMap, "gid-map", "", "read a mapping of groups in the snapshot to local groups from `file`")
 }
 
-func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
+// readIDMap loads the ID map in the file fn.
+func readIDMap(fn string) (restic.IDMap, error) {
+	if fn == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, errors.Fatalf("unable to open ID map: %v", err)
+	}
+	defer f.Close()
+
+	m, err := restic.ParseIDMap(f)
+	if err != nil {
+		return nil, errors.Fatalf("unable to read ID map %v: %v", fn, err)
+	}
+	return m, nil
+}
+
+// parseOwnerMapper returns the owner mapper for the options --owner-mode,
+// --uid-map and --gid-map.
+func parseOwnerMapper(mode, uidMapFile, gidMapFile string) (*restic.OwnerMapper, error) {
+	ownerMode := restic.OwnerNumeric
+	if mode != "" {
+		var err error
+		ownerMode, err = restic.ParseOwnerMode(mode)
+		if err != nil {
+			return nil, errors.Fatal(err.Error())
+		}
+	}
+
+	uidMap, err := readIDMap(uidMapFile)
+	if err != nil {
+		return nil, err
+	}
+	gidMap, err := readIDMap(gidMapFile)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := restic.NewOwnerMapper(ownerMode, uidMap, gidMap)
+	if err != nil {
+		return nil, errors.Fatal(err.Error())
+	}
+	return m, nil
+}
+
+// parsePathRewriter returns the path rewriter for the options
+// --strip-components and --map.
+func parsePathRewriter(stripComponents int, maps []string) (restic.PathRewriter, error) {
+	if stripComponents < 0 {
+		return restic.PathRewriter{}, errors.Fatal("--strip-components must not be negative")
+	}
+
+	rw := restic.PathRewriter{StripComponents: stripComponents}
+	for _, s := range maps {
+		m, err := restic.ParsePathMapping(s)
+		if err != nil {
+			return restic.PathRewriter{}, errors.Fatal(err.Error())
+		}
+		rw.Maps = append(rw.Maps, m)
+	}
+
+	return rw, nil
+}
+
+// restoreItemJSON is printed for each item when --json is set together with
+// --dry-run or --verbose.
+type restoreItemJSON struct {
+	Item       string          `json:"item"`
+	Action     restorer.Action `json:"action"`
+	StructType string          `json:"struct_type"` // "item"
+}
+
+// restoreSummaryJSON is printed at the end of restore when --json is set.
+type restoreSummaryJSON struct {
+	SnapshotID     *restic.ID `json:"snapshot_id"`
+	Target         string     `json:"target"`
+	Errors         uint       `json:"errors"`
+	Verified       bool       `json:"verified"`
+	VerifiedFiles  int        `json:"verified_files"`
+	DryRun         bool       `json:"dry_run"`
+	Restored       int        `json:"restored"`
+	Overwritten    int        `json:"overwritten"`
+	Unchanged      int        `json:"unchanged"`
+	Skipped        int        `json:"skipped"`
+	Deleted        int        `json:"deleted"`
+	SecondsElapsed uint64     `json:"seconds_elapsed"`
+	TotalFiles     uint       `json:"total_files"`
+	FilesRestored  uint       `json:"files_restored"`
+	TotalBytes     uint64     `json:"total_bytes"`
+	BytesRestored  uint64     `json:"bytes_restored"`
+	OwnerErrors    uint       `json:"owner_errors"`
+	StructType     string     `json:"struct_type"` // "summary"
+}
+
+func runRestore(opts RestoreOptions, gopts GlobalOptions, term *termstatus.Terminal, args []string) error {
 	ctx := gopts.ctx
 
 	switch {
@@ -71,6 +237,33 @@ func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
 		return errors.Fatal("exclude and include patterns are mutually exclusive")
 	}
 
+	overwrite := restorer.OverwriteAlways
+	if opts.Overwrite != "" {
+		var err error
+		overwrite, err = restorer.ParseOverwritePolicy(opts.Overwrite)
+		if err != nil {
+			return errors.Fatal(err.Error())
+		}
+	}
+
+	if opts.DryRun && opts.Verify {
+		return errors.Fatal("--dry-run and --verify are mutually exclusive")
+	}
+
+	rewrite, err := parsePathRewriter(opts.StripComponents, opts.Map)
+	if err != nil {
+		return err
+	}
+
+	if opts.Delete && !rewrite.Identity() {
+		return errors.Fatal("--delete cannot be used together with --strip-components or --map")
+	}
+
+	owners, err := parseOwnerMapper(opts.OwnerMode, opts.UIDMap, opts.GIDMap)
+	if err != nil {
+		return err
+	}
+
 	snapshotIDString := args[0]
 
 	debug.Log("restore %v to %v", snapshotIDString, opts.Target)
@@ -112,17 +305,35 @@ func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
 		Exitf(2, "creating restorer failed: %v\n", err)
 	}
 
-	totalErrors := 0
-	res.Error = func(location string, err error) error {
-		Warnf("ignoring error for %s: %s\n", location, err)
-		totalErrors++
-		return nil
-	}
+	var t tomb.Tomb
+	p := ui.NewRestore(term, gopts.verbosity)
+	p.JSON = gopts.JSON
+	p.DryRun = opts.DryRun
+
+	// use the terminal for stdout/stderr
+	prevStdout, prevStderr := gopts.stdout, gopts.stderr
+	defer func() {
+		gopts.stdout, gopts.stderr = prevStdout, prevStderr
+	}()
+	gopts.stdout, gopts.stderr = p.Stdout(), p.Stderr()
+
+	t.Go(func() error { return p.Run(t.Context(gopts.ctx)) })
+	defer func() {
+		// cleanly shutdown all running goroutines, also when restoring fails
+		p.Finish()
+		t.Kill(nil)
+		_ = t.Wait()
+	}()
+
+	res.Error = p.Error
+	res.ReportTotal = p.ReportTotal
+	res.CompleteBytes = p.CompleteBytes
+	res.CompleteFile = p.CompleteFile
 
 	selectExcludeFilter := func(item string, dstpath string, node *restic.Node) (selectedForRestore bool, childMayBeSelected bool) {
 		matched, _, err := filter.List(opts.Exclude, item)
 		if err != nil {
-			Warnf("error for exclude pattern: %v", err)
+			p.E("error for exclude pattern: %v", err)
 		}
 
 		// An exclude filter is basically a 'wildcard but foo',
@@ -138,7 +349,7 @@ func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
 	selectIncludeFilter := func(item string, dstpath string, node *restic.Node) (selectedForRestore bool, childMayBeSelected bool) {
 		matched, childMayMatch, err := filter.List(opts.Include, item)
 		if err != nil {
-			Warnf("error for include pattern: %v", err)
+			p.E("error for include pattern: %v", err)
 		}
 
 		selectedForRestore = matched
@@ -153,17 +364,108 @@ func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
 		res.SelectFilter = selectIncludeFilter
 	}
 
-	Verbosef("restoring %s to %s\n", res.Snapshot(), opts.Target)
+	res.Overwrite = overwrite
+	res.Delete = opts.Delete
+	res.DryRun = opts.DryRun
+	res.SeedDir = opts.SeedDir
+	res.Sparse = opts.Sparse
+	res.Rewrite = rewrite
+	res.Owners = owners
+
+	actions := make(map[restorer.Action]int)
+	enc := json.NewEncoder(gopts.stdout)
+	res.Report = func(location string, action restorer.Action) {
+		actions[action]++
+
+		// files which are not modified are only listed with --verbose
+		important := action != restorer.ActionUnchanged && action != restorer.ActionSkip
+		if gopts.verbosity < 2 && (!opts.DryRun || !important) {
+			return
+		}
+
+		if gopts.JSON {
+			err := enc.Encode(restoreItemJSON{Item: location, Action: action, StructType: "item"})
+			if err != nil {
+				p.E("JSON encode failed: %v\n", err)
+			}
+			return
+		}
+
+		if opts.DryRun {
+			fmt.Fprintf(gopts.stdout, "would %-9s %s\n", action, location)
+			return
+		}
+		fmt.Fprintf(gopts.stdout, "%-9s %s\n", action, location)
+	}
+
+	if !gopts.JSON {
+		if opts.DryRun {
+			p.P("dry run: restoring %s to %s\n", res.Snapshot(), opts.Target)
+		} else {
+			p.P("restoring %s to %s\n", res.Snapshot(), opts.Target)
+		}
+	}
 
 	err = res.RestoreTo(ctx, opts.Target)
-	if err == nil && opts.Verify {
-		Verbosef("verifying files in %s\n", opts.Target)
-		var count int
+	if err != nil {
+		return err
+	}
+	p.Finish()
+
+	var count int
+	if opts.Verify {
+		if !gopts.JSON {
+			p.P("verifying files in %s\n", opts.Target)
+		}
 		count, err = res.VerifyFiles(ctx, opts.Target)
-		Verbosef("finished verifying %d files in %s\n", count, opts.Target)
+		if err != nil {
+			return err
+		}
+		if !gopts.JSON {
+			p.P("finished verifying %d files in %s\n", count, opts.Target)
+		}
 	}
-	if totalErrors > 0 {
-		Printf("There were %d errors\n", totalErrors)
+
+	summary := p.Summary()
+	if gopts.JSON {
+		err = json.NewEncoder(gopts.stdout).Encode(restoreSummaryJSON{
+			SnapshotID:     &id,
+			Target:         opts.Target,
+			Errors:         summary.ErrorCount,
+			Verified:       opts.Verify,
+			VerifiedFiles:  count,
+			DryRun:         opts.DryRun,
+			Restored:       actions[restorer.ActionRestore],
+			Overwritten:    actions[restorer.ActionOverwrite],
+			Unchanged:      actions[restorer.ActionUnchanged],
+			Skipped:        actions[restorer.ActionSkip],
+			Deleted:        actions[restorer.ActionDelete],
+			SecondsElapsed: summary.SecondsElapsed,
+			TotalFiles:     summary.TotalFiles,
+			FilesRestored:  summary.FilesRestored,
+			TotalBytes:     summary.TotalBytes,
+			BytesRestored:  summary.BytesRestored,
+			OwnerErrors:    res.OwnerErrors(),
+			StructType:     "summary",
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		if opts.DryRun {
+			fmt.Fprintf(gopts.stdout, "would restore %d, overwrite %d and delete %d items, %d items are unchanged or skipped\n",
+				actions[restorer.ActionRestore], actions[restorer.ActionOverwrite], actions[restorer.ActionDelete],
+				actions[restorer.ActionUnchanged]+actions[restorer.ActionSkip])
+		}
+
+		if n := res.OwnerErrors(); n > 0 {
+			fmt.Fprintf(gopts.stdout, "could not restore the owner of %d items, restic is not running as root\n", n)
+		}
+
+		if summary.ErrorCount > 0 {
+			fmt.Fprintf(gopts.stdout, "There were %d errors\n", summary.ErrorCount)
+		}
 	}
-	return err
+
+	return nil
 }
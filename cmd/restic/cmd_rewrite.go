@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/walker"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdRewrite = &cobra.Command{
+	Use:   "rewrite [flags] [snapshotID ...]",
+	Short: "Rewrite snapshots to exclude unwanted files",
+	Long: `
+The "rewrite" command excludes files from existing snapshots. It creates new
+snapshots containing the same data as the original ones, but without the files
+matching the exclude patterns.
+
+By default, the original snapshots are kept and the new snapshots are tagged
+with "rewrite". When --forget is given, the original snapshots are removed
+instead. The data which is no longer referenced by any snapshot is only
+removed from the repository by running "prune" afterwards.
+
+When no snapshot ID is given, all snapshots matching the host, tag and path
+filter criteria are rewritten.
+
+Use --dry-run to list which files would be removed from each snapshot without
+modifying the repository.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRewrite(rewriteOptions, globalOptions, args)
+	},
+}
+
+// RewriteOptions bundles all options for the rewrite command.
+type RewriteOptions struct {
+	Forget bool
+	DryRun bool
+
+	Host  string
+	Tags  restic.TagLists
+	Paths []string
+
+	Excludes     []string
+	ExcludeFiles []string
+}
+
+var rewriteOptions RewriteOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdRewrite)
+
+	f := cmdRewrite.Flags()
+	f.BoolVarP(&rewriteOptions.Forget, "forget", "", false, "remove original snapshots after creating new ones")
+	f.BoolVarP(&rewriteOptions.DryRun, "dry-run", "n", false, "do not do anything, just print what would be done")
+
+	f.StringVarP(&rewriteOptions.Host, "host", "H", "", "only consider snapshots for this `host`, when no snapshot ID is given")
+	f.Var(&rewriteOptions.Tags, "tag", "only consider snapshots which include this `taglist`, when no snapshot ID is given")
+	f.StringArrayVar(&rewriteOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`, when no snapshot ID is given")
+
+	f.StringArrayVarP(&rewriteOptions.Excludes, "exclude", "e", nil, "exclude a `pattern` (can be specified multiple times)")
+	f.StringArrayVar(&rewriteOptions.ExcludeFiles, "exclude-file", nil, "read exclude patterns from a `file` (can be specified multiple times)")
+}
+
+// rewriteTag is added to new snapshots when the original ones are kept.
+const rewriteTag = "rewrite"
+
+// dryRunTreeSaver computes the IDs of trees without saving them.
+type dryRunTreeSaver struct {
+	walker.TreeLoader
+}
+
+func (s dryRunTreeSaver) SaveTree(ctx context.Context, t *restic.Tree) (restic.ID, error) {
+	buf, err := json.Marshal(t)
+	if err != nil {
+		return restic.ID{}, errors.Wrap(err, "MarshalJSON")
+	}
+
+	// the repository appends a newline to each tree
+	buf = append(buf, '\n')
+	return restic.Hash(buf), nil
+}
+
+// filterAndReplaceSnapshot runs filter on the tree of sn. When the tree was
+// modified, a new snapshot with the filtered tree is saved and tagged with
+// addTag, and the old snapshot is removed when forget is set. In dry-run mode,
+// the repository is not modified. It returns whether the snapshot was changed.
+func filterAndReplaceSnapshot(ctx context.Context, repo *repository.Repository, sn *restic.Snapshot,
+	filter func(ctx context.Context, saver walker.TreeLoadSaver, sn *restic.Snapshot) (restic.ID, error),
+	dryRun bool, forget bool, addTag string) (bool, error) {
+
+	if sn.Tree == nil {
+		return false, errors.Errorf("snapshot %v has nil tree", sn.ID().Str())
+	}
+
+	var saver walker.TreeLoadSaver = repo
+	if dryRun {
+		saver = dryRunTreeSaver{repo}
+	}
+
+	filteredTree, err := filter(ctx, saver, sn)
+	if err != nil {
+		return false, err
+	}
+
+	if filteredTree.Equal(*sn.Tree) {
+		Verbosef("snapshot %v not modified\n", sn.ID().Str())
+		return false, nil
+	}
+
+	if dryRun {
+		Printf("would save new snapshot\n")
+		if forget {
+			Printf("would remove old snapshot\n")
+		}
+		return true, nil
+	}
+
+	if err = repo.Flush(ctx); err != nil {
+		return false, err
+	}
+
+	if err = repo.SaveIndex(ctx); err != nil {
+		return false, err
+	}
+
+	oldID := *sn.ID()
+
+	// retain the original snapshot id over all rewrites
+	if sn.Original == nil {
+		sn.Original = &oldID
+	}
+	sn.Tree = &filteredTree
+	if !forget {
+		sn.AddTags([]string{addTag})
+	}
+
+	id, err := repo.SaveJSONUnpacked(ctx, restic.SnapshotFile, sn)
+	if err != nil {
+		return false, err
+	}
+	Verbosef("saved new snapshot %v\n", id.Str())
+
+	if forget {
+		h := restic.Handle{Type: restic.SnapshotFile, Name: oldID.String()}
+		if err = repo.Backend().Remove(ctx, h); err != nil {
+			return false, err
+		}
+		debug.Log("old snapshot %v removed", oldID)
+		Verbosef("removed old snapshot %v\n", oldID.Str())
+	}
+
+	return true, nil
+}
+
+func rewriteSnapshot(ctx context.Context, repo *repository.Repository, sn *restic.Snapshot, opts RewriteOptions, reject walker.RejectByNameFunc) (bool, error) {
+	report := func(path string) {
+		if opts.DryRun {
+			Printf("would remove %s\n", path)
+		} else {
+			Verbosef("removing %s\n", path)
+		}
+	}
+
+	filter := func(ctx context.Context, saver walker.TreeLoadSaver, sn *restic.Snapshot) (restic.ID, error) {
+		return walker.FilterTree(ctx, saver, "/", *sn.Tree, reject, report)
+	}
+
+	// only used when the snapshot is saved again
+	sn.Excludes = append(sn.Excludes, opts.Excludes...)
+
+	return filterAndReplaceSnapshot(ctx, repo, sn, filter, opts.DryRun, opts.Forget, rewriteTag)
+}
+
+func runRewrite(opts RewriteOptions, gopts GlobalOptions, args []string) error {
+	if len(opts.ExcludeFiles) > 0 {
+		excludes, err := readExcludePatternsFromFiles(opts.ExcludeFiles)
+		if err != nil {
+			return err
+		}
+		opts.Excludes = append(opts.Excludes, excludes...)
+	}
+
+	if len(opts.Excludes) == 0 {
+		return errors.Fatal("Nothing to do: no excludes provided")
+	}
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		var lock *restic.Lock
+		if opts.Forget && !opts.DryRun {
+			Verbosef("create exclusive lock for repository\n")
+			lock, err = lockRepoExclusive(repo)
+		} else {
+			lock, err = lockRepo(repo)
+		}
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	if err = repo.LoadIndex(ctx); err != nil {
+		return err
+	}
+
+	reject := walker.RejectByNameFunc(rejectByPattern(opts.Excludes))
+
+	changedCount := 0
+	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, args) {
+		Verbosef("\nsnapshot %s of %v at %s\n", sn.ID().Str(), sn.Paths, sn.Time)
+		changed, err := rewriteSnapshot(ctx, repo, sn, opts, reject)
+		if err != nil {
+			return errors.Fatalf("unable to rewrite snapshot ID %q: %v", sn.ID().Str(), err)
+		}
+		if changed {
+			changedCount++
+		}
+	}
+
+	Verbosef("\n")
+	if changedCount == 0 {
+		Verbosef("no snapshots were modified\n")
+	} else if opts.DryRun {
+		Verbosef("would modify %v snapshots\n", changedCount)
+	} else {
+		Verbosef("modified %v snapshots\n", changedCount)
+	}
+
+	return nil
+}
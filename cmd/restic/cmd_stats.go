@@ -3,13 +3,20 @@ package main
 import (
 	"context"
 	"crypto/sha256"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui/table"
 	"github.com/restic/restic/internal/walker"
 	"github.com/spf13/cobra"
 )
@@ -36,7 +43,18 @@ The modes are:
 * raw-data: Counts the size of blobs in the repository, regardless of
   how many files reference them.
 * blobs-per-file: A combination of files-by-contents and raw-data.
+* unique: Counts the stored size of the blobs which are only referenced by
+  each snapshot, i.e. the space which forgetting the snapshot would free. All
+  snapshots are scanned, if a snapshot is specified only its size is shown.
+  With --group-by, the unique and shared sizes are also shown per group of
+  snapshots.
 * Refer to the online manual for more details about each mode.
+
+With --timeline, the snapshots are listed from the oldest to the newest,
+together with the number and stored size of the blobs each snapshot added to
+the repository, i.e. which were not referenced by any earlier snapshot. The
+snapshots are grouped by host and paths, or by the criteria given with
+--group-by. Use --csv to print the timeline as CSV.
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -47,8 +65,28 @@ The modes are:
 func init() {
 	cmdRoot.AddCommand(cmdStats)
 	f := cmdStats.Flags()
-	f.StringVar(&countMode, "mode", countModeRestoreSize, "counting mode: restore-size (default), files-by-contents, blobs-per-file, or raw-data")
+	f.StringVar(&countMode, "mode", countModeRestoreSize, "counting mode: restore-size (default), files-by-contents, blobs-per-file, raw-data or unique")
 	f.StringVarP(&snapshotByHost, "host", "H", "", "filter latest snapshot by this hostname")
+	f.StringVarP(&statsGroupBy, "group-by", "g", "", "with --mode unique or --timeline, group the snapshots by `host,paths,tags`")
+	f.BoolVar(&statsTimeline, "timeline", false, "show the data added to the repository by each snapshot")
+	f.BoolVar(&statsCSV, "csv", false, "with --timeline, print the timeline as CSV")
+}
+
+// findStatsSnapshot returns the ID of the snapshot given by the user.
+func findStatsSnapshot(ctx context.Context, repo restic.Repository) (restic.ID, error) {
+	if snapshotIDString == "latest" {
+		sID, err := restic.FindLatestSnapshot(ctx, repo, []string{}, []restic.TagList{}, snapshotByHost)
+		if err != nil {
+			return restic.ID{}, errors.Fatalf("latest snapshot for criteria not found: %v", err)
+		}
+		return sID, nil
+	}
+
+	sID, err := restic.FindSnapshot(repo, snapshotIDString)
+	if err != nil {
+		return restic.ID{}, errors.Fatalf("error loading snapshot: %v", err)
+	}
+	return sID, nil
 }
 
 func runStats(gopts GlobalOptions, args []string) error {
@@ -77,10 +115,18 @@ func runStats(gopts GlobalOptions, args []string) error {
 		}
 	}
 
-	if !gopts.JSON {
+	if !gopts.JSON && !statsCSV {
 		Printf("scanning...\n")
 	}
 
+	if statsTimeline {
+		return statsGrowth(ctx, gopts, repo)
+	}
+
+	if countMode == countModeUnique {
+		return statsUnique(ctx, gopts, repo)
+	}
+
 	// create a container for the stats (and other needed state)
 	stats := &statsContainer{
 		uniqueFiles: make(map[fileID]struct{}),
@@ -91,18 +137,9 @@ func runStats(gopts GlobalOptions, args []string) error {
 
 	if snapshotIDString != "" {
 		// scan just a single snapshot
-
-		var sID restic.ID
-		if snapshotIDString == "latest" {
-			sID, err = restic.FindLatestSnapshot(ctx, repo, []string{}, []restic.TagList{}, snapshotByHost)
-			if err != nil {
-				return errors.Fatalf("latest snapshot for criteria not found: %v", err)
-			}
-		} else {
-			sID, err = restic.FindSnapshot(repo, snapshotIDString)
-			if err != nil {
-				return errors.Fatalf("error loading snapshot: %v", err)
-			}
+		sID, err := findStatsSnapshot(ctx, repo)
+		if err != nil {
+			return err
 		}
 
 		snapshot, err := restic.LoadSnapshot(ctx, repo, sID)
@@ -263,10 +300,34 @@ func verifyStatsInput(gopts GlobalOptions, args []string) error {
 	case countModeUniqueFilesByContents:
 	case countModeBlobsPerFile:
 	case countModeRawData:
+	case countModeUnique:
 	default:
 		return fmt.Errorf("unknown counting mode: %s (use the -h flag to get a list of supported modes)", countMode)
 	}
 
+	if statsTimeline {
+		if countMode != countModeRestoreSize {
+			return fmt.Errorf("--timeline cannot be used together with --mode")
+		}
+		if len(args) > 0 {
+			return fmt.Errorf("--timeline always shows all snapshots, no snapshot may be specified")
+		}
+		if statsCSV && gopts.JSON {
+			return fmt.Errorf("--csv and --json cannot be used together")
+		}
+	} else if statsCSV {
+		return fmt.Errorf("--csv can only be used with --timeline")
+	}
+
+	if statsGroupBy != "" {
+		if countMode != countModeUnique && !statsTimeline {
+			return fmt.Errorf("--group-by can only be used with --mode unique or --timeline")
+		}
+		if _, err := parseStatsGroupBy(statsGroupBy); err != nil {
+			return err
+		}
+	}
+
 	// ensure at most one snapshot was specified
 	if len(args) > 1 {
 		return fmt.Errorf("only one snapshot may be specified")
@@ -314,6 +375,14 @@ var (
 	// snapshotByHost is the host to filter latest
 	// snapshot by, if given by user
 	snapshotByHost string
+
+	// statsGroupBy lists the criteria to group the
+	// snapshots by, if given by user
+	statsGroupBy string
+
+	// statsTimeline and statsCSV select the timeline
+	// output and its format
+	statsTimeline, statsCSV bool
 )
 
 const (
@@ -321,4 +390,543 @@ const (
 	countModeUniqueFilesByContents = "files-by-contents"
 	countModeBlobsPerFile          = "blobs-per-file"
 	countModeRawData               = "raw-data"
+	countModeUnique                = "unique"
 )
+
+// statsGrouping selects the criteria for --group-by.
+type statsGrouping struct {
+	host, paths, tags bool
+}
+
+// parseStatsGroupBy parses the comma separated list of criteria in s.
+func parseStatsGroupBy(s string) (statsGrouping, error) {
+	var g statsGrouping
+	for _, option := range strings.Split(s, ",") {
+		switch option {
+		case "host":
+			g.host = true
+		case "paths":
+			g.paths = true
+		case "tags":
+			g.tags = true
+		default:
+			return statsGrouping{}, fmt.Errorf("unknown grouping option: %q", option)
+		}
+	}
+	return g, nil
+}
+
+// statsGroupKey identifies a group of snapshots for --group-by.
+type statsGroupKey struct {
+	Hostname string   `json:"host,omitempty"`
+	Paths    []string `json:"paths,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// key returns the group key for sn.
+func (g statsGrouping) key(sn *restic.Snapshot) statsGroupKey {
+	var k statsGroupKey
+	if g.host {
+		k.Hostname = sn.Hostname
+	}
+	if g.paths {
+		k.Paths = append([]string{}, sn.Paths...)
+		sort.Strings(k.Paths)
+	}
+	if g.tags {
+		k.Tags = append([]string{}, sn.Tags...)
+		sort.Strings(k.Tags)
+	}
+	return k
+}
+
+// String returns a description of the group like the forget command.
+func (k statsGroupKey) String() string {
+	var s []string
+	if k.Hostname != "" {
+		s = append(s, "host ["+k.Hostname+"]")
+	}
+	if k.Paths != nil {
+		s = append(s, "paths ["+strings.Join(k.Paths, ", ")+"]")
+	}
+	if k.Tags != nil {
+		s = append(s, "tags ["+strings.Join(k.Tags, ", ")+"]")
+	}
+	return strings.Join(s, ", ")
+}
+
+// storedBlobSize returns the size of the blob h in the pack files, after it
+// has been compressed and encrypted.
+func storedBlobSize(repo restic.Repository, h restic.BlobHandle) (uint, bool) {
+	blobs, found := repo.Index().Lookup(h.ID, h.Type)
+	if !found {
+		return 0, false
+	}
+	return blobs[0].Length, true
+}
+
+// statsUniqueSize contains the sizes of a snapshot or a group of snapshots in
+// mode unique. The sizes of the blobs are those stored in the repository.
+type statsUniqueSize struct {
+	// TotalSize is the size of all blobs referenced by the snapshot.
+	TotalSize      uint64 `json:"total_size"`
+	TotalBlobCount uint64 `json:"total_blob_count"`
+
+	// UniqueSize is the size of the blobs which are not referenced by any
+	// other snapshot (or group), SharedSize is the remainder.
+	UniqueSize      uint64 `json:"unique_size"`
+	UniqueBlobCount uint64 `json:"unique_blob_count"`
+	SharedSize      uint64 `json:"shared_size"`
+}
+
+// statsUniqueSnapshot is printed for each snapshot in mode unique.
+type statsUniqueSnapshot struct {
+	SnapshotID *restic.ID `json:"snapshot_id"`
+	Time       time.Time  `json:"time"`
+	Hostname   string     `json:"hostname"`
+	Paths      []string   `json:"paths"`
+	Tags       []string   `json:"tags,omitempty"`
+	statsUniqueSize
+}
+
+// statsUniqueGroup is printed for each group of snapshots with --group-by.
+type statsUniqueGroup struct {
+	statsGroupKey
+	Snapshots int `json:"snapshots"`
+	statsUniqueSize
+}
+
+// statsUniqueResult is printed as JSON in mode unique.
+type statsUniqueResult struct {
+	Snapshots []*statsUniqueSnapshot `json:"snapshots"`
+	Groups    []*statsUniqueGroup    `json:"groups,omitempty"`
+}
+
+// loadStatsSnapshots returns all snapshots in the repository, the oldest
+// first.
+func loadStatsSnapshots(ctx context.Context, repo restic.Repository) (restic.Snapshots, error) {
+	var snapshots restic.Snapshots
+	err := repo.List(ctx, restic.SnapshotFile, func(snapshotID restic.ID, size int64) error {
+		sn, err := restic.LoadSnapshot(ctx, repo, snapshotID)
+		if err != nil {
+			return fmt.Errorf("Error loading snapshot %s: %v", snapshotID.Str(), err)
+		}
+		if sn.Tree == nil {
+			return fmt.Errorf("snapshot %s has nil tree", sn.ID().Str())
+		}
+		snapshots = append(snapshots, sn)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+	return snapshots, nil
+}
+
+// groupStatsSnapshots sorts the snapshots into groups according to
+// grouping. It returns the groups in the order of their first snapshot and
+// the index of the group for each snapshot.
+func groupStatsSnapshots(snapshots restic.Snapshots, grouping statsGrouping) (groups []statsGroupKey, index []int) {
+	seen := make(map[string]int)
+	index = make([]int, len(snapshots))
+	for i, sn := range snapshots {
+		k := grouping.key(sn)
+		g, ok := seen[k.String()]
+		if !ok {
+			g = len(groups)
+			seen[k.String()] = g
+			groups = append(groups, k)
+		}
+		index[i] = g
+	}
+	return groups, index
+}
+
+// statsUnique computes the size of the blobs which are only referenced by
+// each snapshot or group of snapshots.
+func statsUnique(ctx context.Context, gopts GlobalOptions, repo restic.Repository) error {
+	var selected *restic.ID
+	if snapshotIDString != "" {
+		sID, err := findStatsSnapshot(ctx, repo)
+		if err != nil {
+			return err
+		}
+		selected = &sID
+	}
+
+	var grouping statsGrouping
+	if statsGroupBy != "" {
+		var err error
+		grouping, err = parseStatsGroupBy(statsGroupBy)
+		if err != nil {
+			return err
+		}
+	}
+
+	snapshots, err := loadStatsSnapshots(ctx, repo)
+	if err != nil {
+		return err
+	}
+
+	keys, snapshotGroup := groupStatsSnapshots(snapshots, grouping)
+	groups := make([]*statsUniqueGroup, len(keys))
+	groupBlobs := make([]restic.BlobSet, len(keys))
+	for i, k := range keys {
+		groups[i] = &statsUniqueGroup{statsGroupKey: k}
+		groupBlobs[i] = restic.NewBlobSet()
+	}
+
+	results := make([]*statsUniqueSnapshot, len(snapshots))
+
+	// owner records the index of the snapshot which references a blob, or -1
+	// if the blob is referenced by more than one snapshot. groupOwner does the
+	// same for the groups, groupBlobs contains the blobs already counted for
+	// each group.
+	owner := make(map[restic.BlobHandle]int)
+	groupOwner := make(map[restic.BlobHandle]int)
+	sizes := make(map[restic.BlobHandle]uint)
+
+	for i, sn := range snapshots {
+		res := &statsUniqueSnapshot{
+			SnapshotID: sn.ID(),
+			Time:       sn.Time,
+			Hostname:   sn.Hostname,
+			Paths:      sn.Paths,
+			Tags:       sn.Tags,
+		}
+		results[i] = res
+
+		g := snapshotGroup[i]
+		groups[g].Snapshots++
+
+		blobs := restic.NewBlobSet()
+		err := restic.FindUsedBlobs(ctx, repo, *sn.Tree, blobs, restic.NewBlobSet())
+		if err != nil {
+			return fmt.Errorf("finding blobs of snapshot %s: %v", sn.ID().Str(), err)
+		}
+
+		for h := range blobs {
+			size, ok := sizes[h]
+			if !ok {
+				size, ok = storedBlobSize(repo, h)
+				if !ok {
+					return fmt.Errorf("blob %v not found", h)
+				}
+				sizes[h] = size
+			}
+
+			res.TotalSize += uint64(size)
+			res.TotalBlobCount++
+
+			if _, ok := owner[h]; ok {
+				owner[h] = -1
+			} else {
+				owner[h] = i
+			}
+
+			if groupBlobs[g].Has(h) {
+				continue
+			}
+			groupBlobs[g].Insert(h)
+			groups[g].TotalSize += uint64(size)
+			groups[g].TotalBlobCount++
+
+			if _, ok := groupOwner[h]; ok {
+				groupOwner[h] = -1
+			} else {
+				groupOwner[h] = g
+			}
+		}
+	}
+
+	for h, i := range owner {
+		if i < 0 {
+			continue
+		}
+		results[i].UniqueSize += uint64(sizes[h])
+		results[i].UniqueBlobCount++
+	}
+
+	for h, g := range groupOwner {
+		if g < 0 {
+			continue
+		}
+		groups[g].UniqueSize += uint64(sizes[h])
+		groups[g].UniqueBlobCount++
+	}
+
+	for _, res := range results {
+		res.SharedSize = res.TotalSize - res.UniqueSize
+	}
+	for _, g := range groups {
+		g.SharedSize = g.TotalSize - g.UniqueSize
+	}
+
+	if selected != nil {
+		for _, res := range results {
+			if res.SnapshotID.Equal(*selected) {
+				results = []*statsUniqueSnapshot{res}
+				break
+			}
+		}
+	}
+
+	if statsGroupBy == "" {
+		groups = nil
+	}
+
+	if gopts.JSON {
+		err = json.NewEncoder(gopts.stdout).Encode(statsUniqueResult{
+			Snapshots: results,
+			Groups:    groups,
+		})
+		if err != nil {
+			return fmt.Errorf("encoding output: %v", err)
+		}
+		return nil
+	}
+
+	tab := table.New()
+	tab.AddColumn("ID", "{{ .ID }}")
+	tab.AddColumn("Time", "{{ .Time }}")
+	tab.AddColumn("Host", "{{ .Host }}")
+	tab.AddColumn("Total", "{{ .Total }}")
+	tab.AddColumn("Unique", "{{ .Unique }}")
+	tab.AddColumn("Shared", "{{ .Shared }}")
+
+	type row struct {
+		ID, Time, Host        string
+		Total, Unique, Shared string
+	}
+
+	for _, res := range results {
+		tab.AddRow(row{
+			ID:     res.SnapshotID.Str(),
+			Time:   res.Time.Local().Format(TimeFormat),
+			Host:   res.Hostname,
+			Total:  formatBytes(res.TotalSize),
+			Unique: formatBytes(res.UniqueSize),
+			Shared: formatBytes(res.SharedSize),
+		})
+	}
+	tab.AddFooter(fmt.Sprintf("%d snapshots", len(results)))
+
+	err = tab.Write(gopts.stdout)
+	if err != nil {
+		return err
+	}
+
+	if len(groups) == 0 {
+		return nil
+	}
+
+	Printf("\n")
+
+	tab = table.New()
+	tab.AddColumn("Group", "{{ .Group }}")
+	tab.AddColumn("Snapshots", "{{ .Snapshots }}")
+	tab.AddColumn("Total", "{{ .Total }}")
+	tab.AddColumn("Unique", "{{ .Unique }}")
+	tab.AddColumn("Shared", "{{ .Shared }}")
+
+	type groupRow struct {
+		Group                 string
+		Snapshots             int
+		Total, Unique, Shared string
+	}
+
+	for _, g := range groups {
+		tab.AddRow(groupRow{
+			Group:     g.String(),
+			Snapshots: g.Snapshots,
+			Total:     formatBytes(g.TotalSize),
+			Unique:    formatBytes(g.UniqueSize),
+			Shared:    formatBytes(g.SharedSize),
+		})
+	}
+	tab.AddFooter(fmt.Sprintf("%d groups", len(groups)))
+
+	return tab.Write(gopts.stdout)
+}
+
+// statsTimelineSnapshot is printed for each snapshot with --timeline.
+type statsTimelineSnapshot struct {
+	SnapshotID *restic.ID `json:"snapshot_id"`
+	Time       time.Time  `json:"time"`
+	Hostname   string     `json:"hostname"`
+	Paths      []string   `json:"paths"`
+	Tags       []string   `json:"tags,omitempty"`
+
+	// NewBlobs and NewBytes count the blobs which are not referenced by any
+	// earlier snapshot, with the sizes stored in the repository.
+	NewBlobs uint64 `json:"new_blobs"`
+	NewBytes uint64 `json:"new_bytes"`
+
+	// RepositoryBlobs and RepositoryBytes count the blobs referenced by this
+	// and all earlier snapshots.
+	RepositoryBlobs uint64 `json:"repository_blobs"`
+	RepositoryBytes uint64 `json:"repository_bytes"`
+}
+
+// statsTimelineGroup is printed for each group of snapshots with --timeline.
+type statsTimelineGroup struct {
+	statsGroupKey
+	NewBlobs  uint64                   `json:"new_blobs"`
+	NewBytes  uint64                   `json:"new_bytes"`
+	Snapshots []*statsTimelineSnapshot `json:"snapshots"`
+}
+
+// statsGrowth computes how many blobs each snapshot added to the repository,
+// in the order in which the snapshots were made.
+func statsGrowth(ctx context.Context, gopts GlobalOptions, repo restic.Repository) error {
+	groupBy := statsGroupBy
+	if groupBy == "" {
+		groupBy = "host,paths"
+	}
+	grouping, err := parseStatsGroupBy(groupBy)
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := loadStatsSnapshots(ctx, repo)
+	if err != nil {
+		return err
+	}
+
+	keys, snapshotGroup := groupStatsSnapshots(snapshots, grouping)
+	groups := make([]*statsTimelineGroup, len(keys))
+	for i, k := range keys {
+		groups[i] = &statsTimelineGroup{statsGroupKey: k}
+	}
+
+	// known contains all blobs referenced by the snapshots processed so far,
+	// trees in seen have already been traversed and are skipped
+	known := restic.NewBlobSet()
+	seen := restic.NewBlobSet()
+	var repoBlobs, repoBytes uint64
+
+	for i, sn := range snapshots {
+		blobs := restic.NewBlobSet()
+		err := restic.FindUsedBlobs(ctx, repo, *sn.Tree, blobs, seen)
+		if err != nil {
+			return fmt.Errorf("finding blobs of snapshot %s: %v", sn.ID().Str(), err)
+		}
+
+		res := &statsTimelineSnapshot{
+			SnapshotID: sn.ID(),
+			Time:       sn.Time,
+			Hostname:   sn.Hostname,
+			Paths:      sn.Paths,
+			Tags:       sn.Tags,
+		}
+
+		for h := range blobs {
+			if known.Has(h) {
+				continue
+			}
+			known.Insert(h)
+
+			size, found := storedBlobSize(repo, h)
+			if !found {
+				return fmt.Errorf("blob %v not found", h)
+			}
+			res.NewBlobs++
+			res.NewBytes += uint64(size)
+		}
+
+		repoBlobs += res.NewBlobs
+		repoBytes += res.NewBytes
+		res.RepositoryBlobs = repoBlobs
+		res.RepositoryBytes = repoBytes
+
+		g := groups[snapshotGroup[i]]
+		g.NewBlobs += res.NewBlobs
+		g.NewBytes += res.NewBytes
+		g.Snapshots = append(g.Snapshots, res)
+	}
+
+	switch {
+	case gopts.JSON:
+		err = json.NewEncoder(gopts.stdout).Encode(groups)
+		if err != nil {
+			return fmt.Errorf("encoding output: %v", err)
+		}
+		return nil
+	case statsCSV:
+		return printStatsTimelineCSV(gopts.stdout, groups)
+	}
+
+	for _, g := range groups {
+		Printf("snapshots for (%s):\n", g.String())
+
+		tab := table.New()
+		tab.AddColumn("ID", "{{ .ID }}")
+		tab.AddColumn("Time", "{{ .Time }}")
+		tab.AddColumn("New Blobs", "{{ .NewBlobs }}")
+		tab.AddColumn("Added", "{{ .Added }}")
+		tab.AddColumn("Repository", "{{ .Repository }}")
+
+		type row struct {
+			ID, Time          string
+			NewBlobs          uint64
+			Added, Repository string
+		}
+
+		for _, res := range g.Snapshots {
+			tab.AddRow(row{
+				ID:         res.SnapshotID.Str(),
+				Time:       res.Time.Local().Format(TimeFormat),
+				NewBlobs:   res.NewBlobs,
+				Added:      formatBytes(res.NewBytes),
+				Repository: formatBytes(res.RepositoryBytes),
+			})
+		}
+		tab.AddFooter(fmt.Sprintf("%d snapshots added %d blobs, %s", len(g.Snapshots), g.NewBlobs, formatBytes(g.NewBytes)))
+
+		err = tab.Write(gopts.stdout)
+		if err != nil {
+			return err
+		}
+		Printf("\n")
+	}
+
+	Printf("%d snapshots reference %d blobs, %s\n", len(snapshots), repoBlobs, formatBytes(repoBytes))
+	return nil
+}
+
+// printStatsTimelineCSV writes the timeline to wr as CSV, with one line for
+// each snapshot.
+func printStatsTimelineCSV(wr io.Writer, groups []*statsTimelineGroup) error {
+	w := csv.NewWriter(wr)
+	err := w.Write([]string{"host", "paths", "tags", "snapshot_id", "time",
+		"new_blobs", "new_bytes", "repository_blobs", "repository_bytes"})
+	if err != nil {
+		return err
+	}
+
+	for _, g := range groups {
+		for _, res := range g.Snapshots {
+			err := w.Write([]string{
+				res.Hostname,
+				strings.Join(res.Paths, ","),
+				strings.Join(res.Tags, ","),
+				res.SnapshotID.String(),
+				res.Time.Format(time.RFC3339),
+				strconv.FormatUint(res.NewBlobs, 10),
+				strconv.FormatUint(res.NewBytes, 10),
+				strconv.FormatUint(res.RepositoryBlobs, 10),
+				strconv.FormatUint(res.RepositoryBytes, 10),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
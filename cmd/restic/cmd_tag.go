@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/spf13/cobra"
 
@@ -23,6 +24,7 @@ add tags to/remove tags from the existing set.
 When no snapshot-ID is given, all snapshots matching the host, tag and path filter criteria are modified.
 `,
 	DisableAutoGenTag: true,
+	Annotations:       map[string]string{annotationJSONMessagesToStderr: ""},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return runTag(tagOptions, globalOptions, args)
 	},
@@ -53,8 +55,9 @@ func init() {
 	tagFlags.StringArrayVar(&tagOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`, when no snapshot-ID is given")
 }
 
-func changeTags(ctx context.Context, repo *repository.Repository, sn *restic.Snapshot, setTags, addTags, removeTags []string) (bool, error) {
-	var changed bool
+// changeTags modifies the tags of sn and saves it as a new snapshot. It
+// returns the ID of the new snapshot if the tags were changed.
+func changeTags(ctx context.Context, repo *repository.Repository, sn *restic.Snapshot, setTags, addTags, removeTags []string) (newID restic.ID, changed bool, err error) {
 
 	if len(setTags) != 0 {
 		// Setting the tag to an empty string really means no tags.
@@ -77,26 +80,40 @@ func changeTags(ctx context.Context, repo *repository.Repository, sn *restic.Sna
 		}
 
 		// Save the new snapshot.
-		id, err := repo.SaveJSONUnpacked(ctx, restic.SnapshotFile, sn)
+		newID, err = repo.SaveJSONUnpacked(ctx, restic.SnapshotFile, sn)
 		if err != nil {
-			return false, err
+			return restic.ID{}, false, err
 		}
 
-		debug.Log("new snapshot saved as %v", id)
+		debug.Log("new snapshot saved as %v", newID)
 
 		if err = repo.Flush(ctx); err != nil {
-			return false, err
+			return restic.ID{}, false, err
 		}
 
 		// Remove the old snapshot.
 		h := restic.Handle{Type: restic.SnapshotFile, Name: sn.ID().String()}
 		if err = repo.Backend().Remove(ctx, h); err != nil {
-			return false, err
+			return restic.ID{}, false, err
 		}
 
 		debug.Log("old snapshot %v removed", sn.ID())
 	}
-	return changed, nil
+	return newID, changed, nil
+}
+
+// changedSnapshotJSON is printed for each modified snapshot when --json is set.
+type changedSnapshotJSON struct {
+	OldSnapshotID *restic.ID `json:"old_snapshot_id"`
+	NewSnapshotID restic.ID  `json:"new_snapshot_id"`
+	Tags          []string   `json:"tags"`
+	StructType    string     `json:"struct_type"` // "changed_snapshot"
+}
+
+// tagSummaryJSON is printed at the end of tag when --json is set.
+type tagSummaryJSON struct {
+	ChangedSnapshots int    `json:"changed_snapshots"`
+	StructType       string `json:"struct_type"` // "summary"
 }
 
 func runTag(opts TagOptions, gopts GlobalOptions, args []string) error {
@@ -122,18 +139,35 @@ func runTag(opts TagOptions, gopts GlobalOptions, args []string) error {
 	}
 
 	changeCnt := 0
+	enc := json.NewEncoder(gopts.stdout)
 	ctx, cancel := context.WithCancel(gopts.ctx)
 	defer cancel()
 	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, args) {
-		changed, err := changeTags(ctx, repo, sn, opts.SetTags, opts.AddTags, opts.RemoveTags)
+		newID, changed, err := changeTags(ctx, repo, sn, opts.SetTags, opts.AddTags, opts.RemoveTags)
 		if err != nil {
 			Warnf("unable to modify the tags for snapshot ID %q, ignoring: %v\n", sn.ID(), err)
 			continue
 		}
 		if changed {
 			changeCnt++
+			if gopts.JSON {
+				err = enc.Encode(changedSnapshotJSON{
+					OldSnapshotID: sn.ID(),
+					NewSnapshotID: newID,
+					Tags:          sn.Tags,
+					StructType:    "changed_snapshot",
+				})
+				if err != nil {
+					return err
+				}
+			}
 		}
 	}
+
+	if gopts.JSON {
+		return enc.Encode(tagSummaryJSON{ChangedSnapshots: changeCnt, StructType: "summary"})
+	}
+
 	if changeCnt == 0 {
 		Verbosef("no snapshots were modified\n")
 	} else {
@@ -3,8 +3,11 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
 	"time"
 
+	"github.com/restic/restic/internal/errors"
+
 	"github.com/restic/restic/internal/restic"
 )
 
@@ -25,6 +28,43 @@ func formatBytes(c uint64) string {
 	}
 }
 
+// parseSizeStr parses a size with an optional suffix b/B, k/K, m/M, g/G or
+// t/T (binary units) and returns the number of bytes.
+func parseSizeStr(sizeStr string) (int64, error) {
+	if sizeStr == "" {
+		return 0, errors.New("expected size, got empty string")
+	}
+
+	numStr := sizeStr[:len(sizeStr)-1]
+	var unit int64 = 1
+
+	switch sizeStr[len(sizeStr)-1] {
+	case 'b', 'B':
+		// use initialized values, do nothing here
+	case 'k', 'K':
+		unit = 1 << 10
+	case 'm', 'M':
+		unit = 1 << 20
+	case 'g', 'G':
+		unit = 1 << 30
+	case 't', 'T':
+		unit = 1 << 40
+	default:
+		numStr = sizeStr
+	}
+
+	value, err := strconv.ParseInt(numStr, 10, 64)
+	if err != nil {
+		return 0, errors.Errorf("invalid size %q", sizeStr)
+	}
+
+	if value < 0 {
+		return 0, errors.Errorf("size %q must not be negative", sizeStr)
+	}
+
+	return value * unit, nil
+}
+
 func formatSeconds(sec uint64) string {
 	hours := sec / 3600
 	sec -= hours * 3600
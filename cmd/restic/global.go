@@ -23,6 +23,7 @@ import (
 	"github.com/restic/restic/internal/backend/sftp"
 	"github.com/restic/restic/internal/backend/swift"
 	"github.com/restic/restic/internal/cache"
+	"github.com/restic/restic/internal/compression"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/limiter"
@@ -57,6 +58,7 @@ type GlobalOptions struct {
 	CACerts         []string
 	TLSClientCert   string
 	CleanupCache    bool
+	Compression     compression.Mode
 
 	LimitUploadKb   int
 	LimitDownloadKb int
@@ -73,11 +75,19 @@ type GlobalOptions struct {
 	//  3 means: print very detailed debug messages, this is used when --verbose 2 is specified
 	verbosity uint
 
+	// jsonMessagesToStderr is set for commands which write their messages to
+	// stderr when --json is given, see annotationJSONMessagesToStderr.
+	jsonMessagesToStderr bool
+
 	Options []string
 
 	extended options.Options
 }
 
+// annotationJSONMessagesToStderr marks commands which print JSON to stdout
+// when --json is given and write all other messages to stderr.
+const annotationJSONMessagesToStderr = "json-messages-to-stderr"
+
 var globalOptions = GlobalOptions{
 	stdout: os.Stdout,
 	stderr: os.Stderr,
@@ -105,6 +115,7 @@ func init() {
 	f.StringSliceVar(&globalOptions.CACerts, "cacert", nil, "`file` to load root certificates from (default: use system certificates)")
 	f.StringVar(&globalOptions.TLSClientCert, "tls-client-cert", "", "path to a file containing PEM encoded TLS client certificate and private key")
 	f.BoolVar(&globalOptions.CleanupCache, "cleanup-cache", false, "auto remove old cache directories")
+	f.Var(&globalOptions.Compression, "compression", "compression `mode` for new data, only used with repository version 2 (auto|off|max)")
 	f.IntVar(&globalOptions.LimitUploadKb, "limit-upload", 0, "limits uploads to a maximum rate in KiB/s. (default: unlimited)")
 	f.IntVar(&globalOptions.LimitDownloadKb, "limit-download", 0, "limits downloads to a maximum rate in KiB/s. (default: unlimited)")
 	f.StringSliceVarP(&globalOptions.Options, "option", "o", []string{}, "set extended option (`key=value`, can be specified multiple times)")
@@ -188,10 +199,20 @@ func Printf(format string, args ...interface{}) {
 }
 
 // Verbosef calls Printf to write the message when the verbose flag is set.
+// For commands annotated with annotationJSONMessagesToStderr, the message is
+// written to stderr instead when JSON output is requested, so that stdout only
+// contains JSON.
 func Verbosef(format string, args ...interface{}) {
-	if globalOptions.verbosity >= 1 {
-		Printf(format, args...)
+	if globalOptions.verbosity < 1 {
+		return
+	}
+
+	if globalOptions.JSON && globalOptions.jsonMessagesToStderr {
+		Warnf(format, args...)
+		return
 	}
+
+	Printf(format, args...)
 }
 
 // PrintProgress wraps fmt.Printf to handle the difference in writing progress
@@ -239,7 +260,9 @@ func Exitf(exitcode int, format string, args ...interface{}) {
 }
 
 // resolvePassword determines the password to be used for opening the repository.
-func resolvePassword(opts GlobalOptions) (string, error) {
+// When neither a password file nor a password command is set, the password is
+// taken from the environment variable envStr.
+func resolvePassword(opts GlobalOptions, envStr string) (string, error) {
 	if opts.PasswordFile != "" && opts.PasswordCommand != "" {
 		return "", errors.Fatalf("Password file and command are mutually exclusive options")
 	}
@@ -264,7 +287,7 @@ func resolvePassword(opts GlobalOptions) (string, error) {
 		return strings.TrimSpace(string(s)), errors.Wrap(err, "Readfile")
 	}
 
-	if pwd := os.Getenv("RESTIC_PASSWORD"); pwd != "" {
+	if pwd := os.Getenv(envStr); pwd != "" {
 		return pwd, nil
 	}
 
@@ -361,11 +384,15 @@ func OpenRepository(opts GlobalOptions) (*repository.Repository, error) {
 		return nil, err
 	}
 
+	// backends which can pass the role of the key on to a server
+	roleSetter, _ := be.(interface{ SetKeyRole(string) })
+
 	be = backend.NewRetryBackend(be, 10, func(msg string, err error, d time.Duration) {
 		Warnf("%v returned error, retrying after %v: %v\n", msg, d, err)
 	})
 
 	s := repository.New(be)
+	s.SetCompression(opts.Compression)
 
 	opts.password, err = ReadPassword(opts, "enter password for repository: ")
 	if err != nil {
@@ -377,6 +404,10 @@ func OpenRepository(opts GlobalOptions) (*repository.Repository, error) {
 		return nil, err
 	}
 
+	if roleSetter != nil {
+		roleSetter.SetKeyRole(string(s.KeyRole()))
+	}
+
 	if stdoutIsTerminal() {
 		id := s.Config().ID
 		if len(id) > 8 {
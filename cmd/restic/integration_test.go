@@ -1,18 +1,24 @@
 package main
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bufio"
 	"bytes"
 	"context"
 	"crypto/rand"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	mrand "math/rand"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
 	"syscall"
 	"testing"
@@ -50,7 +56,7 @@ func testRunInit(t testing.TB, opts GlobalOptions) {
 	restic.TestDisableCheckPolynomial(t)
 	restic.TestSetLockTimeout(t, 0)
 
-	rtest.OK(t, runInit(opts, nil))
+	rtest.OK(t, runInit(InitOptions{}, opts, nil))
 	t.Logf("repository initialized at %v", opts.Repo)
 }
 
@@ -90,6 +96,38 @@ func testRunList(t testing.TB, tpe string, opts GlobalOptions) restic.IDs {
 	return parseIDsFromReader(t, buf)
 }
 
+// testRunRestoreOptions runs the restore command with a terminal writing to
+// gopts.stdout and gopts.stderr.
+// withTermStatus runs fn with a terminal which writes to the output of gopts.
+func withTermStatus(gopts GlobalOptions, fn func(term *termstatus.Terminal) error) error {
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	var wg errgroup.Group
+	term := termstatus.New(gopts.stdout, gopts.stderr, gopts.Quiet)
+	wg.Go(func() error { term.Run(ctx); return nil })
+
+	err := fn(term)
+
+	cancel()
+	if werr := wg.Wait(); werr != nil && err == nil {
+		err = werr
+	}
+	return err
+}
+
+func testRunRestoreOptions(opts RestoreOptions, gopts GlobalOptions, args []string) error {
+	return withTermStatus(gopts, func(term *termstatus.Terminal) error {
+		return runRestore(opts, gopts, term, args)
+	})
+}
+
+func testRunHistory(opts HistoryOptions, gopts GlobalOptions, args []string) error {
+	return withTermStatus(gopts, func(term *termstatus.Terminal) error {
+		return runHistory(opts, gopts, term, args)
+	})
+}
+
 func testRunRestore(t testing.TB, opts GlobalOptions, dir string, snapshotID restic.ID) {
 	testRunRestoreExcludes(t, opts, dir, snapshotID, nil)
 }
@@ -101,7 +139,7 @@ func testRunRestoreLatest(t testing.TB, gopts GlobalOptions, dir string, paths [
 		Paths:  paths,
 	}
 
-	rtest.OK(t, runRestore(opts, gopts, []string{"latest"}))
+	rtest.OK(t, testRunRestoreOptions(opts, gopts, []string{"latest"}))
 }
 
 func testRunRestoreExcludes(t testing.TB, gopts GlobalOptions, dir string, snapshotID restic.ID, excludes []string) {
@@ -110,7 +148,7 @@ func testRunRestoreExcludes(t testing.TB, gopts GlobalOptions, dir string, snaps
 		Exclude: excludes,
 	}
 
-	rtest.OK(t, runRestore(opts, gopts, []string{snapshotID.String()}))
+	rtest.OK(t, testRunRestoreOptions(opts, gopts, []string{snapshotID.String()}))
 }
 
 func testRunRestoreIncludes(t testing.TB, gopts GlobalOptions, dir string, snapshotID restic.ID, includes []string) {
@@ -119,7 +157,7 @@ func testRunRestoreIncludes(t testing.TB, gopts GlobalOptions, dir string, snaps
 		Include: includes,
 	}
 
-	rtest.OK(t, runRestore(opts, gopts, []string{snapshotID.String()}))
+	rtest.OK(t, testRunRestoreOptions(opts, gopts, []string{snapshotID.String()}))
 }
 
 func testRunCheck(t testing.TB, gopts GlobalOptions) {
@@ -173,6 +211,10 @@ func testRunLs(t testing.TB, gopts GlobalOptions, snapshotID string) []string {
 }
 
 func testRunFind(t testing.TB, wantJSON bool, gopts GlobalOptions, pattern string) []byte {
+	return testRunFindOptions(t, wantJSON, gopts, FindOptions{}, pattern)
+}
+
+func testRunFindOptions(t testing.TB, wantJSON bool, gopts GlobalOptions, opts FindOptions, patterns ...string) []byte {
 	buf := bytes.NewBuffer(nil)
 	globalOptions.stdout = buf
 	globalOptions.JSON = wantJSON
@@ -181,9 +223,7 @@ func testRunFind(t testing.TB, wantJSON bool, gopts GlobalOptions, pattern strin
 		globalOptions.JSON = false
 	}()
 
-	opts := FindOptions{}
-
-	rtest.OK(t, runFind(opts, gopts, []string{pattern}))
+	rtest.OK(t, runFind(opts, gopts, patterns))
 
 	return buf.Bytes()
 }
@@ -220,7 +260,19 @@ func testRunForget(t testing.TB, gopts GlobalOptions, args ...string) {
 }
 
 func testRunPrune(t testing.TB, gopts GlobalOptions) {
-	rtest.OK(t, runPrune(gopts))
+	// remove all unused data
+	testRunPruneWithOptions(t, PruneOptions{MaxUnused: "0%"}, gopts)
+}
+
+func testRunPruneWithOptions(t testing.TB, opts PruneOptions, gopts GlobalOptions) {
+	rtest.OK(t, runPrune(opts, gopts))
+}
+
+func testSetupBackupData(t testing.TB, env *testEnvironment) string {
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	testRunInit(t, env.gopts)
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+	return datafile
 }
 
 func TestBackup(t *testing.T) {
@@ -288,6 +340,76 @@ func TestBackup(t *testing.T) {
 	testRunCheck(t, env.gopts)
 }
 
+func TestBackupDryRun(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{DryRun: true}
+
+	// dry run backup of an empty repository
+	stat := dirStats(env.repo)
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+	rtest.Equals(t, stat, dirStats(env.repo))
+	rtest.Equals(t, 0, len(testRunList(t, "snapshots", env.gopts)))
+	rtest.Equals(t, 0, len(testRunList(t, "packs", env.gopts)))
+
+	// dry run backup with a parent snapshot and a new file
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, BackupOptions{}, env.gopts)
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(env.testdata, "newfile"), []byte("foobar"), 0644))
+
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	packIDs := testRunList(t, "packs", env.gopts)
+	indexIDs := testRunList(t, "index", env.gopts)
+	stat = dirStats(env.repo)
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, opts, env.gopts)
+	rtest.Equals(t, stat, dirStats(env.repo))
+	rtest.Equals(t, snapshotIDs, testRunList(t, "snapshots", env.gopts))
+	rtest.Equals(t, packIDs, testRunList(t, "packs", env.gopts))
+	rtest.Equals(t, indexIDs, testRunList(t, "index", env.gopts))
+
+	testRunCheck(t, env.gopts)
+}
+
+func TestBackupTar(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := testSetupBackupData(t, env)
+
+	testRunBackup(t, "", nil, BackupOptions{TarFile: datafile}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestore(t, env.gopts, restoredir, snapshotIDs[0])
+	rtest.Assert(t, directoriesEqualContents(env.testdata, restoredir),
+		"directories are not equal")
+
+	// read the same archive from stdin, the first snapshot is used as parent
+	f, err := os.Open(datafile)
+	rtest.OK(t, err)
+	defer f.Close()
+
+	stdin := os.Stdin
+	os.Stdin = f
+	defer func() {
+		os.Stdin = stdin
+	}()
+
+	testRunBackup(t, "", nil, BackupOptions{StdinTar: true}, env.gopts)
+	newest, _ := testRunSnapshots(t, env.gopts)
+	rtest.Assert(t, newest.Parent != nil && *newest.Parent == snapshotIDs[0],
+		"second snapshot does not use the first one as parent")
+	rtest.Equals(t, []string{"/"}, newest.Paths)
+
+	rtest.Assert(t, runBackup(BackupOptions{StdinTar: true, ExcludeOtherFS: true}, env.gopts, nil, nil) != nil,
+		"backup with --stdin-tar and --one-file-system succeeded")
+
+	testRunCheck(t, env.gopts)
+}
+
 func TestBackupNonExistingFile(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -578,6 +700,325 @@ func TestTag(t *testing.T) {
 		"expected original ID to be set to the first snapshot id")
 }
 
+func testRunCopy(t testing.TB, srcGopts GlobalOptions, dstGopts GlobalOptions) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	passwordFile := filepath.Join(tempdir, "password")
+	rtest.OK(t, ioutil.WriteFile(passwordFile, []byte(dstGopts.password), 0600))
+
+	copyOpts := CopyOptions{
+		Repo:         dstGopts.Repo,
+		PasswordFile: passwordFile,
+	}
+
+	rtest.OK(t, runCopy(copyOpts, srcGopts, nil))
+}
+
+func TestCopy(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{}
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, opts, env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "3")}, opts, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	testRunInit(t, env2.gopts)
+	testRunCopy(t, env.gopts, env2.gopts)
+
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	copiedSnapshotIDs := testRunList(t, "snapshots", env2.gopts)
+
+	// Check that the copies size seems reasonable
+	rtest.Assert(t, len(snapshotIDs) == len(copiedSnapshotIDs), "expected %v snapshots, found %v",
+		len(snapshotIDs), len(copiedSnapshotIDs))
+	stat := dirStats(env.repo)
+	stat2 := dirStats(env2.repo)
+	sizeDiff := int64(stat.size) - int64(stat2.size)
+	if sizeDiff < 0 {
+		sizeDiff = -sizeDiff
+	}
+	rtest.Assert(t, sizeDiff < int64(stat.size)/50, "expected less than 2%% size difference: %v vs. %v",
+		stat.size, stat2.size)
+
+	// Check integrity of the copy
+	testRunCheck(t, env2.gopts)
+
+	// Check that the copied snapshots have the same tree contents as the old ones (= identical tree hash)
+	origRestores := make(map[string]struct{})
+	for i, snapshotID := range snapshotIDs {
+		restoredir := filepath.Join(env.base, fmt.Sprintf("restore%d", i))
+		origRestores[restoredir] = struct{}{}
+		testRunRestore(t, env.gopts, restoredir, snapshotID)
+	}
+	for i, snapshotID := range copiedSnapshotIDs {
+		restoredir := filepath.Join(env2.base, fmt.Sprintf("restore%d", i))
+		testRunRestore(t, env2.gopts, restoredir, snapshotID)
+		foundMatch := false
+		for cmpdir := range origRestores {
+			if directoriesEqualContents(restoredir, cmpdir) {
+				delete(origRestores, cmpdir)
+				foundMatch = true
+			}
+		}
+
+		rtest.Assert(t, foundMatch, "found no counterpart for snapshot %v", snapshotID)
+	}
+
+	rtest.Assert(t, len(origRestores) == 0, "found not copied snapshots")
+}
+
+func TestCopyIncremental(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+	env2, cleanup2 := withTestEnvironment(t)
+	defer cleanup2()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{}
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, opts, env.gopts)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, opts, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	testRunInit(t, env2.gopts)
+	testRunCopy(t, env.gopts, env2.gopts)
+
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	copiedSnapshotIDs := testRunList(t, "snapshots", env2.gopts)
+
+	// Check that the copies size seems reasonable
+	testRunCheck(t, env2.gopts)
+	rtest.Assert(t, len(snapshotIDs) == len(copiedSnapshotIDs), "expected %v snapshots, found %v",
+		len(snapshotIDs), len(copiedSnapshotIDs))
+
+	// check that no snapshots are copied, as there are no new ones
+	testRunCopy(t, env.gopts, env2.gopts)
+	testRunCheck(t, env2.gopts)
+	copiedSnapshotIDs = testRunList(t, "snapshots", env2.gopts)
+	rtest.Assert(t, len(snapshotIDs) == len(copiedSnapshotIDs), "still expected %v snapshots, found %v",
+		len(snapshotIDs), len(copiedSnapshotIDs))
+
+	// check that only new snapshots are copied
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "3")}, opts, env.gopts)
+	testRunCopy(t, env.gopts, env2.gopts)
+	testRunCheck(t, env2.gopts)
+	snapshotIDs = testRunList(t, "snapshots", env.gopts)
+	copiedSnapshotIDs = testRunList(t, "snapshots", env2.gopts)
+	rtest.Assert(t, len(snapshotIDs) == len(copiedSnapshotIDs), "still expected %v snapshots, found %v",
+		len(snapshotIDs), len(copiedSnapshotIDs))
+
+	// also test the reverse direction
+	testRunCopy(t, env2.gopts, env.gopts)
+	testRunCheck(t, env.gopts)
+	snapshotIDs = testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == len(copiedSnapshotIDs), "still expected %v snapshots, found %v",
+		len(copiedSnapshotIDs), len(snapshotIDs))
+}
+
+func testRunRewrite(t testing.TB, opts RewriteOptions, gopts GlobalOptions, args ...string) {
+	rtest.OK(t, runRewrite(opts, gopts, args))
+}
+
+func TestRewrite(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	backupDir := filepath.Join(env.testdata, "0", "0", "9")
+	testRunBackup(t, "", []string{backupDir}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+
+	excluded := filepath.ToSlash(filepath.Join(backupDir, "3"))
+	opts := RewriteOptions{Excludes: []string{excluded}}
+
+	// a dry run must not modify the repository
+	dryRunOpts := opts
+	dryRunOpts.DryRun = true
+	testRunRewrite(t, dryRunOpts, env.gopts)
+	rtest.Equals(t, snapshotIDs, testRunList(t, "snapshots", env.gopts))
+
+	// keep the original snapshot
+	testRunRewrite(t, opts, env.gopts)
+	newSnapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(newSnapshotIDs) == 2, "expected two snapshots, got %v", newSnapshotIDs)
+	testRunCheck(t, env.gopts)
+
+	var rewrittenID restic.ID
+	for _, id := range newSnapshotIDs {
+		if !id.Equal(snapshotIDs[0]) {
+			rewrittenID = id
+		}
+	}
+
+	for _, line := range testRunLs(t, env.gopts, rewrittenID.String()) {
+		rtest.Assert(t, line != excluded && !strings.HasPrefix(line, excluded+"/"),
+			"excluded path %v found in rewritten snapshot", line)
+	}
+
+	// rewriting the new snapshot again does not change anything
+	testRunRewrite(t, opts, env.gopts, rewrittenID.String())
+	rtest.Equals(t, 2, len(testRunList(t, "snapshots", env.gopts)))
+
+	// replace the original snapshot
+	opts.Forget = true
+	testRunRewrite(t, opts, env.gopts, snapshotIDs[0].String())
+	newSnapshotIDs = testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(newSnapshotIDs) == 2, "expected two snapshots, got %v", newSnapshotIDs)
+	for _, id := range newSnapshotIDs {
+		rtest.Assert(t, !id.Equal(snapshotIDs[0]), "original snapshot %v was not removed", id.Str())
+	}
+
+	// the trees of the original snapshot are now unused
+	testRunPrune(t, env.gopts)
+	testRunCheck(t, env.gopts)
+}
+
+// testListPacksByType returns all packs which contain blobs of type tpe.
+func testListPacksByType(t testing.TB, gopts GlobalOptions, tpe restic.BlobType) restic.IDSet {
+	repo, err := OpenRepository(gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.LoadIndex(gopts.ctx))
+
+	packs := restic.NewIDSet()
+	for pb := range repo.Index().Each(gopts.ctx) {
+		if pb.Type == tpe {
+			packs.Insert(pb.PackID)
+		}
+	}
+	return packs
+}
+
+func testPackFilename(env *testEnvironment, id restic.ID) string {
+	return filepath.Join(env.repo, "data", id.String()[:2], id.String())
+}
+
+func TestRepairPacks(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	// damage the pack in the repository, not a cached copy
+	env.gopts.NoCache = true
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	// flip a byte in the middle of a data pack
+	packs := testListPacksByType(t, env.gopts, restic.DataBlob)
+	rtest.Assert(t, len(packs) > 0, "no data packs found")
+	damaged := packs.List()[0]
+	filename := testPackFilename(env, damaged)
+
+	buf, err := ioutil.ReadFile(filename)
+	rtest.OK(t, err)
+	buf[len(buf)/2] ^= 0xff
+	rtest.OK(t, os.Chmod(filename, 0600))
+	rtest.OK(t, ioutil.WriteFile(filename, buf, 0600))
+
+	_, err = testRunCheckOutput(env.gopts)
+	rtest.Assert(t, err != nil, "check did not detect the damaged pack")
+
+	rtest.OK(t, runRepairPacks(env.gopts, nil))
+	_, err = os.Stat(filename)
+	rtest.Assert(t, os.IsNotExist(err), "damaged pack %v was not removed", damaged.Str())
+
+	// the snapshot still references the lost blob
+	_, err = testRunCheckOutput(env.gopts)
+	rtest.Assert(t, err != nil, "check did not detect the lost blob")
+
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+
+	// a dry run must not modify the repository
+	rtest.OK(t, runRepairSnapshots(RepairSnapshotsOptions{DryRun: true}, env.gopts, nil))
+	rtest.Equals(t, snapshotIDs, testRunList(t, "snapshots", env.gopts))
+
+	rtest.OK(t, runRepairSnapshots(RepairSnapshotsOptions{Forget: true}, env.gopts, nil))
+	newSnapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(newSnapshotIDs) == 1, "expected one snapshot, got %v", newSnapshotIDs)
+	rtest.Assert(t, !newSnapshotIDs[0].Equal(snapshotIDs[0]), "snapshot was not repaired")
+
+	testRunPrune(t, env.gopts)
+	testRunCheck(t, env.gopts)
+}
+
+func TestRepairSnapshotsMissingTree(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	env.gopts.NoCache = true
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+
+	// remove all trees and rebuild the index
+	for id := range testListPacksByType(t, env.gopts, restic.TreeBlob) {
+		rtest.OK(t, os.Remove(testPackFilename(env, id)))
+	}
+	testRunRebuildIndex(t, env.gopts)
+
+	rtest.OK(t, runRepairSnapshots(RepairSnapshotsOptions{}, env.gopts, nil))
+	newSnapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(newSnapshotIDs) == 2, "expected two snapshots, got %v", newSnapshotIDs)
+
+	var repairedID restic.ID
+	for _, id := range newSnapshotIDs {
+		if !id.Equal(snapshotIDs[0]) {
+			repairedID = id
+		}
+	}
+
+	// the repaired snapshot is empty, but can be restored
+	testRunRestore(t, env.gopts, filepath.Join(env.base, "restore"), repairedID)
+}
+
+func TestRepairSnapshotsNilSubtree(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	// save a snapshot with a directory which has no subtree
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+
+	tree := restic.NewTree()
+	rtest.OK(t, tree.Insert(&restic.Node{Name: "dir", Type: "dir", Mode: os.ModeDir | 0755}))
+	treeID, err := repo.SaveTree(env.gopts.ctx, tree)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(env.gopts.ctx))
+	rtest.OK(t, repo.SaveIndex(env.gopts.ctx))
+
+	sn, err := restic.NewSnapshot([]string{"/"}, nil, "host", time.Now())
+	rtest.OK(t, err)
+	sn.Tree = &treeID
+	_, err = repo.SaveJSONUnpacked(env.gopts.ctx, restic.SnapshotFile, sn)
+	rtest.OK(t, err)
+
+	buf := bytes.NewBuffer(nil)
+	globalOptions.stdout = buf
+	defer func() {
+		globalOptions.stdout = os.Stdout
+	}()
+
+	// the empty tree used as replacement must not be loaded
+	for _, dryRun := range []bool{true, false} {
+		buf.Reset()
+		rtest.OK(t, runRepairSnapshots(RepairSnapshotsOptions{DryRun: dryRun, Forget: true}, env.gopts, nil))
+		rtest.Assert(t, strings.Contains(buf.String(), "subtree is missing"), "missing subtree was not reported: %q", buf.String())
+		rtest.Assert(t, !strings.Contains(buf.String(), "unable to load tree"), "unexpected error: %q", buf.String())
+	}
+
+	testRunPrune(t, env.gopts)
+	testRunCheck(t, env.gopts)
+}
+
 func testRunKeyListOtherIDs(t testing.TB, gopts GlobalOptions) []string {
 	buf := bytes.NewBuffer(nil)
 
@@ -654,6 +1095,67 @@ func TestKeyAddRemove(t *testing.T) {
 	testRunCheck(t, env.gopts)
 }
 
+func testRunKeyAddRole(gopts GlobalOptions, newPassword, role string) error {
+	testKeyNewPassword = newPassword
+	newKeyRole = role
+	defer func() {
+		testKeyNewPassword = ""
+		newKeyRole = ""
+	}()
+
+	return runKey(gopts, []string{"add"})
+}
+
+func TestKeyRoles(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	opts := BackupOptions{}
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+
+	rtest.OK(t, testRunKeyAddRole(env.gopts, "append", "append-only"))
+	rtest.Assert(t, testRunKeyAddRole(env.gopts, "invalid", "write-only") != nil,
+		"adding a key with an invalid role succeeded")
+
+	appendOpts := env.gopts
+	appendOpts.password = "append"
+
+	// adding data is permitted, removing it is not
+	testRunBackup(t, "", []string{env.testdata}, opts, appendOpts)
+	rtest.Equals(t, 2, len(testRunList(t, "snapshots", appendOpts)))
+	rtest.Assert(t, runForget(ForgetOptions{}, appendOpts, []string{snapshotIDs[0].String()}) != nil,
+		"removing a snapshot with an append-only key succeeded")
+	rtest.Equals(t, 2, len(testRunList(t, "snapshots", env.gopts)))
+
+	// an append-only key cannot create keys with more permissions or change passwords
+	rtest.Assert(t, testRunKeyAddRole(appendOpts, "full", "full") != nil,
+		"adding a full key with an append-only key succeeded")
+	rtest.OK(t, testRunKeyAddRole(appendOpts, "read", "read-only"))
+	testKeyNewPassword = "changed"
+	err := runKey(appendOpts, []string{"passwd"})
+	testKeyNewPassword = ""
+	rtest.Assert(t, err != nil, "changing the password of an append-only key succeeded")
+
+	readOpts := env.gopts
+	readOpts.password = "read"
+	rtest.Equals(t, 2, len(testRunList(t, "snapshots", readOpts)))
+	testRunCheck(t, readOpts)
+
+	buf := bytes.NewBuffer(nil)
+	globalOptions.stdout = buf
+	defer func() {
+		globalOptions.stdout = os.Stdout
+	}()
+
+	rtest.OK(t, runKey(readOpts, []string{"list"}))
+	for _, role := range []string{"full", "append-only", "read-only"} {
+		rtest.Assert(t, strings.Contains(buf.String(), role), "role %v not found in key list:\n%v", role, buf.String())
+	}
+}
+
 func testFileSize(filename string, size int64) error {
 	fi, err := os.Stat(filename)
 	if err != nil {
@@ -667,39 +1169,118 @@ func testFileSize(filename string, size int64) error {
 	return nil
 }
 
-func TestRestoreFilter(t *testing.T) {
-	testfiles := []struct {
-		name string
-		size uint
-	}{
-		{"testfile1.c", 100},
-		{"testfile2.exe", 101},
-		{"subdir1/subdir2/testfile3.docx", 102},
-		{"subdir1/subdir2/testfile4.c", 102},
-	}
+func testRunDump(t testing.TB, gopts GlobalOptions, opts DumpOptions, args ...string) []byte {
+	buf := bytes.NewBuffer(nil)
+	gopts.stdout = buf
+	rtest.OK(t, runDump(opts, gopts, args))
+	return buf.Bytes()
+}
 
+func TestDumpDirectory(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
 
 	testRunInit(t, env.gopts)
 
-	for _, testFile := range testfiles {
-		p := filepath.Join(env.testdata, testFile.name)
+	files := []string{"file1", "subdir/file2", "subdir/nested/file3"}
+	for i, name := range files {
+		p := filepath.Join(env.testdata, "dir", filepath.FromSlash(name))
 		rtest.OK(t, os.MkdirAll(filepath.Dir(p), 0755))
-		rtest.OK(t, appendRandomData(p, testFile.size))
+		rtest.OK(t, appendRandomData(p, uint(100+i)))
 	}
 
-	opts := BackupOptions{}
+	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Base(env.testdata)}, BackupOptions{}, env.gopts)
 
-	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Base(env.testdata)}, opts, env.gopts)
-	testRunCheck(t, env.gopts)
+	// a single file is printed as is
+	data := testRunDump(t, env.gopts, DumpOptions{Archive: "tar"}, "latest", "/testdata/dir/subdir/file2")
+	expected, err := ioutil.ReadFile(filepath.Join(env.testdata, "dir", "subdir", "file2"))
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(expected, data), "dumped file has wrong content")
+
+	data = testRunDump(t, env.gopts, DumpOptions{Archive: "tar"}, "latest", "/testdata/dir/")
+	rd := tar.NewReader(bytes.NewReader(data))
+	var names []string
+	for {
+		header, err := rd.Next()
+		if err == io.EOF {
+			break
+		}
+		rtest.OK(t, err)
+		names = append(names, header.Name)
 
-	snapshotID := testRunList(t, "snapshots", env.gopts)[0]
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
 
-	// no restore filter should restore all files
-	testRunRestore(t, env.gopts, filepath.Join(env.base, "restore0"), snapshotID)
-	for _, testFile := range testfiles {
-		rtest.OK(t, testFileSize(filepath.Join(env.base, "restore0", "testdata", testFile.name), int64(testFile.size)))
+		content, err := ioutil.ReadAll(rd)
+		rtest.OK(t, err)
+		expected, err := ioutil.ReadFile(filepath.Join(env.testdata, filepath.FromSlash(header.Name)))
+		rtest.OK(t, err)
+		rtest.Assert(t, bytes.Equal(expected, content), "file %v in tar archive has wrong content", header.Name)
+	}
+	rtest.Equals(t, []string{"dir/", "dir/file1", "dir/subdir/", "dir/subdir/file2", "dir/subdir/nested/", "dir/subdir/nested/file3"}, names)
+
+	data = testRunDump(t, env.gopts, DumpOptions{Archive: "zip"}, "latest", "/testdata/dir/subdir")
+	zrd, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	rtest.OK(t, err)
+	names = nil
+	for _, f := range zrd.File {
+		names = append(names, f.Name)
+	}
+	rtest.Equals(t, []string{"subdir/", "subdir/file2", "subdir/nested/", "subdir/nested/file3"}, names)
+
+	// rewritten paths are derived from the full paths in the snapshot
+	opts := DumpOptions{Archive: "tar", Map: []string{"/testdata/dir/subdir=/data"}}
+	data = testRunDump(t, env.gopts, opts, "latest", "/testdata/dir")
+	rd = tar.NewReader(bytes.NewReader(data))
+	names = nil
+	for {
+		header, err := rd.Next()
+		if err == io.EOF {
+			break
+		}
+		rtest.OK(t, err)
+		names = append(names, header.Name)
+	}
+	rtest.Equals(t, []string{"testdata/dir/", "testdata/dir/file1", "data/", "data/file2", "data/nested/", "data/nested/file3"}, names)
+
+	rtest.Assert(t, runDump(DumpOptions{Archive: "rar"}, env.gopts, []string{"latest", "/testdata/dir"}) != nil,
+		"dump with an invalid archive format succeeded")
+}
+
+func TestRestoreFilter(t *testing.T) {
+	testfiles := []struct {
+		name string
+		size uint
+	}{
+		{"testfile1.c", 100},
+		{"testfile2.exe", 101},
+		{"subdir1/subdir2/testfile3.docx", 102},
+		{"subdir1/subdir2/testfile4.c", 102},
+	}
+
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	for _, testFile := range testfiles {
+		p := filepath.Join(env.testdata, testFile.name)
+		rtest.OK(t, os.MkdirAll(filepath.Dir(p), 0755))
+		rtest.OK(t, appendRandomData(p, testFile.size))
+	}
+
+	opts := BackupOptions{}
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Base(env.testdata)}, opts, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	snapshotID := testRunList(t, "snapshots", env.gopts)[0]
+
+	// no restore filter should restore all files
+	testRunRestore(t, env.gopts, filepath.Join(env.base, "restore0"), snapshotID)
+	for _, testFile := range testfiles {
+		rtest.OK(t, testFileSize(filepath.Join(env.base, "restore0", "testdata", testFile.name), int64(testFile.size)))
 	}
 
 	for i, pat := range []string{"*.c", "*.exe", "*", "*file3*"} {
@@ -742,6 +1323,137 @@ func TestRestore(t *testing.T) {
 		"directories are not equal")
 }
 
+func TestRestoreOverwrite(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	for i := 0; i < 5; i++ {
+		p := filepath.Join(env.testdata, fmt.Sprintf("foo/bar/testfile%v", i))
+		rtest.OK(t, os.MkdirAll(filepath.Dir(p), 0755))
+		rtest.OK(t, appendRandomData(p, uint(mrand.Intn(2<<21))))
+	}
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Base(env.testdata)}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestore(t, env.gopts, restoredir, snapshotIDs[0])
+
+	restored := filepath.Join(restoredir, filepath.Base(env.testdata))
+	modified := filepath.Join(restored, "foo", "bar", "testfile0")
+	extra := filepath.Join(restored, "foo", "extra")
+	rtest.OK(t, appendRandomData(modified, 100))
+	rtest.OK(t, ioutil.WriteFile(extra, []byte("extra"), 0644))
+
+	opts := RestoreOptions{
+		Target:    restoredir,
+		Overwrite: "if-changed",
+		Delete:    true,
+		DryRun:    true,
+	}
+
+	buf := bytes.NewBuffer(nil)
+	gopts := env.gopts
+	gopts.stdout = buf
+	rtest.OK(t, testRunRestoreOptions(opts, gopts, []string{snapshotIDs[0].String()}))
+
+	output := buf.String()
+	for _, line := range []string{"would overwrite", "testfile0", "would delete", "extra"} {
+		rtest.Assert(t, strings.Contains(output, line), "dry run output does not contain %q:\n%s", line, output)
+	}
+	rtest.Assert(t, !directoriesEqualContents(env.testdata, restored), "dry run modified the target")
+
+	opts.DryRun = false
+	rtest.OK(t, testRunRestoreOptions(opts, env.gopts, []string{snapshotIDs[0].String()}))
+	rtest.Assert(t, directoriesEqualContents(env.testdata, restored), "directories are not equal")
+
+	opts.Overwrite = "sometimes"
+	err := testRunRestoreOptions(opts, env.gopts, []string{snapshotIDs[0].String()})
+	rtest.Assert(t, err != nil, "invalid overwrite policy was accepted")
+}
+
+func TestRestoreSeedDir(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	for i := 0; i < 3; i++ {
+		p := filepath.Join(env.testdata, fmt.Sprintf("foo/testfile%v", i))
+		rtest.OK(t, os.MkdirAll(filepath.Dir(p), 0755))
+		rtest.OK(t, appendRandomData(p, uint(mrand.Intn(2<<21))))
+	}
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Base(env.testdata)}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+
+	// the seed differs from the snapshot for one of the files
+	rtest.OK(t, appendRandomData(filepath.Join(env.testdata, "foo", "testfile0"), 100))
+
+	restoredir := filepath.Join(env.base, "restore")
+	opts := RestoreOptions{
+		Target:  restoredir,
+		SeedDir: filepath.Dir(env.testdata),
+	}
+	rtest.OK(t, testRunRestoreOptions(opts, env.gopts, []string{snapshotIDs[0].String()}))
+
+	testRunRestore(t, env.gopts, filepath.Join(env.base, "restore-full"), snapshotIDs[0])
+	rtest.Assert(t, directoriesEqualContents(filepath.Join(env.base, "restore-full"), restoredir),
+		"restore with seed directory differs from full restore")
+}
+
+func TestRestoreRewrite(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	files := []string{"app/releases/2023/file1", "app/releases/2023/data/file2", "app/releases/2022/file3"}
+	for i, name := range files {
+		p := filepath.Join(env.testdata, filepath.FromSlash(name))
+		rtest.OK(t, os.MkdirAll(filepath.Dir(p), 0755))
+		rtest.OK(t, appendRandomData(p, uint(100+i)))
+	}
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Base(env.testdata)}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+
+	// --include matches the paths in the snapshot
+	restoredir := filepath.Join(env.base, "restore-strip")
+	opts := RestoreOptions{
+		Target:          restoredir,
+		Include:         []string{"/testdata/app/releases/2023"},
+		StripComponents: 4,
+	}
+	rtest.OK(t, testRunRestoreOptions(opts, env.gopts, []string{snapshotIDs[0].String()}))
+	rtest.Assert(t, directoriesEqualContents(filepath.Join(env.testdata, "app", "releases", "2023"), restoredir),
+		"restore with --strip-components differs from the snapshot")
+
+	restoredir = filepath.Join(env.base, "restore-map")
+	opts = RestoreOptions{
+		Target:  restoredir,
+		Include: []string{"/testdata/app/releases/2023"},
+		Map:     []string{"/testdata/app/releases/2023=/current"},
+	}
+	rtest.OK(t, testRunRestoreOptions(opts, env.gopts, []string{snapshotIDs[0].String()}))
+	rtest.Assert(t, directoriesEqualContents(filepath.Join(env.testdata, "app", "releases", "2023"), filepath.Join(restoredir, "current")),
+		"restore with --map differs from the snapshot")
+
+	for _, opts := range []RestoreOptions{
+		{Target: restoredir, Map: []string{"relative=/current"}},
+		{Target: restoredir, StripComponents: -1},
+		{Target: restoredir, StripComponents: 1, Delete: true},
+	} {
+		err := testRunRestoreOptions(opts, env.gopts, []string{snapshotIDs[0].String()})
+		rtest.Assert(t, err != nil, "invalid options %+v were accepted", opts)
+	}
+}
+
 func TestRestoreLatest(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -957,6 +1669,117 @@ func TestFindJSON(t *testing.T) {
 	rtest.Assert(t, matches[0].Hits == 3, "expected hits to show 3 matches (%v)", datafile)
 }
 
+func TestFindContent(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	files := map[string]string{
+		"app.conf":   "listen 80\ntoken=abc123\n# token=\n",
+		"notes.txt":  "token=ffff\n",
+		"other.conf": "nothing to see\n",
+		"large.conf": strings.Repeat("x", 2048) + "\ntoken=0\n",
+	}
+	for name, data := range files {
+		rtest.OK(t, ioutil.WriteFile(filepath.Join(env.testdata, name), []byte(data), 0644))
+	}
+
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(env.testdata, "new.conf"), []byte("TOKEN=42\n"), 0644))
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	type contentMatch struct {
+		Path  string        `json:"path"`
+		Lines []contentLine `json:"lines"`
+	}
+	type contentMatches struct {
+		Hits    int            `json:"hits"`
+		Matches []contentMatch `json:"matches"`
+	}
+
+	find := func(opts FindOptions, patterns ...string) map[string][]contentLine {
+		var results []contentMatches
+		rtest.OK(t, json.Unmarshal(testRunFindOptions(t, true, env.gopts, opts, patterns...), &results))
+		rtest.Equals(t, 2, len(results))
+
+		found := make(map[string][]contentLine)
+		for _, sn := range results {
+			for _, m := range sn.Matches {
+				found[path.Base(m.Path)] = m.Lines
+			}
+		}
+		return found
+	}
+
+	rtest.Equals(t, map[string][]contentLine{
+		"app.conf":   {{Line: 2, Text: "token=abc123"}},
+		"large.conf": {{Line: 2, Text: "token=0"}},
+	}, find(FindOptions{Content: "token=[0-9a-f]+"}, "*.conf"))
+
+	rtest.Equals(t, map[string][]contentLine{
+		"app.conf":  {{Line: 2, Text: "token=abc123"}},
+		"notes.txt": {{Line: 1, Text: "token=ffff"}},
+		"new.conf":  {{Line: 1, Text: "TOKEN=42"}},
+	}, find(FindOptions{Content: "^token=[0-9a-f]+$", CaseInsensitive: true, MaxSize: "1k"}))
+
+	out := testRunFindOptions(t, false, env.gopts, FindOptions{Content: "token=abc"}, "app.conf")
+	rtest.Assert(t, strings.Contains(string(out), "    2: token=abc123\n"),
+		"matching line not found in output %q", out)
+}
+
+func TestFindLocalFile(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	data := rtest.Random(23, 8*1024*1024)
+	modified := append(append([]byte{}, data[:6*1024*1024]...), rtest.Random(42, 2*1024*1024)...)
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(env.testdata, "original"), data, 0644))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(env.testdata, "renamed"), data, 0644))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(env.testdata, "modified"), modified, 0644))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(env.testdata, "other"), rtest.Random(5, 1024), 0644))
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	localFile := filepath.Join(env.base, "suspicious")
+	rtest.OK(t, ioutil.WriteFile(localFile, data, 0644))
+
+	type localMatch struct {
+		Path        string `json:"path"`
+		SharedBlobs int    `json:"shared_blobs"`
+		LocalBlobs  int    `json:"local_blobs"`
+	}
+	type localMatches struct {
+		Matches []localMatch `json:"matches"`
+	}
+
+	find := func(opts FindOptions) map[string]localMatch {
+		var results []localMatches
+		rtest.OK(t, json.Unmarshal(testRunFindOptions(t, true, env.gopts, opts), &results))
+		rtest.Equals(t, 1, len(results))
+
+		found := make(map[string]localMatch)
+		for _, m := range results[0].Matches {
+			found[path.Base(m.Path)] = m
+		}
+		return found
+	}
+
+	found := find(FindOptions{LocalFile: localFile})
+	rtest.Equals(t, 2, len(found))
+	rtest.Equals(t, localMatch{Path: found["original"].Path}, found["original"])
+	rtest.Equals(t, localMatch{Path: found["renamed"].Path}, found["renamed"])
+
+	found = find(FindOptions{LocalFile: localFile, Partial: true})
+	rtest.Equals(t, 3, len(found))
+	blobs := found["original"].LocalBlobs
+	rtest.Assert(t, blobs > 1, "local file was not split into several blobs")
+	rtest.Equals(t, blobs, found["renamed"].SharedBlobs)
+	shared := found["modified"].SharedBlobs
+	rtest.Assert(t, shared > 0 && shared < blobs, "unexpected number of shared blobs %d of %d", shared, blobs)
+}
+
 func TestRebuildIndex(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -1022,20 +1845,34 @@ func TestCheckRestoreNoLock(t *testing.T) {
 }
 
 func TestPrune(t *testing.T) {
-	env, cleanup := withTestEnvironment(t)
-	defer cleanup()
+	t.Run("0", func(t *testing.T) {
+		opts := PruneOptions{MaxUnused: "0%"}
+		checkOpts := CheckOptions{ReadData: true, CheckUnused: true}
+		testPrune(t, opts, checkOpts)
+	})
 
-	datafile := filepath.Join("testdata", "backup-data.tar.gz")
-	fd, err := os.Open(datafile)
-	if os.IsNotExist(errors.Cause(err)) {
-		t.Skipf("unable to find data file %q, skipping", datafile)
-		return
-	}
-	rtest.OK(t, err)
-	rtest.OK(t, fd.Close())
+	t.Run("50", func(t *testing.T) {
+		opts := PruneOptions{MaxUnused: "50%"}
+		checkOpts := CheckOptions{ReadData: true}
+		testPrune(t, opts, checkOpts)
+	})
 
-	testRunInit(t, env.gopts)
+	t.Run("unlimited", func(t *testing.T) {
+		opts := PruneOptions{MaxUnused: "unlimited"}
+		checkOpts := CheckOptions{ReadData: true}
+		testPrune(t, opts, checkOpts)
+	})
 
+	t.Run("SmallRepackSize", func(t *testing.T) {
+		opts := PruneOptions{MaxUnused: "0", MaxRepackSize: "1"}
+		checkOpts := CheckOptions{ReadData: true}
+		testPrune(t, opts, checkOpts)
+	})
+}
+
+func testPruneSetup(t testing.TB, env *testEnvironment) {
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	testRunInit(t, env.gopts)
 	rtest.SetupTarTestFixture(t, env.testdata, datafile)
 	opts := BackupOptions{}
 
@@ -1052,7 +1889,123 @@ func TestPrune(t *testing.T) {
 		"expected 3 snapshot, got %v", snapshotIDs)
 
 	testRunForget(t, env.gopts, firstSnapshot[0].String())
-	testRunPrune(t, env.gopts)
+}
+
+func testPrune(t *testing.T, pruneOpts PruneOptions, checkOpts CheckOptions) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testPruneSetup(t, env)
+	testRunPruneWithOptions(t, pruneOpts, env.gopts)
+	rtest.OK(t, runCheck(checkOpts, env.gopts, nil))
+}
+
+func TestPruneDryRun(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testPruneSetup(t, env)
+	packs := testRunList(t, "packs", env.gopts)
+	indexes := testRunList(t, "index", env.gopts)
+
+	testRunPruneWithOptions(t, PruneOptions{DryRun: true, MaxUnused: "0%"}, env.gopts)
+	rtest.Equals(t, packs, testRunList(t, "packs", env.gopts))
+	rtest.Equals(t, indexes, testRunList(t, "index", env.gopts))
+}
+
+func TestPruneInvalidOptions(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	for _, opts := range []PruneOptions{
+		{MaxUnused: ""},
+		{MaxUnused: "100%"},
+		{MaxUnused: "-1%"},
+		{MaxUnused: "foo"},
+		{MaxUnused: "5%", MaxRepackSize: "1x"},
+	} {
+		err := runPrune(opts, env.gopts)
+		rtest.Assert(t, err != nil, "invalid options %#v were accepted", opts)
+	}
+}
+
+func TestPruneConcurrent(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	testRunInit(t, env.gopts)
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+	opts := BackupOptions{}
+	dir := filepath.Join(env.testdata, "0", "0", "9")
+
+	testRunBackup(t, "", []string{dir}, opts, env.gopts)
+	firstSnapshot := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(firstSnapshot) == 1,
+		"expected one snapshot, got %v", firstSnapshot)
+	testRunBackup(t, "", []string{filepath.Join(dir, "2")}, opts, env.gopts)
+
+	// keep a copy of the first snapshot, so that it can be restored later
+	snapshotFile := filepath.Join(env.repo, "snapshots", firstSnapshot[0].String())
+	snapshotData, err := ioutil.ReadFile(snapshotFile)
+	rtest.OK(t, err)
+	testRunForget(t, env.gopts, firstSnapshot[0].String())
+
+	pruneOpts := PruneOptions{MaxUnused: "0%", Concurrent: true}
+	checkPacks := func(marks int) {
+		rtest.Assert(t, len(testRunList(t, "pending-delete", env.gopts)) == marks,
+			"expected %d marks for deletion", marks)
+		_, err := testRunCheckOutput(env.gopts)
+		rtest.OK(t, err)
+	}
+
+	// the unused packs are only marked for deletion
+	packs := testRunList(t, "packs", env.gopts)
+	testRunPruneWithOptions(t, pruneOpts, env.gopts)
+	checkPacks(1)
+	for _, id := range packs {
+		_, err := os.Stat(testPackFilename(env, id))
+		rtest.OK(t, err)
+	}
+
+	// a lock created before the packs were marked prevents the deletion
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	lock := &restic.Lock{Time: time.Now().Add(-time.Minute), Hostname: "other-host", PID: 1}
+	lockID, err := repo.SaveJSONUnpacked(env.gopts.ctx, restic.LockFile, lock)
+	rtest.OK(t, err)
+	testRunPruneWithOptions(t, pruneOpts, env.gopts)
+	rtest.OK(t, repo.Backend().Remove(env.gopts.ctx, restic.Handle{Type: restic.LockFile, Name: lockID.String()}))
+	checkPacks(1)
+
+	// an old lock of an older version of restic, which does not refresh its
+	// locks, may belong to a running backup
+	lock = &restic.Lock{Time: time.Now().Add(-time.Hour), Hostname: "other-host", PID: 1}
+	lockID, err = repo.SaveJSONUnpacked(env.gopts.ctx, restic.LockFile, lock)
+	rtest.OK(t, err)
+	err = runPrune(pruneOpts, env.gopts)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "older version"),
+		"prune --concurrent ignored an unrefreshed lock, error: %v", err)
+	rtest.OK(t, repo.Backend().Remove(env.gopts.ctx, restic.Handle{Type: restic.LockFile, Name: lockID.String()}))
+	checkPacks(1)
+
+	// restoring the snapshot simulates a backup which referenced blobs from
+	// the marked packs before they were marked, so the packs must be kept
+	rtest.OK(t, ioutil.WriteFile(snapshotFile, snapshotData, 0600))
+	testRunPruneWithOptions(t, pruneOpts, env.gopts)
+	_, err = testRunCheckOutput(env.gopts)
+	rtest.OK(t, err)
+
+	// new backups must not reference blobs in marked packs
+	testRunForget(t, env.gopts, firstSnapshot[0].String())
+	testRunPruneWithOptions(t, pruneOpts, env.gopts)
+	checkPacks(1)
+	testRunBackup(t, "", []string{dir}, opts, env.gopts)
+	testRunPruneWithOptions(t, pruneOpts, env.gopts)
+	checkPacks(0)
+
 	testRunCheck(t, env.gopts)
 }
 
@@ -1188,3 +2141,636 @@ func TestQuietBackup(t *testing.T) {
 
 	testRunCheck(t, env.gopts)
 }
+
+// withJSONOutput returns a copy of gopts which requests JSON output and
+// writes it to the returned buffer.
+func withJSONOutput(gopts GlobalOptions) (GlobalOptions, *bytes.Buffer) {
+	buf := bytes.NewBuffer(nil)
+	gopts.JSON = true
+	gopts.stdout = buf
+	return gopts, buf
+}
+
+// decodeJSONLines decodes each line of buf into a map.
+func decodeJSONLines(t testing.TB, buf *bytes.Buffer) []map[string]interface{} {
+	var res []map[string]interface{}
+	sc := bufio.NewScanner(buf)
+	for sc.Scan() {
+		var obj map[string]interface{}
+		rtest.OK(t, json.Unmarshal(sc.Bytes(), &obj))
+		res = append(res, obj)
+	}
+	rtest.OK(t, sc.Err())
+	return res
+}
+
+func TestInitJSON(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	gopts, buf := withJSONOutput(env.gopts)
+	testRunInit(t, gopts)
+
+	var res initJSON
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &res))
+	rtest.Equals(t, "initialized", res.StructType)
+	rtest.Equals(t, env.gopts.Repo, res.Repository)
+	rtest.Assert(t, len(res.ID) == 64, "unexpected repository ID %q", res.ID)
+}
+
+func TestForgetPruneJSON(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	for i := 0; i < 3; i++ {
+		testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9")}, BackupOptions{}, env.gopts)
+	}
+
+	gopts, buf := withJSONOutput(env.gopts)
+	rtest.OK(t, runForget(ForgetOptions{Last: 1, GroupBy: "host,paths"}, gopts, nil))
+
+	var result forgetJSON
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &result))
+	rtest.Equals(t, "forget", result.StructType)
+	groups := result.Groups
+	rtest.Assert(t, len(groups) == 1, "expected one group, got %v", len(groups))
+	rtest.Equals(t, 1, len(groups[0].Keep))
+	rtest.Equals(t, 2, len(groups[0].Remove))
+	rtest.Equals(t, 1, len(groups[0].Reasons))
+	rtest.Equals(t, []string{"last snapshot"}, groups[0].Reasons[0].Matches)
+	rtest.Equals(t, 0, len(result.Remove))
+	rtest.Assert(t, result.Prune == nil, "unexpected prune summary")
+	rtest.Equals(t, 1, len(testRunList(t, "snapshots", env.gopts)))
+
+	gopts, buf = withJSONOutput(env.gopts)
+	rtest.OK(t, runPrune(PruneOptions{MaxUnused: "0%"}, gopts))
+
+	var summary pruneJSON
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &summary))
+	rtest.Equals(t, "prune", summary.StructType)
+	rtest.Assert(t, summary.TotalSize > 0, "total size is zero")
+	rtest.Equals(t, summary.RemoveSize, summary.FreedSize)
+	rtest.Equals(t, len(testRunList(t, "packs", env.gopts)), int(summary.PacksKeep))
+
+	// forget --prune adds the prune summary to the same object
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, BackupOptions{}, env.gopts)
+	gopts, buf = withJSONOutput(env.gopts)
+	pruneOptions.MaxUnused = "0%"
+	defer func() { pruneOptions.MaxUnused = "" }()
+	rtest.OK(t, runForget(ForgetOptions{Last: 1, GroupBy: "host", Prune: true}, gopts, nil))
+
+	rtest.Equals(t, 1, bytes.Count(buf.Bytes(), []byte("\n")))
+	var combined forgetJSON
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &combined))
+	rtest.Equals(t, "forget", combined.StructType)
+	rtest.Equals(t, 1, len(combined.Groups))
+	rtest.Equals(t, 1, len(combined.Groups[0].Remove))
+	rtest.Assert(t, combined.Prune != nil, "prune summary is missing")
+	rtest.Equals(t, "prune", combined.Prune.StructType)
+
+	// snapshots removed by ID are not reported as a group
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "0", "0", "9", "2")}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Equals(t, 2, len(snapshotIDs))
+	gopts, buf = withJSONOutput(env.gopts)
+	rtest.OK(t, runForget(ForgetOptions{}, gopts, []string{snapshotIDs[0].String()}))
+
+	var byID forgetJSON
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &byID))
+	rtest.Equals(t, 0, len(byID.Groups))
+	rtest.Equals(t, 1, len(byID.Remove))
+	rtest.Equals(t, snapshotIDs[0], *byID.Remove[0].ID)
+}
+
+func TestCheckJSON(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	gopts, buf := withJSONOutput(env.gopts)
+	rtest.OK(t, runCheck(CheckOptions{}, gopts, nil))
+	msgs := decodeJSONLines(t, buf)
+	rtest.Equals(t, 1, len(msgs))
+	rtest.Equals(t, "summary", msgs[0]["struct_type"])
+	rtest.Equals(t, float64(0), msgs[0]["errors"])
+
+	// remove a pack which only contains data blobs, so that loading the
+	// trees still works
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.LoadIndex(env.gopts.ctx))
+
+	treePacks := restic.NewIDSet()
+	dataPacks := restic.NewIDSet()
+	for blob := range repo.Index().Each(env.gopts.ctx) {
+		if blob.Type == restic.TreeBlob {
+			treePacks.Insert(blob.PackID)
+		} else {
+			dataPacks.Insert(blob.PackID)
+		}
+	}
+	packs := dataPacks.Sub(treePacks).List()
+	rtest.Assert(t, len(packs) > 0, "no pack with only data blobs found")
+
+	name := packs[0].String()
+	rtest.OK(t, os.Remove(filepath.Join(env.repo, "data", name[:2], name)))
+
+	gopts, buf = withJSONOutput(env.gopts)
+	rtest.Assert(t, runCheck(CheckOptions{}, gopts, nil) != nil, "check did not report an error")
+
+	msgs = decodeJSONLines(t, buf)
+	rtest.Equals(t, 2, len(msgs))
+	rtest.Equals(t, "pack_error", msgs[0]["struct_type"])
+	rtest.Equals(t, name, msgs[0]["pack"])
+	rtest.Equals(t, "summary", msgs[1]["struct_type"])
+	rtest.Equals(t, float64(1), msgs[1]["errors"])
+}
+
+func TestDiffJSON(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, env.testdata, []string{"0"}, BackupOptions{}, env.gopts)
+	firstSnapshot := testRunList(t, "snapshots", env.gopts)
+	rtest.Equals(t, 1, len(firstSnapshot))
+
+	testfile := filepath.Join(env.testdata, "0", "newfile")
+	rtest.OK(t, ioutil.WriteFile(testfile, []byte("foobar"), 0644))
+	testRunBackup(t, env.testdata, []string{"0"}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Equals(t, 2, len(snapshotIDs))
+
+	secondSnapshot := snapshotIDs[0]
+	if secondSnapshot.Equal(firstSnapshot[0]) {
+		secondSnapshot = snapshotIDs[1]
+	}
+
+	gopts, buf := withJSONOutput(env.gopts)
+	rtest.OK(t, runDiff(DiffOptions{}, gopts, []string{firstSnapshot[0].String(), secondSnapshot.String()}))
+
+	msgs := decodeJSONLines(t, buf)
+	rtest.Equals(t, 2, len(msgs))
+	rtest.Equals(t, "change", msgs[0]["struct_type"])
+	rtest.Equals(t, "/0/newfile", msgs[0]["path"])
+	rtest.Equals(t, "+", msgs[0]["modifier"])
+	rtest.Assert(t, msgs[0]["before"] == nil, "added item has metadata before the change")
+	after := msgs[0]["after"].(map[string]interface{})
+	rtest.Equals(t, "file", after["type"])
+	rtest.Equals(t, float64(6), after["size"])
+
+	rtest.Equals(t, "statistics", msgs[1]["struct_type"])
+	added := msgs[1]["added"].(map[string]interface{})
+	rtest.Equals(t, float64(1), added["files"])
+	rtest.Equals(t, float64(1), added["data_blobs"])
+
+	// modify the file and check the changed blobs
+	rtest.OK(t, ioutil.WriteFile(testfile, []byte("foobar, but longer"), 0644))
+	testRunBackup(t, env.testdata, []string{"0"}, BackupOptions{}, env.gopts)
+	snapshotIDs = testRunList(t, "snapshots", env.gopts)
+	rtest.Equals(t, 3, len(snapshotIDs))
+
+	var thirdSnapshot restic.ID
+	for _, id := range snapshotIDs {
+		if !id.Equal(firstSnapshot[0]) && !id.Equal(secondSnapshot) {
+			thirdSnapshot = id
+		}
+	}
+
+	gopts, buf = withJSONOutput(env.gopts)
+	rtest.OK(t, runDiff(DiffOptions{}, gopts, []string{secondSnapshot.String(), thirdSnapshot.String()}))
+
+	var change Change
+	var stats DiffStats
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	rtest.Equals(t, 2, len(lines))
+	rtest.OK(t, json.Unmarshal(lines[0], &change))
+	rtest.OK(t, json.Unmarshal(lines[1], &stats))
+
+	rtest.Equals(t, "M", change.Modifier)
+	rtest.Equals(t, uint64(6), change.Before.Size)
+	rtest.Equals(t, uint64(18), change.After.Size)
+	rtest.Equals(t, &ContentChange{AddedBlobs: 1, AddedBytes: 18, RemovedBlobs: 1, RemovedBytes: 6}, change.Content)
+	rtest.Equals(t, *change.Content, stats.Modified)
+
+	// errors while writing the changes are returned
+	gopts.stdout = &failFirstWriter{}
+	err := runDiff(DiffOptions{}, gopts, []string{secondSnapshot.String(), thirdSnapshot.String()})
+	rtest.Assert(t, err != nil, "write error was not returned")
+}
+
+// failFirstWriter fails the first write and discards all further writes.
+type failFirstWriter struct {
+	failed bool
+}
+
+func (w *failFirstWriter) Write(p []byte) (int, error) {
+	if !w.failed {
+		w.failed = true
+		return 0, errors.New("write failed")
+	}
+	return len(p), nil
+}
+
+func TestDiffLive(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	dir := filepath.Join(env.testdata, "live")
+	rtest.OK(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	for _, name := range []string{"modified", "touched", "removed", filepath.Join("sub", "file")} {
+		rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, name), []byte("content of "+name), 0644))
+	}
+
+	testRunBackup(t, "", []string{dir}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Equals(t, 1, len(snapshotIDs))
+
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "modified"), []byte("new content"), 0644))
+	future := time.Now().Add(time.Hour)
+	rtest.OK(t, os.Chtimes(filepath.Join(dir, "touched"), future, future))
+	rtest.OK(t, os.Remove(filepath.Join(dir, "removed")))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "sub", "added"), []byte("foobar"), 0644))
+
+	prefix, err := snapshotPath(dir)
+	rtest.OK(t, err)
+
+	diff := func(opts DiffOptions) map[string]string {
+		opts.Live = dir
+		gopts, buf := withJSONOutput(env.gopts)
+		rtest.OK(t, runDiff(opts, gopts, []string{snapshotIDs[0].String()}))
+
+		changes := make(map[string]string)
+		for _, msg := range decodeJSONLines(t, buf) {
+			if msg["struct_type"] == "change" {
+				changes[strings.TrimPrefix(msg["path"].(string), prefix)] = msg["modifier"].(string)
+			}
+		}
+		return changes
+	}
+
+	rtest.Equals(t, map[string]string{
+		"/modified":  "M",
+		"/touched":   "M",
+		"/removed":   "-",
+		"/sub/added": "+",
+	}, diff(DiffOptions{}))
+
+	// files with unchanged content only have changed metadata
+	rtest.Equals(t, map[string]string{
+		"/modified":  "M",
+		"/touched":   "U",
+		"/removed":   "-",
+		"/sub/":      "U",
+		"/sub/added": "+",
+	}, diff(DiffOptions{CheckContent: true, ShowMetadata: true}))
+
+	gopts, buf := withJSONOutput(env.gopts)
+	rtest.OK(t, runDiff(DiffOptions{Live: dir, CheckContent: true}, gopts, []string{snapshotIDs[0].String()}))
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	var stats DiffStats
+	rtest.OK(t, json.Unmarshal(lines[len(lines)-1], &stats))
+	rtest.Equals(t, 1, stats.ChangedFiles)
+	rtest.Equals(t, ContentChange{
+		AddedBlobs: 1, AddedBytes: len("new content"),
+		RemovedBlobs: 1, RemovedBytes: len("content of modified"),
+	}, stats.Modified)
+}
+
+func TestHistory(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	dir := filepath.Join(env.testdata, "history")
+	rtest.OK(t, os.MkdirAll(dir, 0755))
+	file := filepath.Join(dir, "config")
+
+	for _, content := range []string{"first", "second", "second", "first"} {
+		rtest.OK(t, ioutil.WriteFile(file, []byte(content), 0644))
+		testRunBackup(t, "", []string{dir}, BackupOptions{}, env.gopts)
+	}
+
+	p, err := snapshotPath(file)
+	rtest.OK(t, err)
+
+	gopts, buf := withJSONOutput(env.gopts)
+	rtest.OK(t, testRunHistory(HistoryOptions{}, gopts, []string{p}))
+
+	var versions []historyVersion
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var v historyVersion
+		rtest.OK(t, json.Unmarshal(line, &v))
+		versions = append(versions, v)
+	}
+
+	rtest.Equals(t, 2, len(versions))
+	for i, v := range versions {
+		rtest.Equals(t, i+1, v.Version)
+		rtest.Equals(t, "file", v.Type)
+		rtest.Equals(t, 2, v.Snapshots)
+	}
+	rtest.Equals(t, uint64(len("first")), versions[0].Size)
+	rtest.Equals(t, uint64(len("second")), versions[1].Size)
+	rtest.Assert(t, versions[0].LastTime.After(versions[1].LastTime),
+		"first version was not seen last")
+
+	target := filepath.Join(env.base, "restore")
+	opts := HistoryOptions{RestoreVersion: 2, Target: target}
+	rtest.OK(t, testRunHistory(opts, env.gopts, []string{p}))
+
+	data, err := ioutil.ReadFile(filepath.Join(target, filepath.FromSlash(p)))
+	rtest.OK(t, err)
+	rtest.Equals(t, "second", string(data))
+
+	opts.RestoreVersion = 3
+	rtest.Assert(t, testRunHistory(opts, env.gopts, []string{p}) != nil,
+		"restoring a version which does not exist did not fail")
+}
+
+func TestHistorySpecialPaths(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file names with wildcards are not allowed on Windows")
+	}
+
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	dir := filepath.Join(env.testdata, "history")
+	rtest.OK(t, os.MkdirAll(dir, 0755))
+	for _, name := range []string{"a*b", "axb", "a[x]b"} {
+		rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+	testRunBackup(t, "", []string{dir}, BackupOptions{}, env.gopts)
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "axb"), []byte("changed"), 0644))
+	testRunBackup(t, "", []string{dir}, BackupOptions{}, env.gopts)
+
+	// the root directory is found in all snapshots
+	gopts, buf := withJSONOutput(env.gopts)
+	rtest.OK(t, testRunHistory(HistoryOptions{}, gopts, []string{"/"}))
+
+	msgs := decodeJSONLines(t, buf)
+	rtest.Equals(t, 2, len(msgs))
+	for _, msg := range msgs {
+		rtest.Equals(t, "dir", msg["type"])
+	}
+
+	// wildcards in the path must not select other files for restore
+	for _, name := range []string{"a*b", "a[x]b"} {
+		p, err := snapshotPath(filepath.Join(dir, name))
+		rtest.OK(t, err)
+
+		target := filepath.Join(env.base, "restore-"+name)
+		opts := HistoryOptions{RestoreVersion: 1, Target: target}
+		rtest.OK(t, testRunHistory(opts, env.gopts, []string{p}))
+
+		restored := filepath.Join(target, filepath.FromSlash(path.Dir(p)))
+		entries, err := ioutil.ReadDir(restored)
+		rtest.OK(t, err)
+		rtest.Equals(t, 1, len(entries))
+		rtest.Equals(t, name, entries[0].Name())
+	}
+}
+
+func TestTagRestoreJSON(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testSetupBackupData(t, env)
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Equals(t, 1, len(snapshotIDs))
+
+	gopts, buf := withJSONOutput(env.gopts)
+	rtest.OK(t, runTag(TagOptions{AddTags: []string{"foo"}}, gopts, nil))
+
+	msgs := decodeJSONLines(t, buf)
+	rtest.Equals(t, 2, len(msgs))
+	rtest.Equals(t, "changed_snapshot", msgs[0]["struct_type"])
+	rtest.Equals(t, snapshotIDs[0].String(), msgs[0]["old_snapshot_id"])
+	rtest.Equals(t, []interface{}{"foo"}, msgs[0]["tags"])
+	rtest.Equals(t, "summary", msgs[1]["struct_type"])
+	rtest.Equals(t, float64(1), msgs[1]["changed_snapshots"])
+
+	newID := msgs[0]["new_snapshot_id"].(string)
+	rtest.Equals(t, newID, testRunList(t, "snapshots", env.gopts)[0].String())
+
+	gopts, buf = withJSONOutput(env.gopts)
+	target := filepath.Join(env.base, "restore")
+	rtest.OK(t, testRunRestoreOptions(RestoreOptions{Target: target, Verify: true}, gopts, []string{newID}))
+
+	// the summary follows the status messages
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	var summary restoreSummaryJSON
+	rtest.OK(t, json.Unmarshal(lines[len(lines)-1], &summary))
+	rtest.Equals(t, "summary", summary.StructType)
+	rtest.Equals(t, newID, summary.SnapshotID.String())
+	rtest.Equals(t, target, summary.Target)
+	rtest.Equals(t, uint(0), summary.Errors)
+	rtest.Assert(t, summary.VerifiedFiles > 0, "no files were verified")
+	rtest.Assert(t, summary.TotalFiles > 0, "no files were counted")
+	rtest.Equals(t, summary.TotalFiles, summary.FilesRestored)
+	rtest.Equals(t, summary.TotalBytes, summary.BytesRestored)
+}
+
+func testRunStatsUnique(t testing.TB, gopts GlobalOptions, groupBy string, args []string) statsUniqueResult {
+	defer func() {
+		countMode = countModeRestoreSize
+		statsGroupBy = ""
+		snapshotIDString = ""
+	}()
+
+	countMode = countModeUnique
+	statsGroupBy = groupBy
+
+	gopts, buf := withJSONOutput(gopts)
+	rtest.OK(t, runStats(gopts, args))
+
+	var res statsUniqueResult
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &res))
+	return res
+}
+
+func TestStatsUnique(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	for i, name := range []string{"a", "b"} {
+		dir := filepath.Join(env.testdata, name)
+		rtest.OK(t, os.MkdirAll(dir, 0755))
+		rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "file"), rtest.Random(i, 500*1024), 0644))
+	}
+
+	// the first two snapshots contain the same data
+	for _, name := range []string{"a", "a", "b"} {
+		opts := BackupOptions{Tags: []string{name}}
+		testRunBackup(t, env.testdata, []string{name}, opts, env.gopts)
+	}
+
+	res := testRunStatsUnique(t, env.gopts, "", nil)
+	rtest.Equals(t, 3, len(res.Snapshots))
+	rtest.Equals(t, 0, len(res.Groups))
+
+	for _, sn := range res.Snapshots[:2] {
+		rtest.Equals(t, uint64(0), sn.UniqueSize)
+		rtest.Equals(t, sn.TotalSize, sn.SharedSize)
+	}
+
+	last := res.Snapshots[2]
+	rtest.Equals(t, []string{"b"}, last.Tags)
+	rtest.Assert(t, last.UniqueSize >= 500*1024, "unique size of the last snapshot is too small: %v", last.UniqueSize)
+	rtest.Equals(t, last.TotalSize, last.UniqueSize+last.SharedSize)
+
+	res = testRunStatsUnique(t, env.gopts, "tags", []string{last.SnapshotID.String()})
+	rtest.Equals(t, 1, len(res.Snapshots))
+	rtest.Equals(t, last.UniqueSize, res.Snapshots[0].UniqueSize)
+
+	rtest.Equals(t, 2, len(res.Groups))
+	rtest.Equals(t, []string{"a"}, res.Groups[0].Tags)
+	rtest.Equals(t, 2, res.Groups[0].Snapshots)
+	rtest.Assert(t, res.Groups[0].UniqueSize >= 500*1024, "unique size of group a is too small: %v", res.Groups[0].UniqueSize)
+	rtest.Equals(t, []string{"b"}, res.Groups[1].Tags)
+	rtest.Equals(t, 1, res.Groups[1].Snapshots)
+	rtest.Equals(t, last.TotalSize, res.Groups[1].TotalSize)
+}
+
+func testRunStatsTimeline(t testing.TB, gopts GlobalOptions, groupBy string, asCSV bool) *bytes.Buffer {
+	defer func() {
+		statsTimeline = false
+		statsCSV = false
+		statsGroupBy = ""
+	}()
+
+	statsTimeline = true
+	statsCSV = asCSV
+	statsGroupBy = groupBy
+
+	buf := bytes.NewBuffer(nil)
+	gopts.stdout = buf
+	if !asCSV {
+		gopts.JSON = true
+	}
+	rtest.OK(t, runStats(gopts, nil))
+	return buf
+}
+
+func TestStatsTimeline(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	for i, name := range []string{"a", "b"} {
+		dir := filepath.Join(env.testdata, name)
+		rtest.OK(t, os.MkdirAll(dir, 0755))
+		rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "file"), rtest.Random(i, 500*1024), 0644))
+	}
+
+	// the second snapshot does not add any data
+	for _, name := range []string{"a", "a", "b"} {
+		testRunBackup(t, env.testdata, []string{name}, BackupOptions{}, env.gopts)
+	}
+
+	buf := testRunStatsTimeline(t, env.gopts, "", false)
+	var groups []statsTimelineGroup
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &groups))
+
+	rtest.Equals(t, 2, len(groups))
+	rtest.Equals(t, 2, len(groups[0].Snapshots))
+	rtest.Equals(t, 1, len(groups[1].Snapshots))
+
+	first, second, last := groups[0].Snapshots[0], groups[0].Snapshots[1], groups[1].Snapshots[0]
+	rtest.Assert(t, first.NewBytes >= 500*1024, "first snapshot added too little data: %v", first.NewBytes)
+	rtest.Equals(t, first.NewBytes, first.RepositoryBytes)
+	rtest.Equals(t, uint64(0), second.NewBlobs)
+	rtest.Equals(t, uint64(0), second.NewBytes)
+	rtest.Equals(t, first.RepositoryBytes, second.RepositoryBytes)
+	rtest.Assert(t, last.NewBytes >= 500*1024, "last snapshot added too little data: %v", last.NewBytes)
+	rtest.Equals(t, groups[0].NewBytes+groups[1].NewBytes, last.RepositoryBytes)
+	rtest.Equals(t, groups[0].NewBlobs+groups[1].NewBlobs, last.RepositoryBlobs)
+
+	buf = testRunStatsTimeline(t, env.gopts, "host", true)
+	records, err := csv.NewReader(buf).ReadAll()
+	rtest.OK(t, err)
+	rtest.Equals(t, 4, len(records))
+	rtest.Equals(t, "snapshot_id", records[0][3])
+	rtest.Equals(t, first.SnapshotID.String(), records[1][3])
+	rtest.Equals(t, strconv.FormatUint(last.RepositoryBytes, 10), records[3][8])
+}
+
+func TestStatsUniqueAlternatingGroups(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	dir := filepath.Join(env.testdata, "a")
+	rtest.OK(t, os.MkdirAll(dir, 0755))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "file"), rtest.Random(23, 500*1024), 0644))
+
+	// all snapshots contain the same data, the groups alternate
+	for _, tag := range []string{"x", "y", "x"} {
+		testRunBackup(t, env.testdata, []string{"a"}, BackupOptions{Tags: []string{tag}}, env.gopts)
+	}
+
+	res := testRunStatsUnique(t, env.gopts, "tags", nil)
+	rtest.Equals(t, 3, len(res.Snapshots))
+	rtest.Equals(t, 2, len(res.Groups))
+
+	total := res.Snapshots[0].TotalSize
+	for _, g := range res.Groups {
+		rtest.Equals(t, total, g.TotalSize)
+		rtest.Equals(t, res.Snapshots[0].TotalBlobCount, g.TotalBlobCount)
+		rtest.Equals(t, uint64(0), g.UniqueSize)
+		rtest.Equals(t, total, g.SharedSize)
+	}
+	rtest.Equals(t, 2, res.Groups[0].Snapshots)
+}
+
+func TestStatsStoredSize(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	repository.TestUseLowSecurityKDFParameters(t)
+	restic.TestDisableCheckPolynomial(t)
+	restic.TestSetLockTimeout(t, 0)
+	rtest.OK(t, runInit(InitOptions{RepositoryVersion: "2"}, env.gopts, nil))
+
+	// the file compresses well, so the stored size is much smaller
+	dir := filepath.Join(env.testdata, "a")
+	rtest.OK(t, os.MkdirAll(dir, 0755))
+	data := bytes.Repeat([]byte("restic stats "), 100*1024)
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "file"), data, 0644))
+	testRunBackup(t, env.testdata, []string{"a"}, BackupOptions{}, env.gopts)
+
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.LoadIndex(env.gopts.ctx))
+
+	var stored uint64
+	for pb := range repo.Index().Each(env.gopts.ctx) {
+		stored += uint64(pb.Length)
+	}
+	rtest.Assert(t, stored < uint64(len(data)), "data was not compressed, %v bytes stored", stored)
+
+	res := testRunStatsUnique(t, env.gopts, "", nil)
+	rtest.Equals(t, 1, len(res.Snapshots))
+	rtest.Equals(t, stored, res.Snapshots[0].TotalSize)
+	rtest.Equals(t, stored, res.Snapshots[0].UniqueSize)
+
+	buf := testRunStatsTimeline(t, env.gopts, "", false)
+	var groups []statsTimelineGroup
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &groups))
+	rtest.Equals(t, 1, len(groups))
+	rtest.Equals(t, stored, groups[0].Snapshots[0].NewBytes)
+}
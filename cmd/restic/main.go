@@ -45,6 +45,8 @@ directories in an encrypted repository stored on different backends.
 			globalOptions.verbosity = 0
 		}
 
+		_, globalOptions.jsonMessagesToStderr = c.Annotations[annotationJSONMessagesToStderr]
+
 		// parse extended options
 		opts, err := options.Parse(globalOptions.Options)
 		if err != nil {
@@ -54,7 +56,7 @@ directories in an encrypted repository stored on different backends.
 		if c.Name() == "version" {
 			return nil
 		}
-		pwd, err := resolvePassword(globalOptions)
+		pwd, err := resolvePassword(globalOptions, "RESTIC_PASSWORD")
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Resolving password failed: %v\n", err)
 			Exit(1)
@@ -382,8 +382,9 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 			return FutureNode{}, true, nil
 		}
 
-		// use previous node if the file hasn't changed
-		if previous != nil && !fileChanged(fi, previous) {
+		// use previous node if the file hasn't changed and its content is
+		// still available in the repository
+		if previous != nil && !FileChanged(fi, previous) && arch.allBlobsPresent(previous) {
 			debug.Log("%v hasn't changed, returning old node", target)
 			arch.CompleteItem(snPath, previous, previous, ItemStats{}, time.Since(start))
 			arch.CompleteBlob(snPath, previous.Size)
@@ -434,9 +435,21 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 	return fn, false, nil
 }
 
-// fileChanged returns true if the file's content has changed since the node
+// allBlobsPresent returns true if all content blobs of node are known to the
+// index. Blobs in packs which are marked for deletion are not considered
+// present.
+func (arch *Archiver) allBlobsPresent(node *restic.Node) bool {
+	for _, id := range node.Content {
+		if !arch.Repo.Index().Has(id, restic.DataBlob) {
+			return false
+		}
+	}
+	return true
+}
+
+// FileChanged returns true if the file's content has changed since the node
 // was created.
-func fileChanged(fi os.FileInfo, node *restic.Node) bool {
+func FileChanged(fi os.FileInfo, node *restic.Node) bool {
 	if node == nil {
 		return true
 	}
@@ -615,14 +615,14 @@ func TestFileChanged(t *testing.T) {
 			fiBefore := lstat(t, filename)
 			node := nodeFromFI(t, filename, fiBefore)
 
-			if fileChanged(fiBefore, node) {
+			if FileChanged(fiBefore, node) {
 				t.Fatalf("unchanged file detected as changed")
 			}
 
 			test.Modify(t, filename)
 
 			fiAfter := lstat(t, filename)
-			if !fileChanged(fiAfter, node) {
+			if !FileChanged(fiAfter, node) {
 				t.Fatalf("modified file detected as unchanged")
 			}
 		})
@@ -639,7 +639,7 @@ func TestFilChangedSpecialCases(t *testing.T) {
 
 	t.Run("nil-node", func(t *testing.T) {
 		fi := lstat(t, filename)
-		if !fileChanged(fi, nil) {
+		if !FileChanged(fi, nil) {
 			t.Fatal("nil node detected as unchanged")
 		}
 	})
@@ -648,7 +648,7 @@ func TestFilChangedSpecialCases(t *testing.T) {
 		fi := lstat(t, filename)
 		node := nodeFromFI(t, filename, fi)
 		node.Type = "symlink"
-		if !fileChanged(fi, node) {
+		if !FileChanged(fi, node) {
 			t.Fatal("node with changed type detected as unchanged")
 		}
 	})
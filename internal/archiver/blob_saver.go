@@ -73,6 +73,14 @@ type FutureBlob struct {
 	res    saveBlobResponse
 }
 
+// knownBlob returns a FutureBlob for a blob with the given ID which has
+// already been saved.
+func knownBlob(id restic.ID, length int) FutureBlob {
+	ch := make(chan saveBlobResponse, 1)
+	ch <- saveBlobResponse{id: id, known: true}
+	return FutureBlob{ch: ch, length: length}
+}
+
 // Wait blocks until the result is available or the context is cancelled.
 func (s *FutureBlob) Wait(ctx context.Context) {
 	select {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"os"
+	"sync"
 
 	"github.com/restic/chunker"
 	"github.com/restic/restic/internal/debug"
@@ -59,6 +60,11 @@ type FileSaver struct {
 
 	pol chunker.Pol
 
+	// zeroBlobs contains the IDs of the chunks which consist only of zeros
+	// and have already been saved, indexed by the length of the chunk
+	zeroBlobsMu sync.Mutex
+	zeroBlobs   map[int]restic.ID
+
 	ch   chan<- saveFileJob
 	done <-chan struct{}
 
@@ -81,6 +87,7 @@ func NewFileSaver(ctx context.Context, t *tomb.Tomb, fs fs.FS, save SaveBlobFn,
 		saveBlob:     save,
 		saveFilePool: NewBufferPool(ctx, int(poolSize), chunker.MaxSize),
 		pol:          pol,
+		zeroBlobs:    make(map[int]restic.ID),
 		ch:           ch,
 		done:         t.Dying(),
 
@@ -164,8 +171,18 @@ func (s *FileSaver) saveFile(ctx context.Context, chnker *chunker.Chunker, snPat
 		return saveFileResponse{err: errors.Errorf("node type %q is wrong", node.Type)}
 	}
 
+	// holes in sparse files are not read from the file and the chunks
+	// within holes are not hashed again
+	var rd io.Reader = f
+	var holes *extentIndex
+	if extents := fs.DataExtents(f, fi.Size()); extents != nil {
+		debug.Log("%v has %d data extents", snPath, len(extents))
+		rd = newSparseReader(f, extents, fi.Size())
+		holes = &extentIndex{extents: extents}
+	}
+
 	// reuse the chunker
-	chnker.Reset(f, s.pol)
+	chnker.Reset(rd, s.pol)
 
 	var results []FutureBlob
 
@@ -194,7 +211,12 @@ func (s *FileSaver) saveFile(ctx context.Context, chnker *chunker.Chunker, snPat
 			return saveFileResponse{err: ctx.Err()}
 		}
 
-		res := s.saveBlob(ctx, restic.DataBlob, buf)
+		var res FutureBlob
+		if holes != nil && holes.isHole(int64(chunk.Start), int64(chunk.Length)) {
+			res = s.saveZeroBlob(ctx, buf)
+		} else {
+			res = s.saveBlob(ctx, restic.DataBlob, buf)
+		}
 		results = append(results, res)
 
 		// test if the context has been cancelled, return the error
@@ -229,6 +251,26 @@ func (s *FileSaver) saveFile(ctx context.Context, chnker *chunker.Chunker, snPat
 	}
 }
 
+// saveZeroBlob saves a chunk which only contains zeros. Only the first chunk
+// with a given length is hashed and passed to saveBlob.
+func (s *FileSaver) saveZeroBlob(ctx context.Context, buf *Buffer) FutureBlob {
+	length := len(buf.Data)
+
+	s.zeroBlobsMu.Lock()
+	id, ok := s.zeroBlobs[length]
+	if !ok {
+		s.zeroBlobs[length] = restic.Hash(buf.Data)
+	}
+	s.zeroBlobsMu.Unlock()
+
+	if !ok {
+		return s.saveBlob(ctx, restic.DataBlob, buf)
+	}
+
+	buf.Release()
+	return knownBlob(id, length)
+}
+
 func (s *FileSaver) worker(ctx context.Context, jobs <-chan saveFileJob) {
 	// a worker has one chunker which is reused for each file (because it contains a rather large buffer)
 	chnker := chunker.New(nil, s.pol)
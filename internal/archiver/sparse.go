@@ -0,0 +1,83 @@
+package archiver
+
+import (
+	"io"
+
+	"github.com/restic/restic/internal/fs"
+)
+
+// sparseReader reads a file with holes. The holes are returned as zeros
+// without reading them from the file.
+type sparseReader struct {
+	f       fs.File
+	extents []fs.Extent
+	size    int64
+
+	offset  int64 // offset of the next byte returned by Read
+	filePos int64 // current position in f
+}
+
+func newSparseReader(f fs.File, extents []fs.Extent, size int64) *sparseReader {
+	return &sparseReader{f: f, extents: extents, size: size}
+}
+
+func (rd *sparseReader) Read(p []byte) (int, error) {
+	if rd.offset >= rd.size {
+		return 0, io.EOF
+	}
+
+	// drop the extents which were read completely
+	for len(rd.extents) > 0 && rd.extents[0].Offset+rd.extents[0].Length <= rd.offset {
+		rd.extents = rd.extents[1:]
+	}
+
+	if len(rd.extents) == 0 || rd.extents[0].Offset > rd.offset {
+		// in a hole until the next extent or the end of the file
+		end := rd.size
+		if len(rd.extents) > 0 {
+			end = rd.extents[0].Offset
+		}
+		if int64(len(p)) > end-rd.offset {
+			p = p[:end-rd.offset]
+		}
+
+		for i := range p {
+			p[i] = 0
+		}
+		rd.offset += int64(len(p))
+		return len(p), nil
+	}
+
+	end := rd.extents[0].Offset + rd.extents[0].Length
+	if int64(len(p)) > end-rd.offset {
+		p = p[:end-rd.offset]
+	}
+
+	if rd.filePos != rd.offset {
+		_, err := rd.f.Seek(rd.offset, io.SeekStart)
+		if err != nil {
+			return 0, err
+		}
+		rd.filePos = rd.offset
+	}
+
+	n, err := rd.f.Read(p)
+	rd.offset += int64(n)
+	rd.filePos += int64(n)
+	return n, err
+}
+
+// extentIndex finds the regions of a file without data. The regions must be
+// requested in ascending order.
+type extentIndex struct {
+	extents []fs.Extent
+}
+
+// isHole returns true if the region of the file does not contain any data.
+func (idx *extentIndex) isHole(offset, length int64) bool {
+	for len(idx.extents) > 0 && idx.extents[0].Offset+idx.extents[0].Length <= offset {
+		idx.extents = idx.extents[1:]
+	}
+
+	return len(idx.extents) == 0 || idx.extents[0].Offset >= offset+length
+}
@@ -0,0 +1,88 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestSparseReader(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	data := make([]byte, 100000)
+	extents := []fs.Extent{
+		{Offset: 0, Length: 1000},
+		{Offset: 5000, Length: 20000},
+		{Offset: 60000, Length: 10},
+	}
+	for i, ext := range extents {
+		copy(data[ext.Offset:], rtest.Random(i, int(ext.Length)))
+	}
+
+	filename := filepath.Join(tempdir, "file")
+	rtest.OK(t, ioutil.WriteFile(filename, data, 0600))
+
+	for _, bufsize := range []int{1, 7, 4096, 200000} {
+		f, err := fs.Open(filename)
+		rtest.OK(t, err)
+
+		rd := newSparseReader(f, extents, int64(len(data)))
+		buf := bytes.NewBuffer(nil)
+		_, err = io.CopyBuffer(buf, struct{ io.Reader }{rd}, make([]byte, bufsize))
+		rtest.OK(t, err)
+		rtest.OK(t, f.Close())
+
+		rtest.Assert(t, bytes.Equal(data, buf.Bytes()), "wrong data read with buffer size %d", bufsize)
+	}
+
+	idx := &extentIndex{extents: extents}
+	rtest.Equals(t, false, idx.isHole(0, 100))
+	rtest.Equals(t, true, idx.isHole(1000, 4000))
+	rtest.Equals(t, false, idx.isHole(4000, 2000))
+	rtest.Equals(t, true, idx.isHole(25000, 35000))
+	rtest.Equals(t, true, idx.isHole(60010, 39990))
+}
+
+func TestArchiverSparseFile(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	const size = 12 * 1024 * 1024
+	data := rtest.Random(23, 100000)
+
+	// the sparse file and the dense file have the same content
+	sparse, err := os.Create(filepath.Join(tempdir, "sparse"))
+	rtest.OK(t, err)
+	rtest.OK(t, sparse.Truncate(size))
+	_, err = sparse.WriteAt(data, 5*1024*1024)
+	rtest.OK(t, err)
+	rtest.OK(t, sparse.Close())
+
+	dense := make([]byte, size)
+	copy(dense[5*1024*1024:], data)
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(tempdir, "dense"), dense, 0600))
+
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	back := fs.TestChdir(t, tempdir)
+	sn := TestSnapshot(t, repo, ".", nil)
+	back()
+
+	tree, err := repo.LoadTree(context.TODO(), *sn.Tree)
+	rtest.OK(t, err)
+
+	sparseNode, denseNode := tree.Find("sparse"), tree.Find("dense")
+	rtest.Assert(t, sparseNode != nil && denseNode != nil, "files not found in snapshot")
+	rtest.Equals(t, uint64(size), sparseNode.Size)
+	rtest.Equals(t, denseNode.Content, sparseNode.Content)
+}
@@ -0,0 +1,83 @@
+// Package dryrun implements a backend which does not modify the repository.
+// Read operations are passed to the wrapped backend, while saving and removing
+// files only pretends to succeed.
+package dryrun
+
+import (
+	"context"
+	"io"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// make sure that Backend implements restic.Backend
+var _ restic.Backend = &Backend{}
+
+// Backend passes reads through to the wrapped backend and discards all
+// writes.
+type Backend struct {
+	b restic.Backend
+}
+
+// New returns a new backend which wraps be and does not modify it.
+func New(be restic.Backend) *Backend {
+	debug.Log("created new dry run backend")
+	return &Backend{b: be}
+}
+
+// Save pretends to store the data from rd under the given handle.
+func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if err := h.Valid(); err != nil {
+		return err
+	}
+
+	debug.Log("faked saving %v bytes at %v", rd.Length(), h)
+	return nil
+}
+
+// Remove pretends to remove the file described by h.
+func (be *Backend) Remove(ctx context.Context, h restic.Handle) error {
+	debug.Log("faked removing %v", h)
+	return nil
+}
+
+// Delete pretends to remove all data in the backend.
+func (be *Backend) Delete(ctx context.Context) error {
+	return nil
+}
+
+// Location returns the location of the wrapped backend.
+func (be *Backend) Location() string {
+	return "DRY:" + be.b.Location()
+}
+
+// Close closes the wrapped backend.
+func (be *Backend) Close() error {
+	return be.b.Close()
+}
+
+// IsNotExist returns true if the error was caused by a non-existing file.
+func (be *Backend) IsNotExist(err error) bool {
+	return be.b.IsNotExist(err)
+}
+
+// Test returns whether the file exists in the wrapped backend.
+func (be *Backend) Test(ctx context.Context, h restic.Handle) (bool, error) {
+	return be.b.Test(ctx, h)
+}
+
+// Load reads the file from the wrapped backend.
+func (be *Backend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	return be.b.Load(ctx, h, length, offset, fn)
+}
+
+// Stat returns information about the file in the wrapped backend.
+func (be *Backend) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, error) {
+	return be.b.Stat(ctx, h)
+}
+
+// List lists the files of type t in the wrapped backend.
+func (be *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	return be.b.List(ctx, t, fn)
+}
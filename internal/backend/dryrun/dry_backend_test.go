@@ -0,0 +1,57 @@
+package dryrun_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/restic/restic/internal/backend/dryrun"
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestDryBackend(t *testing.T) {
+	ctx := context.TODO()
+	m := mem.New()
+
+	existing := restic.Handle{Type: restic.DataFile, Name: restic.NewRandomID().String()}
+	rtest.OK(t, m.Save(ctx, existing, restic.NewByteReader([]byte("foo"))))
+
+	be := dryrun.New(m)
+
+	h := restic.Handle{Type: restic.DataFile, Name: restic.NewRandomID().String()}
+	rtest.OK(t, be.Save(ctx, h, restic.NewByteReader([]byte("bar"))))
+
+	ok, err := m.Test(ctx, h)
+	rtest.OK(t, err)
+	rtest.Assert(t, !ok, "file was saved in the wrapped backend")
+
+	ok, err = be.Test(ctx, h)
+	rtest.OK(t, err)
+	rtest.Assert(t, !ok, "file was saved in the dry run backend")
+
+	rtest.OK(t, be.Remove(ctx, existing))
+	ok, err = m.Test(ctx, existing)
+	rtest.OK(t, err)
+	rtest.Assert(t, ok, "file was removed from the wrapped backend")
+
+	var buf []byte
+	rtest.OK(t, be.Load(ctx, existing, 0, 0, func(rd io.Reader) (err error) {
+		buf, err = ioutil.ReadAll(rd)
+		return err
+	}))
+	rtest.Assert(t, bytes.Equal(buf, []byte("foo")), "wrong data loaded: %q", buf)
+
+	var names []string
+	rtest.OK(t, be.List(ctx, restic.DataFile, func(fi restic.FileInfo) error {
+		names = append(names, fi.Name)
+		return nil
+	}))
+	rtest.Equals(t, []string{existing.Name}, names)
+
+	rtest.Assert(t, be.Save(ctx, restic.Handle{Type: restic.DataFile}, restic.NewByteReader(nil)) != nil,
+		"invalid handle was accepted")
+}
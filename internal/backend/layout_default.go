@@ -16,11 +16,12 @@ type DefaultLayout struct {
 }
 
 var defaultLayoutPaths = map[restic.FileType]string{
-	restic.DataFile:     "data",
-	restic.SnapshotFile: "snapshots",
-	restic.IndexFile:    "index",
-	restic.LockFile:     "locks",
-	restic.KeyFile:      "keys",
+	restic.DataFile:          "data",
+	restic.SnapshotFile:      "snapshots",
+	restic.IndexFile:         "index",
+	restic.LockFile:          "locks",
+	restic.KeyFile:           "keys",
+	restic.PendingDeleteFile: "pending-delete",
 }
 
 func (l *DefaultLayout) String() string {
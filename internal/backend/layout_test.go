@@ -110,6 +110,7 @@ func TestDefaultLayout(t *testing.T) {
 			filepath.Join(tempdir, "index"),
 			filepath.Join(tempdir, "locks"),
 			filepath.Join(tempdir, "keys"),
+			filepath.Join(tempdir, "pending-delete"),
 		}
 
 		for i := 0; i < 256; i++ {
@@ -187,6 +188,7 @@ func TestRESTLayout(t *testing.T) {
 			filepath.Join(path, "index"),
 			filepath.Join(path, "locks"),
 			filepath.Join(path, "keys"),
+			filepath.Join(path, "pending-delete"),
 		}
 
 		sort.Sort(sort.StringSlice(want))
@@ -333,6 +335,7 @@ func TestS3LegacyLayout(t *testing.T) {
 			filepath.Join(path, "index"),
 			filepath.Join(path, "lock"),
 			filepath.Join(path, "key"),
+			filepath.Join(path, "pending-delete"),
 		}
 
 		sort.Sort(sort.StringSlice(want))
@@ -12,6 +12,8 @@ import (
 type Config struct {
 	URL         *url.URL
 	Connections uint `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
+
+	KeyRoleHeader bool `option:"key-role-header" help:"send the role of the key in the X-Restic-Key-Role header so that the server can enforce it"`
 }
 
 func init() {
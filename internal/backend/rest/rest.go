@@ -10,6 +10,7 @@ import (
 	"net/url"
 	"path"
 	"strings"
+	"sync"
 
 	"golang.org/x/net/context/ctxhttp"
 
@@ -29,6 +30,10 @@ type Backend struct {
 	sem    *backend.Semaphore
 	client *http.Client
 	backend.Layout
+
+	sendKeyRole bool
+	keyRoleMu   sync.Mutex
+	keyRole     string
 }
 
 // the REST API protocol version is decided by HTTP request headers, these are the constants.
@@ -37,6 +42,10 @@ const (
 	ContentTypeV2 = "application/vnd.x.restic.rest.v2"
 )
 
+// KeyRoleHeader is the HTTP request header which contains the role of the key
+// used to open the repository, if enabled in the config.
+const KeyRoleHeader = "X-Restic-Key-Role"
+
 // Open opens the REST backend with the given config.
 func Open(cfg Config, rt http.RoundTripper) (*Backend, error) {
 	client := &http.Client{Transport: rt}
@@ -57,6 +66,8 @@ func Open(cfg Config, rt http.RoundTripper) (*Backend, error) {
 		client: client,
 		Layout: &backend.RESTLayout{URL: url, Join: path.Join},
 		sem:    sem,
+
+		sendKeyRole: cfg.KeyRoleHeader,
 	}
 
 	return be, nil
@@ -106,6 +117,32 @@ func (b *Backend) Location() string {
 	return b.url.String()
 }
 
+// SetKeyRole sets the role of the key which was used to open the repository.
+// It is sent to the server with all following requests if the option
+// key-role-header is set.
+func (b *Backend) SetKeyRole(role string) {
+	b.keyRoleMu.Lock()
+	b.keyRole = role
+	b.keyRoleMu.Unlock()
+}
+
+// setHeaders sets the headers common to all requests.
+func (b *Backend) setHeaders(req *http.Request) {
+	req.Header.Set("Accept", ContentTypeV2)
+
+	if !b.sendKeyRole {
+		return
+	}
+
+	b.keyRoleMu.Lock()
+	role := b.keyRole
+	b.keyRoleMu.Unlock()
+
+	if role != "" {
+		req.Header.Set(KeyRoleHeader, role)
+	}
+}
+
 // Save stores data in the backend at the handle.
 func (b *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
 	if err := h.Valid(); err != nil {
@@ -121,7 +158,7 @@ func (b *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindRea
 		return errors.Wrap(err, "NewRequest")
 	}
 	req.Header.Set("Content-Type", "application/octet-stream")
-	req.Header.Set("Accept", ContentTypeV2)
+	b.setHeaders(req)
 
 	// explicitly set the content length, this prevents chunked encoding and
 	// let's the server know what's coming.
@@ -200,7 +237,7 @@ func (b *Backend) openReader(ctx context.Context, h restic.Handle, length int, o
 		byteRange = fmt.Sprintf("bytes=%d-%d", offset, offset+int64(length)-1)
 	}
 	req.Header.Set("Range", byteRange)
-	req.Header.Set("Accept", ContentTypeV2)
+	b.setHeaders(req)
 	debug.Log("Load(%v) send range %v", h, byteRange)
 
 	b.sem.GetToken()
@@ -238,7 +275,7 @@ func (b *Backend) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, e
 	if err != nil {
 		return restic.FileInfo{}, errors.Wrap(err, "NewRequest")
 	}
-	req.Header.Set("Accept", ContentTypeV2)
+	b.setHeaders(req)
 
 	b.sem.GetToken()
 	resp, err := ctxhttp.Do(ctx, b.client, req)
@@ -293,7 +330,7 @@ func (b *Backend) Remove(ctx context.Context, h restic.Handle) error {
 	if err != nil {
 		return errors.Wrap(err, "http.NewRequest")
 	}
-	req.Header.Set("Accept", ContentTypeV2)
+	b.setHeaders(req)
 
 	b.sem.GetToken()
 	resp, err := ctxhttp.Do(ctx, b.client, req)
@@ -332,7 +369,7 @@ func (b *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.Fi
 	if err != nil {
 		return errors.Wrap(err, "NewRequest")
 	}
-	req.Header.Set("Accept", ContentTypeV2)
+	b.setHeaders(req)
 
 	b.sem.GetToken()
 	resp, err := ctxhttp.Do(ctx, b.client, req)
@@ -342,6 +379,13 @@ func (b *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.Fi
 		return errors.Wrap(err, "List")
 	}
 
+	if resp.StatusCode == http.StatusNotFound {
+		// the directory does not exist, e.g. because the server does not
+		// know about the file type yet
+		_ = resp.Body.Close()
+		return nil
+	}
+
 	if resp.StatusCode != 200 {
 		return errors.Errorf("List failed, server response: %v (%v)", resp.Status, resp.StatusCode)
 	}
@@ -446,7 +490,8 @@ func (b *Backend) Delete(ctx context.Context) error {
 		restic.KeyFile,
 		restic.LockFile,
 		restic.SnapshotFile,
-		restic.IndexFile}
+		restic.IndexFile,
+		restic.PendingDeleteFile}
 
 	for _, t := range alltypes {
 		err := b.removeKeys(ctx, t)
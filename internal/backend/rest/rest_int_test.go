@@ -148,3 +148,71 @@ func TestListAPI(t *testing.T) {
 		})
 	}
 }
+
+func TestKeyRoleHeader(t *testing.T) {
+	var tests = []struct {
+		Name    string
+		Enabled bool
+		Role    string
+		Header  string
+	}{
+		{Name: "disabled", Enabled: false, Role: "append-only", Header: ""},
+		{Name: "no-role", Enabled: true, Role: "", Header: ""},
+		{Name: "append-only", Enabled: true, Role: "append-only", Header: "append-only"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var headers []string
+			srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				headers = append(headers, req.Header.Get(rest.KeyRoleHeader))
+				if req.Method == "HEAD" {
+					res.Header().Set("Content-Length", "23")
+				}
+				res.WriteHeader(http.StatusOK)
+			}))
+			defer srv.Close()
+
+			srvURL, err := url.Parse(srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := rest.Config{
+				Connections:   5,
+				URL:           srvURL,
+				KeyRoleHeader: test.Enabled,
+			}
+
+			be, err := rest.Open(cfg, http.DefaultTransport)
+			if err != nil {
+				t.Fatal(err)
+			}
+			be.SetKeyRole(test.Role)
+
+			h := restic.Handle{Type: restic.DataFile, Name: "1122e6749358b057fa1ac6b580a0fbe7a9a5fbc92e82743ee21aaf829624a985"}
+			if _, err = be.Stat(context.TODO(), h); err != nil {
+				t.Fatal(err)
+			}
+
+			if err = be.Remove(context.TODO(), h); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, header := range headers {
+				if header != test.Header {
+					t.Errorf("wrong %v header, want %q, got %q", rest.KeyRoleHeader, test.Header, header)
+				}
+			}
+
+			if len(headers) != 2 {
+				t.Fatalf("wrong number of HTTP requests executed, want 2, got %d", len(headers))
+			}
+
+			err = be.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -701,7 +701,7 @@ func (s *Suite) TestBackend(t *testing.T) {
 
 	for _, tpe := range []restic.FileType{
 		restic.DataFile, restic.KeyFile, restic.LockFile,
-		restic.SnapshotFile, restic.IndexFile,
+		restic.SnapshotFile, restic.IndexFile, restic.PendingDeleteFile,
 	} {
 		// detect non-existing files
 		for _, ts := range testStrings {
@@ -7,6 +7,7 @@ import (
 	"os"
 	"sync"
 
+	"github.com/restic/restic/internal/compression"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/pack"
@@ -646,14 +647,14 @@ func (c *Checker) GetPacks() restic.IDSet {
 	return c.packs
 }
 
-// checkPack reads a pack and checks the integrity of all blobs.
-func checkPack(ctx context.Context, r restic.Repository, id restic.ID) error {
+// CheckPack reads a pack and checks the integrity of all blobs.
+func CheckPack(ctx context.Context, r restic.Repository, id restic.ID) error {
 	debug.Log("checking pack %v", id)
 	h := restic.Handle{Type: restic.DataFile, Name: id.String()}
 
 	packfile, hash, size, err := repository.DownloadAndHash(ctx, r.Backend(), h)
 	if err != nil {
-		return errors.Wrap(err, "checkPack")
+		return errors.Wrap(err, "CheckPack")
 	}
 
 	defer func() {
@@ -704,6 +705,15 @@ func checkPack(ctx context.Context, r restic.Repository, id restic.ID) error {
 			continue
 		}
 
+		if blob.IsCompressed() {
+			plaintext, err = compression.Decompress(nil, plaintext)
+			if err != nil {
+				debug.Log("  error decompressing blob %v: %v", blob.ID, err)
+				errs = append(errs, errors.Errorf("blob %v: %v", i, err))
+				continue
+			}
+		}
+
 		hash := restic.Hash(plaintext)
 		if !hash.Equal(blob.ID) {
 			debug.Log("  Blob ID does not match, want %v, got %v", blob.ID, hash)
@@ -750,7 +760,7 @@ func (c *Checker) ReadPacks(ctx context.Context, packs restic.IDSet, p *restic.P
 					}
 				}
 
-				err := checkPack(ctx, c.repo, id)
+				err := CheckPack(ctx, c.repo, id)
 				p.Report(restic.Stat{Blobs: 1})
 				if err == nil {
 					continue
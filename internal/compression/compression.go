@@ -0,0 +1,135 @@
+package compression
+
+import (
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// Mode selects how blobs are compressed before they are saved to the
+// repository.
+type Mode uint
+
+// These are the supported compression modes.
+const (
+	// Auto compresses blobs with a fast compression level.
+	Auto Mode = iota
+	// Off disables compression.
+	Off
+	// Max compresses blobs with the best compression level available, this
+	// is considerably slower.
+	Max
+)
+
+func (m Mode) String() string {
+	switch m {
+	case Auto:
+		return "auto"
+	case Off:
+		return "off"
+	case Max:
+		return "max"
+	}
+
+	return "invalid"
+}
+
+// Set implements the method needed for pflag command flag parsing.
+func (m *Mode) Set(s string) error {
+	switch s {
+	case "auto":
+		*m = Auto
+	case "off":
+		*m = Off
+	case "max":
+		*m = Max
+	default:
+		return errors.Errorf("invalid compression mode %q, must be one of (auto|off|max)", s)
+	}
+
+	return nil
+}
+
+// Type returns the type name of the value, needed for pflag.
+func (m *Mode) Type() string {
+	return "mode"
+}
+
+var (
+	encoderOnce sync.Once
+	encoders    map[Mode]*zstd.Encoder
+	encoderErr  error
+
+	decoderOnce sync.Once
+	decoder     *zstd.Decoder
+	decoderErr  error
+)
+
+func initEncoders() {
+	encoders = make(map[Mode]*zstd.Encoder)
+
+	levels := map[Mode]zstd.EncoderLevel{
+		Auto: zstd.SpeedDefault,
+		Max:  zstd.SpeedBestCompression,
+	}
+
+	for mode, level := range levels {
+		// the encoder is only used via EncodeAll, which is safe to be called
+		// concurrently
+		enc, err := zstd.NewWriter(nil,
+			zstd.WithEncoderLevel(level),
+			zstd.WithEncoderCRC(false),
+			zstd.WithZeroFrames(true),
+			zstd.WithEncoderConcurrency(1),
+		)
+		if err != nil {
+			encoderErr = err
+			return
+		}
+		encoders[mode] = enc
+	}
+}
+
+func initDecoder() {
+	// the decoder is only used via DecodeAll, which is safe to be called
+	// concurrently
+	decoder, decoderErr = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+}
+
+// Compress appends the compressed data in src to dst and returns the result.
+// When mode is Off, nil is returned.
+func Compress(mode Mode, dst, src []byte) ([]byte, error) {
+	if mode == Off {
+		return nil, nil
+	}
+
+	encoderOnce.Do(initEncoders)
+	if encoderErr != nil {
+		return nil, errors.Wrap(encoderErr, "zstd.NewWriter")
+	}
+
+	enc, ok := encoders[mode]
+	if !ok {
+		return nil, errors.Errorf("invalid compression mode %v", mode)
+	}
+
+	return enc.EncodeAll(src, dst), nil
+}
+
+// Decompress appends the decompressed data in src to dst and returns the
+// result.
+func Decompress(dst, src []byte) ([]byte, error) {
+	decoderOnce.Do(initDecoder)
+	if decoderErr != nil {
+		return nil, errors.Wrap(decoderErr, "zstd.NewReader")
+	}
+
+	buf, err := decoder.DecodeAll(src, dst)
+	if err != nil {
+		return nil, errors.Wrap(err, "decompress")
+	}
+
+	return buf, nil
+}
@@ -0,0 +1,61 @@
+package compression
+
+import (
+	"bytes"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestCompressDecompress(t *testing.T) {
+	var data []byte
+	for i := 0; i < 1000; i++ {
+		data = append(data, []byte("restic compresses data blobs\n")...)
+	}
+	data = append(data, rtest.Random(23, 1024)...)
+
+	for _, mode := range []Mode{Auto, Max} {
+		t.Run(mode.String(), func(t *testing.T) {
+			compressed, err := Compress(mode, nil, data)
+			rtest.OK(t, err)
+			rtest.Assert(t, len(compressed) < len(data),
+				"compressed data is not smaller: %d >= %d", len(compressed), len(data))
+
+			buf, err := Decompress(nil, compressed)
+			rtest.OK(t, err)
+			rtest.Assert(t, bytes.Equal(data, buf), "decompressed data does not match")
+		})
+	}
+}
+
+func TestCompressOff(t *testing.T) {
+	buf, err := Compress(Off, nil, []byte("foobar"))
+	rtest.OK(t, err)
+	rtest.Assert(t, buf == nil, "expected nil buffer, got %v", buf)
+}
+
+func TestDecompressInvalid(t *testing.T) {
+	_, err := Decompress(nil, []byte("not compressed"))
+	rtest.Assert(t, err != nil, "expected error for invalid data")
+}
+
+func TestModeSet(t *testing.T) {
+	var tests = []struct {
+		s    string
+		mode Mode
+	}{
+		{"auto", Auto},
+		{"off", Off},
+		{"max", Max},
+	}
+
+	for _, test := range tests {
+		var m Mode
+		rtest.OK(t, m.Set(test.s))
+		rtest.Equals(t, test.mode, m)
+		rtest.Equals(t, test.s, m.String())
+	}
+
+	var m Mode
+	rtest.Assert(t, m.Set("fast") != nil, "expected error for invalid mode")
+}
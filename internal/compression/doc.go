@@ -0,0 +1,3 @@
+// Package compression implements the compression of blobs stored in a
+// repository.
+package compression
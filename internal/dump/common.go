@@ -0,0 +1,95 @@
+// Package dump writes the content of a snapshot to an archive.
+package dump
+
+import (
+	"context"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// dumper writes nodes to an archive.
+type dumper interface {
+	io.Closer
+
+	// dumpNode writes the node to the archive under the path p.
+	dumpNode(ctx context.Context, node *restic.Node, p string, repo restic.Repository) error
+}
+
+// writeDump writes all nodes in tree and their children to the archive,
+// below the directory prefix, and closes the archive. The paths are changed
+// with rewrite, which requires prefix to be the absolute path of tree in the
+// snapshot. Leading slashes are removed from the rewritten paths.
+func writeDump(ctx context.Context, repo restic.Repository, tree *restic.Tree, prefix string, rewrite restic.PathRewriter, dmp dumper) error {
+	if err := dumpTree(ctx, repo, tree, prefix, rewrite, dmp); err != nil {
+		return err
+	}
+
+	return dmp.Close()
+}
+
+func dumpTree(ctx context.Context, repo restic.Repository, tree *restic.Tree, prefix string, rewrite restic.PathRewriter, dmp dumper) error {
+	for _, node := range tree.Nodes {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		p := path.Join(prefix, node.Name)
+
+		// items without a path of their own are left out, but not their children
+		if name, ok := rewrite.Rewrite(p); ok {
+			if !rewrite.Identity() {
+				name = strings.TrimLeft(name, "/")
+			}
+			if err := dmp.dumpNode(ctx, node, name, repo); err != nil {
+				return err
+			}
+		}
+
+		if node.Type != "dir" || node.Subtree == nil {
+			continue
+		}
+
+		subtree, err := repo.LoadTree(ctx, *node.Subtree)
+		if err != nil {
+			return errors.Wrapf(err, "cannot load subtree for %q", p)
+		}
+
+		if err := dumpTree(ctx, repo, subtree, p, rewrite, dmp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteNodeData writes the content of the file node to w.
+func WriteNodeData(ctx context.Context, w io.Writer, repo restic.Repository, node *restic.Node) error {
+	var buf []byte
+	for _, id := range node.Content {
+		size, found := repo.LookupBlobSize(id, restic.DataBlob)
+		if !found {
+			return errors.Errorf("id %v not found in repository", id)
+		}
+
+		buf = buf[:cap(buf)]
+		if len(buf) < restic.CiphertextLength(int(size)) {
+			buf = restic.NewBlobBuffer(int(size))
+		}
+
+		n, err := repo.LoadBlob(ctx, restic.DataBlob, id, buf)
+		if err != nil {
+			return err
+		}
+		buf = buf[:n]
+
+		_, err = w.Write(buf)
+		if err != nil {
+			return errors.Wrap(err, "Write")
+		}
+	}
+	return nil
+}
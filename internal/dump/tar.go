@@ -0,0 +1,134 @@
+package dump
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"os"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+type tarDumper struct {
+	w *tar.Writer
+
+	// hardlinks maps device and inode of files with more than one link to
+	// the path the file was first written to.
+	hardlinks map[hardlinkKey]string
+}
+
+type hardlinkKey struct {
+	device, inode uint64
+}
+
+// make sure that tarDumper implements dumper
+var _ dumper = &tarDumper{}
+
+// WriteTar writes the nodes in tree and their children to dst as a tar
+// archive. The paths in the archive start with prefix and are changed with
+// rewrite, which requires prefix to be the absolute path of tree in the
+// snapshot.
+func WriteTar(ctx context.Context, repo restic.Repository, tree *restic.Tree, prefix string, rewrite restic.PathRewriter, dst io.Writer) error {
+	dmp := &tarDumper{
+		w:         tar.NewWriter(dst),
+		hardlinks: make(map[hardlinkKey]string),
+	}
+
+	return writeDump(ctx, repo, tree, prefix, rewrite, dmp)
+}
+
+func (dmp *tarDumper) Close() error {
+	return dmp.w.Close()
+}
+
+// copied from archive/tar.FileInfoHeader
+const (
+	// Mode constants from the USTAR spec:
+	// See http://pubs.opengroup.org/onlinepubs/9699919799/utilities/pax.html#tag_20_92_13_06
+	cISUID = 04000 // Set uid
+	cISGID = 02000 // Set gid
+	cISVTX = 01000 // Save text (sticky bit)
+)
+
+// tarMode returns the mode bits for the tar header of node.
+func tarMode(node *restic.Node) int64 {
+	mode := int64(node.Mode.Perm())
+	if node.Mode&os.ModeSetuid != 0 {
+		mode |= cISUID
+	}
+	if node.Mode&os.ModeSetgid != 0 {
+		mode |= cISGID
+	}
+	if node.Mode&os.ModeSticky != 0 {
+		mode |= cISVTX
+	}
+	return mode
+}
+
+func (dmp *tarDumper) dumpNode(ctx context.Context, node *restic.Node, p string, repo restic.Repository) error {
+	header := &tar.Header{
+		Name:       p,
+		Mode:       tarMode(node),
+		Uid:        int(node.UID),
+		Gid:        int(node.GID),
+		Uname:      node.User,
+		Gname:      node.Group,
+		ModTime:    node.ModTime,
+		AccessTime: node.AccessTime,
+		ChangeTime: node.ChangeTime,
+		Format:     tar.FormatPAX,
+	}
+
+	if len(node.ExtendedAttributes) > 0 {
+		header.PAXRecords = make(map[string]string, len(node.ExtendedAttributes))
+		for _, attr := range node.ExtendedAttributes {
+			header.PAXRecords["SCHILY.xattr."+attr.Name] = string(attr.Value)
+		}
+	}
+
+	writeContent := false
+
+	switch node.Type {
+	case "file":
+		key := hardlinkKey{device: node.DeviceID, inode: node.Inode}
+		if target, ok := dmp.hardlinks[key]; ok && node.Links > 1 {
+			header.Typeflag = tar.TypeLink
+			header.Linkname = target
+			break
+		}
+
+		if node.Links > 1 {
+			dmp.hardlinks[key] = p
+		}
+
+		header.Typeflag = tar.TypeReg
+		header.Size = int64(node.Size)
+		writeContent = true
+	case "dir":
+		header.Typeflag = tar.TypeDir
+		header.Name += "/"
+	case "symlink":
+		header.Typeflag = tar.TypeSymlink
+		header.Linkname = node.LinkTarget
+	case "fifo":
+		header.Typeflag = tar.TypeFifo
+	default:
+		// device numbers are stored in a platform dependent format,
+		// sockets cannot be represented in tar archives at all
+		debug.Log("skipping %v of type %v", p, node.Type)
+		return nil
+	}
+
+	err := dmp.w.WriteHeader(header)
+	if err != nil {
+		return errors.Wrap(err, "TarHeader")
+	}
+
+	if !writeContent {
+		return nil
+	}
+
+	return WriteNodeData(ctx, dmp.w, repo, node)
+}
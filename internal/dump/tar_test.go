@@ -0,0 +1,200 @@
+package dump
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+var testArchiveDir = archiver.TestDir{
+	"file": archiver.TestFile{Content: "foobar"},
+	"subdir": archiver.TestDir{
+		"empty": archiver.TestFile{Content: ""},
+		"large": archiver.TestFile{Content: strings.Repeat("0123456789", 100000)},
+		"link":  archiver.TestSymlink{Target: "../file"},
+		"nested": archiver.TestDir{
+			"file": archiver.TestFile{Content: "nested file"},
+		},
+	},
+	"emptydir": archiver.TestDir{},
+}
+
+// snapshotDir saves the files in dir in a snapshot in a new repository and
+// returns the tree of the snapshot.
+func snapshotDir(t *testing.T, dir string) (restic.Repository, *restic.Tree, func()) {
+	repo, cleanup := repository.TestRepository(t)
+
+	back := fs.TestChdir(t, dir)
+	sn := archiver.TestSnapshot(t, repo, ".", nil)
+	back()
+
+	tree, err := repo.LoadTree(context.TODO(), *sn.Tree)
+	rtest.OK(t, err)
+
+	return repo, tree, cleanup
+}
+
+// checkArchiveEntry compares an entry in an archive with the file at name.
+func checkArchiveEntry(t *testing.T, name string, mode os.FileMode, linkTarget string, content []byte) {
+	fi, err := os.Lstat(name)
+	rtest.OK(t, err)
+
+	switch {
+	case fi.IsDir():
+		rtest.Assert(t, mode.IsDir(), "%v: expected a directory, got mode %v", name, mode)
+	case fi.Mode()&os.ModeSymlink != 0:
+		rtest.Assert(t, mode&os.ModeSymlink != 0, "%v: expected a symlink, got mode %v", name, mode)
+		target, err := os.Readlink(name)
+		rtest.OK(t, err)
+		rtest.Equals(t, target, linkTarget)
+	default:
+		rtest.Assert(t, mode.IsRegular(), "%v: expected a file, got mode %v", name, mode)
+		data, err := ioutil.ReadFile(name)
+		rtest.OK(t, err)
+		rtest.Assert(t, bytes.Equal(data, content), "%v: wrong content, want %d bytes, got %d bytes", name, len(data), len(content))
+	}
+
+	if runtime.GOOS != "windows" {
+		rtest.Equals(t, fi.Mode().Perm(), mode.Perm())
+	}
+}
+
+// countFiles returns the number of files and directories below dir.
+func countFiles(t *testing.T, dir string) int {
+	n := 0
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != dir {
+			n++
+		}
+		return nil
+	})
+	rtest.OK(t, err)
+	return n
+}
+
+func TestWriteTar(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	archiver.TestCreateFiles(t, tempdir, testArchiveDir)
+	repo, tree, cleanup := snapshotDir(t, tempdir)
+	defer cleanup()
+
+	buf := bytes.NewBuffer(nil)
+	rtest.OK(t, WriteTar(context.TODO(), repo, tree, "", restic.PathRewriter{}, buf))
+
+	rd := tar.NewReader(buf)
+	entries := 0
+	for {
+		header, err := rd.Next()
+		if err == io.EOF {
+			break
+		}
+		rtest.OK(t, err)
+		entries++
+
+		content, err := ioutil.ReadAll(rd)
+		rtest.OK(t, err)
+
+		name := filepath.Join(tempdir, filepath.FromSlash(strings.TrimSuffix(header.Name, "/")))
+		checkArchiveEntry(t, name, header.FileInfo().Mode(), header.Linkname, content)
+
+		fi, err := os.Lstat(name)
+		rtest.OK(t, err)
+		rtest.Assert(t, header.ModTime.Equal(fi.ModTime()), "%v: wrong mtime, want %v, got %v", name, fi.ModTime(), header.ModTime)
+	}
+
+	rtest.Equals(t, countFiles(t, tempdir), entries)
+}
+
+func TestWriteTarHardlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hard links are not supported by the test on Windows")
+	}
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(tempdir, "a"), []byte("hardlinked"), 0644))
+	rtest.OK(t, os.Link(filepath.Join(tempdir, "a"), filepath.Join(tempdir, "b")))
+
+	repo, tree, cleanup := snapshotDir(t, tempdir)
+	defer cleanup()
+
+	buf := bytes.NewBuffer(nil)
+	rtest.OK(t, WriteTar(context.TODO(), repo, tree, "prefix", restic.PathRewriter{}, buf))
+
+	rd := tar.NewReader(buf)
+
+	header, err := rd.Next()
+	rtest.OK(t, err)
+	rtest.Equals(t, "prefix/a", header.Name)
+	rtest.Equals(t, byte(tar.TypeReg), header.Typeflag)
+
+	header, err = rd.Next()
+	rtest.OK(t, err)
+	rtest.Equals(t, "prefix/b", header.Name)
+	rtest.Equals(t, byte(tar.TypeLink), header.Typeflag)
+	rtest.Equals(t, "prefix/a", header.Linkname)
+	rtest.Equals(t, int64(0), header.Size)
+
+	_, err = rd.Next()
+	rtest.Equals(t, io.EOF, err)
+}
+
+func TestWriteTarRewrite(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	archiver.TestCreateFiles(t, tempdir, testArchiveDir)
+	repo, tree, cleanup := snapshotDir(t, tempdir)
+	defer cleanup()
+
+	rewrite := restic.PathRewriter{
+		Maps:            []restic.PathMapping{{Old: "/srv/subdir/nested", New: "/data/nested"}},
+		StripComponents: 1,
+	}
+
+	buf := bytes.NewBuffer(nil)
+	rtest.OK(t, WriteTar(context.TODO(), repo, tree, "/srv", rewrite, buf))
+
+	var names []string
+	rd := tar.NewReader(buf)
+	for {
+		header, err := rd.Next()
+		if err == io.EOF {
+			break
+		}
+		rtest.OK(t, err)
+		names = append(names, header.Name)
+	}
+
+	sort.Strings(names)
+	rtest.Equals(t, []string{
+		"emptydir/",
+		"file",
+		"nested/",
+		"nested/file",
+		"subdir/",
+		"subdir/empty",
+		"subdir/large",
+		"subdir/link",
+	}, names)
+}
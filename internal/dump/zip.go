@@ -0,0 +1,75 @@
+package dump
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"os"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+type zipDumper struct {
+	w *zip.Writer
+}
+
+// make sure that zipDumper implements dumper
+var _ dumper = &zipDumper{}
+
+// WriteZip writes the nodes in tree and their children to dst as a zip
+// archive. The paths in the archive start with prefix and are changed with
+// rewrite, like for WriteTar. Owners and extended
+// attributes cannot be stored in zip archives, hard links are stored as
+// separate files.
+func WriteZip(ctx context.Context, repo restic.Repository, tree *restic.Tree, prefix string, rewrite restic.PathRewriter, dst io.Writer) error {
+	dmp := &zipDumper{w: zip.NewWriter(dst)}
+	return writeDump(ctx, repo, tree, prefix, rewrite, dmp)
+}
+
+func (dmp *zipDumper) Close() error {
+	return dmp.w.Close()
+}
+
+func (dmp *zipDumper) dumpNode(ctx context.Context, node *restic.Node, p string, repo restic.Repository) error {
+	header := &zip.FileHeader{
+		Name:     p,
+		Method:   zip.Deflate,
+		Modified: node.ModTime,
+	}
+
+	mode := node.Mode & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+
+	switch node.Type {
+	case "file":
+	case "dir":
+		mode |= os.ModeDir
+		header.Name += "/"
+		header.Method = zip.Store
+	case "symlink":
+		mode |= os.ModeSymlink
+		header.Method = zip.Store
+	default:
+		debug.Log("skipping %v of type %v", p, node.Type)
+		return nil
+	}
+
+	header.SetMode(mode)
+
+	w, err := dmp.w.CreateHeader(header)
+	if err != nil {
+		return errors.Wrap(err, "ZipHeader")
+	}
+
+	switch node.Type {
+	case "file":
+		return WriteNodeData(ctx, w, repo, node)
+	case "symlink":
+		// symlinks store the target as the content
+		_, err = io.WriteString(w, node.LinkTarget)
+		return errors.Wrap(err, "Write")
+	}
+
+	return nil
+}
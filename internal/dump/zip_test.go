@@ -0,0 +1,43 @@
+package dump
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestWriteZip(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	archiver.TestCreateFiles(t, tempdir, testArchiveDir)
+	repo, tree, cleanup := snapshotDir(t, tempdir)
+	defer cleanup()
+
+	buf := bytes.NewBuffer(nil)
+	rtest.OK(t, WriteZip(context.TODO(), repo, tree, "", restic.PathRewriter{}, buf))
+
+	rd, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	rtest.OK(t, err)
+
+	for _, f := range rd.File {
+		r, err := f.Open()
+		rtest.OK(t, err)
+		content, err := ioutil.ReadAll(r)
+		rtest.OK(t, err)
+		rtest.OK(t, r.Close())
+
+		name := filepath.Join(tempdir, filepath.FromSlash(strings.TrimSuffix(f.Name, "/")))
+		checkArchiveEntry(t, name, f.Mode(), string(content), content)
+	}
+
+	rtest.Equals(t, countFiles(t, tempdir), len(rd.File))
+}
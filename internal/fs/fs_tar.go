@@ -0,0 +1,457 @@
+package fs
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// Tar is a read-only file system which provides the entries of a tar archive.
+// The archive is read completely when the file system is created, the
+// content of all files is stored in a temporary file so that files can be
+// read in any order. All paths are absolute, the root directory "/" contains
+// the top level entries of the archive.
+//
+// Hard links within the archive share the same inode number. Inode numbers
+// are derived from the path of the first entry of the file in the archive,
+// so they are stable when the same archive is read again.
+type Tar struct {
+	entries map[string]*tarEntry
+	spool   *os.File
+}
+
+// statically ensure that Tar implements FS.
+var _ FS = &Tar{}
+
+// tarEntry is a file, directory or other item in a tar archive.
+type tarEntry struct {
+	name    string
+	mode    os.FileMode
+	modTime time.Time
+	meta    FileMetadata
+
+	// data is shared between all hard links of a file
+	data *tarData
+
+	// children contains the names of all entries of a directory
+	children map[string]struct{}
+
+	// implicit is set for directories which are not contained in the archive
+	implicit bool
+}
+
+// tarData describes the content of a file in the spool file.
+type tarData struct {
+	offset, size int64
+	links        uint64
+}
+
+// paxXattrPrefix is the prefix of PAX records which contain extended attributes.
+const paxXattrPrefix = "SCHILY.xattr."
+
+// NewTar reads the tar archive from rd and returns a file system with its
+// entries. The archive may be compressed with gzip. File content is stored in
+// a temporary file in tempdir, or the default directory for temporary files if
+// tempdir is empty. Close must be called to remove it.
+func NewTar(rd io.Reader, tempdir string) (*Tar, error) {
+	spool, err := ioutil.TempFile(tempdir, "restic-tar-")
+	if err != nil {
+		return nil, errors.Wrap(err, "TempFile")
+	}
+
+	fs := &Tar{
+		entries: make(map[string]*tarEntry),
+		spool:   spool,
+	}
+
+	err = fs.read(rd)
+	if err != nil {
+		_ = fs.Close()
+		return nil, err
+	}
+
+	return fs, nil
+}
+
+// read adds all entries of the archive in rd to the file system.
+func (fs *Tar) read(rd io.Reader) error {
+	bufrd := bufio.NewReader(rd)
+	magic, err := bufrd.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		debug.Log("archive is compressed with gzip")
+		gzrd, err := gzip.NewReader(bufrd)
+		if err != nil {
+			return errors.Wrap(err, "gzip.NewReader")
+		}
+		rd = gzrd
+	} else {
+		rd = bufrd
+	}
+
+	fs.entries["/"] = newImplicitTarDir("/")
+
+	var offset int64
+	tr := tar.NewReader(rd)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "tar.Next")
+		}
+
+		name := path.Clean("/" + hdr.Name)
+		entry := newTarEntry(name, hdr)
+
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeGNUSparse:
+			n, err := io.Copy(fs.spool, tr)
+			if err != nil {
+				return errors.Wrap(err, "Copy")
+			}
+			entry.data = &tarData{offset: offset, size: n, links: 1}
+			offset += n
+		case tar.TypeLink:
+			target, ok := fs.entries[path.Clean("/"+hdr.Linkname)]
+			if !ok || target.data == nil {
+				return errors.Errorf("hard link %v points to unknown file %v", hdr.Name, hdr.Linkname)
+			}
+
+			// hard links share all metadata with the file
+			link := *target
+			link.name = path.Base(name)
+			entry = &link
+			entry.data.links++
+		case tar.TypeSymlink:
+			entry.mode |= os.ModeSymlink
+			entry.meta.LinkTarget = hdr.Linkname
+		case tar.TypeDir:
+			entry.mode |= os.ModeDir
+			entry.children = make(map[string]struct{})
+		case tar.TypeChar:
+			entry.mode |= os.ModeDevice | os.ModeCharDevice
+			entry.meta.Device = mkdev(hdr.Devmajor, hdr.Devminor)
+		case tar.TypeBlock:
+			entry.mode |= os.ModeDevice
+			entry.meta.Device = mkdev(hdr.Devmajor, hdr.Devminor)
+		case tar.TypeFifo:
+			entry.mode |= os.ModeNamedPipe
+		default:
+			debug.Log("skipping %v with unsupported type %c", hdr.Name, hdr.Typeflag)
+			continue
+		}
+
+		fs.add(name, entry)
+	}
+
+	return nil
+}
+
+// add inserts entry at name, parent directories which are not contained in
+// the archive are created.
+func (fs *Tar) add(name string, entry *tarEntry) {
+	if name == "/" {
+		if entry.mode.IsDir() {
+			entry.children = fs.entries["/"].children
+			fs.entries["/"] = entry
+		}
+		return
+	}
+
+	if prev, ok := fs.entries[name]; ok && prev.mode.IsDir() && entry.mode.IsDir() {
+		// keep the entries of a directory which is contained more than once
+		entry.children = prev.children
+	}
+	fs.entries[name] = entry
+
+	// make sure that all parent directories exist
+	for name != "/" {
+		dir := path.Dir(name)
+		parent, ok := fs.entries[dir]
+		if !ok || !parent.mode.IsDir() {
+			parent = newImplicitTarDir(dir)
+			fs.entries[dir] = parent
+		}
+
+		parent.children[path.Base(name)] = struct{}{}
+		if parent.implicit && entry.modTime.After(parent.modTime) {
+			parent.setModTime(entry.modTime)
+		}
+		name = dir
+	}
+}
+
+func newTarEntry(name string, hdr *tar.Header) *tarEntry {
+	mode := os.FileMode(hdr.Mode).Perm()
+	if hdr.Mode&cISUID != 0 {
+		mode |= os.ModeSetuid
+	}
+	if hdr.Mode&cISGID != 0 {
+		mode |= os.ModeSetgid
+	}
+	if hdr.Mode&cISVTX != 0 {
+		mode |= os.ModeSticky
+	}
+
+	entry := &tarEntry{
+		name:    path.Base(name),
+		mode:    mode,
+		modTime: hdr.ModTime,
+		meta: FileMetadata{
+			Inode:      tarInode(name),
+			Links:      1,
+			UID:        uint32(hdr.Uid),
+			GID:        uint32(hdr.Gid),
+			User:       hdr.Uname,
+			Group:      hdr.Gname,
+			AccessTime: hdr.AccessTime,
+			ChangeTime: hdr.ChangeTime,
+		},
+	}
+
+	if entry.meta.AccessTime.IsZero() {
+		entry.meta.AccessTime = hdr.ModTime
+	}
+	if entry.meta.ChangeTime.IsZero() {
+		entry.meta.ChangeTime = hdr.ModTime
+	}
+
+	for key, value := range hdr.PAXRecords {
+		if !strings.HasPrefix(key, paxXattrPrefix) {
+			continue
+		}
+
+		if entry.meta.ExtendedAttributes == nil {
+			entry.meta.ExtendedAttributes = make(map[string][]byte)
+		}
+		entry.meta.ExtendedAttributes[strings.TrimPrefix(key, paxXattrPrefix)] = []byte(value)
+	}
+
+	return entry
+}
+
+// newImplicitTarDir returns an entry for a directory which is not contained in
+// the archive itself. Its modification time is the newest modification time
+// of the entries below it, so that it does not depend on when the archive is
+// read.
+func newImplicitTarDir(name string) *tarEntry {
+	return &tarEntry{
+		name: path.Base(name),
+		mode: os.ModeDir | 0755,
+		meta: FileMetadata{
+			Inode: tarInode(name),
+			Links: 1,
+		},
+		children: make(map[string]struct{}),
+		implicit: true,
+	}
+}
+
+// setModTime sets all timestamps of an implicit directory to t.
+func (e *tarEntry) setModTime(t time.Time) {
+	e.modTime = t
+	e.meta.AccessTime = t
+	e.meta.ChangeTime = t
+}
+
+// Mode constants from the USTAR spec, cf. archive/tar.
+const (
+	cISUID = 04000 // Set uid
+	cISGID = 02000 // Set gid
+	cISVTX = 01000 // Save text (sticky bit)
+)
+
+// tarInode returns an inode number for the file at name.
+func tarInode(name string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	return h.Sum64()
+}
+
+// mkdev returns the device number for major and minor in the encoding used
+// by Linux, where most tar archives with device files are created.
+func mkdev(major, minor int64) uint64 {
+	ma, mi := uint64(major), uint64(minor)
+	return (ma&0xfffff000)<<32 | (ma&0xfff)<<8 | (mi&0xffffff00)<<12 | mi&0xff
+}
+
+// Close removes the temporary file which contains the file content.
+func (fs *Tar) Close() error {
+	err := fs.spool.Close()
+	if rerr := os.Remove(fs.spool.Name()); err == nil {
+		err = rerr
+	}
+	return errors.Wrap(err, "Close")
+}
+
+func (fs *Tar) lookup(name string) (*tarEntry, error) {
+	entry, ok := fs.entries[path.Clean("/"+name)]
+	if !ok {
+		return nil, &os.PathError{Op: "lstat", Path: name, Err: os.ErrNotExist}
+	}
+	return entry, nil
+}
+
+// VolumeName returns leading volume name, for the Tar file system it's
+// always the empty string.
+func (fs *Tar) VolumeName(path string) string {
+	return ""
+}
+
+// Open opens a file for reading.
+func (fs *Tar) Open(name string) (File, error) {
+	entry, err := fs.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+
+	fi := entry.fileInfo()
+	switch {
+	case entry.mode.IsDir():
+		names := make([]string, 0, len(entry.children))
+		for child := range entry.children {
+			names = append(names, child)
+		}
+		sort.Strings(names)
+
+		d := fakeDir{fakeFile: fakeFile{FileInfo: fi, name: name}}
+		for _, child := range names {
+			d.entries = append(d.entries, fs.entries[path.Join(path.Clean("/"+name), child)].fileInfo())
+		}
+		return d, nil
+	case entry.data != nil:
+		return tarFile{
+			SectionReader: io.NewSectionReader(fs.spool, entry.data.offset, entry.data.size),
+			fakeFile:      fakeFile{FileInfo: fi, name: name},
+		}, nil
+	}
+
+	return fakeFile{FileInfo: fi, name: name}, nil
+}
+
+// OpenFile is the generalized open call; most users will use Open
+// or Create instead.  It opens the named file with specified flag
+// (O_RDONLY etc.) and perm, (0666 etc.) if applicable.  If successful,
+// methods on the returned File can be used for I/O.
+// If there is an error, it will be of type *PathError.
+func (fs *Tar) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if flag & ^(O_RDONLY|O_NOFOLLOW) != 0 {
+		return nil, errors.Errorf("invalid combination of flags 0x%x", flag)
+	}
+
+	entry, err := fs.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if flag&O_NOFOLLOW != 0 && entry.mode&os.ModeSymlink != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.ELOOP}
+	}
+
+	return fs.Open(name)
+}
+
+// Stat returns a FileInfo describing the named file. Symlinks are not
+// resolved, so it returns the same as Lstat. If there is an error, it will be
+// of type *PathError.
+func (fs *Tar) Stat(name string) (os.FileInfo, error) {
+	return fs.Lstat(name)
+}
+
+// Lstat returns the FileInfo structure describing the named file.
+// If the file is a symbolic link, the returned FileInfo
+// describes the symbolic link.  Lstat makes no attempt to follow the link.
+// If there is an error, it will be of type *PathError.
+func (fs *Tar) Lstat(name string) (os.FileInfo, error) {
+	entry, err := fs.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return entry.fileInfo(), nil
+}
+
+// Join joins any number of path elements into a single path, adding a
+// Separator if necessary. Join calls Clean on the result; in particular, all
+// empty strings are ignored.
+func (fs *Tar) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+// Separator returns the OS and FS dependent separator for dirs/subdirs/files.
+func (fs *Tar) Separator() string {
+	return "/"
+}
+
+// IsAbs reports whether the path is absolute.
+func (fs *Tar) IsAbs(p string) bool {
+	return path.IsAbs(p)
+}
+
+// Abs returns an absolute representation of path. Relative paths are
+// interpreted relative to the root directory of the archive. Abs calls Clean
+// on the result.
+func (fs *Tar) Abs(p string) (string, error) {
+	return path.Clean("/" + p), nil
+}
+
+// Clean returns the cleaned path. For details, see filepath.Clean.
+func (fs *Tar) Clean(p string) string {
+	return path.Clean(p)
+}
+
+// Base returns the last element of p.
+func (fs *Tar) Base(p string) string {
+	return path.Base(p)
+}
+
+// Dir returns p without the last element.
+func (fs *Tar) Dir(p string) string {
+	return path.Dir(p)
+}
+
+func (entry *tarEntry) fileInfo() os.FileInfo {
+	meta := entry.meta
+	var size int64
+	if entry.data != nil {
+		size = entry.data.size
+		meta.Links = entry.data.links
+	}
+
+	return fakeFileInfo{
+		name:    entry.name,
+		size:    size,
+		mode:    entry.mode,
+		modtime: entry.modTime,
+		sys:     &meta,
+	}
+}
+
+// tarFile is a file in a tar archive which is opened for reading.
+type tarFile struct {
+	*io.SectionReader
+	fakeFile
+}
+
+// ensure that tarFile implements File
+var _ File = tarFile{}
+
+func (f tarFile) Read(p []byte) (int, error) {
+	return f.SectionReader.Read(p)
+}
+
+func (f tarFile) Seek(offset int64, whence int) (int64, error) {
+	return f.SectionReader.Seek(offset, whence)
+}
@@ -0,0 +1,196 @@
+package fs
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/test"
+)
+
+var testTarModTime = time.Unix(1500000000, 0)
+
+// testTarArchive returns a tar archive with several kinds of entries.
+func testTarArchive(t testing.TB) []byte {
+	buf := bytes.NewBuffer(nil)
+	tw := tar.NewWriter(buf)
+
+	entries := []struct {
+		hdr  tar.Header
+		data string
+	}{
+		{hdr: tar.Header{Typeflag: tar.TypeDir, Name: "./", Mode: 0700}},
+		{hdr: tar.Header{Typeflag: tar.TypeDir, Name: "./dir/", Mode: 0750, Uid: 1000, Gid: 100, Uname: "user", Gname: "users"}},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "./dir/file", Mode: 04640, Uid: 1000, Gid: 100, Uname: "user", Gname: "users",
+			PAXRecords: map[string]string{"SCHILY.xattr.user.foo": "bar"}}, data: "file content"},
+		{hdr: tar.Header{Typeflag: tar.TypeSymlink, Name: "./dir/symlink", Linkname: "file", Mode: 0777}},
+		{hdr: tar.Header{Typeflag: tar.TypeLink, Name: "./dir/hardlink", Linkname: "./dir/file"}},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "implicit/sub/file2", Mode: 0644}, data: "other content"},
+		{hdr: tar.Header{Typeflag: tar.TypeFifo, Name: "fifo", Mode: 0600}},
+	}
+
+	for _, entry := range entries {
+		hdr := entry.hdr
+		hdr.ModTime = testTarModTime
+		hdr.Size = int64(len(entry.data))
+		hdr.Format = tar.FormatPAX
+		test.OK(t, tw.WriteHeader(&hdr))
+		_, err := tw.Write([]byte(entry.data))
+		test.OK(t, err)
+	}
+	test.OK(t, tw.Close())
+
+	return buf.Bytes()
+}
+
+func testTarFS(t testing.TB, archive []byte) (*Tar, func()) {
+	tempdir, cleanup := test.TempDir(t)
+	fs, err := NewTar(bytes.NewReader(archive), tempdir)
+	test.OK(t, err)
+
+	return fs, func() {
+		test.OK(t, fs.Close())
+		cleanup()
+	}
+}
+
+func TestTarFS(t *testing.T) {
+	fs, cleanup := testTarFS(t, testTarArchive(t))
+	defer cleanup()
+
+	verifyDirectoryContents(t, fs, "/", []string{"dir", "implicit", "fifo"})
+	verifyDirectoryContents(t, fs, "/dir", []string{"file", "symlink", "hardlink"})
+	verifyDirectoryContents(t, fs, "/implicit", []string{"sub"})
+	verifyDirectoryContents(t, fs, "/implicit/sub", []string{"file2"})
+
+	verifyFileContentOpen(t, fs, "/dir/file", []byte("file content"))
+	verifyFileContentOpenFile(t, fs, "/dir/hardlink", []byte("file content"))
+	verifyFileContentOpen(t, fs, "/implicit/sub/file2", []byte("other content"))
+
+	fi, err := fs.Lstat("/")
+	test.OK(t, err)
+	test.Equals(t, os.ModeDir|0700, fi.Mode())
+
+	fi, err = fs.Lstat("/dir/file")
+	test.OK(t, err)
+	test.Equals(t, os.ModeSetuid|0640, fi.Mode())
+	test.Equals(t, int64(12), fi.Size())
+	test.Assert(t, fi.ModTime().Equal(testTarModTime), "wrong mtime %v", fi.ModTime())
+
+	meta := fi.Sys().(*FileMetadata)
+	test.Equals(t, uint32(1000), meta.UID)
+	test.Equals(t, uint32(100), meta.GID)
+	test.Equals(t, "user", meta.User)
+	test.Equals(t, "users", meta.Group)
+	test.Equals(t, uint64(2), meta.Links)
+	test.Equals(t, map[string][]byte{"user.foo": []byte("bar")}, meta.ExtendedAttributes)
+
+	fi, err = fs.Lstat("/dir/hardlink")
+	test.OK(t, err)
+	test.Equals(t, "hardlink", fi.Name())
+	hardlinkMeta := fi.Sys().(*FileMetadata)
+	test.Equals(t, meta.Inode, hardlinkMeta.Inode)
+	test.Equals(t, uint64(2), hardlinkMeta.Links)
+
+	extFI := ExtendedStat(fi)
+	test.Equals(t, meta.Inode, extFI.Inode)
+	test.Equals(t, int64(12), extFI.Size)
+
+	fi, err = fs.Lstat("/dir/symlink")
+	test.OK(t, err)
+	test.Equals(t, os.ModeSymlink|0777, fi.Mode())
+	test.Equals(t, "file", fi.Sys().(*FileMetadata).LinkTarget)
+
+	_, err = fs.OpenFile("/dir/symlink", O_RDONLY|O_NOFOLLOW, 0)
+	test.Assert(t, err != nil, "opening a symlink with O_NOFOLLOW succeeded")
+
+	fi, err = fs.Lstat("fifo")
+	test.OK(t, err)
+	test.Equals(t, os.ModeNamedPipe|0600, fi.Mode())
+
+	fi, err = fs.Lstat("/implicit/sub")
+	test.OK(t, err)
+	test.Assert(t, fi.IsDir(), "implicit directory is not a directory")
+
+	_, err = fs.Lstat("/missing")
+	test.Assert(t, os.IsNotExist(err), "wrong error for missing file: %v", err)
+}
+
+func TestTarFSInode(t *testing.T) {
+	fs1, cleanup1 := testTarFS(t, testTarArchive(t))
+	defer cleanup1()
+
+	fs2, cleanup2 := testTarFS(t, testTarArchive(t))
+	defer cleanup2()
+
+	for _, name := range []string{"/dir", "/dir/file", "/implicit/sub/file2"} {
+		fi1, err := fs1.Lstat(name)
+		test.OK(t, err)
+		fi2, err := fs2.Lstat(name)
+		test.OK(t, err)
+
+		test.Equals(t, ExtendedStat(fi1).Inode, ExtendedStat(fi2).Inode)
+	}
+}
+
+func TestTarFSGzip(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	gw := gzip.NewWriter(buf)
+	_, err := gw.Write(testTarArchive(t))
+	test.OK(t, err)
+	test.OK(t, gw.Close())
+
+	fs, cleanup := testTarFS(t, buf.Bytes())
+	defer cleanup()
+
+	verifyDirectoryContents(t, fs, "/", []string{"dir", "implicit", "fifo"})
+	verifyFileContentOpen(t, fs, "/implicit/sub/file2", []byte("other content"))
+}
+
+func TestTarFSInvalidHardlink(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	tw := tar.NewWriter(buf)
+	test.OK(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeLink, Name: "link", Linkname: "missing"}))
+	test.OK(t, tw.Close())
+
+	tempdir, cleanup := test.TempDir(t)
+	defer cleanup()
+
+	_, err := NewTar(buf, tempdir)
+	test.Assert(t, err != nil, "hard link to a missing file was accepted")
+}
+
+func TestTarFSImplicitDirModTime(t *testing.T) {
+	older := testTarModTime
+	newer := testTarModTime.Add(time.Hour)
+
+	buf := bytes.NewBuffer(nil)
+	tw := tar.NewWriter(buf)
+	for _, hdr := range []tar.Header{
+		{Typeflag: tar.TypeReg, Name: "a/b/old", Mode: 0644, ModTime: older},
+		{Typeflag: tar.TypeReg, Name: "a/new", Mode: 0644, ModTime: newer},
+		{Typeflag: tar.TypeReg, Name: "c/file", Mode: 0644, ModTime: older},
+	} {
+		test.OK(t, tw.WriteHeader(&hdr))
+	}
+	test.OK(t, tw.Close())
+
+	fs, cleanup := testTarFS(t, buf.Bytes())
+	defer cleanup()
+
+	for name, want := range map[string]time.Time{
+		"/":    newer,
+		"/a":   newer,
+		"/a/b": older,
+		"/c":   older,
+	} {
+		fi, err := fs.Lstat(name)
+		test.OK(t, err)
+		test.Assert(t, fi.ModTime().Equal(want), "wrong mtime for %v: want %v, got %v", name, want, fi.ModTime())
+		meta := fi.Sys().(*FileMetadata)
+		test.Assert(t, meta.ChangeTime.Equal(want), "wrong ctime for %v: want %v, got %v", name, want, meta.ChangeTime)
+	}
+}
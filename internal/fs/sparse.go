@@ -0,0 +1,26 @@
+package fs
+
+import "os"
+
+// Extent is a region of a file.
+type Extent struct {
+	Offset int64
+	Length int64
+}
+
+// DataExtents returns the regions of the file f with the given size which
+// contain data, the regions in between are holes and read as zeros. When the
+// file system does not report holes, nil is returned and the whole file must
+// be read.
+func DataExtents(f File, size int64) []Extent {
+	if tf, ok := f.(*trackFile); ok {
+		f = tf.File
+	}
+
+	osf, ok := f.(*os.File)
+	if !ok || size == 0 {
+		return nil
+	}
+
+	return dataExtents(osf, size)
+}
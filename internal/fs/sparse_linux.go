@@ -0,0 +1,61 @@
+package fs
+
+import (
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/restic/restic/internal/debug"
+)
+
+// whence values for lseek on Linux
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+func dataExtents(f *os.File, size int64) []Extent {
+	extents, err := findDataExtents(f, size)
+	if err != nil {
+		debug.Log("unable to find holes in %v: %v", f.Name(), err)
+		extents = nil
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		debug.Log("Seek for %v failed: %v", f.Name(), err)
+		return nil
+	}
+
+	return extents
+}
+
+func findDataExtents(f *os.File, size int64) ([]Extent, error) {
+	extents := []Extent{}
+
+	for offset := int64(0); offset < size; {
+		start, err := f.Seek(offset, seekData)
+		if pe, ok := err.(*os.PathError); ok && pe.Err == syscall.ENXIO {
+			// no more data until the end of the file
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if start >= size {
+			break
+		}
+
+		end, err := f.Seek(start, seekHole)
+		if err != nil {
+			return nil, err
+		}
+
+		if end > size {
+			end = size
+		}
+		extents = append(extents, Extent{Offset: start, Length: end - start})
+		offset = end
+	}
+
+	return extents, nil
+}
@@ -0,0 +1,58 @@
+package fs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestDataExtents(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	const size = 16 * 1024 * 1024
+	data := rtest.Random(5, 4096)
+
+	// create a file with data in the middle and holes around it
+	filename := filepath.Join(tempdir, "sparse")
+	f, err := os.Create(filename)
+	rtest.OK(t, err)
+	rtest.OK(t, f.Truncate(size))
+	_, err = f.WriteAt(data, 8*1024*1024)
+	rtest.OK(t, err)
+	rtest.OK(t, f.Close())
+
+	f, err = os.Open(filename)
+	rtest.OK(t, err)
+	defer f.Close()
+
+	extents := DataExtents(f, size)
+	if len(extents) == 1 && extents[0].Length == size {
+		t.Skip("file system does not report holes")
+	}
+	rtest.Assert(t, extents != nil, "no extents returned")
+
+	var found bool
+	for _, ext := range extents {
+		rtest.Assert(t, ext.Offset >= 0 && ext.Offset+ext.Length <= size, "invalid extent %v", ext)
+		if ext.Offset <= 8*1024*1024 && ext.Offset+ext.Length >= 8*1024*1024+int64(len(data)) {
+			found = true
+		}
+	}
+	rtest.Assert(t, found, "data is not contained in the extents %v", extents)
+
+	pos, err := f.Seek(0, io.SeekCurrent)
+	rtest.OK(t, err)
+	rtest.Equals(t, int64(0), pos)
+
+	// a file without data consists of a single hole
+	empty := filepath.Join(tempdir, "empty")
+	f2, err := os.Create(empty)
+	rtest.OK(t, err)
+	defer f2.Close()
+	rtest.OK(t, f2.Truncate(size))
+	rtest.Equals(t, []Extent{}, DataExtents(f2, size))
+}
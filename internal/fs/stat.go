@@ -24,11 +24,47 @@ type ExtendedFileInfo struct {
 	ModTime    time.Time // last (content) modification time stamp
 }
 
+// FileMetadata describes a file which is not stored in the local file system,
+// for example an entry of a tar archive. File systems return it from the
+// Sys() method of os.FileInfo.
+type FileMetadata struct {
+	DeviceID uint64 // ID of device containing the file
+	Inode    uint64 // Inode number
+	Links    uint64 // Number of hard links
+	UID      uint32 // owner user ID
+	GID      uint32 // owner group ID
+	User     string // owner user name
+	Group    string // owner group name
+	Device   uint64 // Device ID (if this is a device file)
+
+	AccessTime time.Time // last access time stamp
+	ChangeTime time.Time // last status change time stamp
+
+	LinkTarget         string            // target of a symlink
+	ExtendedAttributes map[string][]byte // extended attributes by name
+}
+
 // ExtendedStat returns an ExtendedFileInfo constructed from the os.FileInfo.
 func ExtendedStat(fi os.FileInfo) ExtendedFileInfo {
 	if fi == nil {
 		panic("os.FileInfo is nil")
 	}
 
+	if meta, ok := fi.Sys().(*FileMetadata); ok {
+		return ExtendedFileInfo{
+			FileInfo: fi,
+			DeviceID: meta.DeviceID,
+			Inode:    meta.Inode,
+			Links:    meta.Links,
+			UID:      meta.UID,
+			GID:      meta.GID,
+			Device:   meta.Device,
+			Size:     fi.Size(),
+
+			AccessTime: meta.AccessTime,
+			ModTime:    fi.ModTime(),
+		}
+	}
+
 	return extendedStat(fi)
 }
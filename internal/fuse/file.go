@@ -73,10 +73,7 @@ func (f *file) Attr(ctx context.Context, a *fuse.Attr) error {
 	a.BlockSize = blockSize
 	a.Nlink = uint32(f.node.Links)
 
-	if !f.root.cfg.OwnerIsRoot {
-		a.Uid = f.node.UID
-		a.Gid = f.node.GID
-	}
+	a.Uid, a.Gid = f.root.owner(f.node)
 	a.Atime = f.node.AccessTime
 	a.Ctime = f.node.ChangeTime
 	a.Mtime = f.node.ModTime
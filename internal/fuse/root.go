@@ -6,6 +6,7 @@
 package fuse
 
 import (
+	"os"
 	"time"
 
 	"github.com/restic/restic/internal/debug"
@@ -18,7 +19,10 @@ import (
 
 // Config holds settings for the fuse mount.
 type Config struct {
-	OwnerIsRoot      bool
+	OwnerIsRoot bool
+	// Owners determines the owner of the files and dirs in the snapshots,
+	// the numeric IDs are used if it is nil.
+	Owners           *restic.OwnerMapper
 	Host             string
 	Tags             []restic.TagList
 	Paths            []string
@@ -73,3 +77,19 @@ func (r *Root) Root() (fs.Node, error) {
 	debug.Log("Root()")
 	return r, nil
 }
+
+// owner returns the UID and GID presented for node.
+func (r *Root) owner(node *restic.Node) (uid, gid uint32) {
+	if r.cfg.OwnerIsRoot {
+		return 0, 0
+	}
+	if r.cfg.Owners == nil {
+		return node.UID, node.GID
+	}
+
+	uid, gid, ok := r.cfg.Owners.Owner(node)
+	if !ok {
+		return uint32(os.Getuid()), uint32(os.Getgid())
+	}
+	return uid, gid
+}
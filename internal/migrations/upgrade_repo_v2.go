@@ -0,0 +1,103 @@
+package migrations
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+func init() {
+	register(&UpgradeRepoV2{})
+}
+
+// UpgradeRepoV2 upgrades a repository from version 1 to version 2, which
+// allows storing compressed blobs. Existing pack files are not modified and
+// stay readable.
+type UpgradeRepoV2 struct{}
+
+// Name returns the name for this migration.
+func (*UpgradeRepoV2) Name() string {
+	return "upgrade_repo_v2"
+}
+
+// Desc returns a short description what the migration does.
+func (*UpgradeRepoV2) Desc() string {
+	return "upgrade a repository to version 2"
+}
+
+// Check tests whether the migration can be applied.
+func (*UpgradeRepoV2) Check(ctx context.Context, repo restic.Repository) (bool, error) {
+	isV1 := repo.Config().Version == 1
+	return isV1, nil
+}
+
+// loadConfigFile returns the raw (encrypted) content of the config file.
+func loadConfigFile(ctx context.Context, be restic.Backend) ([]byte, error) {
+	var buf bytes.Buffer
+	err := be.Load(ctx, restic.Handle{Type: restic.ConfigFile}, 0, 0, func(rd io.Reader) error {
+		buf.Reset()
+		_, err := io.Copy(&buf, rd)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (*UpgradeRepoV2) upgrade(ctx context.Context, repo restic.Repository) error {
+	h := restic.Handle{Type: restic.ConfigFile}
+
+	// now remove the config file
+	err := repo.Backend().Remove(ctx, h)
+	if err != nil {
+		return fmt.Errorf("remove config failed: %v", err)
+	}
+
+	// save the new config with the new version
+	cfg := repo.Config()
+	cfg.Version = 2
+
+	_, err = repo.SaveJSONUnpacked(ctx, restic.ConfigFile, cfg)
+	if err != nil {
+		return fmt.Errorf("save new config file failed: %v", err)
+	}
+
+	// data saved later on must already use the new version
+	repo.SetConfig(cfg)
+
+	return nil
+}
+
+// Apply runs the migration.
+func (m *UpgradeRepoV2) Apply(ctx context.Context, repo restic.Repository) error {
+	// keep a copy of the current config, so that it can be restored if
+	// writing the new config fails
+	oldConfig, err := loadConfigFile(ctx, repo.Backend())
+	if err != nil {
+		return fmt.Errorf("load config file failed: %v", err)
+	}
+
+	err = m.upgrade(ctx, repo)
+	if err == nil {
+		return nil
+	}
+
+	debug.Log("upgrade failed, restoring old config: %v", err)
+
+	h := restic.Handle{Type: restic.ConfigFile}
+	_ = repo.Backend().Remove(ctx, h)
+
+	rerr := repo.Backend().Save(ctx, h, restic.NewByteReader(oldConfig))
+	if rerr != nil {
+		return errors.Errorf("upgrade failed: %v, restoring the old config also failed: %v", err, rerr)
+	}
+
+	return errors.Errorf("upgrade failed, the old config was restored: %v", err)
+}
@@ -124,6 +124,7 @@ type Target struct {
 	Name    string        `option:"name"`
 	ID      int           `option:"id"`
 	Timeout time.Duration `option:"timeout"`
+	Enabled bool          `option:"enabled"`
 	Other   string
 }
 
@@ -157,6 +158,14 @@ var setTests = []struct {
 			Timeout: time.Duration(10*time.Minute + 3*time.Second),
 		},
 	},
+	{
+		Options{
+			"enabled": "true",
+		},
+		Target{
+			Enabled: true,
+		},
+	},
 }
 
 func TestOptionsApply(t *testing.T) {
@@ -201,6 +210,13 @@ var invalidSetTests = []struct {
 		"ns",
 		`time: missing unit in duration 2134`,
 	},
+	{
+		Options{
+			"enabled": "maybe",
+		},
+		"ns",
+		`strconv.ParseBool: parsing "maybe": invalid syntax`,
+	},
 }
 
 func TestOptionsApplyInvalid(t *testing.T) {
@@ -35,8 +35,10 @@ func NewPacker(k *crypto.Key, wr io.Writer) *Packer {
 }
 
 // Add saves the data read from rd as a new blob to the packer. Returned is the
-// number of bytes written to the pack.
-func (p *Packer) Add(t restic.BlobType, id restic.ID, data []byte) (int, error) {
+// number of bytes written to the pack. If the blob is stored compressed,
+// uncompressedLength must be set to the length of the plaintext before it was
+// compressed, otherwise it must be zero.
+func (p *Packer) Add(t restic.BlobType, id restic.ID, data []byte, uncompressedLength int) (int, error) {
 	p.m.Lock()
 	defer p.m.Unlock()
 
@@ -45,13 +47,29 @@ func (p *Packer) Add(t restic.BlobType, id restic.ID, data []byte) (int, error)
 	n, err := p.wr.Write(data)
 	c.Length = uint(n)
 	c.Offset = p.bytes
+	c.UncompressedLength = uint(uncompressedLength)
 	p.bytes += uint(n)
 	p.blobs = append(p.blobs, c)
 
 	return n, errors.Wrap(err, "Write")
 }
 
-var entrySize = uint(binary.Size(restic.BlobType(0)) + binary.Size(uint32(0)) + len(restic.ID{}))
+var (
+	// entrySize is the size of a header entry for an uncompressed blob
+	entrySize = uint(binary.Size(restic.BlobType(0)) + binary.Size(uint32(0)) + len(restic.ID{}))
+	// compressedEntrySize is the size of a header entry for a compressed blob
+	compressedEntrySize = uint(binary.Size(restic.BlobType(0)) + 2*binary.Size(uint32(0)) + len(restic.ID{}))
+)
+
+// The header entry types. Compressed blobs are stored with a header entry
+// which also contains the length of the uncompressed plaintext, they can only
+// be used in repositories with version 2 or later.
+const (
+	entryTypeData           uint8 = 0
+	entryTypeTree           uint8 = 1
+	entryTypeCompressedData uint8 = 2
+	entryTypeCompressedTree uint8 = 3
+)
 
 // headerEntry is used with encoding/binary to read and write header entries
 type headerEntry struct {
@@ -60,6 +78,15 @@ type headerEntry struct {
 	ID     restic.ID
 }
 
+// compressedHeaderEntry is used with encoding/binary to read and write header
+// entries for compressed blobs
+type compressedHeaderEntry struct {
+	Type               uint8
+	Length             uint32
+	UncompressedLength uint32
+	ID                 restic.ID
+}
+
 // Finalize writes the header for all added blobs and finalizes the pack.
 // Returned are the number of bytes written, including the header. If the
 // underlying writer implements io.Closer, it is closed.
@@ -94,7 +121,7 @@ func (p *Packer) Finalize() (uint, error) {
 	bytesWritten += uint(hdrBytes)
 
 	// write length
-	err = binary.Write(p.wr, binary.LittleEndian, uint32(restic.CiphertextLength(len(p.blobs)*int(entrySize))))
+	err = binary.Write(p.wr, binary.LittleEndian, uint32(hdrBytes))
 	if err != nil {
 		return 0, errors.Wrap(err, "binary.Write")
 	}
@@ -112,18 +139,42 @@ func (p *Packer) Finalize() (uint, error) {
 // writeHeader constructs and writes the header to wr.
 func (p *Packer) writeHeader(wr io.Writer) (bytesWritten uint, err error) {
 	for _, b := range p.blobs {
-		entry := headerEntry{
-			Length: uint32(b.Length),
-			ID:     b.ID,
-		}
-
-		switch b.Type {
-		case restic.DataBlob:
-			entry.Type = 0
-		case restic.TreeBlob:
-			entry.Type = 1
-		default:
-			return 0, errors.Errorf("invalid blob type %v", b.Type)
+		var entry interface{}
+		var size uint
+
+		if b.IsCompressed() {
+			e := compressedHeaderEntry{
+				Length:             uint32(b.Length),
+				UncompressedLength: uint32(b.UncompressedLength),
+				ID:                 b.ID,
+			}
+
+			switch b.Type {
+			case restic.DataBlob:
+				e.Type = entryTypeCompressedData
+			case restic.TreeBlob:
+				e.Type = entryTypeCompressedTree
+			default:
+				return 0, errors.Errorf("invalid blob type %v", b.Type)
+			}
+
+			entry, size = e, compressedEntrySize
+		} else {
+			e := headerEntry{
+				Length: uint32(b.Length),
+				ID:     b.ID,
+			}
+
+			switch b.Type {
+			case restic.DataBlob:
+				e.Type = entryTypeData
+			case restic.TreeBlob:
+				e.Type = entryTypeTree
+			default:
+				return 0, errors.Errorf("invalid blob type %v", b.Type)
+			}
+
+			entry, size = e, entrySize
 		}
 
 		err := binary.Write(wr, binary.LittleEndian, entry)
@@ -131,7 +182,7 @@ func (p *Packer) writeHeader(wr io.Writer) (bytesWritten uint, err error) {
 			return bytesWritten, errors.Wrap(err, "binary.Write")
 		}
 
-		bytesWritten += entrySize
+		bytesWritten += size
 	}
 
 	return
@@ -173,6 +224,9 @@ func (p *Packer) String() string {
 var (
 	// size of the header-length field at the end of the file
 	headerLengthSize = binary.Size(uint32(0))
+	// headerSize is the constant overhead of the header, independent of the
+	// number of entries
+	headerSize = headerLengthSize + crypto.Extension
 	// we require at least one entry in the header, and one blob for a pack file
 	minFileSize = entrySize + crypto.Extension + uint(headerLengthSize)
 )
@@ -183,16 +237,11 @@ const (
 	eagerEntries = 15
 )
 
-// readRecords reads up to max records from the underlying ReaderAt, returning
-// the raw header, the total number of records in the header, and any error.
-// If the header contains fewer than max entries, the header is truncated to
-// the appropriate size.
-func readRecords(rd io.ReaderAt, size int64, max int) ([]byte, int, error) {
-	var bufsize int
-	bufsize += max * int(entrySize)
-	bufsize += crypto.Extension
-	bufsize += headerLengthSize
-
+// readRecords reads up to bufsize bytes from the end of the underlying
+// ReaderAt, returning the raw header, the total number of bytes of the header
+// including the header length field, and any error. If the header is shorter
+// than bufsize, the header is truncated to the appropriate size.
+func readRecords(rd io.ReaderAt, size int64, bufsize int) ([]byte, int, error) {
 	if bufsize > int(size) {
 		bufsize = int(size)
 	}
@@ -213,8 +262,6 @@ func readRecords(rd io.ReaderAt, size int64, max int) ([]byte, int, error) {
 		err = InvalidFileError{Message: "header length is zero"}
 	case hlen < crypto.Extension:
 		err = InvalidFileError{Message: "header length is too small"}
-	case (hlen-crypto.Extension)%uint32(entrySize) != 0:
-		err = InvalidFileError{Message: "header length is invalid"}
 	case int64(hlen) > size-int64(headerLengthSize):
 		err = InvalidFileError{Message: "header is larger than file"}
 	case int64(hlen) > maxHeaderSize:
@@ -224,8 +271,8 @@ func readRecords(rd io.ReaderAt, size int64, max int) ([]byte, int, error) {
 		return nil, 0, errors.Wrap(err, "readHeader")
 	}
 
-	total := (int(hlen) - crypto.Extension) / int(entrySize)
-	if total < max {
+	total := int(hlen) + headerLengthSize
+	if total <= bufsize {
 		// truncate to the beginning of the pack header
 		b = b[len(b)-int(hlen):]
 	}
@@ -246,11 +293,12 @@ func readHeader(rd io.ReaderAt, size int64) ([]byte, error) {
 	// eagerly download eagerEntries header entries as part of header-length request.
 	// only make second request if actual number of entries is greater than eagerEntries
 
-	b, c, err := readRecords(rd, size, eagerEntries)
+	eagerSize := eagerEntries*int(entrySize) + headerSize
+	b, c, err := readRecords(rd, size, eagerSize)
 	if err != nil {
 		return nil, err
 	}
-	if c <= eagerEntries {
+	if c <= eagerSize {
 		// eager read sufficed, return what we got
 		return b, nil
 	}
@@ -287,41 +335,66 @@ func List(k *crypto.Key, rd io.ReaderAt, size int64) (entries []restic.Blob, err
 		return nil, err
 	}
 
-	hdrRd := bytes.NewReader(buf)
-
 	entries = make([]restic.Blob, 0, uint(len(buf))/entrySize)
 
 	pos := uint(0)
-	for {
-		e := headerEntry{}
-		err = binary.Read(hdrRd, binary.LittleEndian, &e)
-		if errors.Cause(err) == io.EOF {
-			break
-		}
-
+	for len(buf) > 0 {
+		entry, size, err := parseHeaderEntry(buf)
 		if err != nil {
-			return nil, errors.Wrap(err, "binary.Read")
-		}
-
-		entry := restic.Blob{
-			Length: uint(e.Length),
-			ID:     e.ID,
-			Offset: pos,
-		}
-
-		switch e.Type {
-		case 0:
-			entry.Type = restic.DataBlob
-		case 1:
-			entry.Type = restic.TreeBlob
-		default:
-			return nil, errors.Errorf("invalid type %d", e.Type)
+			return nil, err
 		}
 
+		entry.Offset = pos
 		entries = append(entries, entry)
 
-		pos += uint(e.Length)
+		pos += entry.Length
+		buf = buf[size:]
 	}
 
 	return entries, nil
 }
+
+// parseHeaderEntry decodes the header entry at the start of p. Returned are
+// the blob and the size of the header entry in bytes.
+func parseHeaderEntry(p []byte) (b restic.Blob, size uint, err error) {
+	var entry interface{}
+
+	switch p[0] {
+	case entryTypeData, entryTypeTree:
+		size = entrySize
+		entry = &headerEntry{}
+	case entryTypeCompressedData, entryTypeCompressedTree:
+		size = compressedEntrySize
+		entry = &compressedHeaderEntry{}
+	default:
+		return restic.Blob{}, 0, errors.Errorf("invalid type %d", p[0])
+	}
+
+	if uint(len(p)) < size {
+		return restic.Blob{}, 0, errors.Errorf("header entry is truncated, want %d bytes, got %d", size, len(p))
+	}
+
+	err = binary.Read(bytes.NewReader(p[:size]), binary.LittleEndian, entry)
+	if err != nil {
+		return restic.Blob{}, 0, errors.Wrap(err, "binary.Read")
+	}
+
+	switch e := entry.(type) {
+	case *headerEntry:
+		b.Length = uint(e.Length)
+		b.ID = e.ID
+	case *compressedHeaderEntry:
+		b.Length = uint(e.Length)
+		b.UncompressedLength = uint(e.UncompressedLength)
+		b.ID = e.ID
+	}
+
+	switch p[0] {
+	case entryTypeData, entryTypeCompressedData:
+		b.Type = restic.DataBlob
+	case entryTypeTree, entryTypeCompressedTree:
+		b.Type = restic.TreeBlob
+	}
+
+	return b, size, nil
+}
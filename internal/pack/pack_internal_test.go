@@ -75,10 +75,11 @@ func TestReadRecords(t *testing.T) {
 
 		rd := bytes.NewReader(buf.Bytes())
 
-		header, count, err := readRecords(rd, int64(rd.Len()), entryCount)
+		bufsize := entryCount*int(entrySize) + headerSize
+		header, count, err := readRecords(rd, int64(rd.Len()), bufsize)
 		rtest.OK(t, err)
 		rtest.Equals(t, expectedHeader, header)
-		rtest.Equals(t, totalRecords, count)
+		rtest.Equals(t, len(totalHeader)+headerLengthSize, count)
 	}
 
 	// basic
@@ -93,8 +94,8 @@ func TestReadRecords(t *testing.T) {
 
 	// file size == eager header load size
 	eagerLoadSize := int((eagerEntries * entrySize) + crypto.Extension)
-	headerSize := int(1*entrySize) + crypto.Extension
-	dataSize := eagerLoadSize - headerSize - binary.Size(uint32(0))
+	oneEntryHeaderSize := int(1*entrySize) + crypto.Extension
+	dataSize := eagerLoadSize - oneEntryHeaderSize - binary.Size(uint32(0))
 	testReadRecords(dataSize-1, 1, 1)
 	testReadRecords(dataSize, 1, 1)
 	testReadRecords(dataSize+1, 1, 1)
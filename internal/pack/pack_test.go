@@ -38,7 +38,7 @@ func newPack(t testing.TB, k *crypto.Key, lengths []int) ([]Buf, []byte, uint) {
 	// pack blobs
 	p := pack.NewPacker(k, nil)
 	for _, b := range bufs {
-		p.Add(restic.TreeBlob, b.id, b.data)
+		p.Add(restic.TreeBlob, b.id, b.data, 0)
 	}
 
 	_, err := p.Finalize()
@@ -94,6 +94,65 @@ func TestCreatePack(t *testing.T) {
 	verifyBlobs(t, bufs, k, bytes.NewReader(packData), packSize)
 }
 
+func TestCreatePackCompressed(t *testing.T) {
+	k := crypto.NewRandomKey()
+
+	type blob struct {
+		tpe                restic.BlobType
+		id                 restic.ID
+		data               []byte
+		uncompressedLength int
+	}
+
+	var blobs []blob
+	for i, l := range testLens {
+		b := blob{
+			tpe:  restic.DataBlob,
+			data: rtest.Random(i, l),
+		}
+		b.id = restic.Hash(b.data)
+
+		if i%2 == 0 {
+			b.tpe = restic.TreeBlob
+		}
+
+		// pretend that every third blob is compressed
+		if i%3 == 0 {
+			b.uncompressedLength = 2*l + 1
+		}
+
+		blobs = append(blobs, b)
+	}
+
+	p := pack.NewPacker(k, nil)
+	for _, b := range blobs {
+		_, err := p.Add(b.tpe, b.id, b.data, b.uncompressedLength)
+		rtest.OK(t, err)
+	}
+
+	_, err := p.Finalize()
+	rtest.OK(t, err)
+
+	packData := p.Writer().(*bytes.Buffer).Bytes()
+	rtest.Equals(t, uint(len(packData)), p.Size())
+
+	entries, err := pack.List(k, bytes.NewReader(packData), int64(len(packData)))
+	rtest.OK(t, err)
+	rtest.Equals(t, len(blobs), len(entries))
+
+	for i, b := range blobs {
+		e := entries[i]
+		rtest.Equals(t, b.id, e.ID)
+		rtest.Equals(t, b.tpe, e.Type)
+		rtest.Equals(t, uint(len(b.data)), e.Length)
+		rtest.Equals(t, uint(b.uncompressedLength), e.UncompressedLength)
+		rtest.Equals(t, b.uncompressedLength != 0, e.IsCompressed())
+
+		rtest.Assert(t, bytes.Equal(b.data, packData[e.Offset:e.Offset+e.Length]),
+			"data for blob %v doesn't match", i)
+	}
+}
+
 var blobTypeJSON = []struct {
 	t   restic.BlobType
 	res string
@@ -29,6 +29,7 @@ type Key struct {
 	Created  time.Time `json:"created"`
 	Username string    `json:"username"`
 	Hostname string    `json:"hostname"`
+	Role     KeyRole   `json:"role,omitempty"`
 
 	KDF  string `json:"kdf"`
 	N    int    `json:"N"`
@@ -58,7 +59,7 @@ var (
 // createMasterKey creates a new master key in the given backend and encrypts
 // it with the password.
 func createMasterKey(s *Repository, password string) (*Key, error) {
-	return AddKey(context.TODO(), s, password, nil)
+	return AddKey(context.TODO(), s, password, KeyRoleFull, nil)
 }
 
 // OpenKey tries do decrypt the key specified by name with the given password.
@@ -198,8 +199,8 @@ func LoadKey(ctx context.Context, s *Repository, name string) (k *Key, err error
 	return k, nil
 }
 
-// AddKey adds a new key to an already existing repository.
-func AddKey(ctx context.Context, s *Repository, password string, template *crypto.Key) (*Key, error) {
+// AddKey adds a new key with the given role to an already existing repository.
+func AddKey(ctx context.Context, s *Repository, password string, role KeyRole, template *crypto.Key) (*Key, error) {
 	// make sure we have valid KDF parameters
 	if Params == nil {
 		p, err := crypto.Calibrate(KDFTimeout, KDFMemory)
@@ -220,6 +221,12 @@ func AddKey(ctx context.Context, s *Repository, password string, template *crypt
 		P:       Params.P,
 	}
 
+	// keys with full access are stored without a role, so that older
+	// versions can still use them
+	if role != KeyRoleFull {
+		newkey.Role = role
+	}
+
 	hn, err := os.Hostname()
 	if err == nil {
 		newkey.Hostname = hn
@@ -288,7 +295,15 @@ func (k *Key) String() string {
 	if k == nil {
 		return "<Key nil>"
 	}
-	return fmt.Sprintf("<Key of %s@%s, created on %s>", k.Username, k.Hostname, k.Created)
+	return fmt.Sprintf("<Key of %s@%s, role %s, created on %s>", k.Username, k.Hostname, k.KeyRole(), k.Created)
+}
+
+// KeyRole returns the role of the key.
+func (k *Key) KeyRole() KeyRole {
+	if k.Role == "" {
+		return KeyRoleFull
+	}
+	return k.Role
 }
 
 // Name returns an identifier for the key.
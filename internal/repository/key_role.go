@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// KeyRole describes which modifications of the repository a key permits.
+type KeyRole string
+
+// These are the roles a key can have. Keys without a role have full access.
+const (
+	// KeyRoleFull permits all operations.
+	KeyRoleFull KeyRole = "full"
+	// KeyRoleAppendOnly permits adding data, but not removing it. Only lock
+	// files may be removed, and packs cannot be marked for deletion.
+	KeyRoleAppendOnly KeyRole = "append-only"
+	// KeyRoleReadOnly permits reading data. Only lock files may be saved and
+	// removed.
+	KeyRoleReadOnly KeyRole = "read-only"
+)
+
+// ParseKeyRole returns the role described by s.
+func ParseKeyRole(s string) (KeyRole, error) {
+	switch KeyRole(s) {
+	case "", KeyRoleFull:
+		return KeyRoleFull, nil
+	case KeyRoleAppendOnly, KeyRoleReadOnly:
+		return KeyRole(s), nil
+	}
+
+	return "", errors.Fatalf("invalid key role %q, must be one of full, append-only or read-only", s)
+}
+
+// restrictiveness returns a number which increases with the restrictions
+// imposed by the role.
+func (r KeyRole) restrictiveness() int {
+	switch r {
+	case KeyRoleAppendOnly:
+		return 1
+	case KeyRoleReadOnly:
+		return 2
+	}
+	return 0
+}
+
+// Permits returns true if a key with role r may create a key with role other,
+// which is the case if other is at least as restrictive as r.
+func (r KeyRole) Permits(other KeyRole) bool {
+	return other.restrictiveness() >= r.restrictiveness()
+}
+
+// roleBackend enforces the role of a key on the wrapped backend.
+type roleBackend struct {
+	restic.Backend
+	role KeyRole
+}
+
+// newRoleBackend wraps be so that only the operations permitted by role can
+// be used. For keys with full access, be is returned unchanged.
+func newRoleBackend(be restic.Backend, role KeyRole) restic.Backend {
+	if role == KeyRoleFull {
+		return be
+	}
+
+	return &roleBackend{Backend: be, role: role}
+}
+
+// Save stores the data, if the role permits it.
+func (be *roleBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	switch {
+	case be.role == KeyRoleReadOnly && h.Type != restic.LockFile,
+		// marking packs for deletion removes data later on
+		h.Type == restic.PendingDeleteFile:
+		return errors.Fatalf("saving %v files is not permitted with a %v key", h.Type, be.role)
+	}
+
+	return be.Backend.Save(ctx, h, rd)
+}
+
+// Remove removes the file, if the role permits it.
+func (be *roleBackend) Remove(ctx context.Context, h restic.Handle) error {
+	if h.Type != restic.LockFile {
+		return errors.Fatalf("removing %v files is not permitted with a %v key", h.Type, be.role)
+	}
+
+	return be.Backend.Remove(ctx, h)
+}
+
+// Delete is never permitted.
+func (be *roleBackend) Delete(ctx context.Context) error {
+	return errors.Fatalf("deleting the repository is not permitted with a %v key", be.role)
+}
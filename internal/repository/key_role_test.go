@@ -0,0 +1,131 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseKeyRole(t *testing.T) {
+	var tests = []struct {
+		s    string
+		role repository.KeyRole
+		err  bool
+	}{
+		{"", repository.KeyRoleFull, false},
+		{"full", repository.KeyRoleFull, false},
+		{"append-only", repository.KeyRoleAppendOnly, false},
+		{"read-only", repository.KeyRoleReadOnly, false},
+		{"write-only", "", true},
+	}
+
+	for _, test := range tests {
+		role, err := repository.ParseKeyRole(test.s)
+		if test.err {
+			if err == nil {
+				t.Errorf("ParseKeyRole(%q): expected error, got nil", test.s)
+			}
+			continue
+		}
+
+		rtest.OK(t, err)
+		rtest.Equals(t, test.role, role)
+	}
+}
+
+func TestKeyRolePermits(t *testing.T) {
+	var tests = []struct {
+		role, other repository.KeyRole
+		permits     bool
+	}{
+		{repository.KeyRoleFull, repository.KeyRoleFull, true},
+		{repository.KeyRoleFull, repository.KeyRoleReadOnly, true},
+		{repository.KeyRoleAppendOnly, repository.KeyRoleFull, false},
+		{repository.KeyRoleAppendOnly, repository.KeyRoleAppendOnly, true},
+		{repository.KeyRoleAppendOnly, repository.KeyRoleReadOnly, true},
+		{repository.KeyRoleReadOnly, repository.KeyRoleAppendOnly, false},
+		{repository.KeyRoleReadOnly, repository.KeyRoleReadOnly, true},
+	}
+
+	for _, test := range tests {
+		if test.role.Permits(test.other) != test.permits {
+			t.Errorf("%v.Permits(%v): expected %v", test.role, test.other, test.permits)
+		}
+	}
+}
+
+// openWithRole adds a key with the given role to the repository and opens it
+// again with that key.
+func openWithRole(t *testing.T, be restic.Backend, repo restic.Repository, role repository.KeyRole) *repository.Repository {
+	password := "password for " + string(role)
+	key, err := repository.AddKey(context.TODO(), repo.(*repository.Repository), password, role, repo.Key())
+	rtest.OK(t, err)
+	rtest.Equals(t, role, key.KeyRole())
+
+	r := repository.New(be)
+	rtest.OK(t, r.SearchKey(context.TODO(), password, 10, ""))
+	rtest.Equals(t, role, r.KeyRole())
+
+	return r
+}
+
+func TestKeyRoleBackend(t *testing.T) {
+	be, cleanup := repository.TestBackend(t)
+	defer cleanup()
+
+	repo, cleanup := repository.TestRepositoryWithBackend(t, be)
+	defer cleanup()
+
+	rtest.Equals(t, repository.KeyRoleFull, repo.(*repository.Repository).KeyRole())
+
+	var tests = []struct {
+		role     repository.KeyRole
+		fileType restic.FileType
+		save     bool
+		remove   bool
+	}{
+		{repository.KeyRoleAppendOnly, restic.DataFile, true, false},
+		{repository.KeyRoleAppendOnly, restic.SnapshotFile, true, false},
+		{repository.KeyRoleAppendOnly, restic.IndexFile, true, false},
+		{repository.KeyRoleAppendOnly, restic.KeyFile, true, false},
+		{repository.KeyRoleAppendOnly, restic.PendingDeleteFile, false, false},
+		{repository.KeyRoleAppendOnly, restic.LockFile, true, true},
+		{repository.KeyRoleReadOnly, restic.DataFile, false, false},
+		{repository.KeyRoleReadOnly, restic.SnapshotFile, false, false},
+		{repository.KeyRoleReadOnly, restic.LockFile, true, true},
+	}
+
+	for _, test := range tests {
+		r := openWithRole(t, be, repo, test.role)
+
+		data := rtest.Random(23, 42)
+		h := restic.Handle{Type: test.fileType, Name: restic.Hash(data).String()}
+
+		err := r.Backend().Save(context.TODO(), h, restic.NewByteReader(data))
+		if test.save != (err == nil) {
+			t.Errorf("%v key, save %v: unexpected result %v", test.role, test.fileType, err)
+		}
+
+		// make sure the file exists, so that removing it can succeed
+		if err != nil {
+			rtest.OK(t, be.Save(context.TODO(), h, restic.NewByteReader(data)))
+		}
+
+		err = r.Backend().Remove(context.TODO(), h)
+		if test.remove != (err == nil) {
+			t.Errorf("%v key, remove %v: unexpected result %v", test.role, test.fileType, err)
+		}
+
+		if err == nil {
+			continue
+		}
+
+		// the file must still be there
+		_, err = be.Stat(context.TODO(), h)
+		rtest.OK(t, err)
+		rtest.OK(t, be.Remove(context.TODO(), h))
+	}
+}
@@ -11,8 +11,9 @@ import (
 
 // MasterIndex is a collection of indexes and IDs of chunks that are in the process of being saved.
 type MasterIndex struct {
-	idx      []*Index
-	idxMutex sync.RWMutex
+	idx           []*Index
+	pendingDelete restic.IDSet
+	idxMutex      sync.RWMutex
 }
 
 // NewMasterIndex creates a new master index.
@@ -65,20 +66,42 @@ func (mi *MasterIndex) ListPack(id restic.ID) (list []restic.PackedBlob) {
 	return nil
 }
 
-// Has queries all known Indexes for the ID and returns the first match.
+// Has queries all known Indexes for the ID and returns the first match. Blobs
+// which are only contained in packs marked for deletion are ignored.
 func (mi *MasterIndex) Has(id restic.ID, tpe restic.BlobType) bool {
 	mi.idxMutex.RLock()
 	defer mi.idxMutex.RUnlock()
 
 	for _, idx := range mi.idx {
-		if idx.Has(id, tpe) {
+		if !idx.Has(id, tpe) {
+			continue
+		}
+
+		if len(mi.pendingDelete) == 0 {
 			return true
 		}
+
+		blobs, _ := idx.Lookup(id, tpe)
+		for _, blob := range blobs {
+			if !mi.pendingDelete.Has(blob.PackID) {
+				return true
+			}
+		}
 	}
 
 	return false
 }
 
+// SetPendingDelete sets the packs which are marked for deletion. Blobs which
+// are only contained in these packs can still be loaded, but are not reported
+// by Has, so that they are saved again instead of being referenced.
+func (mi *MasterIndex) SetPendingDelete(packs restic.IDSet) {
+	mi.idxMutex.Lock()
+	defer mi.idxMutex.Unlock()
+
+	mi.pendingDelete = packs
+}
+
 // Count returns the number of blobs of type t in the index.
 func (mi *MasterIndex) Count(t restic.BlobType) (n uint) {
 	mi.idxMutex.RLock()
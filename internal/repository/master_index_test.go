@@ -56,6 +56,36 @@ func TestMasterIndexLookup(t *testing.T) {
 	rtest.Assert(t, blobs == nil, "Expected no blobs when fetching with a random id")
 }
 
+func TestMasterIndexHasPendingDelete(t *testing.T) {
+	id := restic.NewRandomID()
+	pack1 := restic.NewRandomID()
+	pack2 := restic.NewRandomID()
+
+	idx1 := repository.NewIndex()
+	idx1.Store(restic.PackedBlob{
+		PackID: pack1,
+		Blob:   restic.Blob{Type: restic.DataBlob, ID: id, Length: 10},
+	})
+
+	mIdx := repository.NewMasterIndex()
+	mIdx.Insert(idx1)
+	rtest.Assert(t, mIdx.Has(id, restic.DataBlob), "blob not found")
+
+	mIdx.SetPendingDelete(restic.NewIDSet(pack1))
+	rtest.Assert(t, !mIdx.Has(id, restic.DataBlob), "blob in pack marked for deletion was found")
+
+	_, found := mIdx.Lookup(id, restic.DataBlob)
+	rtest.Assert(t, found, "blob in pack marked for deletion cannot be looked up")
+
+	idx2 := repository.NewIndex()
+	idx2.Store(restic.PackedBlob{
+		PackID: pack2,
+		Blob:   restic.Blob{Type: restic.DataBlob, ID: id, Length: 10},
+	})
+	mIdx.Insert(idx2)
+	rtest.Assert(t, mIdx.Has(id, restic.DataBlob), "blob in pack which is not marked was not found")
+}
+
 func BenchmarkMasterIndexLookupSingleIndex(b *testing.B) {
 	idx1, lookupID := createRandomIndex(rand.New(rand.NewSource(0)))
 
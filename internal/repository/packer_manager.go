@@ -111,7 +111,8 @@ func (r *Repository) savePacker(ctx context.Context, t restic.BlobType, p *Packe
 
 	debug.Log("saved as %v", h)
 
-	if t == restic.TreeBlob && r.Cache != nil {
+	// in dry-run mode the pack was not uploaded, so it must not end up in the cache
+	if t == restic.TreeBlob && r.Cache != nil && !r.dryRun {
 		debug.Log("saving tree pack file in cache")
 
 		_, err = p.tmpfile.Seek(0, 0)
@@ -140,10 +141,11 @@ func (r *Repository) savePacker(ctx context.Context, t restic.BlobType, p *Packe
 		debug.Log("  updating blob %v to pack %v", b.ID, id)
 		r.idx.Store(restic.PackedBlob{
 			Blob: restic.Blob{
-				Type:   b.Type,
-				ID:     b.ID,
-				Offset: b.Offset,
-				Length: uint(b.Length),
+				Type:               b.Type,
+				ID:                 b.ID,
+				Offset:             b.Offset,
+				Length:             uint(b.Length),
+				UncompressedLength: b.UncompressedLength,
 			},
 			PackID: id,
 		})
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/restic/restic/internal/compression"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/fs"
@@ -76,6 +77,13 @@ func Repack(ctx context.Context, repo restic.Repository, packs restic.IDSet, kee
 				return nil, err
 			}
 
+			if entry.IsCompressed() {
+				plaintext, err = compression.Decompress(nil, plaintext)
+				if err != nil {
+					return nil, err
+				}
+			}
+
 			id := restic.Hash(plaintext)
 			if !id.Equal(entry.ID) {
 				debug.Log("read blob %v/%v from %v: wrong data returned, hash is %v",
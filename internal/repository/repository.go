@@ -10,7 +10,9 @@ import (
 	"os"
 
 	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/dryrun"
 	"github.com/restic/restic/internal/cache"
+	"github.com/restic/restic/internal/compression"
 	"github.com/restic/restic/internal/crypto"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
@@ -26,9 +28,13 @@ type Repository struct {
 	cfg     restic.Config
 	key     *crypto.Key
 	keyName string
+	keyRole KeyRole
 	idx     *MasterIndex
 	restic.Cache
 
+	compression compression.Mode
+	dryRun      bool
+
 	treePM *packerManager
 	dataPM *packerManager
 }
@@ -50,6 +56,12 @@ func (r *Repository) Config() restic.Config {
 	return r.cfg
 }
 
+// SetConfig replaces the repository configuration in memory, e.g. after the
+// config file has been rewritten.
+func (r *Repository) SetConfig(cfg restic.Config) {
+	r.cfg = cfg
+}
+
 // UseCache replaces the backend with the wrapped cache.
 func (r *Repository) UseCache(c restic.Cache) {
 	if c == nil {
@@ -60,6 +72,19 @@ func (r *Repository) UseCache(c restic.Cache) {
 	r.be = c.Wrap(r.be)
 }
 
+// SetDryRun sets the repository backend into dry-run mode. Saving and removing
+// files only pretends to succeed, so that the repository is not modified.
+func (r *Repository) SetDryRun() {
+	r.dryRun = true
+	r.be = dryrun.New(r.be)
+}
+
+// SetCompression sets the compression mode used for blobs saved to the
+// repository. Blobs are only compressed if the repository version supports it.
+func (r *Repository) SetCompression(mode compression.Mode) {
+	r.compression = mode
+}
+
 // PrefixLength returns the number of bytes required so that all prefixes of
 // all IDs of type t are unique.
 func (r *Repository) PrefixLength(t restic.FileType) (int, error) {
@@ -166,6 +191,19 @@ func (r *Repository) loadBlob(ctx context.Context, id restic.ID, t restic.BlobTy
 			continue
 		}
 
+		if blob.IsCompressed() {
+			plaintext, err = compression.Decompress(make([]byte, 0, blob.UncompressedLength), plaintext)
+			if err != nil {
+				lastError = errors.Errorf("decompressing blob %v failed: %v", id, err)
+				continue
+			}
+
+			if len(plaintext) > cap(plaintextBuf) {
+				return 0, errors.Errorf("buffer is too small: %v < %v", cap(plaintextBuf), len(plaintext))
+			}
+			plaintextBuf = plaintextBuf[:cap(plaintextBuf)]
+		}
+
 		// check hash
 		if !restic.Hash(plaintext).Equal(id) {
 			lastError = errors.Errorf("blob %v returned invalid hash", id)
@@ -211,6 +249,21 @@ func (r *Repository) SaveAndEncrypt(ctx context.Context, t restic.BlobType, data
 
 	debug.Log("save id %v (%v, %d bytes)", id, t, len(data))
 
+	// compress the blob if the repository supports it, the compressed data
+	// is only used when it is actually smaller
+	uncompressedLength := 0
+	if r.cfg.Version >= 2 && r.compression != compression.Off {
+		compressed, err := compression.Compress(r.compression, nil, data)
+		if err != nil {
+			return restic.ID{}, err
+		}
+
+		if len(compressed) < len(data) {
+			uncompressedLength = len(data)
+			data = compressed
+		}
+	}
+
 	// get buf from the pool
 	ciphertext := getBuf()
 
@@ -240,7 +293,7 @@ func (r *Repository) SaveAndEncrypt(ctx context.Context, t restic.BlobType, data
 	}
 
 	// save ciphertext
-	_, err = packer.Add(t, *id, ciphertext)
+	_, err = packer.Add(t, *id, ciphertext, uncompressedLength)
 	if err != nil {
 		return restic.ID{}, err
 	}
@@ -429,7 +482,31 @@ func (r *Repository) LoadIndex(ctx context.Context) error {
 		return err
 	}
 
-	return <-errCh
+	if err = <-errCh; err != nil {
+		return err
+	}
+
+	return r.loadPendingDeletes(ctx)
+}
+
+// loadPendingDeletes loads the list of packs which are marked for deletion,
+// blobs contained in these packs must not be referenced any more.
+func (r *Repository) loadPendingDeletes(ctx context.Context) error {
+	marks, err := restic.LoadAllPendingDeletes(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	packs := restic.NewIDSet()
+	for _, pd := range marks {
+		for _, id := range pd.Packs {
+			packs.Insert(id)
+		}
+	}
+
+	debug.Log("%d packs are marked for deletion", len(packs))
+	r.idx.SetPendingDelete(packs)
+	return nil
 }
 
 // PrepareCache initializes the local cache. indexIDs is the list of IDs of
@@ -520,6 +597,8 @@ func (r *Repository) SearchKey(ctx context.Context, password string, maxKeys int
 	r.dataPM.key = key.master
 	r.treePM.key = key.master
 	r.keyName = key.Name()
+	r.keyRole = key.KeyRole()
+	r.be = newRoleBackend(r.be, r.keyRole)
 	r.cfg, err = restic.LoadConfig(ctx, r)
 	if err != nil {
 		return errors.Fatalf("config cannot be loaded: %v", err)
@@ -528,8 +607,8 @@ func (r *Repository) SearchKey(ctx context.Context, password string, maxKeys int
 }
 
 // Init creates a new master key with the supplied password, initializes and
-// saves the repository config.
-func (r *Repository) Init(ctx context.Context, password string) error {
+// saves the repository config for the given repository version.
+func (r *Repository) Init(ctx context.Context, version uint, password string) error {
 	has, err := r.be.Test(ctx, restic.Handle{Type: restic.ConfigFile})
 	if err != nil {
 		return err
@@ -538,7 +617,7 @@ func (r *Repository) Init(ctx context.Context, password string) error {
 		return errors.New("repository master key and config already initialized")
 	}
 
-	cfg, err := restic.CreateConfig()
+	cfg, err := restic.CreateConfig(version)
 	if err != nil {
 		return err
 	}
@@ -558,6 +637,7 @@ func (r *Repository) init(ctx context.Context, password string, cfg restic.Confi
 	r.dataPM.key = key.master
 	r.treePM.key = key.master
 	r.keyName = key.Name()
+	r.keyRole = key.KeyRole()
 	r.cfg = cfg
 	_, err = r.SaveJSONUnpacked(ctx, restic.ConfigFile, cfg)
 	return err
@@ -568,6 +648,11 @@ func (r *Repository) Key() *crypto.Key {
 	return r.key
 }
 
+// KeyRole returns the role of the key used to open the repository.
+func (r *Repository) KeyRole() KeyRole {
+	return r.keyRole
+}
+
 // KeyName returns the name of the current key in the backend.
 func (r *Repository) KeyName() string {
 	return r.keyName
@@ -4,13 +4,16 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"fmt"
 	"io"
 	"math/rand"
+	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/cache"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/repository"
@@ -195,6 +198,88 @@ func TestLoadBlob(t *testing.T) {
 	}
 }
 
+func TestSaveCompressed(t *testing.T) {
+	for _, version := range []uint{1, 2} {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			repo, cleanup := repository.TestRepositoryWithVersion(t, nil, version)
+			defer cleanup()
+
+			// highly compressible data
+			data := bytes.Repeat([]byte("restic compression test "), 50000)
+
+			id, err := repo.SaveBlob(context.TODO(), restic.DataBlob, data, restic.ID{})
+			rtest.OK(t, err)
+			rtest.OK(t, repo.Flush(context.Background()))
+
+			blobs, found := repo.Index().Lookup(id, restic.DataBlob)
+			rtest.Assert(t, found, "blob %v not found in index", id.Str())
+			rtest.Equals(t, version >= 2, blobs[0].IsCompressed())
+			if version >= 2 {
+				rtest.Assert(t, int(blobs[0].Length) < len(data),
+					"blob was not stored compressed, length %d", blobs[0].Length)
+			}
+
+			size, found := repo.LookupBlobSize(id, restic.DataBlob)
+			rtest.Assert(t, found, "size of blob %v not found", id.Str())
+			rtest.Equals(t, uint(len(data)), size)
+
+			buf := restic.NewBlobBuffer(len(data))
+			n, err := repo.LoadBlob(context.TODO(), restic.DataBlob, id, buf)
+			rtest.OK(t, err)
+			rtest.Equals(t, len(data), n)
+			rtest.Assert(t, bytes.Equal(data, buf[:n]), "data does not match")
+		})
+	}
+}
+
+func listCacheFiles(t *testing.T, dir string) []string {
+	var files []string
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	rtest.OK(t, err)
+	return files
+}
+
+func TestSaveTreeCache(t *testing.T) {
+	for _, dryRun := range []bool{false, true} {
+		t.Run(fmt.Sprintf("dry-run=%v", dryRun), func(t *testing.T) {
+			r, cleanup := repository.TestRepository(t)
+			defer cleanup()
+			repo := r.(*repository.Repository)
+
+			tempdir, tcleanup := rtest.TempDir(t)
+			defer tcleanup()
+
+			c, err := cache.New(repo.Config().ID, tempdir)
+			rtest.OK(t, err)
+			repo.UseCache(c)
+			before := listCacheFiles(t, tempdir)
+
+			if dryRun {
+				repo.SetDryRun()
+			}
+
+			_, err = repo.SaveBlob(context.TODO(), restic.TreeBlob, []byte(`{"nodes":[]}`), restic.ID{})
+			rtest.OK(t, err)
+			rtest.OK(t, repo.Flush(context.Background()))
+
+			after := listCacheFiles(t, tempdir)
+			if dryRun {
+				rtest.Equals(t, before, after)
+			} else {
+				rtest.Equals(t, len(before)+1, len(after))
+			}
+		})
+	}
+}
+
 func BenchmarkLoadBlob(b *testing.B) {
 	repo, cleanup := repository.TestRepository(b)
 	defer cleanup()
@@ -42,6 +42,13 @@ const testChunkerPol = chunker.Pol(0x3DA3358B4DC173)
 // password. If be is nil, an in-memory backend is used. A constant polynomial
 // is used for the chunker and low-security test parameters.
 func TestRepositoryWithBackend(t testing.TB, be restic.Backend) (r restic.Repository, cleanup func()) {
+	test.Helper(t).Helper()
+	return TestRepositoryWithVersion(t, be, restic.RepoVersion)
+}
+
+// TestRepositoryWithVersion returns a repository like
+// TestRepositoryWithBackend, but using the given repository version.
+func TestRepositoryWithVersion(t testing.TB, be restic.Backend, version uint) (r restic.Repository, cleanup func()) {
 	test.Helper(t).Helper()
 	TestUseLowSecurityKDFParameters(t)
 	restic.TestDisableCheckPolynomial(t)
@@ -54,6 +61,7 @@ func TestRepositoryWithBackend(t testing.TB, be restic.Backend) (r restic.Reposi
 	repo := New(be)
 
 	cfg := restic.TestCreateConfig(t, testChunkerPol)
+	cfg.Version = version
 	err := repo.init(context.TODO(), test.TestPassword, cfg)
 	if err != nil {
 		t.Fatalf("TestRepository(): initialize repo failed: %v", err)
@@ -18,8 +18,18 @@ type Config struct {
 	ChunkerPolynomial chunker.Pol `json:"chunker_polynomial"`
 }
 
+// These are the repository versions which are supported.
+const (
+	// MinRepoVersion is the oldest repository version which can be read.
+	MinRepoVersion = 1
+	// MaxRepoVersion is the newest repository version which can be read.
+	// Starting with version 2, blobs may be stored compressed.
+	MaxRepoVersion = 2
+)
+
 // RepoVersion is the version that is written to the config when a repository
-// is newly created with Init().
+// is newly created with Init(). Version 2 must be selected explicitly, as it
+// cannot be read by older versions of restic.
 const RepoVersion = 1
 
 // JSONUnpackedLoader loads unpacked JSON.
@@ -28,8 +38,8 @@ type JSONUnpackedLoader interface {
 }
 
 // CreateConfig creates a config file with a randomly selected polynomial and
-// ID.
-func CreateConfig() (Config, error) {
+// ID for the given repository version.
+func CreateConfig(version uint) (Config, error) {
 	var (
 		err error
 		cfg Config
@@ -40,8 +50,12 @@ func CreateConfig() (Config, error) {
 		return Config{}, errors.Wrap(err, "chunker.RandomPolynomial")
 	}
 
+	if version < MinRepoVersion || version > MaxRepoVersion {
+		return Config{}, errors.Errorf("unsupported repository version %v", version)
+	}
+
 	cfg.ID = NewRandomID().String()
-	cfg.Version = RepoVersion
+	cfg.Version = version
 
 	debug.Log("New config: %#v", cfg)
 	return cfg, nil
@@ -77,8 +91,8 @@ func LoadConfig(ctx context.Context, r JSONUnpackedLoader) (Config, error) {
 		return Config{}, err
 	}
 
-	if cfg.Version != RepoVersion {
-		return Config{}, errors.New("unsupported repository version")
+	if cfg.Version < MinRepoVersion || cfg.Version > MaxRepoVersion {
+		return Config{}, errors.Errorf("unsupported repository version %v", cfg.Version)
 	}
 
 	if checkPolynomial {
@@ -11,12 +11,13 @@ type FileType string
 
 // These are the different data types a backend can store.
 const (
-	DataFile     FileType = "data"
-	KeyFile               = "key"
-	LockFile              = "lock"
-	SnapshotFile          = "snapshot"
-	IndexFile             = "index"
-	ConfigFile            = "config"
+	DataFile          FileType = "data"
+	KeyFile                    = "key"
+	LockFile                   = "lock"
+	SnapshotFile               = "snapshot"
+	IndexFile                  = "index"
+	ConfigFile                 = "config"
+	PendingDeleteFile          = "pending-delete"
 )
 
 // Handle is used to store and access data in a backend.
@@ -46,6 +47,7 @@ func (h Handle) Valid() error {
 	case SnapshotFile:
 	case IndexFile:
 	case ConfigFile:
+	case PendingDeleteFile:
 	default:
 		return errors.Errorf("invalid Type %q", h.Type)
 	}
@@ -26,6 +26,7 @@ import (
 // triggered by regularly calling Refresh.
 type Lock struct {
 	Time      time.Time `json:"time"`
+	Refreshed time.Time `json:"refreshed,omitempty"`
 	Exclusive bool      `json:"exclusive"`
 	Hostname  string    `json:"hostname"`
 	Username  string    `json:"username"`
@@ -183,13 +184,18 @@ func (l *Lock) Unlock() error {
 
 var staleTimeout = 30 * time.Minute
 
-// Stale returns true if the lock is stale. A lock is stale if the timestamp is
-// older than 30 minutes or if it was created on the current machine and the
-// process isn't alive any more.
+// Stale returns true if the lock is stale. A lock is stale if it was neither
+// created nor refreshed within the last 30 minutes or if it was created on the
+// current machine and the process isn't alive any more.
 func (l *Lock) Stale() bool {
 	debug.Log("testing if lock %v for process %d is stale", l, l.PID)
-	if time.Since(l.Time) > staleTimeout {
-		debug.Log("lock is stale, timestamp is too old: %v\n", l.Time)
+	last := l.Time
+	if l.Refreshed.After(last) {
+		last = l.Refreshed
+	}
+
+	if time.Since(last) > staleTimeout {
+		debug.Log("lock is stale, timestamp is too old: %v\n", last)
 		return true
 	}
 
@@ -217,10 +223,20 @@ func (l *Lock) Stale() bool {
 	return false
 }
 
+// Unrefreshed returns true if the lock was never refreshed and is older than
+// the stale timeout. Older versions of restic do not record when a lock was
+// refreshed, so such a lock may still belong to a running process although
+// Stale() reports it as stale.
+func (l *Lock) Unrefreshed() bool {
+	return l.Refreshed.IsZero() && time.Since(l.Time) > staleTimeout
+}
+
 // Refresh refreshes the lock by creating a new file in the backend with a new
-// timestamp. Afterwards the old lock is removed.
+// timestamp. Afterwards the old lock is removed. The time the lock was created
+// is kept.
 func (l *Lock) Refresh(ctx context.Context) error {
 	debug.Log("refreshing lock %v", l.lockID)
+	l.Refreshed = time.Now()
 	id, err := l.createLock(ctx)
 	if err != nil {
 		return err
@@ -272,6 +288,50 @@ func LoadLock(ctx context.Context, repo Repository, id ID) (*Lock, error) {
 	return lock, nil
 }
 
+// FindLocksCreatedBefore returns all locks in the repository which were created
+// before t and are not stale.
+func FindLocksCreatedBefore(ctx context.Context, repo Repository, t time.Time) ([]*Lock, error) {
+	var locks []*Lock
+	err := repo.List(ctx, LockFile, func(id ID, size int64) error {
+		lock, err := LoadLock(ctx, repo, id)
+		if err != nil {
+			// ignore locks that cannot be loaded
+			debug.Log("ignore lock %v: %v", id, err)
+			return nil
+		}
+
+		if lock.Time.Before(t) && !lock.Stale() {
+			locks = append(locks, lock)
+		}
+
+		return nil
+	})
+
+	return locks, err
+}
+
+// FindUnrefreshedLocks returns all locks in the repository for which
+// Unrefreshed() is true.
+func FindUnrefreshedLocks(ctx context.Context, repo Repository) ([]*Lock, error) {
+	var locks []*Lock
+	err := repo.List(ctx, LockFile, func(id ID, size int64) error {
+		lock, err := LoadLock(ctx, repo, id)
+		if err != nil {
+			// ignore locks that cannot be loaded
+			debug.Log("ignore lock %v: %v", id, err)
+			return nil
+		}
+
+		if lock.Unrefreshed() {
+			locks = append(locks, lock)
+		}
+
+		return nil
+	})
+
+	return locks, err
+}
+
 // RemoveStaleLocks deletes all locks detected as stale from the repository.
 func RemoveStaleLocks(ctx context.Context, repo Repository) error {
 	return repo.List(ctx, LockFile, func(id ID, size int64) error {
@@ -256,3 +256,78 @@ func TestLockRefresh(t *testing.T) {
 		"expected a new ID after lock refresh, got the same")
 	rtest.OK(t, lock.Unlock())
 }
+
+func TestLockStaleRefreshed(t *testing.T) {
+	lock := restic.Lock{
+		Time:      time.Now().Add(-time.Hour),
+		Refreshed: time.Now().Add(-time.Minute),
+		PID:       os.Getpid(),
+		Hostname:  "other-host",
+	}
+	rtest.Assert(t, !lock.Stale(), "refreshed lock is considered stale")
+
+	lock.Refreshed = time.Now().Add(-time.Hour)
+	rtest.Assert(t, lock.Stale(), "lock refreshed an hour ago is not considered stale")
+}
+
+func TestFindUnrefreshedLocks(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	// old lock which was never refreshed, e.g. by an older version of restic
+	_, err := createFakeLock(repo, time.Now().Add(-time.Hour), os.Getpid())
+	rtest.OK(t, err)
+
+	// recent lock
+	_, err = createFakeLock(repo, time.Now().Add(-time.Minute), os.Getpid())
+	rtest.OK(t, err)
+
+	// old lock which was refreshed recently
+	hostname, err := os.Hostname()
+	rtest.OK(t, err)
+	refreshed := &restic.Lock{
+		Time:      time.Now().Add(-time.Hour),
+		Refreshed: time.Now().Add(-time.Minute),
+		PID:       os.Getpid(),
+		Hostname:  hostname,
+	}
+	_, err = repo.SaveJSONUnpacked(context.TODO(), restic.LockFile, refreshed)
+	rtest.OK(t, err)
+
+	locks, err := restic.FindUnrefreshedLocks(context.TODO(), repo)
+	rtest.OK(t, err)
+
+	rtest.Assert(t, len(locks) == 1, "expected one lock, got %d", len(locks))
+	rtest.Assert(t, locks[0].Refreshed.IsZero(), "wrong lock returned: %v", locks[0])
+}
+
+func TestFindLocksCreatedBefore(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	mark := time.Now().Add(-10 * time.Minute)
+
+	// stale lock, created before the mark
+	_, err := createFakeLock(repo, time.Now().Add(-time.Hour), os.Getpid())
+	rtest.OK(t, err)
+
+	// lock created before the mark
+	id, err := createFakeLock(repo, time.Now().Add(-20*time.Minute), os.Getpid())
+	rtest.OK(t, err)
+
+	// lock created after the mark
+	_, err = createFakeLock(repo, time.Now().Add(-time.Minute), os.Getpid())
+	rtest.OK(t, err)
+
+	locks, err := restic.FindLocksCreatedBefore(context.TODO(), repo, mark)
+	rtest.OK(t, err)
+
+	rtest.Assert(t, len(locks) == 1, "expected one lock, got %d", len(locks))
+	rtest.Assert(t, locks[0].Time.Before(mark), "wrong lock returned: %v", locks[0])
+
+	rtest.OK(t, removeLock(repo, id))
+
+	locks, err = restic.FindLocksCreatedBefore(context.TODO(), repo, mark)
+	rtest.OK(t, err)
+	rtest.Assert(t, len(locks) == 0, "expected no locks, got %d", len(locks))
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"os/user"
+	"sort"
 	"strconv"
 	"sync"
 	"syscall"
@@ -174,7 +175,7 @@ func (node *Node) CreateAt(ctx context.Context, path string, repo Repository) er
 
 // RestoreMetadata restores node metadata
 func (node Node) RestoreMetadata(path string) error {
-	err := node.restoreMetadata(path)
+	err := node.restoreMetadata(path, true)
 	if err != nil {
 		debug.Log("restoreMetadata(%s) error %v", path, err)
 	}
@@ -182,19 +183,38 @@ func (node Node) RestoreMetadata(path string) error {
 	return err
 }
 
-func (node Node) restoreMetadata(path string) error {
+// RestoreMetadataNoOwner restores the node metadata except for the owner,
+// which can be set with Lchown before.
+func (node Node) RestoreMetadataNoOwner(path string) error {
+	err := node.restoreMetadata(path, false)
+	if err != nil {
+		debug.Log("restoreMetadata(%s) error %v", path, err)
+	}
+
+	return err
+}
+
+// Lchown changes the owner of the item at path, symlinks are not followed.
+// On Windows, it does nothing.
+func Lchown(path string, uid, gid int) error {
+	return lchown(path, uid, gid)
+}
+
+func (node Node) restoreMetadata(path string, owner bool) error {
 	var firsterr error
 
-	if err := lchown(path, int(node.UID), int(node.GID)); err != nil {
-		// Like "cp -a" and "rsync -a" do, we only report lchown permission errors
-		// if we run as root.
-		// On Windows, Geteuid always returns -1, and we always report lchown
-		// permission errors.
-		if os.Geteuid() > 0 && os.IsPermission(err) {
-			debug.Log("not running as root, ignoring lchown permission error for %v: %v",
-				path, err)
-		} else {
-			firsterr = errors.Wrap(err, "Lchown")
+	if owner {
+		if err := lchown(path, int(node.UID), int(node.GID)); err != nil {
+			// Like "cp -a" and "rsync -a" do, we only report lchown permission errors
+			// if we run as root.
+			// On Windows, Geteuid always returns -1, and we always report lchown
+			// permission errors.
+			if os.Geteuid() > 0 && os.IsPermission(err) {
+				debug.Log("not running as root, ignoring lchown permission error for %v: %v",
+					path, err)
+			} else {
+				firsterr = errors.Wrap(err, "Lchown")
+			}
 		}
 	}
 
@@ -591,6 +611,11 @@ func lookupGroup(gid string) (string, error) {
 }
 
 func (node *Node) fillExtra(path string, fi os.FileInfo) error {
+	if meta, ok := fi.Sys().(*fs.FileMetadata); ok {
+		node.fillMetadata(meta)
+		return nil
+	}
+
 	stat, ok := toStatT(fi.Sys())
 	if !ok {
 		// fill minimal info with current values for uid, gid
@@ -641,6 +666,43 @@ func (node *Node) fillExtra(path string, fi os.FileInfo) error {
 	return nil
 }
 
+// fillMetadata fills the node with the metadata of a file which is not stored
+// in the local file system.
+func (node *Node) fillMetadata(meta *fs.FileMetadata) {
+	node.Inode = meta.Inode
+	node.DeviceID = meta.DeviceID
+	node.UID = meta.UID
+	node.GID = meta.GID
+	node.User = meta.User
+	node.Group = meta.Group
+	node.AccessTime = meta.AccessTime
+	node.ChangeTime = meta.ChangeTime
+
+	switch node.Type {
+	case "file":
+		node.Links = meta.Links
+	case "symlink":
+		node.LinkTarget = meta.LinkTarget
+		node.Links = meta.Links
+	case "dev", "chardev":
+		node.Device = meta.Device
+		node.Links = meta.Links
+	}
+
+	names := make([]string, 0, len(meta.ExtendedAttributes))
+	for name := range meta.ExtendedAttributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		node.ExtendedAttributes = append(node.ExtendedAttributes, ExtendedAttribute{
+			Name:  name,
+			Value: meta.ExtendedAttributes[name],
+		})
+	}
+}
+
 func (node *Node) fillExtendedAttributes(path string) error {
 	if node.Type == "symlink" {
 		return nil
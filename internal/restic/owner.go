@@ -0,0 +1,189 @@
+package restic
+
+import (
+	"bufio"
+	"io"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// OwnerMode selects how the owner of the items in a snapshot is determined
+// when they are restored or mounted.
+type OwnerMode string
+
+// These are the available owner modes.
+const (
+	// OwnerNumeric uses the numeric UID and GID stored in the snapshot.
+	OwnerNumeric OwnerMode = "numeric"
+	// OwnerNames looks up the user and group names stored in the snapshot on
+	// the local system, items with unknown names use the numeric IDs.
+	OwnerNames OwnerMode = "names"
+	// OwnerNone does not change the owner.
+	OwnerNone OwnerMode = "none"
+)
+
+// ParseOwnerMode returns the owner mode with the name s.
+func ParseOwnerMode(s string) (OwnerMode, error) {
+	switch m := OwnerMode(s); m {
+	case OwnerNumeric, OwnerNames, OwnerNone:
+		return m, nil
+	}
+	return "", errors.Errorf("invalid owner mode %q, must be one of numeric, names or none", s)
+}
+
+// IDMap maps user or group names or numeric IDs in a snapshot to local names
+// or numeric IDs.
+type IDMap map[string]string
+
+// ParseIDMap reads an IDMap from rd. Each line contains the name or ID in the
+// snapshot and the local name or ID, separated by white space. Empty lines
+// and lines starting with # are ignored.
+func ParseIDMap(rd io.Reader) (IDMap, error) {
+	m := make(IDMap)
+	sc := bufio.NewScanner(rd)
+	for line := 1; sc.Scan(); line++ {
+		s := strings.TrimSpace(sc.Text())
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+
+		fields := strings.Fields(s)
+		if len(fields) != 2 {
+			return nil, errors.Errorf("line %d: expected two fields, got %d", line, len(fields))
+		}
+		m[fields[0]] = fields[1]
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, errors.Wrap(err, "Scan")
+	}
+	return m, nil
+}
+
+// lookupUID and lookupGID return the numeric ID of a local user or group.
+var lookupUID = func(name string) (uint32, bool) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(u.Uid, 10, 32)
+	return uint32(id), err == nil
+}
+
+var lookupGID = func(name string) (uint32, bool) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(g.Gid, 10, 32)
+	return uint32(id), err == nil
+}
+
+// idResolver maps the IDs and names of either users or groups.
+type idResolver struct {
+	ids    map[string]uint32
+	lookup func(name string) (uint32, bool)
+
+	m     sync.Mutex
+	cache map[string]lookupResult
+}
+
+type lookupResult struct {
+	id    uint32
+	found bool
+}
+
+func newIDResolver(idMap IDMap, lookup func(string) (uint32, bool)) (*idResolver, error) {
+	r := &idResolver{
+		ids:    make(map[string]uint32, len(idMap)),
+		lookup: lookup,
+		cache:  make(map[string]lookupResult),
+	}
+
+	for from, to := range idMap {
+		id, err := strconv.ParseUint(to, 10, 32)
+		if err == nil {
+			r.ids[from] = uint32(id)
+			continue
+		}
+
+		local, found := lookup(to)
+		if !found {
+			return nil, errors.Errorf("unknown local name %q for %q", to, from)
+		}
+		r.ids[from] = local
+	}
+
+	return r, nil
+}
+
+// resolve returns the local ID for the item with the id and name in the
+// snapshot. Entries in the map take precedence, names are only looked up
+// when byName is set.
+func (r *idResolver) resolve(id uint32, name string, byName bool) uint32 {
+	if local, ok := r.ids[name]; ok && name != "" {
+		return local
+	}
+	if local, ok := r.ids[strconv.FormatUint(uint64(id), 10)]; ok {
+		return local
+	}
+
+	if !byName || name == "" {
+		return id
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	res, ok := r.cache[name]
+	if !ok {
+		res.id, res.found = r.lookup(name)
+		r.cache[name] = res
+	}
+
+	if !res.found {
+		return id
+	}
+	return res.id
+}
+
+// OwnerMapper determines the local owner of the items in a snapshot. It is
+// safe for concurrent use.
+type OwnerMapper struct {
+	mode     OwnerMode
+	uid, gid *idResolver
+}
+
+// NewOwnerMapper returns an OwnerMapper for mode. The maps are applied in all
+// modes except OwnerNone, they may be nil. An error is returned if a local
+// name in the maps does not exist.
+func NewOwnerMapper(mode OwnerMode, uidMap, gidMap IDMap) (*OwnerMapper, error) {
+	uid, err := newIDResolver(uidMap, lookupUID)
+	if err != nil {
+		return nil, errors.Wrap(err, "uid map")
+	}
+
+	gid, err := newIDResolver(gidMap, lookupGID)
+	if err != nil {
+		return nil, errors.Wrap(err, "gid map")
+	}
+
+	return &OwnerMapper{mode: mode, uid: uid, gid: gid}, nil
+}
+
+// Owner returns the local UID and GID for node. The last return value is false
+// if the owner should not be changed.
+func (m *OwnerMapper) Owner(node *Node) (uid, gid uint32, ok bool) {
+	if m.mode == OwnerNone {
+		return 0, 0, false
+	}
+
+	byName := m.mode == OwnerNames
+	uid = m.uid.resolve(node.UID, node.User, byName)
+	gid = m.gid.resolve(node.GID, node.Group, byName)
+	return uid, gid, true
+}
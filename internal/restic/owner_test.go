@@ -0,0 +1,89 @@
+package restic
+
+import (
+	"strings"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseOwnerMode(t *testing.T) {
+	for _, s := range []string{"numeric", "names", "none"} {
+		m, err := ParseOwnerMode(s)
+		rtest.OK(t, err)
+		rtest.Equals(t, OwnerMode(s), m)
+	}
+
+	_, err := ParseOwnerMode("root")
+	rtest.Assert(t, err != nil, "invalid owner mode was accepted")
+}
+
+func TestParseIDMap(t *testing.T) {
+	m, err := ParseIDMap(strings.NewReader(`
+# snapshot  local
+33          1001
+www-data    web
+`))
+	rtest.OK(t, err)
+	rtest.Equals(t, IDMap{"33": "1001", "www-data": "web"}, m)
+
+	_, err = ParseIDMap(strings.NewReader("33 1001 1002\n"))
+	rtest.Assert(t, err != nil, "line with three fields was accepted")
+}
+
+// withTestLookup replaces the local user and group database.
+func withTestLookup(users, groups map[string]uint32) func() {
+	prevUID, prevGID := lookupUID, lookupGID
+	lookup := func(db map[string]uint32) func(string) (uint32, bool) {
+		return func(name string) (uint32, bool) {
+			id, ok := db[name]
+			return id, ok
+		}
+	}
+	lookupUID, lookupGID = lookup(users), lookup(groups)
+	return func() {
+		lookupUID, lookupGID = prevUID, prevGID
+	}
+}
+
+func TestOwnerMapper(t *testing.T) {
+	defer withTestLookup(
+		map[string]uint32{"www-data": 1033, "alice": 1000},
+		map[string]uint32{"www-data": 1033, "staff": 50},
+	)()
+
+	uidMap := IDMap{"2000": "alice", "bob": "1500"}
+	gidMap := IDMap{"users": "staff"}
+
+	var tests = []struct {
+		mode     OwnerMode
+		node     Node
+		uid, gid uint32
+		ok       bool
+	}{
+		{OwnerNumeric, Node{UID: 33, GID: 33, User: "www-data", Group: "www-data"}, 33, 33, true},
+		{OwnerNames, Node{UID: 33, GID: 33, User: "www-data", Group: "www-data"}, 1033, 1033, true},
+		// unknown names use the numeric IDs
+		{OwnerNames, Node{UID: 42, GID: 43, User: "unknown", Group: "unknown"}, 42, 43, true},
+		{OwnerNames, Node{UID: 42, GID: 43}, 42, 43, true},
+		// the maps apply to IDs and names in all modes
+		{OwnerNumeric, Node{UID: 2000, GID: 100, User: "carol", Group: "users"}, 1000, 50, true},
+		{OwnerNames, Node{UID: 7, GID: 7, User: "bob"}, 1500, 7, true},
+		{OwnerNone, Node{UID: 33, GID: 33, User: "www-data", Group: "www-data"}, 0, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.mode), func(t *testing.T) {
+			m, err := NewOwnerMapper(test.mode, uidMap, gidMap)
+			rtest.OK(t, err)
+
+			uid, gid, ok := m.Owner(&test.node)
+			rtest.Equals(t, test.ok, ok)
+			rtest.Equals(t, test.uid, uid)
+			rtest.Equals(t, test.gid, gid)
+		})
+	}
+
+	_, err := NewOwnerMapper(OwnerNumeric, IDMap{"33": "unknown"}, nil)
+	rtest.Assert(t, err != nil, "map with an unknown local name was accepted")
+}
@@ -0,0 +1,97 @@
+package restic
+
+import (
+	"path"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// PathMapping replaces the prefix Old of a path in a snapshot with New.
+type PathMapping struct {
+	Old, New string
+}
+
+// ParsePathMapping parses a mapping in the form "/old/prefix=/new/prefix".
+// Both paths must be absolute.
+func ParsePathMapping(s string) (PathMapping, error) {
+	i := strings.Index(s, "=")
+	if i < 0 {
+		return PathMapping{}, errors.Errorf("invalid path mapping %q, must be in the form /old/prefix=/new/prefix", s)
+	}
+
+	m := PathMapping{Old: s[:i], New: s[i+1:]}
+	if !strings.HasPrefix(m.Old, "/") || !strings.HasPrefix(m.New, "/") {
+		return PathMapping{}, errors.Errorf("invalid path mapping %q, both paths must be absolute", s)
+	}
+
+	m.Old, m.New = path.Clean(m.Old), path.Clean(m.New)
+	return m, nil
+}
+
+// match returns the part of p below m.Old, and whether p starts with m.Old.
+func (m PathMapping) match(p string) (string, bool) {
+	if m.Old == "/" {
+		return p, true
+	}
+	if p == m.Old {
+		return "", true
+	}
+	if strings.HasPrefix(p, m.Old+"/") {
+		return p[len(m.Old):], true
+	}
+	return "", false
+}
+
+// PathRewriter changes the paths of the items in a snapshot when they are
+// restored or dumped. The zero value does not change any path.
+type PathRewriter struct {
+	// Maps replaces path prefixes, the mapping with the longest matching
+	// prefix is used. Paths which no mapping matches are not changed.
+	Maps []PathMapping
+
+	// StripComponents removes this number of leading components from the
+	// paths after the mappings have been applied.
+	StripComponents int
+}
+
+// Identity returns true if rw does not change any path.
+func (rw PathRewriter) Identity() bool {
+	return len(rw.Maps) == 0 && rw.StripComponents <= 0
+}
+
+// Rewrite returns the new path for the item at p, which is an absolute path
+// in a snapshot with forward slashes. The second return value is false if the
+// item does not have a path of its own after rewriting, because all of its
+// components were stripped or it was mapped to the root directory. The
+// children of such a directory may still have a path.
+func (rw PathRewriter) Rewrite(p string) (string, bool) {
+	if rw.Identity() {
+		return p, true
+	}
+
+	var best *PathMapping
+	var rest string
+	for i, m := range rw.Maps {
+		r, ok := m.match(p)
+		if ok && (best == nil || len(m.Old) > len(best.Old)) {
+			best, rest = &rw.Maps[i], r
+		}
+	}
+	if best != nil {
+		p = path.Join(best.New, rest)
+	}
+
+	if rw.StripComponents > 0 {
+		components := strings.Split(strings.Trim(p, "/"), "/")
+		if len(components) <= rw.StripComponents {
+			return "", false
+		}
+		p = "/" + path.Join(components[rw.StripComponents:]...)
+	}
+
+	if p == "/" {
+		return "", false
+	}
+	return p, true
+}
@@ -0,0 +1,91 @@
+package restic
+
+import (
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParsePathMapping(t *testing.T) {
+	var tests = []struct {
+		s     string
+		m     PathMapping
+		valid bool
+	}{
+		{"/srv/app=/data", PathMapping{Old: "/srv/app", New: "/data"}, true},
+		{"/srv/app/=/data/", PathMapping{Old: "/srv/app", New: "/data"}, true},
+		{"/srv=/", PathMapping{Old: "/srv", New: "/"}, true},
+		{"/a=b=/c", PathMapping{}, false},
+		{"/srv/app", PathMapping{}, false},
+		{"srv=/data", PathMapping{}, false},
+		{"/srv=data", PathMapping{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			m, err := ParsePathMapping(test.s)
+			if !test.valid {
+				rtest.Assert(t, err != nil, "invalid mapping %q was accepted", test.s)
+				return
+			}
+			rtest.OK(t, err)
+			rtest.Equals(t, test.m, m)
+		})
+	}
+}
+
+func TestPathRewriter(t *testing.T) {
+	var tests = []struct {
+		rw   PathRewriter
+		path string
+		res  string
+		ok   bool
+	}{
+		{PathRewriter{}, "/srv/app", "/srv/app", true},
+		{PathRewriter{StripComponents: 2}, "/srv/app/data/file", "/data/file", true},
+		{PathRewriter{StripComponents: 2}, "/srv/app", "", false},
+		{PathRewriter{StripComponents: 2}, "/srv", "", false},
+		{
+			PathRewriter{Maps: []PathMapping{{Old: "/srv/app/releases/2023", New: "/data"}}},
+			"/srv/app/releases/2023/file", "/data/file", true,
+		},
+		{
+			PathRewriter{Maps: []PathMapping{{Old: "/srv/app/releases/2023", New: "/data"}}},
+			"/srv/app/releases/2023", "/data", true,
+		},
+		{
+			PathRewriter{Maps: []PathMapping{{Old: "/srv/app/releases/2023", New: "/data"}}},
+			"/srv/app/releases/20234", "/srv/app/releases/20234", true,
+		},
+		{
+			PathRewriter{Maps: []PathMapping{{Old: "/srv/app", New: "/"}}},
+			"/srv/app", "", false,
+		},
+		{
+			PathRewriter{Maps: []PathMapping{{Old: "/srv/app", New: "/"}}},
+			"/srv/app/file", "/file", true,
+		},
+		{
+			// the longest prefix wins
+			PathRewriter{Maps: []PathMapping{{Old: "/srv", New: "/a"}, {Old: "/srv/app", New: "/b"}, {Old: "/", New: "/c"}}},
+			"/srv/app/file", "/b/file", true,
+		},
+		{
+			PathRewriter{Maps: []PathMapping{{Old: "/srv", New: "/a"}, {Old: "/srv/app", New: "/b"}, {Old: "/", New: "/c"}}},
+			"/home/file", "/c/home/file", true,
+		},
+		{
+			// components are stripped after mapping
+			PathRewriter{Maps: []PathMapping{{Old: "/srv/app", New: "/x/y"}}, StripComponents: 1},
+			"/srv/app/file", "/y/file", true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			res, ok := test.rw.Rewrite(test.path)
+			rtest.Equals(t, test.ok, ok)
+			rtest.Equals(t, test.res, res)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package restic
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// PendingDelete marks pack files for deletion. The pack files are not removed
+// right away, because processes which started before the mark was written may
+// still reference blobs contained in them. Processes which start afterwards
+// must not use blobs which are only contained in marked pack files.
+type PendingDelete struct {
+	Time     time.Time `json:"time"`
+	Hostname string    `json:"hostname,omitempty"`
+	Packs    IDs       `json:"packs"`
+
+	id *ID
+}
+
+// NewPendingDelete returns a new mark for packs.
+func NewPendingDelete(packs IDSet) *PendingDelete {
+	pd := &PendingDelete{
+		Time:  time.Now(),
+		Packs: packs.List(),
+	}
+
+	hn, err := os.Hostname()
+	if err == nil {
+		pd.Hostname = hn
+	}
+
+	return pd
+}
+
+// LoadPendingDelete loads the mark with the id from the repository.
+func LoadPendingDelete(ctx context.Context, repo Repository, id ID) (*PendingDelete, error) {
+	pd := &PendingDelete{id: &id}
+	err := repo.LoadJSONUnpacked(ctx, PendingDeleteFile, id, pd)
+	if err != nil {
+		return nil, err
+	}
+
+	return pd, nil
+}
+
+// LoadAllPendingDeletes returns all marks stored in the repository.
+func LoadAllPendingDeletes(ctx context.Context, repo Repository) (marks []*PendingDelete, err error) {
+	err = repo.List(ctx, PendingDeleteFile, func(id ID, size int64) error {
+		pd, err := LoadPendingDelete(ctx, repo, id)
+		if err != nil {
+			return err
+		}
+
+		marks = append(marks, pd)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return marks, nil
+}
+
+// Save stores the mark in the repository.
+func (pd *PendingDelete) Save(ctx context.Context, repo Repository) error {
+	id, err := repo.SaveJSONUnpacked(ctx, PendingDeleteFile, pd)
+	if err != nil {
+		return err
+	}
+
+	pd.id = &id
+	return nil
+}
+
+// Remove deletes the mark from the repository.
+func (pd *PendingDelete) Remove(ctx context.Context, repo Repository) error {
+	if pd.id == nil {
+		return nil
+	}
+
+	return repo.Backend().Remove(ctx, Handle{Type: PendingDeleteFile, Name: pd.id.String()})
+}
+
+// ID returns the ID of the mark.
+func (pd *PendingDelete) ID() *ID {
+	return pd.id
+}
+
+func (pd PendingDelete) String() string {
+	return fmt.Sprintf("<PendingDelete %s of %d packs at %s>", pd.id.Str(), len(pd.Packs), pd.Time)
+}
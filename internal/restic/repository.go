@@ -23,6 +23,7 @@ type Repository interface {
 	LoadIndex(context.Context) error
 
 	Config() Config
+	SetConfig(Config)
 
 	LookupBlobSize(ID, BlobType) (uint, bool)
 
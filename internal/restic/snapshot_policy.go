@@ -12,14 +12,19 @@ import (
 
 // ExpirePolicy configures which snapshots should be automatically removed.
 type ExpirePolicy struct {
-	Last    int       // keep the last n snapshots
-	Hourly  int       // keep the last n hourly snapshots
-	Daily   int       // keep the last n daily snapshots
-	Weekly  int       // keep the last n weekly snapshots
-	Monthly int       // keep the last n monthly snapshots
-	Yearly  int       // keep the last n yearly snapshots
-	Within  Duration  // keep snapshots made within this duration
-	Tags    []TagList // keep all snapshots that include at least one of the tag lists.
+	Last          int       // keep the last n snapshots
+	Hourly        int       // keep the last n hourly snapshots
+	Daily         int       // keep the last n daily snapshots
+	Weekly        int       // keep the last n weekly snapshots
+	Monthly       int       // keep the last n monthly snapshots
+	Yearly        int       // keep the last n yearly snapshots
+	Within        Duration  // keep snapshots made within this duration
+	WithinHourly  Duration  // keep hourly snapshots made within this duration
+	WithinDaily   Duration  // keep daily snapshots made within this duration
+	WithinWeekly  Duration  // keep weekly snapshots made within this duration
+	WithinMonthly Duration  // keep monthly snapshots made within this duration
+	WithinYearly  Duration  // keep yearly snapshots made within this duration
+	Tags          []TagList // keep all snapshots that include at least one of the tag lists.
 }
 
 func (e ExpirePolicy) String() (s string) {
@@ -61,6 +66,30 @@ func (e ExpirePolicy) String() (s string) {
 		s += fmt.Sprintf("all snapshots within %s of the newest", e.Within)
 	}
 
+	var within []string
+	if !e.WithinHourly.Zero() {
+		within = append(within, fmt.Sprintf("hourly snapshots within %s", e.WithinHourly))
+	}
+	if !e.WithinDaily.Zero() {
+		within = append(within, fmt.Sprintf("daily snapshots within %s", e.WithinDaily))
+	}
+	if !e.WithinWeekly.Zero() {
+		within = append(within, fmt.Sprintf("weekly snapshots within %s", e.WithinWeekly))
+	}
+	if !e.WithinMonthly.Zero() {
+		within = append(within, fmt.Sprintf("monthly snapshots within %s", e.WithinMonthly))
+	}
+	if !e.WithinYearly.Zero() {
+		within = append(within, fmt.Sprintf("yearly snapshots within %s", e.WithinYearly))
+	}
+
+	if len(within) > 0 {
+		if s != "" {
+			s += " and "
+		}
+		s += fmt.Sprintf("all %s of the newest", strings.Join(within, ", "))
+	}
+
 	return s
 }
 
@@ -127,6 +156,11 @@ func findLatestTimestamp(list Snapshots) time.Time {
 	return latest
 }
 
+// withinCutoff returns the time which is the duration d before latest.
+func withinCutoff(latest time.Time, d Duration) time.Time {
+	return latest.AddDate(-d.Years, -d.Months, -d.Days).Add(time.Hour * time.Duration(-d.Hours))
+}
+
 // KeepReason specifies why a particular snapshot was kept, and the counters at
 // that point in the policy evaluation.
 type KeepReason struct {
@@ -180,6 +214,19 @@ func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots, reason
 		{p.Yearly, y, -1, "yearly snapshot"},
 	}
 
+	var bucketsWithin = [5]struct {
+		Within Duration
+		bucker func(d time.Time, nr int) int
+		Last   int
+		reason string
+	}{
+		{p.WithinHourly, ymdh, -1, "hourly within"},
+		{p.WithinDaily, ymd, -1, "daily within"},
+		{p.WithinWeekly, yw, -1, "weekly within"},
+		{p.WithinMonthly, ym, -1, "monthly within"},
+		{p.WithinYearly, y, -1, "yearly within"},
+	}
+
 	latest := findLatestTimestamp(list)
 
 	for nr, cur := range list {
@@ -196,8 +243,7 @@ func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots, reason
 
 		// If the timestamp of the snapshot is within the range, then keep it.
 		if !p.Within.Zero() {
-			t := latest.AddDate(-p.Within.Years, -p.Within.Months, -p.Within.Days).Add(time.Hour * time.Duration(-p.Within.Hours))
-			if cur.Time.After(t) {
+			if cur.Time.After(withinCutoff(latest, p.Within)) {
 				keepSnap = true
 				keepSnapReasons = append(keepSnapReasons, fmt.Sprintf("within %v", p.Within))
 			}
@@ -217,6 +263,22 @@ func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots, reason
 			}
 		}
 
+		// Keep the newest snapshot of each period, as long as it is within the
+		// duration. These buckets are not counted.
+		for i, b := range bucketsWithin {
+			if b.Within.Zero() || !cur.Time.After(withinCutoff(latest, b.Within)) {
+				continue
+			}
+
+			val := b.bucker(cur.Time, nr)
+			if val != b.Last {
+				debug.Log("keep %v %v, bucker within %v, val %v\n", cur.Time, cur.id.Str(), i, val)
+				keepSnap = true
+				bucketsWithin[i].Last = val
+				keepSnapReasons = append(keepSnapReasons, fmt.Sprintf("%v %v", b.reason, b.Within))
+			}
+		}
+
 		if keepSnap {
 			keep = append(keep, cur)
 			kr := KeepReason{
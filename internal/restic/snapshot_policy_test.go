@@ -228,6 +228,17 @@ func TestApplyPolicy(t *testing.T) {
 		{Within: parseDuration("13d23h")},
 		{Within: parseDuration("2m2h")},
 		{Within: parseDuration("1y2m3d3h")},
+		{WithinHourly: parseDuration("1y")},
+		{WithinDaily: parseDuration("1m")},
+		{WithinWeekly: parseDuration("1m")},
+		{WithinMonthly: parseDuration("1y")},
+		{WithinYearly: parseDuration("10y")},
+		{
+			WithinHourly:  parseDuration("2d"),
+			WithinDaily:   parseDuration("1m"),
+			WithinWeekly:  parseDuration("6m"),
+			WithinMonthly: parseDuration("5y"),
+		},
 	}
 
 	for i, p := range tests {
@@ -4,7 +4,9 @@ import (
 	"context"
 	"io"
 	"path/filepath"
+	"strings"
 
+	"github.com/restic/restic/internal/compression"
 	"github.com/restic/restic/internal/crypto"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
@@ -38,6 +40,7 @@ const (
 type fileInfo struct {
 	location string      // file on local filesystem relative to restorer basedir
 	blobs    []restic.ID // remaining blobs of the file
+	offsets  []int64     // offsets of the remaining blobs, nil if the blobs are appended
 }
 
 // information about a data pack required to restore one or more files
@@ -66,6 +69,15 @@ type fileRestorer struct {
 
 	dst   string
 	files []*fileInfo
+
+	// sparse files are created by writing holes instead of chunks which
+	// only contain zeros
+	sparse bool
+
+	// completeBlob is called from the workers after a blob has been written
+	completeBlob func(location string, bytes uint64)
+	// completeFile is called when all blobs of a file have been written
+	completeFile func(location string)
 }
 
 func newFileRestorer(dst string, packLoader func(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error, key *crypto.Key, idx filePackTraverser) *fileRestorer {
@@ -76,6 +88,9 @@ func newFileRestorer(dst string, packLoader func(ctx context.Context, h restic.H
 		filesWriter: newFilesWriter(filesWriterCount),
 		packCache:   newPackCache(packCacheCapacity),
 		dst:         dst,
+
+		completeBlob: func(string, uint64) {},
+		completeFile: func(string) {},
 	}
 }
 
@@ -83,10 +98,22 @@ func (r *fileRestorer) addFile(location string, content restic.IDs) {
 	r.files = append(r.files, &fileInfo{location: location, blobs: content})
 }
 
+// addFileAt adds a file which already exists and is only missing the blobs
+// in content, which are written at the corresponding offsets.
+func (r *fileRestorer) addFileAt(location string, content restic.IDs, offsets []int64) {
+	r.files = append(r.files, &fileInfo{location: location, blobs: content, offsets: offsets})
+}
+
 func (r *fileRestorer) targetPath(location string) string {
 	return filepath.Join(r.dst, location)
 }
 
+// targetLocation returns the location relative to the restorer basedir of the
+// file at target, which must be below the basedir.
+func (r *fileRestorer) targetLocation(target string) string {
+	return strings.TrimPrefix(target, r.dst)
+}
+
 // used to pass information among workers (wish golang channels allowed multivalues)
 type processingInfo struct {
 	pack  *packInfo
@@ -175,11 +202,15 @@ func (r *fileRestorer) restoreFiles(ctx context.Context, onError func(path strin
 			} else {
 				r.idx.forEachFilePack(file, func(packIdx int, packID restic.ID, packBlobs []restic.Blob) bool {
 					file.blobs = file.blobs[len(packBlobs):]
+					if file.offsets != nil {
+						file.offsets = file.offsets[len(packBlobs):]
+					}
 					return false // only interesed in the first pack
 				})
 				if len(file.blobs) == 0 {
 					r.filesWriter.close(target)
 					delete(inprogress, file)
+					r.completeFile(file.location)
 				}
 				success = append(success, file)
 			}
@@ -278,16 +309,26 @@ func (r *fileRestorer) processPack(ctx context.Context, request processingInfo,
 	for file := range request.files {
 		target := r.targetPath(file.location)
 		r.idx.forEachFilePack(file, func(packIdx int, packID restic.ID, packBlobs []restic.Blob) bool {
-			for _, blob := range packBlobs {
+			for i, blob := range packBlobs {
 				debug.Log("Writing blob %s (%d bytes) from pack %s to %s", blob.ID.Str(), blob.Length, packID.Str(), file.location)
 				buf, err := r.loadBlob(rd, blob)
 				if err == nil {
-					err = r.filesWriter.writeToFile(target, buf)
+					switch {
+					case r.sparse && isZero(buf) && file.offsets != nil:
+						// the file was created with the final size, the hole exists already
+					case r.sparse && isZero(buf):
+						err = r.filesWriter.writeHole(target, int64(len(buf)))
+					case file.offsets != nil:
+						err = r.filesWriter.writeToFileAt(target, buf, file.offsets[i])
+					default:
+						err = r.filesWriter.writeToFile(target, buf)
+					}
 				}
 				if err != nil {
 					request.files[file] = err
 					break // could not restore the file
 				}
+				r.completeBlob(file.location, uint64(len(buf)))
 			}
 			return false
 		})
@@ -315,6 +356,13 @@ func (r *fileRestorer) loadBlob(rd io.ReaderAt, blob restic.Blob) ([]byte, error
 		return nil, errors.Errorf("decrypting blob %v failed: %v", blob.ID, err)
 	}
 
+	if blob.IsCompressed() {
+		plaintext, err = compression.Decompress(make([]byte, 0, blob.UncompressedLength), plaintext)
+		if err != nil {
+			return nil, errors.Errorf("decompressing blob %v failed: %v", blob.ID, err)
+		}
+	}
+
 	// check hash
 	if !restic.Hash(plaintext).Equal(blob.ID) {
 		return nil, errors.Errorf("blob %v returned invalid hash", blob.ID)
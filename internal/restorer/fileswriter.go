@@ -1,6 +1,7 @@
 package restorer
 
 import (
+	"bytes"
 	"io"
 	"os"
 	"sync"
@@ -24,31 +25,35 @@ func newFilesWriter(count int) *filesWriter {
 	return &filesWriter{inprogress: make(map[string]struct{}), writers: writers}
 }
 
-func (w *filesWriter) writeToFile(path string, buf []byte) error {
-	acquireWriter := func() (io.Writer, error) {
-		w.lock.Lock()
-		defer w.lock.Unlock()
-		if wr, ok := w.writers.Get(path); ok {
-			debug.Log("Used cached writer for %s", path)
-			return wr.(*os.File), nil
-		}
-		var flags int
-		if _, append := w.inprogress[path]; append {
-			flags = os.O_APPEND | os.O_WRONLY
-		} else {
-			w.inprogress[path] = struct{}{}
-			flags = os.O_CREATE | os.O_TRUNC | os.O_WRONLY
-		}
-		wr, err := os.OpenFile(path, flags, 0600)
-		if err != nil {
-			return nil, err
-		}
-		w.writers.Add(path, wr)
-		debug.Log("Opened and cached writer for %s", path)
-		return wr, nil
+func (w *filesWriter) acquireWriter(path string, existing bool) (*os.File, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if wr, ok := w.writers.Get(path); ok {
+		debug.Log("Used cached writer for %s", path)
+		return wr.(*os.File), nil
 	}
+	var flags int
+	if _, append := w.inprogress[path]; append {
+		flags = os.O_APPEND | os.O_WRONLY
+	} else {
+		w.inprogress[path] = struct{}{}
+		flags = os.O_CREATE | os.O_TRUNC | os.O_WRONLY
+	}
+	if existing {
+		// the file was prepared before, data is written at an offset
+		flags = os.O_WRONLY
+	}
+	wr, err := os.OpenFile(path, flags, 0600)
+	if err != nil {
+		return nil, err
+	}
+	w.writers.Add(path, wr)
+	debug.Log("Opened and cached writer for %s", path)
+	return wr, nil
+}
 
-	wr, err := acquireWriter()
+func (w *filesWriter) writeToFile(path string, buf []byte) error {
+	wr, err := w.acquireWriter(path, false)
 	if err != nil {
 		return err
 	}
@@ -62,6 +67,60 @@ func (w *filesWriter) writeToFile(path string, buf []byte) error {
 	return nil
 }
 
+// writeToFileAt writes buf at offset to the existing file at path.
+func (w *filesWriter) writeToFileAt(path string, buf []byte, offset int64) error {
+	wr, err := w.acquireWriter(path, true)
+	if err != nil {
+		return err
+	}
+	n, err := wr.WriteAt(buf, offset)
+	if err != nil {
+		return err
+	}
+	if n != len(buf) {
+		return errors.Errorf("error writing file %v: wrong length written, want %d, got %d", path, len(buf), n)
+	}
+	return nil
+}
+
+// writeHole extends the file at path by length bytes without writing any
+// data, on most file systems this creates a hole in a sparse file.
+func (w *filesWriter) writeHole(path string, length int64) error {
+	wr, err := w.acquireWriter(path, false)
+	if err != nil {
+		return err
+	}
+	size, err := wr.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	err = wr.Truncate(size + length)
+	if err != nil {
+		return err
+	}
+	// writers opened without O_APPEND continue at the current position
+	_, err = wr.Seek(size+length, io.SeekStart)
+	return err
+}
+
+// zeroBuf is compared with the data to find chunks which only contain zeros.
+var zeroBuf = make([]byte, 64*1024)
+
+// isZero returns true if buf only contains zeros.
+func isZero(buf []byte) bool {
+	for len(buf) > 0 {
+		n := len(buf)
+		if n > len(zeroBuf) {
+			n = len(zeroBuf)
+		}
+		if !bytes.Equal(buf[:n], zeroBuf[:n]) {
+			return false
+		}
+		buf = buf[n:]
+	}
+	return true
+}
+
 func (w *filesWriter) close(path string) {
 	w.lock.Lock()
 	defer w.lock.Unlock()
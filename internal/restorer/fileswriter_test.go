@@ -42,3 +42,30 @@ func TestFilesWriterBasic(t *testing.T) {
 	rtest.OK(t, err)
 	rtest.Equals(t, []byte{2, 2}, buf)
 }
+
+func TestFilesWriterHole(t *testing.T) {
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	w := newFilesWriter(1)
+
+	f1 := dir + "/f1"
+	f2 := dir + "/f2"
+
+	rtest.OK(t, w.writeHole(f1, 3))
+	rtest.OK(t, w.writeToFile(f1, []byte{1}))
+	// writing f2 evicts the cached writer for f1
+	rtest.OK(t, w.writeToFile(f2, []byte{2}))
+	rtest.OK(t, w.writeHole(f1, 2))
+	rtest.OK(t, w.writeToFile(f1, []byte{1}))
+	rtest.OK(t, w.writeHole(f1, 2))
+	w.close(f1)
+	w.close(f2)
+
+	buf, err := ioutil.ReadFile(f1)
+	rtest.OK(t, err)
+	rtest.Equals(t, []byte{0, 0, 0, 1, 0, 0, 1, 0, 0}, buf)
+
+	rtest.Assert(t, isZero(make([]byte, 100000)), "zeros not detected")
+	rtest.Assert(t, !isZero(append(make([]byte, 100000), 1)), "data detected as zeros")
+}
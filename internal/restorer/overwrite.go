@@ -0,0 +1,240 @@
+package restorer
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/restic/chunker"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// OverwritePolicy selects which items already present in the target
+// directory are replaced by the restorer.
+type OverwritePolicy string
+
+// These are the available overwrite policies.
+const (
+	// OverwriteAlways replaces all existing items.
+	OverwriteAlways OverwritePolicy = "always"
+	// OverwriteIfChanged only replaces items which differ from the snapshot.
+	OverwriteIfChanged OverwritePolicy = "if-changed"
+	// OverwriteIfNewer only replaces items which are older than the version
+	// in the snapshot.
+	OverwriteIfNewer OverwritePolicy = "if-newer"
+	// OverwriteNever keeps all existing items.
+	OverwriteNever OverwritePolicy = "never"
+)
+
+// ParseOverwritePolicy returns the policy with the name s.
+func ParseOverwritePolicy(s string) (OverwritePolicy, error) {
+	switch p := OverwritePolicy(s); p {
+	case OverwriteAlways, OverwriteIfChanged, OverwriteIfNewer, OverwriteNever:
+		return p, nil
+	}
+	return "", errors.Errorf("invalid overwrite policy %q, must be one of always, if-changed, if-newer or never", s)
+}
+
+// Action describes what the restorer does with an item in the target directory.
+type Action string
+
+// These are the actions reported by the restorer.
+const (
+	// ActionRestore creates an item which does not exist yet.
+	ActionRestore Action = "restore"
+	// ActionOverwrite replaces an existing item.
+	ActionOverwrite Action = "overwrite"
+	// ActionUnchanged keeps an existing item with the correct content, only
+	// the metadata is restored.
+	ActionUnchanged Action = "unchanged"
+	// ActionSkip keeps an existing item as it is.
+	ActionSkip Action = "skip"
+	// ActionDelete removes an item which is not contained in the snapshot.
+	ActionDelete Action = "delete"
+)
+
+// itemAction decides what to do with node, which is to be restored at target.
+func (res *Restorer) itemAction(node *restic.Node, target string) (Action, error) {
+	fi, err := fs.Lstat(target)
+	if os.IsNotExist(err) {
+		return ActionRestore, nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "Lstat")
+	}
+
+	switch res.Overwrite {
+	case OverwriteNever:
+		return ActionSkip, nil
+	case OverwriteIfNewer:
+		if !node.ModTime.After(fi.ModTime()) {
+			return ActionSkip, nil
+		}
+	case OverwriteIfChanged:
+		same, err := res.sameContent(node, target, fi)
+		if err != nil {
+			return "", err
+		}
+		if same {
+			return ActionUnchanged, nil
+		}
+	}
+
+	return ActionOverwrite, nil
+}
+
+// prepareTarget decides what to do with node and reports the decision.
+// Existing items which are overwritten are removed, so that other hard links
+// to an existing file are not modified.
+func (res *Restorer) prepareTarget(node *restic.Node, target, location string) (Action, error) {
+	action, err := res.itemAction(node, target)
+	if err != nil {
+		return "", err
+	}
+	debug.Log("%v: %v", location, action)
+	res.Report(location, action)
+
+	if action == ActionOverwrite && !res.DryRun {
+		err = fs.RemoveAll(target)
+		if err != nil {
+			return "", errors.Wrap(err, "RemoveAll")
+		}
+	}
+
+	return action, nil
+}
+
+// prepareDir makes sure that target can be created as a directory. An item
+// which is not a directory is removed unless the policy is OverwriteNever.
+func (res *Restorer) prepareDir(target, location string) error {
+	fi, err := fs.Lstat(target)
+	if err != nil || fi.IsDir() {
+		return nil
+	}
+
+	if res.Overwrite == OverwriteNever {
+		return errors.Errorf("%v exists and is not a directory", target)
+	}
+
+	res.Report(location, ActionOverwrite)
+	if res.DryRun {
+		return nil
+	}
+	return errors.Wrap(fs.Remove(target), "Remove")
+}
+
+// sameContent reports whether the item at target, described by fi, already
+// has the content of node. Files with the same size and modification time are
+// assumed to be unchanged, other files of the same size are split into chunks
+// which are compared with node.Content.
+func (res *Restorer) sameContent(node *restic.Node, target string, fi os.FileInfo) (bool, error) {
+	mode := fi.Mode()
+
+	switch node.Type {
+	case "file":
+		if !mode.IsRegular() || int64(node.Size) != fi.Size() {
+			return false, nil
+		}
+		if node.ModTime.Equal(fi.ModTime()) {
+			return true, nil
+		}
+		return res.sameChunks(node, target)
+	case "symlink":
+		if mode&os.ModeSymlink == 0 {
+			return false, nil
+		}
+		linkTarget, err := fs.Readlink(target)
+		if err != nil {
+			return false, errors.Wrap(err, "Readlink")
+		}
+		return linkTarget == node.LinkTarget, nil
+	case "fifo":
+		return mode&os.ModeNamedPipe != 0, nil
+	case "dev":
+		return mode&os.ModeDevice != 0 && mode&os.ModeCharDevice == 0 && fs.ExtendedStat(fi).Device == node.Device, nil
+	case "chardev":
+		return mode&os.ModeCharDevice != 0 && fs.ExtendedStat(fi).Device == node.Device, nil
+	}
+
+	return false, nil
+}
+
+// sameChunks splits the file at target into chunks with the chunker
+// polynomial of the repository and compares them with node.Content.
+func (res *Restorer) sameChunks(node *restic.Node, target string) (bool, error) {
+	f, err := fs.Open(target)
+	if err != nil {
+		return false, errors.Wrap(err, "Open")
+	}
+	defer f.Close()
+
+	chnker := chunker.New(f, res.repo.Config().ChunkerPolynomial)
+	var buf []byte
+	for i := 0; ; i++ {
+		chunk, err := chnker.Next(buf)
+		if errors.Cause(err) == io.EOF {
+			return i == len(node.Content), nil
+		}
+		if err != nil {
+			return false, errors.Wrap(err, "Next")
+		}
+		buf = chunk.Data
+
+		if i >= len(node.Content) || !node.Content[i].Equal(restic.Hash(chunk.Data)) {
+			return false, nil
+		}
+	}
+}
+
+// removeExtraItems removes all items in the directory target which are not
+// contained in the tree with treeID.
+func (res *Restorer) removeExtraItems(ctx context.Context, target, location string, treeID restic.ID) error {
+	tree, err := res.repo.LoadTree(ctx, treeID)
+	if err != nil {
+		return res.Error(location, err)
+	}
+
+	names := make(map[string]struct{}, len(tree.Nodes))
+	for _, node := range tree.Nodes {
+		names[node.Name] = struct{}{}
+	}
+
+	dir, err := fs.Open(target)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return res.Error(location, errors.Wrap(err, "Open"))
+	}
+	entries, err := dir.Readdirnames(-1)
+	_ = dir.Close()
+	if err != nil {
+		return res.Error(location, errors.Wrap(err, "Readdirnames"))
+	}
+
+	for _, name := range entries {
+		if _, ok := names[name]; ok {
+			continue
+		}
+
+		itemLocation := filepath.Join(location, name)
+		res.Report(itemLocation, ActionDelete)
+		if res.DryRun {
+			continue
+		}
+
+		err = fs.RemoveAll(filepath.Join(target, name))
+		if err != nil {
+			err = res.Error(itemLocation, errors.Wrap(err, "RemoveAll"))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
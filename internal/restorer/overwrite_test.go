@@ -0,0 +1,269 @@
+package restorer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+var overwriteTestTime = time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+
+var overwriteTestSnapshot = Snapshot{
+	Nodes: map[string]Node{
+		"foo": File{Data: "content: foo\n", ModTime: overwriteTestTime},
+		"dir": Dir{
+			Nodes: map[string]Node{
+				"bar": File{Data: "content: bar\n", ModTime: overwriteTestTime},
+			},
+		},
+	},
+}
+
+// setupOverwriteTarget creates a target directory with an outdated and older
+// file foo, a file dir/bar with the right content and a newer modification
+// time and two files which are not in overwriteTestSnapshot.
+func setupOverwriteTarget(t *testing.T, dir string) {
+	files := []struct {
+		name    string
+		data    string
+		modTime time.Time
+	}{
+		{"foo", "old foo\n", overwriteTestTime.Add(-time.Hour)},
+		{"dir/bar", "content: bar\n", overwriteTestTime.Add(time.Hour)},
+		{"extra", "extra\n", overwriteTestTime},
+		{"dir/extra", "extra\n", overwriteTestTime},
+	}
+
+	for _, f := range files {
+		name := filepath.Join(dir, filepath.FromSlash(f.name))
+		rtest.OK(t, os.MkdirAll(filepath.Dir(name), 0700))
+		rtest.OK(t, ioutil.WriteFile(name, []byte(f.data), 0644))
+		rtest.OK(t, os.Chtimes(name, f.modTime, f.modTime))
+	}
+}
+
+func newOverwriteTestRestorer(t *testing.T) (*Restorer, map[string]Action, func()) {
+	repo, cleanup := repository.TestRepository(t)
+
+	_, id := saveSnapshot(t, repo, overwriteTestSnapshot)
+	res, err := NewRestorer(repo, id)
+	rtest.OK(t, err)
+
+	actions := make(map[string]Action)
+	res.Report = func(location string, action Action) {
+		actions[filepath.ToSlash(location)] = action
+	}
+
+	return res, actions, cleanup
+}
+
+func readTestFile(t *testing.T, dir, name string) string {
+	data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+	rtest.OK(t, err)
+	return string(data)
+}
+
+func TestRestorerOverwrite(t *testing.T) {
+	var tests = []struct {
+		Policy  OverwritePolicy
+		Actions map[string]Action
+		Foo     string
+	}{
+		{
+			Policy: OverwriteAlways,
+			Actions: map[string]Action{
+				"/foo":     ActionOverwrite,
+				"/dir/bar": ActionOverwrite,
+			},
+			Foo: "content: foo\n",
+		},
+		{
+			Policy: OverwriteIfChanged,
+			Actions: map[string]Action{
+				"/foo":     ActionOverwrite,
+				"/dir/bar": ActionUnchanged,
+			},
+			Foo: "content: foo\n",
+		},
+		{
+			Policy: OverwriteIfNewer,
+			Actions: map[string]Action{
+				"/foo":     ActionOverwrite,
+				"/dir/bar": ActionSkip,
+			},
+			Foo: "content: foo\n",
+		},
+		{
+			Policy: OverwriteNever,
+			Actions: map[string]Action{
+				"/foo":     ActionSkip,
+				"/dir/bar": ActionSkip,
+			},
+			Foo: "old foo\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.Policy), func(t *testing.T) {
+			res, actions, cleanup := newOverwriteTestRestorer(t)
+			defer cleanup()
+
+			tempdir, cleanup := rtest.TempDir(t)
+			defer cleanup()
+			setupOverwriteTarget(t, tempdir)
+
+			res.Overwrite = test.Policy
+			rtest.OK(t, res.RestoreTo(context.TODO(), tempdir))
+
+			rtest.Equals(t, test.Actions, actions)
+			rtest.Equals(t, test.Foo, readTestFile(t, tempdir, "foo"))
+			rtest.Equals(t, "content: bar\n", readTestFile(t, tempdir, "dir/bar"))
+			rtest.Equals(t, "extra\n", readTestFile(t, tempdir, "extra"))
+
+			fi, err := os.Stat(filepath.Join(tempdir, "dir", "bar"))
+			rtest.OK(t, err)
+			if actions["/dir/bar"] == ActionSkip {
+				rtest.Assert(t, fi.ModTime().Equal(overwriteTestTime.Add(time.Hour)), "skipped file was modified")
+			} else {
+				rtest.Assert(t, fi.ModTime().Equal(overwriteTestTime), "wrong modification time %v", fi.ModTime())
+			}
+		})
+	}
+}
+
+func TestParseOverwritePolicy(t *testing.T) {
+	for _, s := range []string{"always", "if-changed", "if-newer", "never"} {
+		p, err := ParseOverwritePolicy(s)
+		rtest.OK(t, err)
+		rtest.Equals(t, OverwritePolicy(s), p)
+	}
+
+	_, err := ParseOverwritePolicy("sometimes")
+	rtest.Assert(t, err != nil, "invalid policy was accepted")
+}
+
+func TestRestorerDelete(t *testing.T) {
+	res, actions, cleanup := newOverwriteTestRestorer(t)
+	defer cleanup()
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+	setupOverwriteTarget(t, tempdir)
+
+	res.Overwrite = OverwriteIfChanged
+	res.Delete = true
+	rtest.OK(t, res.RestoreTo(context.TODO(), tempdir))
+
+	rtest.Equals(t, ActionDelete, actions["/dir/extra"])
+	_, err := os.Lstat(filepath.Join(tempdir, "dir", "extra"))
+	rtest.Assert(t, os.IsNotExist(err), "dir/extra was not deleted: %v", err)
+
+	// the target directory itself is not part of the snapshot
+	_, ok := actions["/extra"]
+	rtest.Assert(t, !ok, "extra file in the target directory was reported")
+	rtest.Equals(t, "extra\n", readTestFile(t, tempdir, "extra"))
+
+	rtest.Equals(t, "content: foo\n", readTestFile(t, tempdir, "foo"))
+	rtest.Equals(t, "content: bar\n", readTestFile(t, tempdir, "dir/bar"))
+}
+
+func TestRestorerDeleteFilter(t *testing.T) {
+	var tests = []struct {
+		name    string
+		filter  func(item string, dstpath string, node *restic.Node) (bool, bool)
+		actions map[string]Action
+		deleted bool
+	}{
+		{
+			// only the file is selected, its directory must be left alone
+			name: "file",
+			filter: func(item string, dstpath string, node *restic.Node) (bool, bool) {
+				item = filepath.ToSlash(item)
+				return item == "/dir/bar", item == "/dir"
+			},
+			actions: map[string]Action{
+				"/dir/bar": ActionUnchanged,
+			},
+		},
+		{
+			name: "dir",
+			filter: func(item string, dstpath string, node *restic.Node) (bool, bool) {
+				item = filepath.ToSlash(item)
+				return item == "/dir" || item == "/dir/bar", item == "/dir"
+			},
+			actions: map[string]Action{
+				"/dir/bar":   ActionUnchanged,
+				"/dir/extra": ActionDelete,
+			},
+			deleted: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, actions, cleanup := newOverwriteTestRestorer(t)
+			defer cleanup()
+
+			tempdir, cleanup := rtest.TempDir(t)
+			defer cleanup()
+			setupOverwriteTarget(t, tempdir)
+
+			res.Overwrite = OverwriteIfChanged
+			res.Delete = true
+			res.SelectFilter = test.filter
+			rtest.OK(t, res.RestoreTo(context.TODO(), tempdir))
+
+			rtest.Equals(t, test.actions, actions)
+			rtest.Equals(t, "old foo\n", readTestFile(t, tempdir, "foo"))
+			rtest.Equals(t, "extra\n", readTestFile(t, tempdir, "extra"))
+
+			_, err := os.Lstat(filepath.Join(tempdir, "dir", "extra"))
+			rtest.Equals(t, test.deleted, os.IsNotExist(err))
+		})
+	}
+}
+
+func TestRestorerDryRun(t *testing.T) {
+	res, actions, cleanup := newOverwriteTestRestorer(t)
+	defer cleanup()
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+	setupOverwriteTarget(t, tempdir)
+
+	res.Overwrite = OverwriteIfChanged
+	res.Delete = true
+	res.DryRun = true
+	rtest.OK(t, res.RestoreTo(context.TODO(), tempdir))
+
+	rtest.Equals(t, map[string]Action{
+		"/foo":       ActionOverwrite,
+		"/dir/bar":   ActionUnchanged,
+		"/dir/extra": ActionDelete,
+	}, actions)
+
+	rtest.Equals(t, "old foo\n", readTestFile(t, tempdir, "foo"))
+	rtest.Equals(t, "extra\n", readTestFile(t, tempdir, "extra"))
+	rtest.Equals(t, "extra\n", readTestFile(t, tempdir, "dir/extra"))
+
+	// a dry run into a missing directory must not create it
+	missing := filepath.Join(tempdir, "missing")
+	actions = make(map[string]Action)
+	res.Report = func(location string, action Action) {
+		actions[filepath.ToSlash(location)] = action
+	}
+	rtest.OK(t, res.RestoreTo(context.TODO(), missing))
+	rtest.Equals(t, map[string]Action{
+		"/foo":     ActionRestore,
+		"/dir/bar": ActionRestore,
+	}, actions)
+	_, err := os.Lstat(missing)
+	rtest.Assert(t, os.IsNotExist(err), "dry run created the target directory")
+}
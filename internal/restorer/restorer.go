@@ -5,7 +5,6 @@ import (
 	"os"
 	"path/filepath"
 
-	"github.com/restic/restic/internal/crypto"
 	"github.com/restic/restic/internal/errors"
 
 	"github.com/restic/restic/internal/debug"
@@ -20,6 +19,50 @@ type Restorer struct {
 
 	Error        func(location string, err error) error
 	SelectFilter func(item string, dstpath string, node *restic.Node) (selectedForRestore bool, childMayBeSelected bool)
+
+	// Report is called with the action taken for each item in the target
+	// directory, except for directories.
+	Report func(location string, action Action)
+
+	// Overwrite selects which existing items in the target are replaced.
+	Overwrite OverwritePolicy
+	// Delete removes items which are not in the snapshot from the restored
+	// directories. Directories which are not selected by SelectFilter, and
+	// the target directory itself, are left untouched.
+	Delete bool
+	// DryRun only reports what would be done, nothing is written.
+	DryRun bool
+
+	// SeedDir is a directory with older versions of the files in the
+	// snapshot at the same paths. Data found in these files or in the
+	// existing files in the target is copied instead of being downloaded.
+	SeedDir string
+
+	// Sparse writes holes instead of chunks which only contain zeros.
+	Sparse bool
+
+	// Rewrite changes the paths of the items below the target directory.
+	// Include and exclude filters in SelectFilter still see the locations
+	// in the snapshot. Delete cannot be used together with Rewrite.
+	Rewrite restic.PathRewriter
+
+	// Owners determines the owner of the restored items. If it is nil, the
+	// numeric IDs stored in the snapshot are used.
+	Owners *restic.OwnerMapper
+
+	// ownerErrors counts the items whose owner could not be changed because
+	// restic is not running as root.
+	ownerErrors uint
+
+	// ReportTotal is called with the number of files and bytes to restore
+	// once the files in the snapshot have been collected.
+	ReportTotal func(files uint, bytes uint64)
+	// CompleteBytes is called when bytes of the file at location have been
+	// written. It may be called concurrently.
+	CompleteBytes func(location string, bytes uint64)
+	// CompleteFile is called when the content of the file at location is
+	// complete, including existing files which were kept.
+	CompleteFile func(location string)
 }
 
 var restorerAbortOnAllErrors = func(location string, err error) error { return err }
@@ -30,6 +73,12 @@ func NewRestorer(repo restic.Repository, id restic.ID) (*Restorer, error) {
 		repo:         repo,
 		Error:        restorerAbortOnAllErrors,
 		SelectFilter: func(string, string, *restic.Node) (bool, bool) { return true, true },
+		Report:       func(string, Action) {},
+		Overwrite:    OverwriteAlways,
+
+		ReportTotal:   func(uint, uint64) {},
+		CompleteBytes: func(string, uint64) {},
+		CompleteFile:  func(string) {},
 	}
 
 	var err error
@@ -49,9 +98,11 @@ type treeVisitor struct {
 }
 
 // traverseTree traverses a tree from the repo and calls treeVisitor.
-// target is the path in the file system, location within the snapshot.
-func (res *Restorer) traverseTree(ctx context.Context, target, location string, treeID restic.ID, visitor treeVisitor) error {
-	debug.Log("%v %v %v", target, location, treeID)
+// dst is the target directory in the file system, location the path within
+// the snapshot. The path of each item below dst is computed from its location
+// with res.Rewrite.
+func (res *Restorer) traverseTree(ctx context.Context, dst, location string, treeID restic.ID, visitor treeVisitor) error {
+	debug.Log("%v %v %v", dst, location, treeID)
 	tree, err := res.repo.LoadTree(ctx, treeID)
 	if err != nil {
 		debug.Log("error loading tree %v: %v", treeID, err)
@@ -72,17 +123,24 @@ func (res *Restorer) traverseTree(ctx context.Context, target, location string,
 			continue
 		}
 
-		nodeTarget := filepath.Join(target, nodeName)
 		nodeLocation := filepath.Join(location, nodeName)
 
-		if target == nodeTarget || !fs.HasPathPrefix(target, nodeTarget) {
-			debug.Log("target: %v %v", target, nodeTarget)
-			debug.Log("node %q has invalid target path %q", node.Name, nodeTarget)
-			err := res.Error(nodeLocation, errors.New("node has invalid path"))
-			if err != nil {
-				return err
+		// items which have no path of their own after rewriting are not
+		// restored, but the children of directories may be
+		nodeTarget := ""
+		rewritten, hasTarget := res.Rewrite.Rewrite(filepath.ToSlash(nodeLocation))
+		if hasTarget {
+			nodeTarget = filepath.Join(dst, filepath.FromSlash(rewritten))
+
+			if dst == nodeTarget || !fs.HasPathPrefix(dst, nodeTarget) {
+				debug.Log("target: %v %v", dst, nodeTarget)
+				debug.Log("node %q has invalid target path %q", node.Name, nodeTarget)
+				err := res.Error(nodeLocation, errors.New("node has invalid path"))
+				if err != nil {
+					return err
+				}
+				continue
 			}
-			continue
 		}
 
 		// sockets cannot be restored
@@ -92,6 +150,7 @@ func (res *Restorer) traverseTree(ctx context.Context, target, location string,
 
 		selectedForRestore, childMayBeSelected := res.SelectFilter(nodeLocation, nodeTarget, node)
 		debug.Log("SelectFilter returned %v %v", selectedForRestore, childMayBeSelected)
+		selectedForRestore = selectedForRestore && hasTarget
 
 		sanitizeError := func(err error) error {
 			if err != nil {
@@ -113,7 +172,7 @@ func (res *Restorer) traverseTree(ctx context.Context, target, location string,
 			}
 
 			if childMayBeSelected {
-				err = sanitizeError(res.traverseTree(ctx, nodeTarget, nodeLocation, *node.Subtree, visitor))
+				err = sanitizeError(res.traverseTree(ctx, dst, nodeLocation, *node.Subtree, visitor))
 				if err != nil {
 					return err
 				}
@@ -156,13 +215,54 @@ func (res *Restorer) restoreNodeTo(ctx context.Context, node *restic.Node, targe
 
 func (res *Restorer) restoreNodeMetadataTo(node *restic.Node, target, location string) error {
 	debug.Log("restoreNodeMetadata %v %v %v", node.Name, target, location)
-	err := node.RestoreMetadata(target)
+	ownerErr := res.restoreOwner(node, target, location)
+
+	err := node.RestoreMetadataNoOwner(target)
 	if err != nil {
 		debug.Log("node.RestoreMetadata(%s) error %v", target, err)
 	}
+
+	if ownerErr != nil {
+		return ownerErr
+	}
 	return err
 }
 
+// restoreOwner changes the owner of the item at target according to
+// res.Owners. Like "cp -a" and "rsync -a" do, permission errors are only
+// reported when running as root, otherwise they are counted.
+func (res *Restorer) restoreOwner(node *restic.Node, target, location string) error {
+	uid, gid := node.UID, node.GID
+	if res.Owners != nil {
+		var ok bool
+		uid, gid, ok = res.Owners.Owner(node)
+		if !ok {
+			return nil
+		}
+	}
+
+	err := restic.Lchown(target, int(uid), int(gid))
+	if err == nil {
+		return nil
+	}
+
+	// On Windows, Geteuid always returns -1, and we always report lchown
+	// permission errors.
+	if os.Geteuid() > 0 && os.IsPermission(err) {
+		debug.Log("not running as root, ignoring lchown permission error for %v: %v", location, err)
+		res.ownerErrors++
+		return nil
+	}
+
+	return errors.Wrap(err, "Lchown")
+}
+
+// OwnerErrors returns the number of items whose owner could not be restored
+// because restic is not running as root.
+func (res *Restorer) OwnerErrors() uint {
+	return res.ownerErrors
+}
+
 func (res *Restorer) restoreHardlinkAt(node *restic.Node, target, path, location string) error {
 	if err := fs.Remove(path); !os.IsNotExist(err) {
 		return errors.Wrap(err, "RemoveCreateHardlink")
@@ -189,7 +289,8 @@ func (res *Restorer) restoreEmptyFileAt(node *restic.Node, target, location stri
 }
 
 // RestoreTo creates the directories and files in the snapshot below dst.
-// Before an item is created, res.Filter is called.
+// Before an item is created, res.Filter is called. Existing items are
+// replaced according to res.Overwrite.
 func (res *Restorer) RestoreTo(ctx context.Context, dst string) error {
 	var err error
 	if !filepath.IsAbs(dst) {
@@ -199,27 +300,56 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) error {
 		}
 	}
 
-	restoreNodeMetadata := func(node *restic.Node, target, location string) error {
-		return res.restoreNodeMetadataTo(node, target, location)
+	if res.Delete && !res.Rewrite.Identity() {
+		return errors.New("deleting extra files is not supported when paths are rewritten")
+	}
+
+	if res.DryRun {
+		return res.dryRun(ctx, dst)
 	}
+
 	noop := func(node *restic.Node, target, location string) error { return nil }
 
 	idx := restic.NewHardlinkIndex()
 
+	// kept records the existing files which are not written
+	kept := make(map[string]Action)
+
+	totalFiles, totalBytes, err := res.countFiles(ctx, dst)
+	if err != nil {
+		return err
+	}
+	res.ReportTotal(totalFiles, totalBytes)
+
+	// counted records the hard linked files which are reported as complete
+	counted := restic.NewHardlinkIndex()
+
+	// seeds maps the target of an existing file to the seed it was moved to,
+	// it is kept until the new file is restored completely
+	seeds := make(map[string]string)
+
 	filerestorer := newFileRestorer(dst, res.repo.Backend().Load, res.repo.Key(), filePackTraverser{lookup: res.repo.Index().Lookup})
+	filerestorer.sparse = res.Sparse
+	filerestorer.completeBlob = res.CompleteBytes
+	filerestorer.completeFile = res.CompleteFile
 
 	// first tree pass: create directories and collect all files to restore
 	err = res.traverseTree(ctx, dst, string(filepath.Separator), *res.sn.Tree, treeVisitor{
 		enterDir: func(node *restic.Node, target, location string) error {
+			err := res.prepareDir(target, location)
+			if err != nil {
+				return err
+			}
+
 			// create dir with default permissions
 			// #leaveDir restores dir metadata after visiting all children
 			return fs.MkdirAll(target, 0700)
 		},
 
-		visitNode: func(node *restic.Node, target, location string) error {
+		visitNode: func(node *restic.Node, target, location string) (err error) {
 			// create parent dir with default permissions
 			// second pass #leaveDir restores dir metadata after visiting/restoring all children
-			err := fs.MkdirAll(filepath.Dir(target), 0700)
+			err = fs.MkdirAll(filepath.Dir(target), 0700)
 			if err != nil {
 				return err
 			}
@@ -228,6 +358,34 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) error {
 				return nil
 			}
 
+			// only the content of the first hard link to a file is written
+			written := node.Size > 0 && (node.Links < 2 || !idx.Has(node.Inode, node.DeviceID))
+
+			action, seed, err := res.prepareFile(node, target, location, written)
+			if err != nil {
+				return err
+			}
+			if seed != "" {
+				defer func() {
+					if err != nil {
+						_ = removeSeed(seed, target, true)
+						return
+					}
+					seeds[target] = seed
+				}()
+			}
+			if action == ActionSkip || action == ActionUnchanged {
+				kept[location] = action
+				if node.Links < 2 || !counted.Has(node.Inode, node.DeviceID) {
+					if node.Links > 1 {
+						counted.Add(node.Inode, node.DeviceID, location)
+					}
+					res.CompleteBytes(location, node.Size)
+					res.CompleteFile(location)
+				}
+				return nil
+			}
+
 			if node.Size == 0 {
 				return nil // deal with empty files later
 			}
@@ -236,48 +394,149 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) error {
 				if idx.Has(node.Inode, node.DeviceID) {
 					return nil
 				}
-				idx.Add(node.Inode, node.DeviceID, location)
+				idx.Add(node.Inode, node.DeviceID, target)
+			}
+
+			if seed != "" {
+				// reuse the content of the previous version of the file
+				return res.seedFile(filerestorer, node, seed, target, location)
 			}
 
-			filerestorer.addFile(location, node.Content)
+			fileLocation := filerestorer.targetLocation(target)
+			if seed = res.seedDirFile(fileLocation); seed != "" {
+				return res.seedFile(filerestorer, node, seed, target, location)
+			}
+
+			filerestorer.addFile(fileLocation, node.Content)
 
 			return nil
 		},
 		leaveDir: noop,
 	})
 	if err != nil {
-		return err
+		return removeSeeds(seeds, nil, err)
 	}
 
-	err = filerestorer.restoreFiles(ctx, func(location string, err error) { res.Error(location, err) })
+	failed := make(map[string]struct{})
+	err = filerestorer.restoreFiles(ctx, func(location string, err error) {
+		failed[filerestorer.targetPath(location)] = struct{}{}
+		res.Error(location, err)
+	})
+	err = removeSeeds(seeds, failed, err)
 	if err != nil {
 		return err
 	}
 
 	// second tree pass: restore special files and filesystem metadata
-	return res.traverseTree(ctx, dst, string(filepath.Separator), *res.sn.Tree, treeVisitor{
+	err = res.traverseTree(ctx, dst, string(filepath.Separator), *res.sn.Tree, treeVisitor{
 		enterDir: noop,
 		visitNode: func(node *restic.Node, target, location string) error {
 			if node.Type != "file" {
+				action, err := res.prepareTarget(node, target, location)
+				if err != nil {
+					return err
+				}
+
+				switch action {
+				case ActionSkip:
+					return nil
+				case ActionUnchanged:
+					return res.restoreNodeMetadataTo(node, target, location)
+				}
 				return res.restoreNodeTo(ctx, node, target, location)
 			}
 
+			if action, ok := kept[location]; ok {
+				if action == ActionUnchanged {
+					return res.restoreNodeMetadataTo(node, target, location)
+				}
+				return nil
+			}
+
 			// create empty files, but not hardlinks to empty files
 			if node.Size == 0 && (node.Links < 2 || !idx.Has(node.Inode, node.DeviceID)) {
 				if node.Links > 1 {
-					idx.Add(node.Inode, node.DeviceID, location)
+					idx.Add(node.Inode, node.DeviceID, target)
 				}
-				return res.restoreEmptyFileAt(node, target, location)
+				err := res.restoreEmptyFileAt(node, target, location)
+				if err != nil {
+					return err
+				}
+				res.CompleteFile(location)
+				return nil
 			}
 
-			if idx.Has(node.Inode, node.DeviceID) && idx.GetFilename(node.Inode, node.DeviceID) != location {
-				return res.restoreHardlinkAt(node, filerestorer.targetPath(idx.GetFilename(node.Inode, node.DeviceID)), target, location)
+			if idx.Has(node.Inode, node.DeviceID) && idx.GetFilename(node.Inode, node.DeviceID) != target {
+				return res.restoreHardlinkAt(node, idx.GetFilename(node.Inode, node.DeviceID), target, location)
 			}
 
 			return res.restoreNodeMetadataTo(node, target, location)
 		},
-		leaveDir: restoreNodeMetadata,
+		leaveDir: func(node *restic.Node, target, location string) error {
+			if res.Delete {
+				err := res.removeExtraItems(ctx, target, location, *node.Subtree)
+				if err != nil {
+					return err
+				}
+			}
+			return res.restoreNodeMetadataTo(node, target, location)
+		},
+	})
+	return err
+}
+
+// countFiles returns the number and the total size of the files which are
+// selected for restore. Hard linked files are only counted once.
+func (res *Restorer) countFiles(ctx context.Context, dst string) (files uint, bytes uint64, err error) {
+	noop := func(node *restic.Node, target, location string) error { return nil }
+	idx := restic.NewHardlinkIndex()
+
+	err = res.traverseTree(ctx, dst, string(filepath.Separator), *res.sn.Tree, treeVisitor{
+		enterDir: noop,
+		visitNode: func(node *restic.Node, target, location string) error {
+			if node.Type != "file" {
+				return nil
+			}
+
+			if node.Links > 1 {
+				if idx.Has(node.Inode, node.DeviceID) {
+					return nil
+				}
+				idx.Add(node.Inode, node.DeviceID, location)
+			}
+
+			files++
+			bytes += node.Size
+			return nil
+		},
+		leaveDir: noop,
 	})
+
+	return files, bytes, err
+}
+
+// dryRun reports what RestoreTo would do without modifying anything below dst.
+func (res *Restorer) dryRun(ctx context.Context, dst string) error {
+	noop := func(node *restic.Node, target, location string) error { return nil }
+
+	leaveDir := noop
+	if res.Delete {
+		leaveDir = func(node *restic.Node, target, location string) error {
+			return res.removeExtraItems(ctx, target, location, *node.Subtree)
+		}
+	}
+
+	err := res.traverseTree(ctx, dst, string(filepath.Separator), *res.sn.Tree, treeVisitor{
+		enterDir: func(node *restic.Node, target, location string) error {
+			return res.prepareDir(target, location)
+		},
+		visitNode: func(node *restic.Node, target, location string) error {
+			_, err := res.prepareTarget(node, target, location)
+			return err
+		},
+		leaveDir: leaveDir,
+	})
+	return err
 }
 
 // Snapshot returns the snapshot this restorer is configured to use.
@@ -314,7 +573,7 @@ func (res *Restorer) VerifyFiles(ctx context.Context, dst string) (int, error) {
 			offset := int64(0)
 			for _, blobID := range node.Content {
 				blobs, _ := res.repo.Index().Lookup(blobID, restic.DataBlob)
-				length := blobs[0].Length - uint(crypto.Extension)
+				length := blobs[0].DataLength()
 				buf := make([]byte, length) // TODO do I want to reuse the buffer somehow?
 				_, err = file.ReadAt(buf, offset)
 				if err != nil {
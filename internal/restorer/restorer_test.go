@@ -6,7 +6,9 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -24,9 +26,13 @@ type Snapshot struct {
 }
 
 type File struct {
-	Data  string
-	Links uint64
-	Inode uint64
+	Data    string
+	Links   uint64
+	Inode   uint64
+	ModTime time.Time
+
+	// UID and GID default to the current user and group
+	UID, GID uint32
 }
 
 type Dir struct {
@@ -67,16 +73,24 @@ func saveDir(t testing.TB, repo restic.Repository, nodes map[string]Node, inode
 			if len(n.(File).Data) > 0 {
 				fc = append(fc, saveFile(t, repo, node))
 			}
+			uid, gid := node.UID, node.GID
+			if uid == 0 {
+				uid = uint32(os.Getuid())
+			}
+			if gid == 0 {
+				gid = uint32(os.Getgid())
+			}
 			tree.Insert(&restic.Node{
 				Type:    "file",
 				Mode:    0644,
 				Name:    name,
-				UID:     uint32(os.Getuid()),
-				GID:     uint32(os.Getgid()),
+				UID:     uid,
+				GID:     gid,
 				Content: fc,
 				Size:    uint64(len(n.(File).Data)),
 				Inode:   fi,
 				Links:   lc,
+				ModTime: node.ModTime,
 			})
 		case Dir:
 			id := saveDir(t, repo, node.Nodes, inode)
@@ -694,3 +708,210 @@ func TestRestorerTraverseTree(t *testing.T) {
 		})
 	}
 }
+
+func TestRestorerProgress(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	_, id := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"foo":   File{Data: "content: foo\n"},
+			"empty": File{Data: ""},
+			"link1": File{Data: "content: link\n", Links: 2, Inode: 42},
+			"link2": File{Data: "content: link\n", Links: 2, Inode: 42},
+			"dir": Dir{
+				Nodes: map[string]Node{
+					"bar": File{Data: "content: bar\n"},
+				},
+			},
+		},
+	})
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	// the second run keeps all files with if-changed
+	for _, overwrite := range []OverwritePolicy{OverwriteAlways, OverwriteIfChanged} {
+		t.Run(string(overwrite), func(t *testing.T) {
+			res, err := NewRestorer(repo, id)
+			rtest.OK(t, err)
+			res.Overwrite = overwrite
+
+			var totalFiles, files uint
+			var totalBytes, restored uint64
+			var mu sync.Mutex
+			res.ReportTotal = func(f uint, b uint64) {
+				totalFiles, totalBytes = f, b
+			}
+			res.CompleteBytes = func(location string, b uint64) {
+				mu.Lock()
+				restored += b
+				mu.Unlock()
+			}
+			res.CompleteFile = func(location string) {
+				files++
+			}
+
+			rtest.OK(t, res.RestoreTo(context.TODO(), tempdir))
+
+			rtest.Equals(t, uint(4), totalFiles)
+			rtest.Equals(t, uint64(len("content: foo\ncontent: link\ncontent: bar\n")), totalBytes)
+			rtest.Equals(t, totalFiles, files)
+			rtest.Equals(t, totalBytes, restored)
+		})
+	}
+}
+
+// listTestDir returns the content of all files below dir, directories are
+// listed with a trailing slash and no content.
+func listTestDir(t *testing.T, dir string) map[string]string {
+	files := make(map[string]string)
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || p == dir {
+			return err
+		}
+
+		name, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+
+		if fi.IsDir() {
+			files[name+"/"] = ""
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(p)
+		files[name] = string(data)
+		return err
+	})
+	rtest.OK(t, err)
+	return files
+}
+
+func TestRestorerRewrite(t *testing.T) {
+	snapshot := Snapshot{
+		Nodes: map[string]Node{
+			"foo": File{Data: "content: foo\n"},
+			"srv": Dir{
+				Nodes: map[string]Node{
+					"other": File{Data: "content: other\n"},
+					"app": Dir{
+						Nodes: map[string]Node{
+							"file":  File{Data: "content: file\n"},
+							"link1": File{Data: "content: link\n", Links: 2, Inode: 42},
+							"link2": File{Data: "content: link\n", Links: 2, Inode: 42},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	var tests = []struct {
+		Rewrite restic.PathRewriter
+		Include string
+		Files   map[string]string
+	}{
+		{
+			Rewrite: restic.PathRewriter{StripComponents: 1},
+			Files: map[string]string{
+				"other":     "content: other\n",
+				"app/":      "",
+				"app/file":  "content: file\n",
+				"app/link1": "content: link\n",
+				"app/link2": "content: link\n",
+			},
+		},
+		{
+			Rewrite: restic.PathRewriter{Maps: []restic.PathMapping{{Old: "/srv/app", New: "/data/current"}}},
+			Include: "/srv/app",
+			Files: map[string]string{
+				"data/":              "",
+				"data/current/":      "",
+				"data/current/file":  "content: file\n",
+				"data/current/link1": "content: link\n",
+				"data/current/link2": "content: link\n",
+			},
+		},
+		{
+			Rewrite: restic.PathRewriter{Maps: []restic.PathMapping{{Old: "/srv", New: "/"}}},
+			Files: map[string]string{
+				"foo":       "content: foo\n",
+				"other":     "content: other\n",
+				"app/":      "",
+				"app/file":  "content: file\n",
+				"app/link1": "content: link\n",
+				"app/link2": "content: link\n",
+			},
+		},
+	}
+
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+	_, id := saveSnapshot(t, repo, snapshot)
+
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			res, err := NewRestorer(repo, id)
+			rtest.OK(t, err)
+			res.Rewrite = test.Rewrite
+
+			if test.Include != "" {
+				// filters match the paths in the snapshot
+				res.SelectFilter = func(item string, dstpath string, node *restic.Node) (bool, bool) {
+					item = filepath.ToSlash(item)
+					selected := fs.HasPathPrefix(test.Include, item)
+					return selected, selected || fs.HasPathPrefix(item, test.Include)
+				}
+			}
+
+			tempdir, cleanup := rtest.TempDir(t)
+			defer cleanup()
+
+			rtest.OK(t, res.RestoreTo(context.TODO(), tempdir))
+			rtest.Equals(t, test.Files, listTestDir(t, tempdir))
+
+			if runtime.GOOS != "windows" {
+				var link1, link2 string
+				for name := range test.Files {
+					switch filepath.Base(name) {
+					case "link1":
+						link1 = filepath.Join(tempdir, filepath.FromSlash(name))
+					case "link2":
+						link2 = filepath.Join(tempdir, filepath.FromSlash(name))
+					}
+				}
+				fi1, err := os.Stat(link1)
+				rtest.OK(t, err)
+				fi2, err := os.Stat(link2)
+				rtest.OK(t, err)
+				rtest.Assert(t, os.SameFile(fi1, fi2), "%v and %v are not hard linked", link1, link2)
+			}
+
+			count, err := res.VerifyFiles(context.TODO(), tempdir)
+			rtest.OK(t, err)
+			rtest.Assert(t, count > 0, "no files were verified")
+		})
+	}
+}
+
+func TestRestorerRewriteDelete(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+	_, id := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"foo": File{Data: "content: foo\n"},
+		},
+	})
+
+	res, err := NewRestorer(repo, id)
+	rtest.OK(t, err)
+	res.Rewrite = restic.PathRewriter{StripComponents: 1}
+	res.Delete = true
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+	rtest.Assert(t, res.RestoreTo(context.TODO(), tempdir) != nil, "delete was accepted together with rewriting")
+}
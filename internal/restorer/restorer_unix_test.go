@@ -3,7 +3,10 @@
 package restorer
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"syscall"
@@ -59,3 +62,99 @@ func TestRestorerRestoreEmptyHardlinkedFileds(t *testing.T) {
 		rtest.Equals(t, s1.Ino, s2.Ino)
 	}
 }
+
+func TestRestorerSparseFiles(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	// zeros at the start and the end of the file are split into separate chunks
+	data := make([]byte, 10*1024*1024)
+	copy(data[4*1024*1024:], rtest.Random(17, 1024*1024))
+	id, _ := snapshotTestFile(t, repo, data)
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	// check that the file system supports holes
+	f, err := os.Create(filepath.Join(tempdir, "hole"))
+	rtest.OK(t, err)
+	rtest.OK(t, f.Truncate(int64(len(data))))
+	fi, err := f.Stat()
+	rtest.OK(t, err)
+	rtest.OK(t, f.Close())
+	if fi.Sys().(*syscall.Stat_t).Blocks != 0 {
+		t.Skip("file system does not support sparse files")
+	}
+
+	res, err := NewRestorer(repo, id)
+	rtest.OK(t, err)
+	res.Sparse = true
+	target := filepath.Join(tempdir, "target")
+	rtest.OK(t, res.RestoreTo(context.TODO(), target))
+
+	restored, err := ioutil.ReadFile(filepath.Join(target, "file"))
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(data, restored), "restored file has wrong content")
+
+	fi, err = os.Stat(filepath.Join(target, "file"))
+	rtest.OK(t, err)
+	allocated := fi.Sys().(*syscall.Stat_t).Blocks * 512
+	rtest.Assert(t, allocated < int64(len(data))/2, "file is not sparse, %d bytes of %d allocated", allocated, len(data))
+}
+
+func TestRestorerOwner(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	const foreignID = 12345
+
+	_, id := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"file": File{Data: "content: file\n", UID: foreignID, GID: foreignID},
+		},
+	})
+
+	uid, gid := uint32(os.Getuid()), uint32(os.Getgid())
+	idMap := restic.IDMap{"12345": fmt.Sprintf("%d", uid)}
+	gidMap := restic.IDMap{"12345": fmt.Sprintf("%d", gid)}
+
+	var tests = []struct {
+		mode          restic.OwnerMode
+		uidMap        restic.IDMap
+		gidMap        restic.IDMap
+		uid, gid      uint32
+		errorsAllowed bool
+	}{
+		{mode: restic.OwnerNone, uid: uid, gid: gid},
+		{mode: restic.OwnerNumeric, uidMap: idMap, gidMap: gidMap, uid: uid, gid: gid},
+		{mode: restic.OwnerNumeric, uid: foreignID, gid: foreignID, errorsAllowed: true},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.mode), func(t *testing.T) {
+			res, err := NewRestorer(repo, id)
+			rtest.OK(t, err)
+			res.Owners, err = restic.NewOwnerMapper(test.mode, test.uidMap, test.gidMap)
+			rtest.OK(t, err)
+
+			tempdir, cleanup := rtest.TempDir(t)
+			defer cleanup()
+			rtest.OK(t, res.RestoreTo(context.TODO(), tempdir))
+
+			fi, err := os.Stat(filepath.Join(tempdir, "file"))
+			rtest.OK(t, err)
+			stat := fi.Sys().(*syscall.Stat_t)
+
+			if os.Geteuid() != 0 && test.errorsAllowed {
+				// only root can change the owner to another user
+				rtest.Equals(t, uint(1), res.OwnerErrors())
+				rtest.Equals(t, uid, stat.Uid)
+				return
+			}
+
+			rtest.Equals(t, uint(0), res.OwnerErrors())
+			rtest.Equals(t, test.uid, stat.Uid)
+			rtest.Equals(t, test.gid, stat.Gid)
+		})
+	}
+}
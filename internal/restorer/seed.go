@@ -0,0 +1,221 @@
+package restorer
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/restic/chunker"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// prepareFile works like prepareTarget for files. When the existing file is
+// overwritten and seed is set, the file is moved to a temporary file in the
+// same directory instead of being removed so that its content can be reused,
+// the name of the temporary file is returned. The caller must pass it to
+// removeSeed once it is no longer needed.
+func (res *Restorer) prepareFile(node *restic.Node, target, location string, seed bool) (Action, string, error) {
+	action, err := res.itemAction(node, target)
+	if err != nil {
+		return "", "", err
+	}
+	debug.Log("%v: %v", location, action)
+	res.Report(location, action)
+
+	if action != ActionOverwrite {
+		return action, "", nil
+	}
+
+	if seed {
+		fi, err := fs.Lstat(target)
+		if err == nil && fi.Mode().IsRegular() && fi.Size() > 0 {
+			tmp, err := ioutil.TempFile(filepath.Dir(target), filepath.Base(target)+".restic-seed-")
+			if err != nil {
+				return "", "", errors.Wrap(err, "TempFile")
+			}
+			err = tmp.Close()
+			if err != nil {
+				_ = fs.Remove(tmp.Name())
+				return "", "", errors.Wrap(err, "Close")
+			}
+
+			err = fs.Rename(target, tmp.Name())
+			if err != nil {
+				_ = fs.Remove(tmp.Name())
+				return "", "", errors.Wrap(err, "Rename")
+			}
+			return action, tmp.Name(), nil
+		}
+	}
+
+	err = fs.RemoveAll(target)
+	if err != nil {
+		return "", "", errors.Wrap(err, "RemoveAll")
+	}
+	return action, "", nil
+}
+
+// removeSeed removes the file seed returned by prepareFile. If restoring
+// target failed, the seed is moved back to target instead so that the
+// existing file is kept.
+func removeSeed(seed, target string, failed bool) error {
+	if failed {
+		return errors.Wrap(fs.Rename(seed, target), "Rename")
+	}
+
+	return errors.Wrap(fs.Remove(seed), "Remove")
+}
+
+// removeSeeds calls removeSeed for all seeds, which map the target of a file
+// to its seed. The seeds of the targets in failed are moved back, if err is
+// set all of them are. The first error is returned.
+func removeSeeds(seeds map[string]string, failed map[string]struct{}, err error) error {
+	for target, seed := range seeds {
+		_, ok := failed[target]
+		rerr := removeSeed(seed, target, ok || err != nil)
+		if rerr != nil {
+			debug.Log("unable to remove seed %v of %v: %v", seed, target, rerr)
+			if err == nil {
+				err = rerr
+			}
+		}
+	}
+	return err
+}
+
+// seedDirFile returns the file in res.SeedDir at location, which is relative
+// to the target directory, or an empty string if there is no such regular
+// file.
+func (res *Restorer) seedDirFile(location string) string {
+	if res.SeedDir == "" {
+		return ""
+	}
+
+	seed := filepath.Join(res.SeedDir, location)
+	fi, err := fs.Lstat(seed)
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() == 0 {
+		return ""
+	}
+	return seed
+}
+
+// seedFile creates the file for node at target. All blobs of node which are
+// found in the local file seed are copied from there, the remaining blobs
+// are added to the file restorer to be downloaded.
+func (res *Restorer) seedFile(r *fileRestorer, node *restic.Node, seed, target, location string) error {
+	// offsets of the blobs in the new file
+	positions := make([]int64, len(node.Content))
+	offsets := make(map[restic.ID][]int64, len(node.Content))
+	lengths := make(map[restic.ID]uint64, len(node.Content))
+	size := int64(0)
+	for i, id := range node.Content {
+		blobs, found := res.repo.Index().Lookup(id, restic.DataBlob)
+		if !found {
+			return errors.Errorf("Unknown blob %s", id.String())
+		}
+		positions[i] = size
+		offsets[id] = append(offsets[id], size)
+		lengths[id] = uint64(blobs[0].DataLength())
+		size += int64(blobs[0].DataLength())
+	}
+
+	f, err := fs.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrap(err, "OpenFile")
+	}
+
+	err = f.Truncate(size)
+	if err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "Truncate")
+	}
+
+	copied, err := res.copySeedChunks(f, seed, offsets)
+	if err != nil {
+		// download the whole file instead
+		debug.Log("unable to use seed %v for %v: %v", seed, location, err)
+		copied = nil
+	}
+
+	err = f.Close()
+	if err != nil {
+		return errors.Wrap(err, "Close")
+	}
+
+	if copied == nil {
+		r.addFile(r.targetLocation(target), node.Content)
+		return nil
+	}
+
+	var missing restic.IDs
+	var missingOffsets []int64
+	var copiedBytes uint64
+	for i, id := range node.Content {
+		if _, ok := copied[id]; !ok {
+			missing = append(missing, id)
+			missingOffsets = append(missingOffsets, positions[i])
+			continue
+		}
+		copiedBytes += lengths[id]
+	}
+
+	debug.Log("%v: copied %d of %d blobs from %v", location, len(node.Content)-len(missing), len(node.Content), seed)
+	res.CompleteBytes(location, copiedBytes)
+	if len(missing) == 0 {
+		res.CompleteFile(location)
+		return nil
+	}
+
+	r.addFileAt(r.targetLocation(target), missing, missingOffsets)
+	return nil
+}
+
+// copySeedChunks splits the file seed into chunks with the chunker polynomial
+// of the repository. Each chunk listed in offsets is written to wr at all of
+// its offsets. The IDs of the copied chunks are returned.
+func (res *Restorer) copySeedChunks(wr io.WriterAt, seed string, offsets map[restic.ID][]int64) (map[restic.ID]struct{}, error) {
+	rd, err := fs.Open(seed)
+	if err != nil {
+		return nil, errors.Wrap(err, "Open")
+	}
+	defer rd.Close()
+
+	copied := make(map[restic.ID]struct{})
+	chnker := chunker.New(rd, res.repo.Config().ChunkerPolynomial)
+	var buf []byte
+	for {
+		chunk, err := chnker.Next(buf)
+		if errors.Cause(err) == io.EOF {
+			return copied, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "Next")
+		}
+		buf = chunk.Data
+
+		id := restic.Hash(chunk.Data)
+		if _, ok := copied[id]; ok {
+			continue
+		}
+
+		if res.Sparse && isZero(chunk.Data) && len(offsets[id]) > 0 {
+			// the new file was created with holes
+			copied[id] = struct{}{}
+			continue
+		}
+
+		for _, offset := range offsets[id] {
+			_, err = wr.WriteAt(chunk.Data, offset)
+			if err != nil {
+				return nil, errors.Wrap(err, "WriteAt")
+			}
+		}
+		if len(offsets[id]) > 0 {
+			copied[id] = struct{}{}
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package restorer
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/archiver"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// seedTestData is large enough to be split into several chunks.
+var seedTestData = rtest.Random(23, 8*1024*1024)
+
+// snapshotTestFile saves data as the file "file" in a new snapshot and
+// returns the snapshot ID and the node of the file.
+func snapshotTestFile(t *testing.T, repo restic.Repository, data []byte) (restic.ID, *restic.Node) {
+	srcdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(srcdir, "file"), data, 0644))
+
+	back := fs.TestChdir(t, srcdir)
+	defer back()
+
+	arch := archiver.New(repo, fs.Local{}, archiver.Options{})
+	sn, id, err := arch.Snapshot(context.TODO(), []string{"."}, archiver.SnapshotOptions{Time: time.Now()})
+	rtest.OK(t, err)
+
+	tree, err := repo.LoadTree(context.TODO(), *sn.Tree)
+	rtest.OK(t, err)
+	node := tree.Find("file")
+	rtest.Assert(t, node != nil, "file not found in snapshot")
+	rtest.Assert(t, len(node.Content) > 2, "file has only %d chunks", len(node.Content))
+
+	return id, node
+}
+
+// removeDataPacks removes the packs which contain the blobs in content from
+// the repository, so that restoring them fails.
+func removeDataPacks(t *testing.T, repo restic.Repository, content restic.IDs) {
+	for _, id := range content {
+		blobs, found := repo.Index().Lookup(id, restic.DataBlob)
+		rtest.Assert(t, found, "blob %v not found", id.Str())
+
+		h := restic.Handle{Type: restic.DataFile, Name: blobs[0].PackID.String()}
+		err := repo.Backend().Remove(context.TODO(), h)
+		if err != nil && !repo.Backend().IsNotExist(err) {
+			t.Fatal(err)
+		}
+	}
+}
+
+func restoreSeedTestFile(t *testing.T, repo restic.Repository, id restic.ID, dst, seedDir string) {
+	res, err := NewRestorer(repo, id)
+	rtest.OK(t, err)
+	res.SeedDir = seedDir
+	rtest.OK(t, res.RestoreTo(context.TODO(), dst))
+
+	data, err := ioutil.ReadFile(filepath.Join(dst, "file"))
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(seedTestData, data), "restored file has wrong content")
+
+	entries, err := ioutil.ReadDir(dst)
+	rtest.OK(t, err)
+	rtest.Assert(t, len(entries) == 1, "seed file was not removed, found %d files", len(entries))
+}
+
+func TestRestorerSeedDir(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+	id, node := snapshotTestFile(t, repo, seedTestData)
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	seedDir := filepath.Join(tempdir, "seed")
+	rtest.OK(t, os.Mkdir(seedDir, 0700))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(seedDir, "file"), seedTestData, 0644))
+
+	// all data must be taken from the seed, nothing can be downloaded
+	removeDataPacks(t, repo, node.Content)
+	restoreSeedTestFile(t, repo, id, filepath.Join(tempdir, "target"), seedDir)
+}
+
+func TestRestorerSeedPartial(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+	id, _ := snapshotTestFile(t, repo, seedTestData)
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	// the seed lacks the start of the file and has some changed data in the middle
+	seed := append([]byte{}, seedTestData[1024*1024:]...)
+	copy(seed[3*1024*1024:], rtest.Random(42, 100))
+
+	seedDir := filepath.Join(tempdir, "seed")
+	rtest.OK(t, os.Mkdir(seedDir, 0700))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(seedDir, "file"), seed, 0644))
+
+	restoreSeedTestFile(t, repo, id, filepath.Join(tempdir, "target"), seedDir)
+}
+
+func TestRestorerSeedExistingFile(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+	id, _ := snapshotTestFile(t, repo, seedTestData)
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	// the existing file only differs in the last chunk
+	existing := append([]byte{}, seedTestData...)
+	copy(existing[len(existing)-10:], "0123456789")
+
+	target := filepath.Join(tempdir, "target")
+	rtest.OK(t, os.Mkdir(target, 0700))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(target, "file"), existing, 0644))
+
+	if runtime.GOOS != "windows" {
+		// hard links to the existing file must not be modified
+		rtest.OK(t, os.Link(filepath.Join(target, "file"), filepath.Join(tempdir, "link")))
+	}
+
+	restoreSeedTestFile(t, repo, id, target, "")
+
+	if runtime.GOOS != "windows" {
+		data, err := ioutil.ReadFile(filepath.Join(tempdir, "link"))
+		rtest.OK(t, err)
+		rtest.Assert(t, bytes.Equal(existing, data), "hard link to the existing file was modified")
+	}
+}
+
+func TestRestorerSeedRestoredOnError(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+	id, node := snapshotTestFile(t, repo, seedTestData)
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	target := filepath.Join(tempdir, "file")
+	existing := rtest.Random(5, 1000)
+	rtest.OK(t, ioutil.WriteFile(target, existing, 0644))
+
+	res, err := NewRestorer(repo, id)
+	rtest.OK(t, err)
+
+	action, seed, err := res.prepareFile(node, target, "/file", true)
+	rtest.OK(t, err)
+	rtest.Equals(t, ActionOverwrite, action)
+	rtest.Equals(t, tempdir, filepath.Dir(seed))
+	_, err = os.Lstat(target)
+	rtest.Assert(t, os.IsNotExist(err), "existing file was not moved")
+
+	// a failed restore must put the existing file back
+	rtest.OK(t, removeSeed(seed, target, true))
+
+	data, err := ioutil.ReadFile(target)
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(existing, data), "existing file has wrong content")
+
+	entries, err := ioutil.ReadDir(tempdir)
+	rtest.OK(t, err)
+	rtest.Assert(t, len(entries) == 1, "seed file was not removed, found %d files", len(entries))
+}
+
+func TestRestorerSeedMissingBlob(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+	id, node := snapshotTestFile(t, repo, seedTestData)
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	// the last chunk of the existing file differs, it must be downloaded
+	existing := append([]byte{}, seedTestData...)
+	copy(existing[len(existing)-10:], "0123456789")
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(tempdir, "file"), existing, 0644))
+
+	removeDataPacks(t, repo, node.Content)
+
+	res, err := NewRestorer(repo, id)
+	rtest.OK(t, err)
+	var errs []error
+	res.Error = func(location string, err error) error {
+		errs = append(errs, err)
+		return nil
+	}
+	rtest.OK(t, res.RestoreTo(context.TODO(), tempdir))
+	rtest.Assert(t, len(errs) > 0, "loading the missing blob did not fail")
+
+	data, err := ioutil.ReadFile(filepath.Join(tempdir, "file"))
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(existing, data), "existing file was not restored")
+
+	entries, err := ioutil.ReadDir(tempdir)
+	rtest.OK(t, err)
+	rtest.Assert(t, len(entries) == 1, "seed file was not removed, found %d files", len(entries))
+}
@@ -0,0 +1,271 @@
+package ui
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/ui/termstatus"
+)
+
+// Restore reports progress for the `restore` command.
+type Restore struct {
+	*Message
+	*StdioWrapper
+
+	MinUpdatePause time.Duration
+
+	// JSON prints the status as JSON once per second instead of updating
+	// the status line.
+	JSON bool
+
+	// DryRun suppresses the summary printed by Finish, as no files are
+	// restored.
+	DryRun bool
+
+	term  *termstatus.Terminal
+	v     uint
+	start time.Time
+
+	totalCh     chan counter
+	processedCh chan counter
+	errCh       chan struct{}
+	finished    chan struct{}
+	finishOnce  sync.Once
+
+	summary struct {
+		sync.Mutex
+		total, processed counter
+		errors           uint
+	}
+}
+
+// RestoreStatus is the progress of a restore.
+type RestoreStatus struct {
+	SecondsElapsed   uint64  `json:"seconds_elapsed"`
+	SecondsRemaining uint64  `json:"seconds_remaining,omitempty"`
+	PercentDone      float64 `json:"percent_done"`
+	TotalFiles       uint    `json:"total_files"`
+	FilesRestored    uint    `json:"files_restored"`
+	TotalBytes       uint64  `json:"total_bytes"`
+	BytesRestored    uint64  `json:"bytes_restored"`
+	BytesPerSecond   uint64  `json:"bytes_per_second"`
+	ErrorCount       uint    `json:"error_count"`
+	StructType       string  `json:"struct_type"` // "status"
+}
+
+// NewRestore returns a new restore progress reporter.
+func NewRestore(term *termstatus.Terminal, verbosity uint) *Restore {
+	return &Restore{
+		Message:      NewMessage(term, verbosity),
+		StdioWrapper: NewStdioWrapper(term),
+		term:         term,
+		v:            verbosity,
+		start:        time.Now(),
+
+		// limit to 60fps by default
+		MinUpdatePause: time.Second / 60,
+
+		totalCh:     make(chan counter),
+		processedCh: make(chan counter),
+		errCh:       make(chan struct{}),
+		finished:    make(chan struct{}),
+	}
+}
+
+// Run regularly updates the status lines. It should be called in a separate
+// goroutine.
+func (r *Restore) Run(ctx context.Context) error {
+	var (
+		lastUpdate       time.Time
+		total, processed counter
+		errors           uint
+		started          bool
+	)
+
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+
+	for {
+		tick := false
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-r.finished:
+			started = false
+			r.finished = nil
+			if !r.JSON {
+				r.term.SetStatus([]string{""})
+			}
+		case total = <-r.totalCh:
+			started = true
+		case s := <-r.processedCh:
+			processed.Files += s.Files
+			processed.Bytes += s.Bytes
+		case <-r.errCh:
+			errors++
+		case <-t.C:
+			tick = true
+		}
+
+		if !started {
+			continue
+		}
+
+		if r.JSON {
+			// print the status only once per second, not at all with --quiet
+			if tick && r.v > 0 {
+				r.printJSON(r.status(total, processed, errors))
+			}
+			continue
+		}
+
+		// limit update frequency
+		if !tick && time.Since(lastUpdate) < r.MinUpdatePause {
+			continue
+		}
+		lastUpdate = time.Now()
+
+		r.update(r.status(total, processed, errors))
+	}
+}
+
+// status computes the current status.
+func (r *Restore) status(total, processed counter, errors uint) RestoreStatus {
+	elapsed := time.Since(r.start)
+	s := RestoreStatus{
+		SecondsElapsed: uint64(elapsed / time.Second),
+		TotalFiles:     total.Files,
+		FilesRestored:  processed.Files,
+		TotalBytes:     total.Bytes,
+		BytesRestored:  processed.Bytes,
+		ErrorCount:     errors,
+		StructType:     "status",
+	}
+
+	if total.Bytes > 0 {
+		s.PercentDone = float64(processed.Bytes) / float64(total.Bytes)
+		if s.PercentDone > 1 {
+			s.PercentDone = 1
+		}
+	}
+
+	if secs := elapsed.Seconds(); secs > 0 {
+		s.BytesPerSecond = uint64(float64(processed.Bytes) / secs)
+	}
+
+	if s.BytesPerSecond > 0 && processed.Bytes < total.Bytes {
+		s.SecondsRemaining = (total.Bytes - processed.Bytes) / s.BytesPerSecond
+	}
+
+	return s
+}
+
+// update updates the status lines.
+func (r *Restore) update(s RestoreStatus) {
+	var eta string
+	if s.SecondsRemaining > 0 {
+		eta = fmt.Sprintf(" ETA %s", formatSeconds(s.SecondsRemaining))
+	}
+
+	status := fmt.Sprintf("[%s] %s  %v files %s, total %v files %v, %d errors, %s/s%s",
+		formatSeconds(s.SecondsElapsed),
+		formatPercent(s.BytesRestored, s.TotalBytes),
+		s.FilesRestored,
+		formatBytes(s.BytesRestored),
+		s.TotalFiles,
+		formatBytes(s.TotalBytes),
+		s.ErrorCount,
+		formatBytes(s.BytesPerSecond),
+		eta,
+	)
+
+	r.term.SetStatus([]string{status})
+}
+
+// printJSON prints the status as a line of JSON.
+func (r *Restore) printJSON(s RestoreStatus) {
+	buf, err := json.Marshal(s)
+	if err != nil {
+		r.E("JSON encode failed: %v\n", err)
+		return
+	}
+	r.term.Print(string(buf))
+}
+
+// ReportTotal sets the number of files and bytes to restore.
+func (r *Restore) ReportTotal(files uint, bytes uint64) {
+	r.summary.Lock()
+	r.summary.total = counter{Files: files, Bytes: bytes}
+	r.summary.Unlock()
+
+	r.totalCh <- counter{Files: files, Bytes: bytes}
+}
+
+// CompleteBytes is called when bytes of the file at location have been
+// restored.
+func (r *Restore) CompleteBytes(location string, bytes uint64) {
+	r.summary.Lock()
+	r.summary.processed.Bytes += bytes
+	r.summary.Unlock()
+
+	r.processedCh <- counter{Bytes: bytes}
+}
+
+// CompleteFile is called when the content of the file at location has been
+// restored completely.
+func (r *Restore) CompleteFile(location string) {
+	r.summary.Lock()
+	r.summary.processed.Files++
+	r.summary.Unlock()
+
+	r.processedCh <- counter{Files: 1}
+}
+
+// Error is the error callback function for the restorer, it prints the error
+// and returns nil.
+func (r *Restore) Error(location string, err error) error {
+	r.summary.Lock()
+	r.summary.errors++
+	r.summary.Unlock()
+
+	r.E("ignoring error for %s: %s\n", location, err)
+	r.errCh <- struct{}{}
+	return nil
+}
+
+// Summary returns the final status of the restore.
+func (r *Restore) Summary() RestoreStatus {
+	r.summary.Lock()
+	defer r.summary.Unlock()
+
+	s := r.status(r.summary.total, r.summary.processed, r.summary.errors)
+	s.SecondsRemaining = 0
+	s.StructType = "summary"
+	return s
+}
+
+// Finish removes the status line and prints the summary unless JSON output
+// or a dry run was requested. Calling it more than once has no effect.
+func (r *Restore) Finish() {
+	r.finishOnce.Do(r.finish)
+}
+
+func (r *Restore) finish() {
+	close(r.finished)
+
+	if r.JSON || r.DryRun {
+		return
+	}
+
+	s := r.Summary()
+	r.P("restored %v files, %s in %s (%s/s)\n",
+		s.FilesRestored,
+		formatBytes(s.BytesRestored),
+		formatSeconds(s.SecondsElapsed),
+		formatBytes(s.BytesPerSecond),
+	)
+}
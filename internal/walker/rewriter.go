@@ -0,0 +1,127 @@
+package walker
+
+import (
+	"context"
+	"path"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// TreeLoadSaver loads and saves trees.
+type TreeLoadSaver interface {
+	TreeLoader
+	SaveTree(context.Context, *restic.Tree) (restic.ID, error)
+}
+
+// NodeRewriteFunc is called for each node in a tree. It returns the node which
+// replaces the original one in the new tree, or nil if the node should be
+// removed. The returned node must not be the same pointer as node if it was
+// modified.
+type NodeRewriteFunc func(node *restic.Node, path string) *restic.Node
+
+// FailedTreeRewriteFunc is called when the tree id at path cannot be loaded.
+// It returns the ID of the tree which is used instead, or an error.
+type FailedTreeRewriteFunc func(id restic.ID, path string, err error) (restic.ID, error)
+
+// RejectByNameFunc returns true for all paths which should be removed from a
+// tree.
+type RejectByNameFunc func(path string) bool
+
+// TreeRewriter rewrites trees by applying a function to all nodes.
+type TreeRewriter struct {
+	rewriteNode NodeRewriteFunc
+	failedTree  FailedTreeRewriteFunc
+}
+
+// NewTreeRewriter returns a TreeRewriter which calls rewriteNode for each node.
+// When failedTree is nil, errors while loading trees are returned.
+func NewTreeRewriter(rewriteNode NodeRewriteFunc, failedTree FailedTreeRewriteFunc) *TreeRewriter {
+	if failedTree == nil {
+		failedTree = func(id restic.ID, path string, err error) (restic.ID, error) {
+			return restic.ID{}, err
+		}
+	}
+
+	return &TreeRewriter{
+		rewriteNode: rewriteNode,
+		failedTree:  failedTree,
+	}
+}
+
+// RewriteTree rewrites the tree id located at nodepath and all its subtrees.
+// Modified trees are saved to repo, and the ID of the new tree is returned. If
+// nothing was changed, the original ID is returned and no tree is saved.
+func (t *TreeRewriter) RewriteTree(ctx context.Context, repo TreeLoadSaver, nodepath string, id restic.ID) (restic.ID, error) {
+	tree, err := repo.LoadTree(ctx, id)
+	if err != nil {
+		return t.failedTree(id, nodepath, err)
+	}
+
+	changed := false
+	newTree := restic.NewTree()
+
+	for _, node := range tree.Nodes {
+		p := path.Join(nodepath, node.Name)
+
+		newNode := t.rewriteNode(node, p)
+		if newNode == nil {
+			changed = true
+			continue
+		}
+		if newNode != node {
+			changed = true
+		}
+		node = newNode
+
+		if node.Type == "dir" {
+			if node.Subtree == nil {
+				return restic.ID{}, errors.Errorf("subtree for node %v in tree %v is nil", node.Name, p)
+			}
+
+			subtreeID, err := t.RewriteTree(ctx, repo, p, *node.Subtree)
+			if err != nil {
+				return restic.ID{}, err
+			}
+
+			if !subtreeID.Equal(*node.Subtree) {
+				changed = true
+
+				// do not modify the tree returned by the loader
+				n := *node
+				n.Subtree = &subtreeID
+				node = &n
+			}
+		}
+
+		err = newTree.Insert(node)
+		if err != nil {
+			return restic.ID{}, err
+		}
+	}
+
+	if !changed {
+		return id, nil
+	}
+
+	return repo.SaveTree(ctx, newTree)
+}
+
+// FilterTree removes all nodes from the tree id (located at nodepath) for which
+// reject returns true, descending into all subtrees. Modified trees are saved
+// to repo, and the ID of the new tree is returned. If nothing was removed,
+// the original ID is returned and no tree is saved. For each removed node,
+// report is called with its path, unless report is nil.
+func FilterTree(ctx context.Context, repo TreeLoadSaver, nodepath string, id restic.ID, reject RejectByNameFunc, report func(path string)) (restic.ID, error) {
+	rewriter := NewTreeRewriter(func(node *restic.Node, path string) *restic.Node {
+		if reject(path) {
+			if report != nil {
+				report(path)
+			}
+			return nil
+		}
+		return node
+	}, nil)
+
+	return rewriter.RewriteTree(ctx, repo, nodepath, id)
+}
@@ -0,0 +1,125 @@
+package walker
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// WritableTreeMap also supports saving trees.
+type WritableTreeMap struct {
+	TreeMap
+}
+
+func (t WritableTreeMap) SaveTree(ctx context.Context, tree *restic.Tree) (restic.ID, error) {
+	buf, err := json.Marshal(tree)
+	if err != nil {
+		return restic.ID{}, err
+	}
+
+	id := restic.Hash(buf)
+	if _, ok := t.TreeMap[id]; !ok {
+		t.TreeMap[id] = tree
+	}
+
+	return id, nil
+}
+
+func TestFilterTree(t *testing.T) {
+	var tests = []struct {
+		tree    TestTree
+		reject  map[string]bool
+		want    TestTree
+		removed []string
+	}{
+		{
+			tree: TestTree{
+				"foo":    TestFile{},
+				"subdir": TestTree{"subfile": TestFile{}},
+			},
+			reject: map[string]bool{},
+			want: TestTree{
+				"foo":    TestFile{},
+				"subdir": TestTree{"subfile": TestFile{}},
+			},
+		},
+		{
+			tree: TestTree{
+				"foo":    TestFile{},
+				"bar":    TestFile{},
+				"subdir": TestTree{"subfile": TestFile{}},
+			},
+			reject: map[string]bool{"/bar": true},
+			want: TestTree{
+				"foo":    TestFile{},
+				"subdir": TestTree{"subfile": TestFile{}},
+			},
+			removed: []string{"/bar"},
+		},
+		{
+			tree: TestTree{
+				"foo": TestFile{},
+				"subdir": TestTree{
+					"subfile":  TestFile{},
+					"subfile2": TestFile{},
+					"subsubdir": TestTree{
+						"secret": TestFile{},
+					},
+				},
+				"other": TestTree{"secret": TestFile{}},
+			},
+			reject: map[string]bool{
+				"/subdir/subfile2":         true,
+				"/subdir/subsubdir/secret": true,
+				"/other":                   true,
+			},
+			want: TestTree{
+				"foo": TestFile{},
+				"subdir": TestTree{
+					"subfile":   TestFile{},
+					"subsubdir": TestTree{},
+				},
+			},
+			removed: []string{"/other", "/subdir/subfile2", "/subdir/subsubdir/secret"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			repo, root := BuildTreeMap(test.tree)
+			_, wantRoot := BuildTreeMap(test.want)
+
+			var removed []string
+			newRoot, err := FilterTree(context.TODO(), WritableTreeMap{repo}, "/", root,
+				func(path string) bool {
+					return test.reject[path]
+				},
+				func(path string) {
+					removed = append(removed, path)
+				})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !newRoot.Equal(wantRoot) {
+				t.Errorf("wrong tree ID returned, want %v, got %v", wantRoot.Str(), newRoot.Str())
+			}
+
+			if len(removed) != len(test.removed) {
+				t.Fatalf("wrong paths removed, want %v, got %v", test.removed, removed)
+			}
+
+			for i := range removed {
+				if removed[i] != test.removed[i] {
+					t.Errorf("wrong path removed, want %v, got %v", test.removed[i], removed[i])
+				}
+			}
+
+			if len(test.removed) == 0 && !newRoot.Equal(root) {
+				t.Errorf("unmodified tree was saved again")
+			}
+		})
+	}
+}